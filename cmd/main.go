@@ -1,41 +1,448 @@
 package main
 
 import (
+	"crypto_trade_bot/domain"
+	"crypto_trade_bot/infra/cache"
 	"crypto_trade_bot/infra/client"
 	"crypto_trade_bot/infra/config"
+	"crypto_trade_bot/infra/storage"
 	"crypto_trade_bot/interface/controller"
 	"crypto_trade_bot/interface/gateway"
+	"crypto_trade_bot/interface/presenter"
 	"crypto_trade_bot/usecase"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
 	// コマンドラインフラグの定義
 	tradeMode := flag.Bool("trade", false, "Enable trade mode")
-	symbol := flag.String("symbol", "BTC-USDT", "Symbol to trade (e.g., BTC-USDT)")
+	symbol := flag.String("symbol", "BTC-USDT", "Symbol to trade (e.g., BTC-USDT). Comma-separated list allowed for backtest, download and optimize")
 	side := flag.String("side", "buy", "Trade side: 'buy' for long, 'sell' for short")
 	amount := flag.Float64("amount", 10.0, "Amount in USD to trade")
 	execute := flag.Bool("execute", false, "Set to true to execute the trade for real")
+	stopLossPct := flag.Float64("stop-loss-pct", 0, "Stop-loss distance in percent from entry (e.g., 2 for 2%)")
+	stopLossPrice := flag.Float64("stop-loss-price", 0, "Stop-loss at an absolute price")
+	stopLossATR := flag.Float64("stop-loss-atr", 0, "Stop-loss distance as a multiple of ATR(14) on -analysis-granularity klines")
+	trailingPct := flag.Float64("trailing-pct", 0, "Exit the size not closed by -take-profit with a trailing stop this many percent behind the best price")
+	trailingATR := flag.Float64("trailing-atr", 0, "Exit the size not closed by -take-profit with a trailing stop this many ATR(14) behind the best price")
+	trailingActivation := flag.Float64("trailing-activation-pct", 0, "Start trailing only after the position gains this many percent")
+	limitPrice := flag.Float64("limit-price", 0, "Enter with a limit order at this price instead of a market order")
+	postOnly := flag.Bool("post-only", false, "Make the limit entry order post-only (maker only)")
+	timeInForce := flag.String("time-in-force", "", "Time in force of the limit entry order: GTC, IOC or FOK")
+	maxEntrySlippage := flag.Float64("max-entry-slippage-bps", 0, "Refuse a market entry whose estimated fill from the order book is more than this many bps from mid (0 = only log the estimate)")
+	leverage := flag.Float64("leverage", 0, "Leverage for the trade (defaults to TRADE_LEVERAGE or 1)")
+	marginMode := flag.String("margin-mode", "", "Margin mode for the trade: isolated or cross (defaults to TRADE_MARGIN_MODE or isolated)")
+	takeProfit := flag.String("take-profit", "", "Comma-separated take-profit levels as SIZE%@TARGET, where TARGET is a percent (1%), an R-multiple of the stop-loss (2R) or a price (105.5), e.g. 40%@1%,40%@2%. Defaults to 100%@1% unless a trailing stop is set")
+	breakeven := flag.Bool("breakeven-after-first-tp", false, "Move the stop-loss to the entry price once the first -take-profit level has filled")
+	bracket := flag.Bool("bracket", false, "Place the stop-loss and take-profit as exchange-side stop orders right after entry so they trigger even while the bot is not running")
+	stopPriceType := flag.String("stop-price-type", "MP", "Price that triggers -bracket stop orders: TP (last trade), MP (mark) or IP (index)")
+	algo := flag.String("algo", "", "Execution algorithm for the entry: twap, iceberg or pov")
+	algoDuration := flag.Duration("algo-duration", 10*time.Minute, "Duration of -algo twap, or the time limit of -algo pov")
+	algoSlices := flag.Int("algo-slices", 10, "Number of child orders for -algo twap")
+	algoInterval := flag.Duration("algo-interval", 30*time.Second, "Wait between child orders for -algo iceberg, and the volume window for -algo pov")
+	algoVisible := flag.Float64("algo-visible-lots", 0, "Lots shown at a time for -algo iceberg")
+	algoPOVPct := flag.Float64("algo-pov-pct", 10, "Percent of market volume to trade for -algo pov")
+	algoSlippage := flag.Float64("algo-max-slippage-bps", 0, "Send child orders as IOC limits at most this many bps from the current price (0 = market)")
+	algoExits := flag.Bool("algo-exits", false, "Also execute take-profit exits with -algo (stop-loss exits always use one market order)")
+	reconcileMode := flag.Bool("reconcile", false, "Compare open positions on the exchange with saved trades and report discrepancies. With -execute, resume monitoring the matched trades")
+	adoptPositions := flag.Bool("adopt-positions", false, "When reconciling, adopt positions the bot does not know with the stop-loss/take-profit flags and fix saved trades that no longer match the exchange. Requires -execute")
+	priceStream := flag.Bool("price-stream", true, "Monitor trades with prices from the KuCoin WebSocket, keep the order book of -symbol in sync over it and, with -execute, react to order fills and liquidations from the private channel, falling back to REST while it is down (not used with -paper or -replay)")
+	paperMode := flag.Bool("paper", false, "Use simulated paper trading instead of the live exchange")
+	backtestMode := flag.Bool("backtest", false, "Enable backtest mode")
+	granularity := flag.Int("granularity", 60, "Kline granularity in minutes for backtest and download")
+	capital := flag.Float64("capital", 1000.0, "Initial capital in USD for backtest")
+	downloadMode := flag.Bool("download", false, "Download historical klines into the local cache")
+	from := flag.String("from", "", "Start date (YYYY-MM-DD, UTC) for download")
+	to := flag.String("to", "", "End date (YYYY-MM-DD, UTC) for download, inclusive of the whole day. Defaults to now")
+	cacheDir := flag.String("cache-dir", "data/klines", "Directory of the local kline cache")
+	useCache := flag.Bool("use-cache", false, "Read klines from the local cache for analysis, backtest and optimize")
+	analysisGranularity := flag.Int("analysis-granularity", 60, "Kline granularity in minutes for trend analysis and ATR")
+	baseGranularity := flag.Int("base-granularity", 0, "Build every granularity from klines of this granularity in minutes (e.g. 1) aligned to UTC, leaving out the bar still in progress. Backtest and optimize require -use-cache after downloading them; otherwise older klines are paged in from the REST API. In trade mode with 1, the price stream keeps -symbol up to date (0 = fetch each granularity)")
+	optimizeMode := flag.Bool("optimize", false, "Optimize MACD/RSI parameters over historical klines")
+	randomSamples := flag.Int("random", 0, "Number of randomly sampled parameter sets for optimize (0 = full grid)")
+	folds := flag.Int("folds", 4, "Number of walk-forward windows for optimize")
+	trainRatio := flag.Float64("train-ratio", 0.7, "Share of each walk-forward window used for training")
+	signalConfigPath := flag.String("signal-config", "", "JSON file with MACD/RSI parameters for analysis and backtest")
+	signalConfigOut := flag.String("signal-config-out", "", "Write the optimized signal config to this file")
+	reportMode := flag.Bool("report", false, "Write performance reports for backtest, or for paper trading history with -paper")
+	reportDir := flag.String("report-dir", "reports", "Directory for JSON/HTML performance reports")
+	ordersMode := flag.Bool("orders", false, "List open orders on all symbols, or on -symbol if given")
+	cancelID := flag.String("cancel", "", "Cancel the order with this order ID")
+	cancelClientOID := flag.String("cancel-client-oid", "", "Cancel the order with this clientOid on -symbol")
+	cancelAll := flag.Bool("cancel-all", false, "Cancel all open orders on -symbol (comma-separated)")
+	recordPath := flag.String("record", "", "Record all HTTP traffic to this cassette file as it happens (auth headers are scrubbed)")
+	replayPath := flag.String("replay", "", "Replay HTTP traffic from this cassette file instead of using the network")
 
 	flag.Parse()
 
 	// 環境変数の読み込み
 	config.LoadEnv()
 
+	signalConfig := domain.DefaultSignalConfig()
+	if *signalConfigPath != "" {
+		found, err := storage.NewJSONFile(*signalConfigPath).Load(&signalConfig)
+		if err != nil || !found {
+			log.Fatalf("Failed to load signal config %s: %v", *signalConfigPath, err)
+		}
+		log.Printf("Loaded signal config from %s", *signalConfigPath)
+	}
+
 	// 依存関係の注入 (DI)
 	httpClient := client.NewHTTPClient()
-	kucoinGateway := gateway.NewKuCoinGateway(httpClient)
+	if *recordPath != "" && *replayPath != "" {
+		log.Fatal("-record and -replay cannot be used together")
+	}
+	if *recordPath != "" {
+		recorder := client.NewRecordingTransport(http.DefaultTransport, *recordPath)
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				log.Printf("Failed to write cassette: %v", err)
+			}
+		}()
+		httpClient = client.NewHTTPClientWithTransport(recorder)
+		log.Printf("Recording HTTP traffic to %s", *recordPath)
+	}
+	if *replayPath != "" {
+		transport, err := client.NewReplayTransport(*replayPath)
+		if err != nil {
+			log.Fatalf("Failed to load cassette: %v", err)
+		}
+		httpClient = client.NewHTTPClientWithTransport(transport)
+		log.Printf("Replaying HTTP traffic from %s", *replayPath)
+	}
+	kucoinGateway := gateway.NewKuCoinGateway(httpClient, config.GetEnv("KUCOIN_BASE_URL", gateway.DefaultKuCoinFuturesURL))
 	openaiGateway := gateway.NewOpenAIGateway(httpClient)
-	tradingUsecase := usecase.NewTradingUsecase(kucoinGateway, openaiGateway)
-	cliController := controller.NewCLIController(tradingUsecase)
+	klineCache := cache.NewKlineCache(*cacheDir)
+	costs := config.LoadCostModel(gateway.NewOrderBookDepth(kucoinGateway, kucoinGateway))
+	var klineProvider usecase.KlineProvider = kucoinGateway
+	if *useCache {
+		klineProvider = klineCache
+		log.Printf("Reading klines from cache: %s", *cacheDir)
+	}
+	var candleAggregator *usecase.CandleAggregator
+	if *baseGranularity > 0 {
+		if *analysisGranularity%*baseGranularity != 0 {
+			log.Fatalf("-analysis-granularity %d is not a multiple of -base-granularity %d", *analysisGranularity, *baseGranularity)
+		}
+		if *backtestMode || *optimizeMode {
+			if *granularity%*baseGranularity != 0 {
+				log.Fatalf("-granularity %d is not a multiple of -base-granularity %d", *granularity, *baseGranularity)
+			}
+			// バックテストと最適化は全期間の足を使うため、REST の直近の足だけでは足りない
+			if !*useCache {
+				log.Fatal("-base-granularity with -backtest or -optimize requires -use-cache")
+			}
+		}
+		candleAggregator = usecase.NewCandleAggregator(klineProvider, *baseGranularity)
+		if !*useCache {
+			candleAggregator.SetHistory(kucoinGateway, 500*time.Millisecond)
+		}
+		klineProvider = candleAggregator
+		log.Printf("Building klines from %dm klines", *baseGranularity)
+	}
+	var tradingGateway usecase.KuCoinGateway = kucoinGateway
+	var orderGateway usecase.OrderGateway = kucoinGateway
+	var paperGateway *gateway.PaperGateway
+	if *paperMode {
+		var err error
+		paperGateway, err = gateway.NewPaperGateway(kucoinGateway, costs)
+		if err != nil {
+			log.Fatalf("Failed to initialize paper gateway: %v", err)
+		}
+		tradingGateway = paperGateway
+		orderGateway = paperGateway
+		// ペーパートレードでは実際の注文が出ないため、常に約定処理を実行する
+		*execute = true
+		log.Println("Paper trading enabled. Orders will be simulated.")
+	}
+	tradeStatePath := config.GetEnv("TRADE_STATE_FILE", "trade_state.json")
+	if *paperMode {
+		tradeStatePath = config.GetEnv("PAPER_TRADE_STATE_FILE", "paper_trade_state.json")
+	}
+	tradeStore := storage.NewTradeStateFile(tradeStatePath)
+	tradingUsecase := usecase.NewTradingUsecase(tradingGateway, klineProvider, openaiGateway, signalConfig, tradeStore)
+	tradingUsecase.SetAnalysisGranularity(*analysisGranularity)
+	// ペーパートレードは価格を確認したときに逆指値を約定させ、再生は記録した REST の通信しか返せないため、REST で監視する
+	if *priceStream && !*paperMode && *replayPath == "" && (*tradeMode || *reconcileMode) {
+		marketStream := gateway.NewKuCoinMarketStream(kucoinGateway)
+		defer marketStream.Close()
+		tradingUsecase.SetPriceStream(marketStream)
+		if *tradeMode {
+			orderBooks := gateway.NewKuCoinOrderBooks(kucoinGateway)
+			defer orderBooks.Close()
+			defer orderBooks.Watch(*symbol)()
+			tradingUsecase.SetOrderBookSource(orderBooks)
+		}
+		if *tradeMode && candleAggregator != nil && *baseGranularity == 1 {
+			candleStream := gateway.NewKuCoinCandleStream(kucoinGateway)
+			defer candleStream.Close()
+			candleAggregator.SetCandleStream(candleStream)
+			defer candleAggregator.Watch(*symbol)()
+		}
+		if *execute {
+			accountStream := gateway.NewKuCoinAccountStream(kucoinGateway)
+			defer accountStream.Close()
+			tradingUsecase.SetAccountEventStream(accountStream)
+		}
+	}
+	backtestUsecase := usecase.NewBacktestUsecase(klineProvider, signalConfig, costs)
+	downloadUsecase := usecase.NewDownloadUsecase(kucoinGateway, klineCache, 500*time.Millisecond)
+	optimizeUsecase := usecase.NewOptimizeUsecase(klineProvider)
+	reportUsecase := usecase.NewReportUsecase(presenter.NewReportWriter(*reportDir))
+	orderUsecase := usecase.NewOrderUsecase(orderGateway)
+	cliController := controller.NewCLIController(tradingUsecase, backtestUsecase, downloadUsecase, optimizeUsecase, reportUsecase, orderUsecase)
 
 	// モードに応じて処理を分岐
-	if *tradeMode {
-		log.Println("--- Trade Mode ---")
-		cliController.RunTrade(*symbol, *side, *amount, *execute)
+	if *downloadMode {
+		log.Println("--- Download Mode ---")
+		fromTime, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			log.Fatalf("Invalid -from date %q: %v", *from, err)
+		}
+		toTime := time.Now()
+		if *to != "" {
+			day, err := time.Parse("2006-01-02", *to)
+			if err != nil {
+				log.Fatalf("Invalid -to date %q: %v", *to, err)
+			}
+			// 終了日の最後の足まで含める
+			if end := day.AddDate(0, 0, 1).Add(-time.Millisecond); end.Before(toTime) {
+				toTime = end
+			}
+		}
+		cliController.RunDownload(strings.Split(*symbol, ","), *granularity, fromTime, toTime)
+	} else if *optimizeMode {
+		log.Println("--- Optimize Mode ---")
+		opts := usecase.OptimizeOptions{
+			Grid:           usecase.DefaultParamGrid(),
+			RandomSamples:  *randomSamples,
+			Folds:          *folds,
+			TrainRatio:     *trainRatio,
+			AmountUSD:      *amount,
+			InitialCapital: *capital,
+			Costs:          costs,
+			Seed:           time.Now().UnixNano(),
+		}
+		cliController.RunOptimize(strings.Split(*symbol, ","), *granularity, opts, *signalConfigOut)
+	} else if *backtestMode {
+		log.Println("--- Backtest Mode ---")
+		cliController.RunBacktest(strings.Split(*symbol, ","), *granularity, *amount, *capital, *reportMode)
+	} else if *reportMode {
+		log.Println("--- Report Mode ---")
+		if paperGateway == nil {
+			log.Fatal("Report mode without -backtest requires -paper")
+		}
+		cliController.RunReport("paper", paperGateway.Orders(), paperGateway.InitialBalance(), paperGateway.TotalFunding(), nil)
+	} else if *ordersMode {
+		log.Println("--- Orders Mode ---")
+		// -symbol を明示しない場合は全銘柄の注文を表示する
+		var symbols []string
+		if isFlagSet("symbol") {
+			symbols = strings.Split(*symbol, ",")
+		}
+		cliController.RunListOrders(symbols)
+	} else if *cancelID != "" || *cancelClientOID != "" {
+		log.Println("--- Cancel Mode ---")
+		if *cancelID != "" && *cancelClientOID != "" {
+			log.Fatal("-cancel and -cancel-client-oid cannot be used together")
+		}
+		cliController.RunCancelOrder(*cancelID, *symbol, *cancelClientOID)
+	} else if *cancelAll {
+		log.Println("--- Cancel All Mode ---")
+		cliController.RunCancelAll(strings.Split(*symbol, ","))
+	} else if *tradeMode || *reconcileMode {
+		if *reconcileMode {
+			log.Println("--- Reconcile Mode ---")
+		} else {
+			log.Println("--- Trade Mode ---")
+		}
+		if *adoptPositions && !*execute {
+			log.Fatalf("-adopt-positions requires -execute")
+		}
+		stopLoss, err := parseStopLoss(*stopLossPct, *stopLossPrice, *stopLossATR)
+		if err != nil {
+			log.Fatalf("Invalid stop-loss flags: %v", err)
+		}
+		trailingStop, err := parseTrailingStop(*trailingPct, *trailingATR, *trailingActivation)
+		if err != nil {
+			log.Fatalf("Invalid trailing stop flags: %v", err)
+		}
+		takeProfits, err := parseTakeProfits(*takeProfit)
+		if err != nil {
+			log.Fatalf("Invalid -take-profit: %v", err)
+		}
+		margin := config.LoadMarginSettings()
+		if *leverage != 0 {
+			margin.Leverage = *leverage
+		}
+		if *marginMode != "" {
+			if margin.Mode, err = domain.ParseMarginMode(*marginMode); err != nil {
+				log.Fatalf("Invalid -margin-mode: %v", err)
+			}
+		}
+		if (*postOnly || *timeInForce != "") && *limitPrice <= 0 {
+			log.Fatalf("-post-only and -time-in-force require -limit-price")
+		}
+		var bracketPriceType domain.StopPriceType
+		if *bracket {
+			if bracketPriceType, err = domain.ParseStopPriceType(*stopPriceType); err != nil {
+				log.Fatalf("Invalid -stop-price-type: %v", err)
+			}
+		} else if isFlagSet("stop-price-type") {
+			log.Fatalf("-stop-price-type requires -bracket")
+		}
+		var plan domain.ExecutionPlan
+		if *algo != "" {
+			if plan.Algo, err = domain.ParseExecutionAlgo(*algo); err != nil {
+				log.Fatalf("Invalid -algo: %v", err)
+			}
+			plan.Duration, plan.Slices, plan.Interval = *algoDuration, *algoSlices, *algoInterval
+			plan.VisibleSize, plan.ParticipationPct, plan.MaxSlippageBps = *algoVisible, *algoPOVPct, *algoSlippage
+			if err := plan.Validate(); err != nil {
+				log.Fatalf("Invalid -algo flags: %v", err)
+			}
+		} else if *algoExits {
+			log.Fatalf("-algo-exits requires -algo")
+		}
+		var exitPlan domain.ExecutionPlan
+		if *algoExits {
+			exitPlan = plan
+		}
+		var abort <-chan struct{}
+		if plan.Enabled() {
+			abort = abortOnInterrupt()
+		}
+		opts := usecase.TradeOptions{
+			StopLoss:                  stopLoss,
+			TrailingStop:              trailingStop,
+			TakeProfits:               takeProfits,
+			BreakevenAfterFirstTarget: *breakeven,
+			EntryLimitPrice:           *limitPrice,
+			EntryTimeInForce:          domain.TimeInForce(strings.ToUpper(*timeInForce)),
+			EntryPostOnly:             *postOnly,
+			MaxEntrySlippageBps:       *maxEntrySlippage,
+			Margin:                    margin,
+			BracketPriceType:          bracketPriceType,
+			EntryExecution:            plan,
+			ExitExecution:             exitPlan,
+			Abort:                     abort,
+			AdoptPositions:            *adoptPositions,
+		}
+		if *reconcileMode {
+			cliController.RunReconcile(*execute, opts)
+		} else {
+			cliController.RunTrade(*symbol, *side, *amount, *execute, opts)
+		}
 	} else {
 		log.Println("--- Analysis Mode ---")
 		cliController.RunAnalysis()
 	}
 }
+
+// abortOnInterrupt は最初の Ctrl+C で閉じられるチャネルを返します。
+// 執行中のアルゴリズムを中断しても約定した分の監視は続けるため、2回目の Ctrl+C で終了します。
+func abortOnInterrupt() <-chan struct{} {
+	abort := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		log.Println("Interrupted: aborting the running execution algorithm. Press Ctrl+C again to exit.")
+		close(abort)
+		<-sigs
+		os.Exit(1)
+	}()
+	return abort
+}
+
+// isFlagSet はフラグがコマンドラインで明示的に指定されたかを返します。
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parseStopLoss は損切りのフラグを検証し、いずれか1つだけが指定されている場合にその条件を返します。
+func parseStopLoss(pct, price, atr float64) (domain.StopLoss, error) {
+	var stopLoss domain.StopLoss
+	for _, candidate := range []domain.StopLoss{
+		{Type: domain.StopLossPercent, Value: pct},
+		{Type: domain.StopLossPrice, Value: price},
+		{Type: domain.StopLossATR, Value: atr},
+	} {
+		if candidate.Value < 0 {
+			return domain.StopLoss{}, fmt.Errorf("%s stop-loss must not be negative", candidate.Type)
+		}
+		if candidate.Value == 0 {
+			continue
+		}
+		if stopLoss.Enabled() {
+			return domain.StopLoss{}, fmt.Errorf("only one of -stop-loss-pct, -stop-loss-price and -stop-loss-atr can be set")
+		}
+		stopLoss = candidate
+	}
+	return stopLoss, nil
+}
+
+// parseTrailingStop はトレーリングストップのフラグを検証し、条件を返します。
+func parseTrailingStop(pct, atr, activationPct float64) (domain.TrailingStop, error) {
+	if pct < 0 || atr < 0 || activationPct < 0 {
+		return domain.TrailingStop{}, fmt.Errorf("trailing stop values must not be negative")
+	}
+	switch {
+	case pct > 0 && atr > 0:
+		return domain.TrailingStop{}, fmt.Errorf("only one of -trailing-pct and -trailing-atr can be set")
+	case pct > 0:
+		return domain.TrailingStop{Type: domain.TrailingStopPercent, Distance: pct, ActivationPct: activationPct}, nil
+	case atr > 0:
+		return domain.TrailingStop{Type: domain.TrailingStopATR, Distance: atr, ActivationPct: activationPct}, nil
+	case activationPct > 0:
+		return domain.TrailingStop{}, fmt.Errorf("-trailing-activation-pct requires -trailing-pct or -trailing-atr")
+	}
+	return domain.TrailingStop{}, nil
+}
+
+// parseTakeProfits は "40%@1%,40%@2R,20%@105.5" 形式の利益確定の段階を解析します。
+func parseTakeProfits(s string) ([]domain.TakeProfit, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var levels []domain.TakeProfit
+	for _, part := range strings.Split(s, ",") {
+		sizeStr, targetStr, ok := strings.Cut(strings.TrimSpace(part), "@")
+		if !ok {
+			return nil, fmt.Errorf("level %q must be SIZE%%@TARGET", part)
+		}
+		sizePct, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(sizeStr), "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in %q: %w", part, err)
+		}
+
+		tp := domain.TakeProfit{Type: domain.TakeProfitPrice, SizePct: sizePct}
+		targetStr = strings.TrimSpace(targetStr)
+		switch {
+		case strings.HasSuffix(targetStr, "%"):
+			tp.Type, targetStr = domain.TakeProfitPercent, strings.TrimSuffix(targetStr, "%")
+		case strings.HasSuffix(strings.ToUpper(targetStr), "R"):
+			tp.Type, targetStr = domain.TakeProfitR, targetStr[:len(targetStr)-1]
+		}
+		if tp.Value, err = strconv.ParseFloat(targetStr, 64); err != nil {
+			return nil, fmt.Errorf("invalid target in %q: %w", part, err)
+		}
+		levels = append(levels, tp)
+	}
+	return levels, domain.ValidateTakeProfits(levels)
+}
@@ -0,0 +1,64 @@
+package domain
+
+import "time"
+
+// OrderEventType は注文の変化の種類です。
+type OrderEventType string
+
+const (
+	OrderEventOpen     OrderEventType = "open"     // 板に載った
+	OrderEventMatch    OrderEventType = "match"    // 一部または全部が約定した
+	OrderEventFilled   OrderEventType = "filled"   // 全量が約定して終了した
+	OrderEventCanceled OrderEventType = "canceled" // 取り消されて終了した
+	OrderEventUpdate   OrderEventType = "update"   // 数量が変更された
+)
+
+// OrderEvent は自分の注文の変化です。
+type OrderEvent struct {
+	Type       OrderEventType
+	Order      Order   // 変化した後の注文の状態。Price は注文価格で、平均約定価格ではない
+	MatchSize  float64 // Type が match の場合の約定数量
+	MatchPrice float64 // Type が match の場合の約定価格
+	TradeID    string
+	Liquidity  string // maker または taker
+	Time       time.Time
+}
+
+// 建玉が変化した理由のうち、ボットの注文によらずに建玉が決済されたことを表すものです。
+const (
+	PositionChangeLiquidation = "liquidation"
+	PositionChangeADL         = "adl" // 自動デレバレッジ
+)
+
+// PositionEvent は自分の建玉の変化です。建玉がなくなった場合は Position.Lots が 0 です。
+type PositionEvent struct {
+	Position  Position
+	MarkPrice float64
+	Reason    string // 取引所の changeReason
+	Time      time.Time
+}
+
+// Closed は建玉がなくなったかを返します。
+func (e PositionEvent) Closed() bool {
+	return e.Position.Lots == 0
+}
+
+// Liquidated は強制決済または自動デレバレッジで建玉が減ったかを返します。
+func (e PositionEvent) Liquidated() bool {
+	return e.Reason == PositionChangeLiquidation || e.Reason == PositionChangeADL
+}
+
+// BalanceEvent は証拠金の残高の変化です。
+type BalanceEvent struct {
+	Currency  string
+	Available float64 // 注文に使える残高
+	Hold      float64 // 注文の証拠金として拘束されている残高
+	Time      time.Time
+}
+
+// AccountEvent は非公開のストリームで受信した口座の変化です。Order・Position・Balance のいずれか1つだけが設定されます。
+type AccountEvent struct {
+	Order    *OrderEvent
+	Position *PositionEvent
+	Balance  *BalanceEvent
+}
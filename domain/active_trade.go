@@ -0,0 +1,266 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sizeEpsilon は残りサイズを0とみなす閾値です。
+const sizeEpsilon = 1e-9
+
+// TakeProfitTarget は建て時に価格を確定した利益確定の段階です。
+type TakeProfitTarget struct {
+	Label   string
+	Price   float64
+	Size    float64
+	Filled  bool
+	OrderID string // 取引所に逆指値注文を出している場合の注文ID
+	// ClientOID は取引所の逆指値注文の clientOid です。発注前に保存し、OrderID が空のままの場合は発注結果が確定していません。
+	ClientOID string
+}
+
+// BracketStop は取引所に出している損切りの逆指値注文です。
+// PriceType が空の場合は取引所側の決済注文を使わず、監視ループだけで決済します。
+type BracketStop struct {
+	OrderID   string
+	ClientOID string
+	Price     float64
+	PriceType StopPriceType
+	Label     string // 発動した場合の決済理由
+	// Replacing は発注結果が確定していない新しい損切り注文です。確定するまで OrderID の注文は取り消しません。
+	Replacing *PendingOrder
+}
+
+// PendingOrder は clientOid を保存してから発注し、結果がまだ確定していない注文です。
+// 再起動後も clientOid で取引所の注文を探して結果を確定させ、同じ注文を二重に発注しないようにします。
+type PendingOrder struct {
+	ClientOID string
+	Label     string
+	Target    int // 利益確定の段階の添字。それ以外は -1
+	Size      float64
+	Price     float64       // 逆指値注文の発動価格
+	Algo      ExecutionAlgo // 執行アルゴリズムで子注文に分けた場合のアルゴリズム
+}
+
+// ExitFill は部分決済を含む1回の決済の記録です。
+type ExitFill struct {
+	Label   string
+	OrderID string
+	Size    float64
+	Price   float64
+	Fee     float64
+	PnL     float64 // 手数料を含まない損益
+	At      time.Time
+}
+
+// ActiveTrade は監視中の取引の状態です。再起動後も監視を再開できるよう永続化されます。
+// Size・RemainingSize と決済の数量はロット数で、損益は Multiplier を掛けた原資産数量で計算します。
+type ActiveTrade struct {
+	// ID は取引を一意に識別する値で、この取引で発注する注文の clientOid の接頭辞になります。
+	ID            string
+	Symbol        string
+	Side          OrderSide
+	Size          float64
+	RemainingSize float64
+	Multiplier    float64 // 1ロットあたりの原資産数量。0 の場合は1として扱う
+	Margin        MarginSettings
+	EntryPrice    float64
+	EntryOrderID  string
+	EntryFee      float64
+	OpenedAt      time.Time
+	// OrderSeq はこの取引で発注した注文の数です。clientOid の連番に使うため、発注前に保存します。
+	OrderSeq int
+	// PendingEntry は結果が確定していない建て注文です。約定を確認するまで監視は始めません。
+	PendingEntry *PendingOrder
+	// PendingExit は結果が確定していない決済注文です。確定するまで次の決済注文は出しません。
+	PendingExit *PendingOrder
+
+	TakeProfits []TakeProfitTarget
+	StopPrice   float64 // 0 の場合は損切りを行わない
+	// BreakevenAfterFirstTarget を指定すると、最初に利益確定の段階で決済した時点で損切りを建値に移します。
+	BreakevenAfterFirstTarget bool
+	// ExitExecution は利益確定の決済に使う執行アルゴリズムです。損切りは常に1回の成行注文で決済します。
+	ExitExecution ExecutionPlan
+
+	Trailing          TrailingStop
+	TrailingATR       float64 // ATR 指定の場合に建て時点で計算した ATR
+	BestPrice         float64 // 建て以降の最良価格（ロングは最高値、ショートは最安値）
+	TrailingActive    bool
+	TrailingStopPrice float64
+
+	// BracketStop は取引所側の損切り注文です。利益確定の段階の注文と OCO として扱い、建玉がなくなったら残りを取り消します。
+	BracketStop BracketStop
+
+	Exits []ExitFill
+}
+
+// UpdateTrailing は最新価格で最良価格を更新し、トレーリングストップを有利な方向にのみ動かします。
+// 状態が変化した場合は true を返します。
+func (t *ActiveTrade) UpdateTrailing(price float64) (bool, error) {
+	if !t.Trailing.Enabled() {
+		return false, nil
+	}
+
+	changed := false
+	if t.BestPrice == 0 || (t.Side == Buy && price > t.BestPrice) || (t.Side == Sell && price < t.BestPrice) {
+		t.BestPrice = price
+		changed = true
+	}
+
+	if !t.TrailingActive {
+		gain := (t.BestPrice - t.EntryPrice) / t.EntryPrice * 100
+		if t.Side == Sell {
+			gain = -gain
+		}
+		if gain < t.Trailing.ActivationPct {
+			return changed, nil
+		}
+		t.TrailingActive = true
+		changed = true
+	}
+
+	distance, err := t.Trailing.PriceDistance(t.BestPrice, t.TrailingATR)
+	if err != nil {
+		return changed, err
+	}
+	stop := t.BestPrice - distance
+	if t.Side == Sell {
+		stop = t.BestPrice + distance
+	}
+	if t.TrailingStopPrice == 0 || (t.Side == Buy && stop > t.TrailingStopPrice) || (t.Side == Sell && stop < t.TrailingStopPrice) {
+		t.TrailingStopPrice = stop
+		changed = true
+	}
+	return changed, nil
+}
+
+// NextExit は最新価格で次に決済すべき理由とサイズを返します。決済不要の場合は ok が false です。
+// 利益確定の段階で決済する場合は target にその添字を、それ以外は -1 を返します。
+func (t *ActiveTrade) NextExit(price float64) (label string, size float64, target int, ok bool) {
+	if t.IsClosed() {
+		return "", 0, -1, false
+	}
+	// 取引所に逆指値注文を出している（または発注結果を確認中の）決済は取引所が執行する
+	if t.BracketStop.OrderID == "" && t.BracketStop.Replacing == nil {
+		if t.StopPrice > 0 && IsStopHit(t.Side, price, t.StopPrice) {
+			return "Stop-loss", t.RemainingSize, -1, true
+		}
+		if t.TrailingActive && IsStopHit(t.Side, price, t.TrailingStopPrice) {
+			return "Trailing stop", t.RemainingSize, -1, true
+		}
+	}
+
+	for i, tp := range t.TakeProfits {
+		if tp.Filled || tp.OrderID != "" || tp.ClientOID != "" {
+			continue
+		}
+		reached := (t.Side == Buy && price >= tp.Price) || (t.Side == Sell && price <= tp.Price)
+		if !reached {
+			return "", 0, -1, false
+		}
+		size = tp.Size
+		// トレーリングで残りを決済しない場合、最後の段階で残り全てを決済する
+		if size > t.RemainingSize || (i == len(t.TakeProfits)-1 && !t.Trailing.Enabled()) {
+			size = t.RemainingSize
+		}
+		return tp.Label, size, i, true
+	}
+	return "", 0, -1, false
+}
+
+// RecordExit は決済を記録し、残りサイズを減らします。
+// BreakevenAfterFirstTarget の場合、利益確定の段階で決済した時点で損切りが建値より不利なら建値に移します。
+func (t *ActiveTrade) RecordExit(fill ExitFill, target int) {
+	fill.PnL = (&Position{Side: t.Side, Size: fill.Size * t.multiplier(), EntryPrice: t.EntryPrice}).UnrealizedPnL(fill.Price)
+	t.Exits = append(t.Exits, fill)
+	t.RemainingSize -= fill.Size
+	if t.RemainingSize < sizeEpsilon {
+		t.RemainingSize = 0
+	}
+	if target >= 0 && target < len(t.TakeProfits) {
+		// 一部しか約定しなかった場合、その段階は残りの数量で再度決済する
+		tp := &t.TakeProfits[target]
+		tp.Size -= fill.Size
+		if tp.Size < sizeEpsilon {
+			tp.Size = 0
+			tp.Filled = true
+		}
+		if t.BreakevenAfterFirstTarget && !t.IsClosed() {
+			t.moveStopToBreakeven()
+		}
+	}
+}
+
+// moveStopToBreakeven は損切りがない、または建値より不利な場合に損切りを建値に移します。
+func (t *ActiveTrade) moveStopToBreakeven() {
+	if t.StopPrice == 0 || (t.Side == Buy && t.StopPrice < t.EntryPrice) || (t.Side == Sell && t.StopPrice > t.EntryPrice) {
+		t.StopPrice = t.EntryPrice
+	}
+}
+
+// NewTradeID は銘柄と建てた時刻から取引の ID を作ります。
+func NewTradeID(symbol string, openedAt time.Time) string {
+	return strings.ReplaceAll(symbol, "-", "") + "-" + strconv.FormatInt(openedAt.UnixMilli(), 36)
+}
+
+// NextClientOID は連番を進めて、この取引の次の注文に使う clientOid を返します。
+// 連番は発注前に保存し、再起動後に同じ clientOid を別の注文に使わないようにします。
+func (t *ActiveTrade) NextClientOID() string {
+	t.OrderSeq++
+	return fmt.Sprintf("%s-%d", t.ID, t.OrderSeq)
+}
+
+// UsesBracket は取引所側の逆指値注文で決済する取引かを返します。
+func (t *ActiveTrade) UsesBracket() bool {
+	return t.BracketStop.PriceType != ""
+}
+
+// ProtectiveStop は現在有効な損切り価格と決済理由を返します。
+// トレーリングストップが有効で損切りより有利な場合はトレーリングストップを返し、どちらもない場合は ok が false です。
+func (t *ActiveTrade) ProtectiveStop() (label string, price float64, ok bool) {
+	label, price = "Stop-loss", t.StopPrice
+	if t.TrailingActive && (price == 0 || (t.Side == Buy && t.TrailingStopPrice > price) || (t.Side == Sell && t.TrailingStopPrice < price)) {
+		label, price = "Trailing stop", t.TrailingStopPrice
+	}
+	return label, price, price > 0
+}
+
+// IsClosed は建玉が全て決済されたかを返します。
+func (t *ActiveTrade) IsClosed() bool {
+	return t.RemainingSize <= sizeEpsilon
+}
+
+// RealizedPnL は決済済み分の損益の合計を返します（手数料を含みません）。
+func (t *ActiveTrade) RealizedPnL() float64 {
+	total := 0.0
+	for _, e := range t.Exits {
+		total += e.PnL
+	}
+	return total
+}
+
+// TotalFees は建てと決済で支払った手数料の合計を返します。
+func (t *ActiveTrade) TotalFees() float64 {
+	total := t.EntryFee
+	for _, e := range t.Exits {
+		total += e.Fee
+	}
+	return total
+}
+
+func (t *ActiveTrade) multiplier() float64 {
+	if t.Multiplier == 0 {
+		return 1
+	}
+	return t.Multiplier
+}
+
+// CloseSide は決済注文のサイドを返します。
+func (t *ActiveTrade) CloseSide() OrderSide {
+	if t.Side == Buy {
+		return Sell
+	}
+	return Buy
+}
@@ -0,0 +1,124 @@
+package domain
+
+import "testing"
+
+// newLongTrade は建値 100 で10ロットのロングに、101/102/103 で 3/3/4 ロットを利益確定する段階を付けた取引を返します。
+func newLongTrade() *ActiveTrade {
+	return &ActiveTrade{
+		ID:            "XBTUSDTM-test",
+		Symbol:        "XBTUSDTM",
+		Side:          Buy,
+		Size:          10,
+		RemainingSize: 10,
+		EntryPrice:    100,
+		StopPrice:     95,
+		TakeProfits: []TakeProfitTarget{
+			{Label: "TP1", Price: 101, Size: 3},
+			{Label: "TP2", Price: 102, Size: 3},
+			{Label: "TP3", Price: 103, Size: 4},
+		},
+	}
+}
+
+// exitAll は monitorTrade と同じく、price で決済すべき段階を全て決済し、決済した段階の名前を返します。
+func exitAll(trade *ActiveTrade, price float64) []string {
+	var labels []string
+	for !trade.IsClosed() {
+		label, size, target, ok := trade.NextExit(price)
+		if !ok {
+			break
+		}
+		trade.RecordExit(ExitFill{Label: label, Size: size, Price: price}, target)
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+func TestNextExitSkipsThroughGappedTargets(t *testing.T) {
+	tests := []struct {
+		price     float64
+		labels    []string
+		remaining float64
+	}{
+		{price: 100.5, labels: nil, remaining: 10},
+		{price: 101, labels: []string{"TP1"}, remaining: 7},
+		{price: 102.5, labels: []string{"TP1", "TP2"}, remaining: 4},
+		{price: 110, labels: []string{"TP1", "TP2", "TP3"}, remaining: 0},
+	}
+	for _, tt := range tests {
+		trade := newLongTrade()
+		labels := exitAll(trade, tt.price)
+		if len(labels) != len(tt.labels) {
+			t.Fatalf("price %v: exits %v, want %v", tt.price, labels, tt.labels)
+		}
+		for i := range labels {
+			if labels[i] != tt.labels[i] {
+				t.Errorf("price %v: exits %v, want %v", tt.price, labels, tt.labels)
+			}
+		}
+		if !approxEqual(trade.RemainingSize, tt.remaining) {
+			t.Errorf("price %v: remaining %v, want %v", tt.price, trade.RemainingSize, tt.remaining)
+		}
+	}
+}
+
+func TestLastTargetClosesTheRemainder(t *testing.T) {
+	trade := newLongTrade()
+	// 途中の段階が一部しか約定せず、残りが段階の合計とずれた場合も最後の段階で全て決済する
+	trade.RecordExit(ExitFill{Label: "TP1", Size: 2, Price: 101}, 0)
+	trade.RecordExit(ExitFill{Label: "TP1", Size: 1, Price: 101}, 0)
+	trade.RecordExit(ExitFill{Label: "Reduced outside the bot", Size: 1.5, Price: 101}, -1)
+	exitAll(trade, 102)
+
+	label, size, target, ok := trade.NextExit(103)
+	if !ok || label != "TP3" || target != 2 || !approxEqual(size, 2.5) {
+		t.Fatalf("NextExit(103) = %q, %v, %d, %v; want TP3 closing the remaining 2.5 lots", label, size, target, ok)
+	}
+	trade.RecordExit(ExitFill{Label: label, Size: size, Price: 103}, target)
+	if !trade.IsClosed() || trade.RemainingSize != 0 {
+		t.Errorf("remaining %v after the last target, want 0", trade.RemainingSize)
+	}
+	if _, _, _, ok := trade.NextExit(110); ok {
+		t.Error("NextExit on a closed trade should not exit")
+	}
+
+	// トレーリングストップで残りを決済する場合、最後の段階は自分のサイズだけを決済する
+	trailing := newLongTrade()
+	trailing.Trailing = TrailingStop{Type: TrailingStopPercent, Distance: 1}
+	exitAll(trailing, 102)
+	if _, size, _, _ := trailing.NextExit(103); size != 4 {
+		t.Errorf("last target with a trailing stop closes %v lots, want 4", size)
+	}
+}
+
+func TestBreakevenAfterFirstTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		side      OrderSide
+		stop      float64
+		breakeven bool
+		wantStop  float64
+	}{
+		{name: "long stop moves up", side: Buy, stop: 95, breakeven: true, wantStop: 100},
+		{name: "short stop moves down", side: Sell, stop: 105, breakeven: true, wantStop: 100},
+		{name: "no stop gets one at entry", side: Buy, stop: 0, breakeven: true, wantStop: 100},
+		{name: "better stop is kept", side: Buy, stop: 100.5, breakeven: true, wantStop: 100.5},
+		{name: "disabled", side: Buy, stop: 95, breakeven: false, wantStop: 95},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trade := newLongTrade()
+			trade.Side, trade.StopPrice, trade.BreakevenAfterFirstTarget = tt.side, tt.stop, tt.breakeven
+
+			// 損切りや段階以外の決済では動かさない
+			trade.RecordExit(ExitFill{Label: "Reduced outside the bot", Size: 1, Price: 100}, -1)
+			if trade.StopPrice != tt.stop {
+				t.Fatalf("stop moved to %v by an exit outside the targets", trade.StopPrice)
+			}
+			trade.RecordExit(ExitFill{Label: "TP1", Size: 3, Price: 101}, 0)
+			if trade.StopPrice != tt.wantStop {
+				t.Errorf("stop after the first target = %v, want %v", trade.StopPrice, tt.wantStop)
+			}
+		})
+	}
+}
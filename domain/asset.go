@@ -11,6 +11,8 @@ type Asset struct {
 	Volume24H     float64
 	MACD          float64
 	RSI           float64
+	SpreadBps     float64 // 板のスプレッド（bps）。板を取得していない場合は 0
+	Depth         float64 // 仲値の前後の一定の幅にある気配の数量（ロット）
 	LastUpdatedAt time.Time
 }
 
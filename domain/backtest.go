@@ -0,0 +1,74 @@
+package domain
+
+import "time"
+
+// Trade はポジションを建ててから決済するまでの1回の取引です。
+type Trade struct {
+	Symbol     string    `json:"symbol"`
+	Side       OrderSide `json:"side"`
+	EntryTime  time.Time `json:"entryTime"`
+	EntryPrice float64   `json:"entryPrice"`
+	ExitTime   time.Time `json:"exitTime"`
+	ExitPrice  float64   `json:"exitPrice"`
+	Size       float64   `json:"size"`
+	GrossPnL   float64   `json:"grossPnl"` // コスト控除前の損益
+	EntryFee   float64   `json:"entryFee"`
+	ExitFee    float64   `json:"exitFee"`
+	Funding    float64   `json:"funding"` // 資金調達コスト（正の値は支払い）
+	PnL        float64   `json:"pnl"`     // コスト控除後の損益
+	IsOpen     bool      `json:"isOpen"`  // 期間終了時点で決済されていない場合は true（最終価格で評価）
+}
+
+// Costs は手数料と資金調達コストの合計を返します。
+func (t *Trade) Costs() float64 {
+	return t.EntryFee + t.ExitFee + t.Funding
+}
+
+// ReturnRate は取引の収益率（%）を計算します。
+func (t *Trade) ReturnRate() float64 {
+	notional := t.EntryPrice * t.Size
+	if notional == 0 {
+		return 0.0
+	}
+	return t.PnL / notional * 100
+}
+
+// EquityPoint は資産曲線の1点を表します。
+type EquityPoint struct {
+	Time   time.Time `json:"time"`
+	Equity float64   `json:"equity"`
+}
+
+// BacktestResult は1銘柄分のバックテスト結果です。
+type BacktestResult struct {
+	Symbol         string
+	InitialCapital float64
+	Trades         []Trade
+	EquityCurve    []EquityPoint
+}
+
+// FinalEquity は期間終了時点の資産額を返します。
+func (r *BacktestResult) FinalEquity() float64 {
+	if len(r.EquityCurve) == 0 {
+		return r.InitialCapital
+	}
+	return r.EquityCurve[len(r.EquityCurve)-1].Equity
+}
+
+// GrossPnL はコスト控除前の損益の合計を返します。
+func (r *BacktestResult) GrossPnL() float64 {
+	total := 0.0
+	for _, t := range r.Trades {
+		total += t.GrossPnL
+	}
+	return total
+}
+
+// NetPnL はコスト控除後の損益の合計を返します。
+func (r *BacktestResult) NetPnL() float64 {
+	total := 0.0
+	for _, t := range r.Trades {
+		total += t.PnL
+	}
+	return total
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Candle は1本のローソク足です。Time は足の開始時刻です。
+// Volume は出来高（先物ではロット数）、Turnover は売買代金で、取引所が返さない場合は 0 です。
+type Candle struct {
+	Time     time.Time
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Volume   float64
+	Turnover float64
+}
+
+// SortCandles はローソク足を古い順に並べ、同じ時刻の足は後にあるものだけを残した系列を返します。
+func SortCandles(candles []Candle) []Candle {
+	sorted := append([]Candle(nil), candles...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	out := sorted[:0]
+	for _, c := range sorted {
+		if n := len(out); n > 0 && out[n-1].Time.Equal(c.Time) {
+			out[n-1] = c
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// LastCandles は古い順に並んだローソク足の直近 count 本を返します。count が 0 以下の場合は全てを返します。
+func LastCandles(candles []Candle, count int) []Candle {
+	if count > 0 && len(candles) > count {
+		return candles[len(candles)-count:]
+	}
+	return candles
+}
+
+// CandleCloses はローソク足の時刻と終値の系列を返します。
+func CandleCloses(candles []Candle) ([]time.Time, []float64) {
+	times := make([]time.Time, len(candles))
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		times[i], closes[i] = c.Time, c.Close
+	}
+	return times, closes
+}
+
+// CandleBucket は時刻 t を含む granularity 分足の開始時刻を返します。区切りは UTC の 0 時を起点に揃えます。
+func CandleBucket(t time.Time, granularity int) time.Time {
+	// time.Time の Truncate はゼロ時刻（UTC の 0 時）からの倍数に切り捨てるため、日足も UTC の日付で区切られる
+	return t.UTC().Truncate(time.Duration(granularity) * time.Minute)
+}
+
+// AggregateCandles は古い順に並んだ from 分足を、UTC で区切りを揃えた to 分足にまとめます。
+// 最後の足は、区切りの終わりが now より後か、区切りの最後の from 分足がまだない場合に確定していない足として
+// partial に返し、complete には含めません。確定していない足がない場合 partial は nil です。
+// 最初の足は、元の足が区切りの途中から始まっている場合は一部しか含まないため捨てます。
+// 途中の欠けた足は取引がなかったものとして扱います。to が from の倍数でない場合はエラーを返します。
+func AggregateCandles(candles []Candle, from, to int, now time.Time) (complete []Candle, partial *Candle, err error) {
+	if from <= 0 || to < from || to%from != 0 {
+		return nil, nil, fmt.Errorf("cannot build %dm candles from %dm candles", to, from)
+	}
+	var bars []Candle
+	for _, c := range candles {
+		start := CandleBucket(c.Time, to)
+		if n := len(bars); n > 0 && bars[n-1].Time.Equal(start) {
+			b := &bars[n-1]
+			b.High = math.Max(b.High, c.High)
+			b.Low = math.Min(b.Low, c.Low)
+			b.Close = c.Close
+			b.Volume += c.Volume
+			b.Turnover += c.Turnover
+			continue
+		}
+		c.Time = start
+		bars = append(bars, c)
+	}
+	if len(bars) > 0 && candles[0].Time.After(bars[0].Time) {
+		bars = bars[1:]
+	}
+	if len(bars) == 0 {
+		return nil, nil, nil
+	}
+
+	last := bars[len(bars)-1]
+	end := last.Time.Add(time.Duration(to) * time.Minute)
+	lastSource := candles[len(candles)-1].Time.Add(time.Duration(from) * time.Minute)
+	if end.After(now) || lastSource.Before(end) {
+		return bars[:len(bars)-1], &last, nil
+	}
+	return bars, nil, nil
+}
@@ -0,0 +1,153 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+// minuteCandles は start から n 本の1分足を返します。i 本目は終値 i、出来高 1 で、skip が true の分は除きます。
+func minuteCandles(start time.Time, n int, skip func(time.Time) bool) []Candle {
+	var candles []Candle
+	for i := 0; i < n; i++ {
+		t := start.Add(time.Duration(i) * time.Minute)
+		if skip != nil && skip(t) {
+			continue
+		}
+		p := float64(i)
+		candles = append(candles, Candle{Time: t, Open: p, High: p + 0.5, Low: p - 0.5, Close: p, Volume: 1})
+	}
+	return candles
+}
+
+func TestCandleBucket(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	tests := []struct {
+		t           time.Time
+		granularity int
+		want        time.Time
+	}{
+		{t: time.Date(2024, 1, 2, 5, 59, 59, 0, time.UTC), granularity: 240, want: time.Date(2024, 1, 2, 4, 0, 0, 0, time.UTC)},
+		// 日足は現地の日付ではなく UTC の日付で区切る
+		{t: time.Date(2024, 1, 2, 8, 30, 0, 0, jst), granularity: 1440, want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// 30分ずれたタイムゾーンでも UTC の正時に揃える
+		{t: time.Date(2024, 1, 2, 10, 45, 0, 0, ist), granularity: 60, want: time.Date(2024, 1, 2, 5, 0, 0, 0, time.UTC)},
+		{t: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), granularity: 60, want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got := CandleBucket(tt.t, tt.granularity)
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("CandleBucket(%s, %d) = %s, want %s", tt.t, tt.granularity, got, tt.want)
+		}
+	}
+}
+
+func TestAggregateCandles(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	hour := func(h int) time.Time { return day.Add(time.Duration(h) * time.Hour) }
+	later := hour(24)
+	tests := []struct {
+		name        string
+		candles     []Candle
+		now         time.Time
+		wantTimes   []time.Time
+		wantVolume  []float64
+		wantPartial time.Time // ゼロ値の場合は partial がないこと
+	}{
+		{
+			name:       "leading partial bucket is dropped",
+			candles:    minuteCandles(hour(0).Add(30*time.Minute), 150, nil),
+			now:        later,
+			wantTimes:  []time.Time{hour(1), hour(2)},
+			wantVolume: []float64{60, 60},
+		},
+		{
+			name:        "bucket still in progress is partial",
+			candles:     minuteCandles(hour(0), 150, nil),
+			now:         hour(2).Add(30 * time.Minute),
+			wantTimes:   []time.Time{hour(0), hour(1)},
+			wantVolume:  []float64{60, 60},
+			wantPartial: hour(2),
+		},
+		{
+			name:        "bucket missing its last source candle is partial",
+			candles:     minuteCandles(hour(0), 119, nil),
+			now:         later,
+			wantTimes:   []time.Time{hour(0)},
+			wantVolume:  []float64{60},
+			wantPartial: hour(1),
+		},
+		{
+			name: "gap inside a bucket",
+			candles: minuteCandles(hour(0), 180, func(t time.Time) bool {
+				return !t.Before(hour(1).Add(10*time.Minute)) && t.Before(hour(1).Add(50*time.Minute))
+			}),
+			now:        later,
+			wantTimes:  []time.Time{hour(0), hour(1), hour(2)},
+			wantVolume: []float64{60, 20, 60},
+		},
+		{
+			name:       "bucket without any source candle is skipped",
+			candles:    minuteCandles(hour(0), 180, func(t time.Time) bool { return !t.Before(hour(1)) && t.Before(hour(2)) }),
+			now:        later,
+			wantTimes:  []time.Time{hour(0), hour(2)},
+			wantVolume: []float64{60, 60},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			complete, partial, err := AggregateCandles(tt.candles, 1, 60, tt.now)
+			if err != nil {
+				t.Fatalf("AggregateCandles: %v", err)
+			}
+			if len(complete) != len(tt.wantTimes) {
+				t.Fatalf("got %d complete candles %+v, want %d", len(complete), complete, len(tt.wantTimes))
+			}
+			for i, c := range complete {
+				if !c.Time.Equal(tt.wantTimes[i]) || c.Volume != tt.wantVolume[i] {
+					t.Errorf("candle %d = %s with volume %v, want %s with volume %v", i, c.Time, c.Volume, tt.wantTimes[i], tt.wantVolume[i])
+				}
+			}
+			switch {
+			case tt.wantPartial.IsZero() && partial != nil:
+				t.Errorf("unexpected partial candle %+v", partial)
+			case !tt.wantPartial.IsZero() && (partial == nil || !partial.Time.Equal(tt.wantPartial)):
+				t.Errorf("partial = %+v, want the candle starting at %s", partial, tt.wantPartial)
+			}
+		})
+	}
+}
+
+func TestAggregateCandlesOHLC(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	// 1時間目の 10〜49 分は欠けている
+	candles := minuteCandles(start, 120, func(t time.Time) bool {
+		m := t.Sub(start) / time.Minute
+		return m >= 70 && m < 110
+	})
+	complete, _, err := AggregateCandles(candles, 1, 60, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("AggregateCandles: %v", err)
+	}
+	want := []Candle{
+		{Time: start, Open: 0, High: 59.5, Low: -0.5, Close: 59, Volume: 60},
+		{Time: start.Add(time.Hour), Open: 60, High: 119.5, Low: 59.5, Close: 119, Volume: 20},
+	}
+	if len(complete) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(complete), len(want))
+	}
+	for i := range want {
+		if complete[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, complete[i], want[i])
+		}
+	}
+}
+
+func TestAggregateCandlesRejectsUnalignedGranularity(t *testing.T) {
+	candles := minuteCandles(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), 60, nil)
+	for _, to := range []int{45, 3} {
+		if _, _, err := AggregateCandles(candles, 2, to, time.Now()); err == nil {
+			t.Errorf("AggregateCandles from 2m to %dm: expected an error", to)
+		}
+	}
+}
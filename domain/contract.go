@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+)
+
+// lotEpsilon はロット数の丸めで浮動小数点の誤差を吸収するための値です。
+const lotEpsilon = 1e-9
+
+// ContractSpec は先物契約の仕様です。注文数量はロット数で指定します。
+type ContractSpec struct {
+	Symbol      string
+	Multiplier  float64 // 1ロットあたりの原資産数量
+	LotSize     float64 // 注文数量（ロット数）の刻みで、最小注文数量でもある
+	TickSize    float64 // 価格の刻み
+	MaxOrderQty float64 // 1注文あたりの最大ロット数
+	MaxLeverage float64
+}
+
+// Validate は仕様がサイズ計算に使える値かを検証します。
+func (c ContractSpec) Validate() error {
+	if c.Multiplier <= 0 || c.LotSize <= 0 || c.TickSize <= 0 {
+		return fmt.Errorf("invalid contract spec for %s: multiplier %v, lot size %v, tick size %v", c.Symbol, c.Multiplier, c.LotSize, c.TickSize)
+	}
+	return nil
+}
+
+// RoundLots はロット数をロットの刻みに切り捨てます。
+func (c ContractSpec) RoundLots(lots float64) float64 {
+	return math.Floor(lots/c.LotSize+lotEpsilon) * c.LotSize
+}
+
+// LotsForNotional は USD 建ての金額を、金額を超えない最大のロット数に換算します。
+// 1ロットに満たない場合や、1注文の上限を超える場合はエラーを返します。
+func (c ContractSpec) LotsForNotional(notionalUSD, price float64) (float64, error) {
+	if err := c.Validate(); err != nil {
+		return 0, err
+	}
+	if notionalUSD <= 0 || price <= 0 {
+		return 0, fmt.Errorf("notional and price must be positive: %v, %v", notionalUSD, price)
+	}
+
+	lots := c.RoundLots(notionalUSD / (price * c.Multiplier))
+	if lots < c.LotSize {
+		return 0, fmt.Errorf("%.2f USD is below the minimum order of %v lot(s) on %s (%.2f USD at %.4f)",
+			notionalUSD, c.LotSize, c.Symbol, c.Notional(c.LotSize, price), price)
+	}
+	if c.MaxOrderQty > 0 && lots > c.MaxOrderQty {
+		return 0, fmt.Errorf("%v lots exceed the maximum order quantity %v on %s", lots, c.MaxOrderQty, c.Symbol)
+	}
+	return lots, nil
+}
+
+// ValidateLots はロット数がロットの刻みに沿っており、1注文の上限以内かを検証します。
+func (c ContractSpec) ValidateLots(lots float64) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if lots < c.LotSize || math.Abs(c.RoundLots(lots)-lots) > lotEpsilon*c.LotSize {
+		return fmt.Errorf("%v is not a valid quantity on %s: must be a multiple of %v lot(s)", lots, c.Symbol, c.LotSize)
+	}
+	if c.MaxOrderQty > 0 && lots > c.MaxOrderQty {
+		return fmt.Errorf("%v lots exceed the maximum order quantity %v on %s", lots, c.MaxOrderQty, c.Symbol)
+	}
+	return nil
+}
+
+// RoundPrice は価格を刻みに丸めます。約定しにくい方向（買いは切り下げ、売りは切り上げ）に丸めます。
+func (c ContractSpec) RoundPrice(price float64, side OrderSide) float64 {
+	ticks := price / c.TickSize
+	if side == Buy {
+		ticks = math.Floor(ticks + lotEpsilon)
+	} else {
+		ticks = math.Ceil(ticks - lotEpsilon)
+	}
+	// 刻みの桁数に揃えて表示上の誤差を除く
+	decimals := math.Max(0, math.Ceil(-math.Log10(c.TickSize)))
+	scale := math.Pow(10, decimals)
+	return math.Round(ticks*c.TickSize*scale) / scale
+}
+
+// Notional はロット数と価格から USD 建ての金額を計算します。
+func (c ContractSpec) Notional(lots, price float64) float64 {
+	return lots * c.Multiplier * price
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLotsForNotional(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     ContractSpec
+		notional float64
+		price    float64
+		want     float64
+		wantErr  string
+	}{
+		// 100 USD / (50000 * 0.001) = 2 ロット
+		{name: "fractional multiplier", spec: ContractSpec{Symbol: "XBTUSDTM", Multiplier: 0.001, LotSize: 1, TickSize: 0.1}, notional: 100, price: 50000, want: 2},
+		// 100 / (3000 * 0.01) = 3.33... → 3 ロット
+		{name: "rounds down to whole lots", spec: ContractSpec{Symbol: "ETHUSDTM", Multiplier: 0.01, LotSize: 1, TickSize: 0.01}, notional: 100, price: 3000, want: 3},
+		// 100 / (0.5 * 10) = 20 ロットを 5 の刻みに
+		{name: "multiplier above one", spec: ContractSpec{Symbol: "DOGEUSDTM", Multiplier: 10, LotSize: 5, TickSize: 0.00001}, notional: 110, price: 0.5, want: 20},
+		// 10 / (3 * 1) = 3.33... → 0.1 の刻みで 3.3
+		{name: "fractional lot size", spec: ContractSpec{Symbol: "XYZUSDTM", Multiplier: 1, LotSize: 0.1, TickSize: 0.001}, notional: 10, price: 3, want: 3.3},
+		// 0.3 / 0.1 の浮動小数点の誤差で 2 ロットに切り捨てない
+		{name: "exact multiple survives float error", spec: ContractSpec{Symbol: "XYZUSDTM", Multiplier: 0.1, LotSize: 1, TickSize: 0.01}, notional: 0.3, price: 1, want: 3},
+		{name: "below one lot", spec: ContractSpec{Symbol: "XBTUSDTM", Multiplier: 0.001, LotSize: 1, TickSize: 0.1}, notional: 40, price: 50000, wantErr: "below the minimum order"},
+		{name: "above max order quantity", spec: ContractSpec{Symbol: "XBTUSDTM", Multiplier: 0.001, LotSize: 1, TickSize: 0.1, MaxOrderQty: 10}, notional: 1000, price: 50000, wantErr: "maximum order quantity"},
+		{name: "invalid spec", spec: ContractSpec{Symbol: "XBTUSDTM", LotSize: 1, TickSize: 0.1}, notional: 100, price: 50000, wantErr: "invalid contract spec"},
+		{name: "non-positive price", spec: ContractSpec{Symbol: "XBTUSDTM", Multiplier: 0.001, LotSize: 1, TickSize: 0.1}, notional: 100, price: 0, wantErr: "must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.spec.LotsForNotional(tt.notional, tt.price)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LotsForNotional = %v, %v; want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LotsForNotional: %v", err)
+			}
+			if !approxEqual(got, tt.want) {
+				t.Errorf("LotsForNotional = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLots(t *testing.T) {
+	spec := ContractSpec{Symbol: "XYZUSDTM", Multiplier: 1, LotSize: 0.1, TickSize: 0.01, MaxOrderQty: 100}
+	tests := []struct {
+		lots  float64
+		valid bool
+	}{
+		{lots: 0.1, valid: true},
+		{lots: 0.3, valid: true},
+		{lots: 100, valid: true},
+		{lots: 0.05, valid: false},
+		{lots: 0.25, valid: false},
+		{lots: 100.1, valid: false},
+	}
+	for _, tt := range tests {
+		if err := spec.ValidateLots(tt.lots); (err == nil) != tt.valid {
+			t.Errorf("ValidateLots(%v) = %v, want valid %v", tt.lots, err, tt.valid)
+		}
+	}
+}
+
+func TestRoundPrice(t *testing.T) {
+	tests := []struct {
+		tick  float64
+		price float64
+		side  OrderSide
+		want  float64
+	}{
+		// 買いは切り下げ、売りは切り上げ
+		{tick: 0.1, price: 50000.17, side: Buy, want: 50000.1},
+		{tick: 0.1, price: 50000.17, side: Sell, want: 50000.2},
+		{tick: 0.5, price: 101.3, side: Buy, want: 101},
+		{tick: 0.5, price: 101.3, side: Sell, want: 101.5},
+		{tick: 0.00001, price: 0.123456, side: Buy, want: 0.12345},
+		{tick: 0.00001, price: 0.123456, side: Sell, want: 0.12346},
+		// 既に刻みに沿った価格は浮動小数点の誤差があってもそのまま
+		{tick: 0.01, price: 0.29, side: Buy, want: 0.29},
+		{tick: 0.01, price: 0.29, side: Sell, want: 0.29},
+		{tick: 1, price: 3000, side: Sell, want: 3000},
+	}
+	for _, tt := range tests {
+		spec := ContractSpec{Symbol: "XYZUSDTM", Multiplier: 1, LotSize: 1, TickSize: tt.tick}
+		if got := spec.RoundPrice(tt.price, tt.side); got != tt.want {
+			t.Errorf("RoundPrice(%v, %s) with tick %v = %v, want %v", tt.price, tt.side, tt.tick, got, tt.want)
+		}
+	}
+}
+
+func TestNotional(t *testing.T) {
+	spec := ContractSpec{Symbol: "XBTUSDTM", Multiplier: 0.001, LotSize: 1, TickSize: 0.1}
+	if got := spec.Notional(3, 50000); !approxEqual(got, 150) {
+		t.Errorf("Notional(3, 50000) = %v, want 150", got)
+	}
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Liquidity は約定がメイカーかテイカーかを表します。
+type Liquidity string
+
+const (
+	Maker Liquidity = "maker"
+	Taker Liquidity = "taker"
+)
+
+// FeeModel は約定代金に対する手数料を計算します。
+type FeeModel interface {
+	Fee(notional float64, liquidity Liquidity) float64
+}
+
+// SlippageModel は基準価格と注文サイズから約定価格を見積もります。
+type SlippageModel interface {
+	FillPrice(symbol string, side OrderSide, size, refPrice float64) float64
+}
+
+// FundingModel は保有期間中に発生する資金調達コストを計算します（正の値は支払い、負の値は受け取り）。
+type FundingModel interface {
+	Funding(position Position, markPrice float64, from, to time.Time) float64
+}
+
+// CostModel はシミュレーションの約定に適用するコストの組み合わせです。
+type CostModel struct {
+	Fee      FeeModel
+	Slippage SlippageModel
+	Funding  FundingModel
+}
+
+// NoCostModel はコストを一切考慮しないモデルを返します。
+func NoCostModel() CostModel {
+	return CostModel{
+		Fee:      FixedBpsFee{},
+		Slippage: FixedBpsSlippage{},
+		Funding:  FixedRateFunding{},
+	}
+}
+
+// FixedBpsFee はメイカー/テイカーを区別しない固定料率の手数料です。
+type FixedBpsFee struct {
+	Bps float64
+}
+
+// Fee は約定代金に固定料率を掛けた手数料を返します。
+func (f FixedBpsFee) Fee(notional float64, _ Liquidity) float64 {
+	return math.Abs(notional) * f.Bps / 10000
+}
+
+// FeeTier は取引量に応じた手数料ランクです。
+type FeeTier struct {
+	MinVolume float64 // 30日間の取引量 (USDT)
+	MakerBps  float64
+	TakerBps  float64
+}
+
+// TieredFee は30日間の取引量に応じたメイカー/テイカー手数料です。
+type TieredFee struct {
+	Tiers  []FeeTier
+	Volume float64
+}
+
+// Fee は取引量に該当するランクの料率で手数料を計算します。
+func (f TieredFee) Fee(notional float64, liquidity Liquidity) float64 {
+	tiers := make([]FeeTier, len(f.Tiers))
+	copy(tiers, f.Tiers)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinVolume < tiers[j].MinVolume })
+
+	var tier FeeTier
+	for _, t := range tiers {
+		if f.Volume >= t.MinVolume {
+			tier = t
+		}
+	}
+	bps := tier.TakerBps
+	if liquidity == Maker {
+		bps = tier.MakerBps
+	}
+	return math.Abs(notional) * bps / 10000
+}
+
+// FixedBpsSlippage は基準価格から不利な方向に固定幅だけずらして約定させます。
+type FixedBpsSlippage struct {
+	Bps float64
+}
+
+// FillPrice は買いなら高く、売りなら安く約定価格を返します。
+func (s FixedBpsSlippage) FillPrice(_ string, side OrderSide, _ float64, refPrice float64) float64 {
+	if side == Buy {
+		return refPrice * (1 + s.Bps/10000)
+	}
+	return refPrice * (1 - s.Bps/10000)
+}
+
+// PriceLevel は板の1価格帯です。
+type PriceLevel struct {
+	Price float64
+	Size  float64
+}
+
+// BookSource は板情報の取得元です。買い注文には売り板を、売り注文には買い板を良い順に返します。
+// 数量は FillPrice に渡すサイズと同じ原資産単位です。
+type BookSource interface {
+	Levels(symbol string, side OrderSide) []PriceLevel
+}
+
+// BookSlippage は板を順に消化したときの平均約定価格で見積もります。
+// 板が取得できない場合は Fallback を使用します。
+type BookSlippage struct {
+	Book     BookSource
+	Fallback SlippageModel
+}
+
+// FillPrice は板の厚みに応じた平均約定価格を返します。板が足りない分は最後の価格帯で約定したとみなします。
+func (s BookSlippage) FillPrice(symbol string, side OrderSide, size, refPrice float64) float64 {
+	var levels []PriceLevel
+	if s.Book != nil {
+		levels = s.Book.Levels(symbol, side)
+	}
+	if len(levels) == 0 || size <= 0 {
+		if s.Fallback == nil {
+			return refPrice
+		}
+		return s.Fallback.FillPrice(symbol, side, size, refPrice)
+	}
+
+	remaining, cost := size, 0.0
+	for _, l := range levels {
+		take := math.Min(remaining, l.Size)
+		cost += take * l.Price
+		remaining -= take
+		if remaining <= 0 {
+			break
+		}
+	}
+	if remaining > 0 {
+		cost += remaining * levels[len(levels)-1].Price
+	}
+	return cost / size
+}
+
+// FixedRateFunding は一定間隔（KuCoin先物では UTC の 04:00, 12:00, 20:00 の8時間ごと）に固定の資金調達率で精算します。
+type FixedRateFunding struct {
+	Rate     float64 // 1回の精算あたりの資金調達率（例: 0.0001 = 0.01%）
+	Interval time.Duration
+	Offset   time.Duration // UTC の 0 時から最初の精算時刻までの時間（KuCoin先物では4時間）
+}
+
+// Funding は (from, to] に含まれる精算時刻ごとに、ロングは支払い・ショートは受け取りとして計算します。
+func (f FixedRateFunding) Funding(position Position, markPrice float64, from, to time.Time) float64 {
+	if f.Rate == 0 || f.Interval <= 0 || !to.After(from) {
+		return 0
+	}
+	// 精算時刻が区切りになるよう Offset だけずらしてから切り捨てる
+	settlements := to.Add(-f.Offset).Truncate(f.Interval).Sub(from.Add(-f.Offset).Truncate(f.Interval)) / f.Interval
+	cost := float64(settlements) * position.Size * markPrice * f.Rate
+	if position.Side == Sell {
+		return -cost
+	}
+	return cost
+}
@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestFixedBpsFee(t *testing.T) {
+	fee := FixedBpsFee{Bps: 6}
+	tests := []struct {
+		notional  float64
+		liquidity Liquidity
+		want      float64
+	}{
+		{notional: 10000, liquidity: Taker, want: 6},
+		{notional: 10000, liquidity: Maker, want: 6},
+		{notional: -5000, liquidity: Taker, want: 3}, // 売りの約定代金も絶対値で計算する
+		{notional: 0, liquidity: Taker, want: 0},
+	}
+	for _, tt := range tests {
+		if got := fee.Fee(tt.notional, tt.liquidity); !approxEqual(got, tt.want) {
+			t.Errorf("Fee(%v, %s) = %v, want %v", tt.notional, tt.liquidity, got, tt.want)
+		}
+	}
+}
+
+func TestTieredFee(t *testing.T) {
+	// 順不同で渡しても取引量の少ない順に判定する
+	tiers := []FeeTier{
+		{MinVolume: 1000000, MakerBps: 1, TakerBps: 4},
+		{MinVolume: 0, MakerBps: 2, TakerBps: 6},
+		{MinVolume: 50000, MakerBps: 1.5, TakerBps: 5},
+	}
+	tests := []struct {
+		volume    float64
+		liquidity Liquidity
+		want      float64
+	}{
+		{volume: 0, liquidity: Taker, want: 6},
+		{volume: 0, liquidity: Maker, want: 2},
+		{volume: 49999, liquidity: Taker, want: 6},
+		{volume: 50000, liquidity: Maker, want: 1.5},
+		{volume: 2000000, liquidity: Taker, want: 4},
+	}
+	for _, tt := range tests {
+		fee := TieredFee{Tiers: tiers, Volume: tt.volume}
+		if got := fee.Fee(10000, tt.liquidity); !approxEqual(got, tt.want) {
+			t.Errorf("volume %v, %s: Fee(10000) = %v, want %v", tt.volume, tt.liquidity, got, tt.want)
+		}
+	}
+}
+
+func TestFixedBpsSlippage(t *testing.T) {
+	s := FixedBpsSlippage{Bps: 10}
+	if got := s.FillPrice("XBTUSDTM", Buy, 1, 100); !approxEqual(got, 100.1) {
+		t.Errorf("buy fill = %v, want 100.1", got)
+	}
+	if got := s.FillPrice("XBTUSDTM", Sell, 1, 100); !approxEqual(got, 99.9) {
+		t.Errorf("sell fill = %v, want 99.9", got)
+	}
+}
+
+// staticBook は固定の板を返す BookSource です。
+type staticBook []PriceLevel
+
+func (b staticBook) Levels(string, OrderSide) []PriceLevel { return b }
+
+func TestBookSlippage(t *testing.T) {
+	book := staticBook{{Price: 100, Size: 1}, {Price: 101, Size: 2}}
+	tests := []struct {
+		name string
+		book BookSource
+		size float64
+		want float64
+	}{
+		{name: "within the best level", book: book, size: 0.5, want: 100},
+		{name: "walks two levels", book: book, size: 3, want: (100 + 2*101) / 3.0},
+		{name: "beyond the book at the last level", book: book, size: 4, want: (100 + 3*101) / 4.0},
+		{name: "empty book uses the fallback", book: staticBook{}, size: 1, want: 100.1},
+		// 乗数 1 の銘柄の板はそのまま BookSource として使える。買いは売り気配を消化する
+		{name: "order book", book: &OrderBook{Symbol: "XBTUSDTM", Bids: []PriceLevel{{Price: 99, Size: 5}}, Asks: book}, size: 3, want: (100 + 2*101) / 3.0},
+		{name: "order book of another symbol uses the fallback", book: &OrderBook{Symbol: "ETHUSDTM", Asks: book}, size: 1, want: 100.1},
+		{name: "no book uses the fallback", size: 1, want: 100.1},
+	}
+	for _, tt := range tests {
+		s := BookSlippage{Book: tt.book, Fallback: FixedBpsSlippage{Bps: 10}}
+		if got := s.FillPrice("XBTUSDTM", Buy, tt.size, 100); !approxEqual(got, tt.want) {
+			t.Errorf("%s: FillPrice = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFixedRateFunding(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	funding := FixedRateFunding{Rate: 0.0001, Interval: 8 * time.Hour, Offset: 4 * time.Hour}
+	long := Position{Side: Buy, Size: 2}
+	short := Position{Side: Sell, Size: 2}
+	tests := []struct {
+		name     string
+		model    FixedRateFunding
+		position Position
+		from, to time.Time
+		want     float64
+	}{
+		// 12:00 と 20:00 の2回。2 * 100 * 0.0001 = 0.02 ずつ
+		{name: "long pays twice", model: funding, position: long, from: day.Add(11 * time.Hour), to: day.Add(21 * time.Hour), want: 0.04},
+		{name: "short receives", model: funding, position: short, from: day.Add(11 * time.Hour), to: day.Add(21 * time.Hour), want: -0.04},
+		// 開始時刻ちょうどの精算は含めず、終了時刻ちょうどの精算は含める
+		{name: "settlement at from is excluded", model: funding, position: long, from: day.Add(12 * time.Hour), to: day.Add(20 * time.Hour), want: 0.02},
+		{name: "no settlement in between", model: funding, position: long, from: day.Add(13 * time.Hour), to: day.Add(19 * time.Hour), want: 0},
+		// 00:00, 08:00, 16:00 には精算しない
+		{name: "not at the midnight boundaries", model: funding, position: long, from: day.Add(-time.Hour), to: day.Add(17 * time.Hour), want: 0.04},
+		// 前日 20:00 と当日 04:00 をまたぐ
+		{name: "across midnight", model: funding, position: long, from: day.Add(-5 * time.Hour), to: day.Add(5 * time.Hour), want: 0.04},
+		{name: "no offset settles at midnight", model: FixedRateFunding{Rate: 0.0001, Interval: 8 * time.Hour}, position: long, from: day.Add(-time.Hour), to: day.Add(time.Hour), want: 0.02},
+		{name: "reversed range", model: funding, position: long, from: day.Add(17 * time.Hour), to: day.Add(7 * time.Hour), want: 0},
+		{name: "zero rate", model: FixedRateFunding{Interval: 8 * time.Hour}, position: long, from: day, to: day.Add(24 * time.Hour), want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.model.Funding(tt.position, 100, tt.from, tt.to); !approxEqual(got, tt.want) {
+			t.Errorf("%s: Funding = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "errors"
+
+// ErrRateLimited は取引所のレート制限に達したことを表すエラーです。
+var ErrRateLimited = errors.New("rate limited by exchange")
+
+// ErrRejected は取引所がリクエストを処理した上で拒否したことを表すエラーです。
+// 通信エラーと違って注文が受け付けられていないことが確定しているため、再送しても同じ結果になります。
+var ErrRejected = errors.New("request rejected")
+
+// ErrOrderNotFound は指定した注文が取引所に存在しないことを表すエラーです。
+var ErrOrderNotFound = errors.New("order not found")
@@ -0,0 +1,196 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ExecutionAlgo は大きな注文を子注文に分けて執行するアルゴリズムです。
+type ExecutionAlgo string
+
+const (
+	AlgoTWAP    ExecutionAlgo = "twap"    // 一定期間に均等な子注文を一定間隔で出す
+	AlgoIceberg ExecutionAlgo = "iceberg" // 一度に見せるサイズだけの子注文を約定するたびに出し直す
+	AlgoPOV     ExecutionAlgo = "pov"     // 市場の出来高の一定割合ずつ子注文を出す
+)
+
+// ParseExecutionAlgo は大文字小文字を区別せずに執行アルゴリズムを解析します。
+func ParseExecutionAlgo(s string) (ExecutionAlgo, error) {
+	switch a := ExecutionAlgo(strings.ToLower(strings.TrimSpace(s))); a {
+	case AlgoTWAP, AlgoIceberg, AlgoPOV:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid execution algorithm %q: must be twap, iceberg or pov", s)
+	}
+}
+
+// ExecutionPlan は親注文の執行方法です。
+type ExecutionPlan struct {
+	Algo ExecutionAlgo // 空の場合は1回の注文で執行する
+
+	Duration time.Duration // TWAP は執行期間、POV は執行を打ち切るまでの期間
+	Slices   int           // TWAP の子注文の数
+	// Interval は Iceberg の子注文の間隔と、POV で出来高を集計する間隔です。
+	Interval         time.Duration
+	VisibleSize      float64 // Iceberg で一度に出すロット数
+	ParticipationPct float64 // POV で市場の出来高に対して参加する割合 (%)
+	// MaxSlippageBps が正の場合、子注文は発注時点の価格からこの幅を上限とする IOC 指値にする。
+	// 0 の場合は成行で発注する。
+	MaxSlippageBps float64
+}
+
+// Enabled は執行アルゴリズムを使うかを返します。
+func (p ExecutionPlan) Enabled() bool {
+	return p.Algo != ""
+}
+
+// Validate はアルゴリズムごとに必要な設定がそろっているかを検証します。
+func (p ExecutionPlan) Validate() error {
+	if p.MaxSlippageBps < 0 {
+		return fmt.Errorf("max slippage must not be negative: %v bps", p.MaxSlippageBps)
+	}
+	switch p.Algo {
+	case "":
+		return nil
+	case AlgoTWAP:
+		if p.Duration <= 0 || p.Slices < 1 {
+			return fmt.Errorf("twap requires a positive duration and at least one slice")
+		}
+	case AlgoIceberg:
+		if p.VisibleSize <= 0 {
+			return fmt.Errorf("iceberg requires a positive visible size")
+		}
+		if p.Interval < 0 {
+			return fmt.Errorf("iceberg interval must not be negative: %s", p.Interval)
+		}
+	case AlgoPOV:
+		if p.ParticipationPct <= 0 || p.ParticipationPct > 100 {
+			return fmt.Errorf("pov participation must be in (0, 100]: %v", p.ParticipationPct)
+		}
+		if p.Interval <= 0 || p.Duration <= 0 {
+			return fmt.Errorf("pov requires a positive interval and duration")
+		}
+	default:
+		return fmt.Errorf("invalid execution algorithm: %s", p.Algo)
+	}
+	return nil
+}
+
+// ChildLimitPrice は子注文の指値を返します。MaxSlippageBps が 0 の場合は成行のため 0 です。
+// 買いは基準価格より高く、売りは安く、呼値の刻みに丸めた価格を上限にします。
+func (p ExecutionPlan) ChildLimitPrice(side OrderSide, refPrice float64, spec ContractSpec) float64 {
+	if p.MaxSlippageBps <= 0 {
+		return 0
+	}
+	if side == Buy {
+		return spec.RoundPrice(refPrice*(1+p.MaxSlippageBps/10000), Buy)
+	}
+	return spec.RoundPrice(refPrice*(1-p.MaxSlippageBps/10000), Sell)
+}
+
+// SplitLots は total ロットを最大 parts 個のロットの刻みに沿った子注文に分け、端数は最後の子注文に含めます。
+// 1つあたりが1ロットに満たない場合は子注文の数を減らします。
+func SplitLots(total float64, parts int, spec ContractSpec) []float64 {
+	if parts < 1 {
+		parts = 1
+	}
+	lot := spec.LotSize
+	if lot <= 0 {
+		lot = 1
+	}
+	if maxParts := int(math.Floor(total/lot + lotEpsilon)); parts > maxParts {
+		parts = maxParts
+	}
+	if parts <= 1 {
+		return []float64{total}
+	}
+
+	each := spec.RoundLots(total / float64(parts))
+	sizes := make([]float64, parts)
+	rest := total
+	for i := 0; i < parts-1; i++ {
+		sizes[i] = each
+		rest -= each
+	}
+	sizes[parts-1] = spec.RoundLots(rest)
+	return sizes
+}
+
+// ChildClientOID は親注文の clientOid から n 番目（1始まり）の子注文の clientOid を作ります。
+// 子注文は連番順に1つずつ発注するため、再起動後も見つからなくなるまで順に探せば全ての子注文を集められます。
+func ChildClientOID(parent string, n int) string {
+	return fmt.Sprintf("%s-%d", parent, n)
+}
+
+// MarketTrade は取引所で成立した1件の約定（全参加者の約定）です。Size はロット数です。
+type MarketTrade struct {
+	Sequence int64
+	Price    float64
+	Size     float64
+	Side     OrderSide // テイカーのサイド
+	Time     time.Time
+}
+
+// ExecutionProgress は親注文の執行状況です。
+type ExecutionProgress struct {
+	Algo       ExecutionAlgo
+	Symbol     string
+	Side       OrderSide
+	TargetSize float64 // 親注文のロット数
+	FilledSize float64
+	AvgPrice   float64
+	Fee        float64
+	OrderIDs   []string // 発注した子注文のID
+	Aborted    bool
+}
+
+// AddFill は子注文の約定を執行状況に加えます。
+func (p *ExecutionProgress) AddFill(order Order) {
+	p.OrderIDs = append(p.OrderIDs, order.ID)
+	if order.FilledSize <= 0 {
+		return
+	}
+	p.AvgPrice = (p.AvgPrice*p.FilledSize + order.Price*order.FilledSize) / (p.FilledSize + order.FilledSize)
+	p.FilledSize += order.FilledSize
+	p.Fee += order.Fee
+}
+
+// Remaining は未約定のロット数を返します。
+func (p ExecutionProgress) Remaining() float64 {
+	if r := p.TargetSize - p.FilledSize; r > sizeEpsilon {
+		return r
+	}
+	return 0
+}
+
+// FilledPct は親注文に対する約定済みの割合 (%) を返します。
+func (p ExecutionProgress) FilledPct() float64 {
+	if p.TargetSize == 0 {
+		return 0
+	}
+	return p.FilledSize / p.TargetSize * 100
+}
+
+// Order は執行結果を1つの注文として返します。注文IDは最初の子注文のIDです。
+func (p ExecutionProgress) Order() Order {
+	order := Order{
+		Symbol:     p.Symbol,
+		Side:       p.Side,
+		Type:       OrderTypeMarket,
+		Price:      p.AvgPrice,
+		Amount:     p.TargetSize,
+		FilledSize: p.FilledSize,
+		Fee:        p.Fee,
+		Status:     OrderStatusCanceled,
+		CreatedAt:  time.Now(),
+	}
+	if len(p.OrderIDs) > 0 {
+		order.ID = p.OrderIDs[0]
+	}
+	if p.Remaining() == 0 {
+		order.Status = OrderStatusFilled
+	}
+	return order
+}
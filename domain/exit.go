@@ -0,0 +1,185 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+)
+
+// StopLossType は損切り価格の指定方法です。
+type StopLossType string
+
+const (
+	StopLossNone    StopLossType = ""
+	StopLossPercent StopLossType = "percent" // 建値からの下落（ショートは上昇）率 (%)
+	StopLossPrice   StopLossType = "price"   // 絶対価格
+	StopLossATR     StopLossType = "atr"     // ATR の倍数
+)
+
+// StopLoss は損切りの条件です。
+type StopLoss struct {
+	Type  StopLossType
+	Value float64
+}
+
+// Enabled は損切りが設定されているかを返します。
+func (s StopLoss) Enabled() bool {
+	return s.Type != StopLossNone
+}
+
+// StopPrice は建値と ATR から損切り価格を計算します。
+// 損切り価格が建値より有利な側にある場合はエラーを返します。
+func (s StopLoss) StopPrice(side OrderSide, entryPrice, atr float64) (float64, error) {
+	if s.Value <= 0 {
+		return 0, fmt.Errorf("stop-loss value must be positive: %v", s.Value)
+	}
+
+	var distance float64
+	switch s.Type {
+	case StopLossPercent:
+		distance = entryPrice * s.Value / 100
+	case StopLossATR:
+		if atr <= 0 {
+			return 0, fmt.Errorf("ATR is not available for stop-loss")
+		}
+		distance = atr * s.Value
+	case StopLossPrice:
+		if (side == Buy && s.Value >= entryPrice) || (side == Sell && s.Value <= entryPrice) {
+			return 0, fmt.Errorf("stop-loss price %.4f is on the wrong side of entry %.4f for %s", s.Value, entryPrice, side)
+		}
+		return s.Value, nil
+	default:
+		return 0, fmt.Errorf("unknown stop-loss type: %s", s.Type)
+	}
+
+	if side == Buy {
+		if distance >= entryPrice {
+			return 0, fmt.Errorf("stop-loss distance %.4f exceeds entry price %.4f", distance, entryPrice)
+		}
+		return entryPrice - distance, nil
+	}
+	return entryPrice + distance, nil
+}
+
+// IsStopHit は価格が損切り価格に達したかを判定します。
+func IsStopHit(side OrderSide, price, stopPrice float64) bool {
+	if side == Buy {
+		return price <= stopPrice
+	}
+	return price >= stopPrice
+}
+
+// TrailingStopType はトレーリングストップの幅の指定方法です。
+type TrailingStopType string
+
+const (
+	TrailingStopNone    TrailingStopType = ""
+	TrailingStopPercent TrailingStopType = "percent" // 最良価格からの率 (%)
+	TrailingStopATR     TrailingStopType = "atr"     // 建て時の ATR の倍数
+)
+
+// TrailingStop はトレーリングストップの条件です。
+// ActivationPct が正の場合、含み益がその率に達してからストップの追従を開始します。
+type TrailingStop struct {
+	Type          TrailingStopType
+	Distance      float64
+	ActivationPct float64
+}
+
+// Enabled はトレーリングストップが設定されているかを返します。
+func (t TrailingStop) Enabled() bool {
+	return t.Type != TrailingStopNone
+}
+
+// PriceDistance は最良価格からストップまでの価格幅を計算します。
+func (t TrailingStop) PriceDistance(bestPrice, atr float64) (float64, error) {
+	if t.Distance <= 0 {
+		return 0, fmt.Errorf("trailing stop distance must be positive: %v", t.Distance)
+	}
+	switch t.Type {
+	case TrailingStopPercent:
+		return bestPrice * t.Distance / 100, nil
+	case TrailingStopATR:
+		if atr <= 0 {
+			return 0, fmt.Errorf("ATR is not available for trailing stop")
+		}
+		return atr * t.Distance, nil
+	default:
+		return 0, fmt.Errorf("unknown trailing stop type: %s", t.Type)
+	}
+}
+
+// TakeProfitType は利益確定価格の指定方法です。
+type TakeProfitType string
+
+const (
+	TakeProfitPercent TakeProfitType = "percent" // 建値からの率 (%)
+	TakeProfitR       TakeProfitType = "r"       // 損切り幅 (R) の倍数
+	TakeProfitPrice   TakeProfitType = "price"   // 絶対価格
+)
+
+// TakeProfit は利益確定の1段階です。SizePct は建玉に対する決済割合 (%) です。
+type TakeProfit struct {
+	Type    TakeProfitType
+	Value   float64
+	SizePct float64
+}
+
+// TargetPrice は建値と損切り価格から利益確定価格を計算します。
+func (tp TakeProfit) TargetPrice(side OrderSide, entryPrice, stopPrice float64) (float64, error) {
+	if tp.Value <= 0 {
+		return 0, fmt.Errorf("take-profit value must be positive: %v", tp.Value)
+	}
+
+	var distance float64
+	switch tp.Type {
+	case TakeProfitPercent:
+		distance = entryPrice * tp.Value / 100
+	case TakeProfitR:
+		if stopPrice <= 0 {
+			return 0, fmt.Errorf("R-multiple take-profit requires a stop-loss")
+		}
+		distance = math.Abs(entryPrice-stopPrice) * tp.Value
+	case TakeProfitPrice:
+		if (side == Buy && tp.Value <= entryPrice) || (side == Sell && tp.Value >= entryPrice) {
+			return 0, fmt.Errorf("take-profit price %.4f is on the wrong side of entry %.4f for %s", tp.Value, entryPrice, side)
+		}
+		return tp.Value, nil
+	default:
+		return 0, fmt.Errorf("unknown take-profit type: %s", tp.Type)
+	}
+
+	if side == Buy {
+		return entryPrice + distance, nil
+	}
+	if distance >= entryPrice {
+		return 0, fmt.Errorf("take-profit distance %.4f exceeds entry price %.4f", distance, entryPrice)
+	}
+	return entryPrice - distance, nil
+}
+
+// Label は利益確定の段階を表示用の文字列にします。
+func (tp TakeProfit) Label() string {
+	switch tp.Type {
+	case TakeProfitPercent:
+		return fmt.Sprintf("TP %.0f%% @ %+.2f%%", tp.SizePct, tp.Value)
+	case TakeProfitR:
+		return fmt.Sprintf("TP %.0f%% @ %.2fR", tp.SizePct, tp.Value)
+	default:
+		return fmt.Sprintf("TP %.0f%% @ %.4f", tp.SizePct, tp.Value)
+	}
+}
+
+// ValidateTakeProfits は利益確定の段階の決済割合が 0 より大きく、合計が 100% 以下であることを検証します。
+func ValidateTakeProfits(levels []TakeProfit) error {
+	total := 0.0
+	for _, tp := range levels {
+		if tp.SizePct <= 0 {
+			return fmt.Errorf("take-profit size must be positive: %v%%", tp.SizePct)
+		}
+		total += tp.SizePct
+	}
+	if total > 100+1e-9 {
+		return fmt.Errorf("take-profit sizes add up to %.2f%%, more than 100%%", total)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MarginMode は証拠金の方式を表します。
+type MarginMode string
+
+const (
+	IsolatedMargin MarginMode = "isolated" // ポジションごとに証拠金を分ける
+	CrossMargin    MarginMode = "cross"    // 口座残高全体を証拠金にする
+)
+
+// ParseMarginMode は大文字小文字を区別せずに証拠金の方式を解析します。
+func ParseMarginMode(s string) (MarginMode, error) {
+	switch mode := MarginMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case IsolatedMargin, CrossMargin:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid margin mode %q: must be isolated or cross", s)
+	}
+}
+
+// MarginSettings は取引ごとのレバレッジと証拠金の方式です。
+type MarginSettings struct {
+	Leverage float64
+	Mode     MarginMode
+}
+
+// DefaultMarginSettings は1倍・分離証拠金の設定を返します。
+func DefaultMarginSettings() MarginSettings {
+	return MarginSettings{Leverage: 1, Mode: IsolatedMargin}
+}
+
+// Validate はレバレッジが1倍以上かつ契約の上限以内であることを検証します。
+func (m MarginSettings) Validate(spec ContractSpec) error {
+	if m.Leverage < 1 {
+		return fmt.Errorf("leverage must be at least 1: %v", m.Leverage)
+	}
+	if spec.MaxLeverage > 0 && m.Leverage > spec.MaxLeverage {
+		return fmt.Errorf("leverage %vx exceeds the maximum %vx on %s", m.Leverage, spec.MaxLeverage, spec.Symbol)
+	}
+	if m.Mode != IsolatedMargin && m.Mode != CrossMargin {
+		return fmt.Errorf("invalid margin mode: %q", m.Mode)
+	}
+	return nil
+}
+
+// InitialMargin は想定元本に対して必要な当初証拠金を返します。
+func (m MarginSettings) InitialMargin(notional float64) float64 {
+	return notional / m.Leverage
+}
+
+// ApproxLiquidationPrice は分離証拠金で維持証拠金を無視した場合のおおよその清算価格を返します。
+// 全額を失う価格のため、実際の清算はこれより手前で起こります。クロス証拠金では口座残高に依存するため 0 を返します。
+func (m MarginSettings) ApproxLiquidationPrice(side OrderSide, entryPrice float64) float64 {
+	if m.Mode != IsolatedMargin {
+		return 0
+	}
+	if side == Buy {
+		return entryPrice * (1 - 1/m.Leverage)
+	}
+	return entryPrice * (1 + 1/m.Leverage)
+}
+
+// String は "5x isolated" の形式で表します。
+func (m MarginSettings) String() string {
+	return fmt.Sprintf("%vx %s", m.Leverage, m.Mode)
+}
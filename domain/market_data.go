@@ -0,0 +1,177 @@
+package domain
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// PriceKind はリアルタイムで受信した価格の種類です。
+type PriceKind string
+
+const (
+	PriceLast PriceKind = "last" // 最終約定価格
+	PriceMark PriceKind = "mark" // マーク価格
+)
+
+// PriceUpdate はストリームで受信した1回分の価格の更新です。
+type PriceUpdate struct {
+	Symbol     string
+	Kind       PriceKind
+	Price      float64
+	BestBid    float64 // 最終約定価格の更新でのみ設定される
+	BestAsk    float64 // 最終約定価格の更新でのみ設定される
+	IndexPrice float64 // マーク価格の更新でのみ設定される
+	Time       time.Time
+}
+
+// OrderBook は銘柄の板情報です。Bids は価格の高い順、Asks は価格の低い順に並び、各気配の Size は取引所と同じロット数です。
+// Sequence は取引所の板の更新の通し番号で、差分の更新を適用するたびに1つ進みます。
+type OrderBook struct {
+	Symbol   string
+	Sequence int64
+	Bids     []PriceLevel
+	Asks     []PriceLevel
+	Time     time.Time
+}
+
+// BestBid は最良買い気配を返します。買い注文がない場合は ok が false です。
+func (b *OrderBook) BestBid() (level PriceLevel, ok bool) {
+	if len(b.Bids) == 0 {
+		return PriceLevel{}, false
+	}
+	return b.Bids[0], true
+}
+
+// BestAsk は最良売り気配を返します。売り注文がない場合は ok が false です。
+func (b *OrderBook) BestAsk() (level PriceLevel, ok bool) {
+	if len(b.Asks) == 0 {
+		return PriceLevel{}, false
+	}
+	return b.Asks[0], true
+}
+
+// MidPrice は最良気配の仲値を返します。
+func (b *OrderBook) MidPrice() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+	return (bid.Price + ask.Price) / 2, true
+}
+
+// Spread は最良売り気配と最良買い気配の差を返します。
+func (b *OrderBook) Spread() (float64, bool) {
+	bid, okBid := b.BestBid()
+	ask, okAsk := b.BestAsk()
+	if !okBid || !okAsk {
+		return 0, false
+	}
+	return ask.Price - bid.Price, true
+}
+
+// SpreadBps はスプレッドを仲値に対する bps で返します。
+func (b *OrderBook) SpreadBps() (float64, bool) {
+	spread, ok := b.Spread()
+	mid, _ := b.MidPrice()
+	if !ok || mid <= 0 {
+		return 0, false
+	}
+	return spread / mid * 10000, true
+}
+
+// DepthAt は side の成行注文が price まで約定させられる数量の合計を返します。
+// 買いの場合は price 以下の売り気配、売りの場合は price 以上の買い気配の数量を合計します。
+func (b *OrderBook) DepthAt(side OrderSide, price float64) float64 {
+	depth := 0.0
+	for _, l := range b.takerLevels(side) {
+		if (side == Buy && l.Price > price) || (side == Sell && l.Price < price) {
+			break
+		}
+		depth += l.Size
+	}
+	return depth
+}
+
+// VWAP は side の成行注文で size を約定させた場合の平均約定価格と、約定できる数量を返します。
+// 板の数量が足りない場合、filled は size より小さくなり、平均価格は約定できる分だけのものです。
+func (b *OrderBook) VWAP(side OrderSide, size float64) (price, filled float64) {
+	cost := 0.0
+	for _, l := range b.takerLevels(side) {
+		if filled >= size {
+			break
+		}
+		take := math.Min(l.Size, size-filled)
+		cost += take * l.Price
+		filled += take
+	}
+	if filled == 0 {
+		return 0, 0
+	}
+	return cost / filled, filled
+}
+
+// SlippageBps は side の成行注文で size を約定させた場合の、平均約定価格の仲値からの不利な乖離を bps で返します。
+// 板の数量が足りず全量を約定させられない場合は ok が false です。
+func (b *OrderBook) SlippageBps(side OrderSide, size float64) (bps float64, ok bool) {
+	mid, okMid := b.MidPrice()
+	vwap, filled := b.VWAP(side, size)
+	if !okMid || mid <= 0 || filled < size {
+		return 0, false
+	}
+	if side == Buy {
+		return (vwap - mid) / mid * 10000, true
+	}
+	return (mid - vwap) / mid * 10000, true
+}
+
+// Levels は side の成行注文が約定する相手側の気配を良い順に返し、BookSource を実装します。
+// 別の銘柄の板を求められた場合は nil を返します。数量はロット数のままのため、原資産単位で見積もる場合は乗数を掛けます。
+func (b *OrderBook) Levels(symbol string, side OrderSide) []PriceLevel {
+	if symbol != b.Symbol {
+		return nil
+	}
+	return b.takerLevels(side)
+}
+
+// takerLevels は side の成行注文が約定する相手側の気配を返します。
+func (b *OrderBook) takerLevels(side OrderSide) []PriceLevel {
+	if side == Buy {
+		return b.Asks
+	}
+	return b.Bids
+}
+
+// Apply は板の差分の更新を1つ適用します。side が Buy なら買い気配、Sell なら売り気配の price の数量を size にし、
+// size が 0 の場合はその価格を板から取り除きます。
+func (b *OrderBook) Apply(side OrderSide, price, size float64) {
+	levels := &b.Asks
+	// 買い気配は価格の高い順に並ぶ
+	before := func(p float64) bool { return p < price }
+	if side == Buy {
+		levels = &b.Bids
+		before = func(p float64) bool { return p > price }
+	}
+	i := sort.Search(len(*levels), func(i int) bool { return !before((*levels)[i].Price) })
+	exists := i < len(*levels) && (*levels)[i].Price == price
+	switch {
+	case size <= 0 && exists:
+		*levels = append((*levels)[:i], (*levels)[i+1:]...)
+	case size <= 0:
+	case exists:
+		(*levels)[i].Size = size
+	default:
+		*levels = append(*levels, PriceLevel{})
+		copy((*levels)[i+1:], (*levels)[i:])
+		(*levels)[i] = PriceLevel{Price: price, Size: size}
+	}
+}
+
+// Clone は板のコピーを返します。保持している板を呼び出し側に渡す場合に使います。
+func (b *OrderBook) Clone() OrderBook {
+	c := *b
+	c.Bids = append([]PriceLevel(nil), b.Bids...)
+	c.Asks = append([]PriceLevel(nil), b.Asks...)
+	return c
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// ParamScore は1つのパラメータ候補の評価結果です。
+type ParamScore struct {
+	Params          SignalParams
+	InSampleReturn  float64 // 全期間での収益率 (%)
+	OutSampleReturn float64 // ウォークフォワード検証期間の平均収益率 (%)
+	Trades          int
+}
+
+// WalkForwardWindow はウォークフォワード検証の1ウィンドウで選ばれたパラメータとその成績です。
+type WalkForwardWindow struct {
+	TrainStart  time.Time
+	TrainEnd    time.Time
+	TestStart   time.Time
+	TestEnd     time.Time
+	Params      SignalParams
+	TrainReturn float64
+	TestReturn  float64
+}
+
+// OptimizationResult は1銘柄分のパラメータ最適化の結果です。
+type OptimizationResult struct {
+	Symbol  string
+	Ranking []ParamScore // 検証期間の成績が良い順
+	Windows []WalkForwardWindow
+}
+
+// Best は最上位のパラメータを返します。
+func (r *OptimizationResult) Best() (SignalParams, bool) {
+	if len(r.Ranking) == 0 {
+		return SignalParams{}, false
+	}
+	return r.Ranking[0].Params, true
+}
@@ -1,6 +1,10 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // OrderSide は注文のサイド（買い/売り）を表します。
 type OrderSide string
@@ -14,18 +18,232 @@ const (
 type OrderStatus string
 
 const (
-	OrderStatusNew      OrderStatus = "new"
-	OrderStatusFilled   OrderStatus = "filled"
-	OrderStatusCanceled OrderStatus = "canceled"
+	OrderStatusNew             OrderStatus = "new"
+	OrderStatusPartiallyFilled OrderStatus = "partially_filled" // 一部約定し、残りが板に残っている
+	OrderStatusFilled          OrderStatus = "filled"
+	OrderStatusCanceled        OrderStatus = "canceled" // 未約定分が取り消された（一部約定を含む）
 )
 
 // Order は取引注文の情報を保持するエンティティです。
+// Price は約定済みの場合は平均約定価格、未約定の指値注文の場合は指値です。
 type Order struct {
-	ID        string
+	ID         string
+	ClientOID  string
+	Symbol     string
+	Side       OrderSide
+	Type       OrderType
+	Price      float64
+	Amount     float64 // 注文数量（先物の場合はロット数）
+	FilledSize float64 // 約定済み数量
+	Multiplier float64 // 1ロットあたりの原資産数量。0 の場合は数量が原資産単位であることを表す
+	Fee        float64
+	Status     OrderStatus
+	Stop       StopDirection // 逆指値注文の場合のみ
+	StopPrice  float64
+	CreatedAt  time.Time
+}
+
+// BaseAmount は注文数量を原資産単位に換算して返します。
+func (o Order) BaseAmount() float64 {
+	if o.Multiplier == 0 {
+		return o.Amount
+	}
+	return o.Amount * o.Multiplier
+}
+
+// IsDone は注文がこれ以上約定しない状態かを返します。
+func (o Order) IsDone() bool {
+	return o.Status == OrderStatusFilled || o.Status == OrderStatusCanceled
+}
+
+// ApplyFills は約定履歴から平均約定価格・約定数量・手数料を計算して反映します。
+func (o *Order) ApplyFills(fills []Fill) {
+	size, value, fee := 0.0, 0.0, 0.0
+	for _, f := range fills {
+		size += f.Size
+		value += f.Price * f.Size
+		fee += f.Fee
+	}
+	if size == 0 {
+		return
+	}
+	o.FilledSize = size
+	o.Price = value / size
+	o.Fee = fee
+}
+
+// Fill は注文の1回の約定です。
+type Fill struct {
+	TradeID   string
+	OrderID   string
 	Symbol    string
 	Side      OrderSide
 	Price     float64
-	Amount    float64
-	Status    OrderStatus
-	CreatedAt time.Time
+	Size      float64
+	Fee       float64
+	Liquidity Liquidity
+	Time      time.Time
+}
+
+// OrderType は注文の種類を表します。
+type OrderType string
+
+const (
+	OrderTypeMarket OrderType = "market"
+	OrderTypeLimit  OrderType = "limit"
+)
+
+// TimeInForce は指値注文の有効期限の種類を表します。
+type TimeInForce string
+
+const (
+	GoodTillCanceled  TimeInForce = "GTC"
+	ImmediateOrCancel TimeInForce = "IOC"
+	FillOrKill        TimeInForce = "FOK"
+)
+
+// StopDirection は逆指値注文が発動する価格の方向です。
+type StopDirection string
+
+const (
+	StopDown StopDirection = "down" // 価格が StopPrice 以下になったら発動する
+	StopUp   StopDirection = "up"   // 価格が StopPrice 以上になったら発動する
+)
+
+// StopPriceType は逆指値注文の発動判定に使う価格の種類です。
+type StopPriceType string
+
+const (
+	TradePrice StopPriceType = "TP" // 最終約定価格
+	MarkPrice  StopPriceType = "MP" // マーク価格
+	IndexPrice StopPriceType = "IP" // インデックス価格
+)
+
+// ParseStopPriceType は大文字小文字を区別せずに逆指値の価格の種類を解析します。
+func ParseStopPriceType(s string) (StopPriceType, error) {
+	switch t := StopPriceType(strings.ToUpper(strings.TrimSpace(s))); t {
+	case TradePrice, MarkPrice, IndexPrice:
+		return t, nil
+	default:
+		return "", fmt.Errorf("invalid stop price type %q: must be TP, MP or IP", s)
+	}
+}
+
+// StopTriggered は価格が逆指値の発動条件を満たすかを返します。
+func StopTriggered(stop StopDirection, stopPrice, price float64) bool {
+	if stop == StopDown {
+		return price <= stopPrice
+	}
+	return price >= stopPrice
+}
+
+// maxClientOIDLength は取引所が受け付ける clientOid の最大長です。
+const maxClientOIDLength = 40
+
+// ValidateClientOID は clientOid が英数字・ハイフン・アンダースコアからなる40文字以内かを検証します。空は許可します。
+func ValidateClientOID(id string) error {
+	if len(id) > maxClientOIDLength {
+		return fmt.Errorf("clientOid %q is longer than %d characters", id, maxClientOIDLength)
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("clientOid %q contains an invalid character %q", id, c)
+		}
+	}
+	return nil
+}
+
+// OrderRequest は取引所に送る新規注文の内容です。
+type OrderRequest struct {
+	// ClientOID は注文を一意に識別する ID です。同じ ID の注文は取引所で一度しか受け付けられないため、
+	// 再送しても二重に発注されません。空の場合はゲートウェイが発注のたびに生成します。
+	ClientOID   string
+	Symbol      string
+	Side        OrderSide
+	Type        OrderType
+	Size        float64
+	Price       float64     // 指値注文の価格
+	TimeInForce TimeInForce // 指値注文のみ。省略時は取引所の既定 (GTC)
+	PostOnly    bool        // メイカーとして約定しない場合は取り消す
+	Hidden      bool        // 板に表示しない
+	Iceberg     bool        // VisibleSize だけを板に表示する
+	VisibleSize float64
+	ReduceOnly  bool       // 建玉を減らす方向にのみ約定する
+	CloseOrder  bool       // 建玉を全て決済する。Size は無視される
+	Leverage    float64    // 0 の場合は1倍
+	MarginMode  MarginMode // 省略時は取引所の設定に従う
+	// Stop を指定すると逆指値注文になり、StopPrice に達するまで取引所で待機します。
+	Stop          StopDirection
+	StopPriceType StopPriceType
+	StopPrice     float64
+}
+
+// Validate は注文の組み合わせが取引所の制約を満たすかを検証します。
+func (r OrderRequest) Validate() error {
+	if r.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if r.Side != Buy && r.Side != Sell {
+		return fmt.Errorf("invalid side: %s", r.Side)
+	}
+	if err := ValidateClientOID(r.ClientOID); err != nil {
+		return err
+	}
+	if !r.CloseOrder && r.Size <= 0 {
+		return fmt.Errorf("order size must be positive: %v", r.Size)
+	}
+	if r.Leverage != 0 && r.Leverage < 1 {
+		return fmt.Errorf("leverage must be at least 1: %v", r.Leverage)
+	}
+	if r.MarginMode != "" && r.MarginMode != IsolatedMargin && r.MarginMode != CrossMargin {
+		return fmt.Errorf("invalid margin mode: %s", r.MarginMode)
+	}
+	switch r.Stop {
+	case "":
+		if r.StopPrice != 0 || r.StopPriceType != "" {
+			return fmt.Errorf("stop price and stop price type require a stop direction")
+		}
+	case StopDown, StopUp:
+		if r.StopPrice <= 0 {
+			return fmt.Errorf("stop price must be positive: %v", r.StopPrice)
+		}
+		if _, err := ParseStopPriceType(string(r.StopPriceType)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid stop direction: %s", r.Stop)
+	}
+
+	switch r.Type {
+	case OrderTypeMarket:
+		if r.Price != 0 || r.TimeInForce != "" || r.PostOnly || r.Hidden || r.Iceberg {
+			return fmt.Errorf("price, time in force, post-only, hidden and iceberg apply only to limit orders")
+		}
+		return nil
+	case OrderTypeLimit:
+	default:
+		return fmt.Errorf("invalid order type: %s", r.Type)
+	}
+
+	if r.Price <= 0 {
+		return fmt.Errorf("limit order price must be positive: %v", r.Price)
+	}
+	switch r.TimeInForce {
+	case "", GoodTillCanceled, ImmediateOrCancel, FillOrKill:
+	default:
+		return fmt.Errorf("invalid time in force: %s", r.TimeInForce)
+	}
+	if r.PostOnly && (r.TimeInForce == ImmediateOrCancel || r.TimeInForce == FillOrKill) {
+		return fmt.Errorf("post-only orders cannot be %s", r.TimeInForce)
+	}
+	if r.PostOnly && (r.Hidden || r.Iceberg) {
+		return fmt.Errorf("post-only orders cannot be hidden or iceberg")
+	}
+	if r.Hidden && r.Iceberg {
+		return fmt.Errorf("an order cannot be both hidden and iceberg")
+	}
+	if r.Iceberg && (r.VisibleSize <= 0 || (!r.CloseOrder && r.VisibleSize >= r.Size)) {
+		return fmt.Errorf("iceberg visible size must be positive and smaller than the order size: %v", r.VisibleSize)
+	}
+	return nil
 }
@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// DrawdownPoint はドローダウン曲線の1点を表します（ピークからの下落率, %）。
+type DrawdownPoint struct {
+	Time     time.Time `json:"time"`
+	Drawdown float64   `json:"drawdown"`
+}
+
+// PerformanceReport は取引結果のパフォーマンス指標をまとめたレポートです。
+// 率は全て % で表します。
+type PerformanceReport struct {
+	Name            string          `json:"name"`
+	Start           time.Time       `json:"start"`
+	End             time.Time       `json:"end"`
+	InitialCapital  float64         `json:"initialCapital"`
+	FinalEquity     float64         `json:"finalEquity"`
+	TotalReturn     float64         `json:"totalReturn"`
+	CAGR            float64         `json:"cagr"`
+	Sharpe          float64         `json:"sharpe"`
+	Sortino         float64         `json:"sortino"`
+	MaxDrawdown     float64         `json:"maxDrawdown"`
+	MaxDrawdownDays float64         `json:"maxDrawdownDays"` // 最長の水面下期間（日）
+	GrossPnL        float64         `json:"grossPnl"`        // 約定価格ベースの損益（手数料・資金調達控除前）
+	TotalCosts      float64         `json:"totalCosts"`      // 手数料と資金調達コストの合計
+	Funding         float64         `json:"funding"`         // 取引ごとに按分していない資金調達コスト（ペーパートレードの累計）
+	NetPnL          float64         `json:"netPnl"`
+	Trades          int             `json:"trades"`
+	WinRate         float64         `json:"winRate"`
+	ProfitFactor    float64         `json:"profitFactor"` // 損失の取引がない場合は 0
+	AverageTradePnL float64         `json:"averageTradePnl"`
+	Exposure        float64         `json:"exposure"` // ポジションを保有していた時間の割合
+	RoundTrips      []Trade         `json:"roundTrips"`
+	EquityCurve     []EquityPoint   `json:"equityCurve"`
+	DrawdownCurve   []DrawdownPoint `json:"drawdownCurve"`
+}
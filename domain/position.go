@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// Position は保有中のポジションを保持するエンティティです。
+type Position struct {
+	Symbol     string
+	Side       OrderSide
+	Size       float64
+	Lots       float64 // 先物の建玉のロット数。Size はこれに乗数を掛けた原資産数量
+	EntryPrice float64 // 平均建値
+	Leverage   float64 // 0 の場合は1倍
+	MarginMode MarginMode
+	OpenedAt   time.Time
+}
+
+// Notional はポジションの建値ベースの想定元本を返します。
+func (p *Position) Notional() float64 {
+	return p.Size * p.EntryPrice
+}
+
+// Margin はポジションの当初証拠金を返します。
+func (p *Position) Margin() float64 {
+	if p.Leverage <= 1 {
+		return p.Notional()
+	}
+	return p.Notional() / p.Leverage
+}
+
+// UnrealizedPnL は指定価格での含み損益を計算します。
+func (p *Position) UnrealizedPnL(price float64) float64 {
+	if p.Side == Buy {
+		return (price - p.EntryPrice) * p.Size
+	}
+	return (p.EntryPrice - price) * p.Size
+}
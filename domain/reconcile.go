@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"math"
+	"sort"
+)
+
+// ReconcileStatus は取引所の建玉とローカルに保存した取引の状態を突き合わせた結果です。
+type ReconcileStatus string
+
+const (
+	ReconcileMatched      ReconcileStatus = "matched"       // サイドとロット数が一致している
+	ReconcileSizeMismatch ReconcileStatus = "size_mismatch" // サイドは一致するがロット数が異なる
+	ReconcileSideMismatch ReconcileStatus = "side_mismatch" // 保存した取引と反対側の建玉がある
+	ReconcileUnknown      ReconcileStatus = "unknown"       // 保存した取引のない建玉
+	ReconcileMissing      ReconcileStatus = "missing"       // 保存した取引に対応する建玉がない
+	ReconcilePendingEntry ReconcileStatus = "pending_entry" // 建て注文の結果を確認中の取引
+)
+
+// PositionReconciliation は1銘柄の突き合わせ結果です。建玉または取引がない場合は nil です。
+type PositionReconciliation struct {
+	Symbol   string
+	Status   ReconcileStatus
+	Position *Position
+	Trade    *ActiveTrade
+	Action   string // 食い違いに対して行った対応。空の場合は報告のみ
+}
+
+// Discrepancy は取引所とローカルの状態が食い違っているかを返します。
+func (r PositionReconciliation) Discrepancy() bool {
+	return r.Status != ReconcileMatched && r.Status != ReconcilePendingEntry
+}
+
+// ReconcilePositions は取引所の建玉と保存した取引を銘柄ごとに突き合わせ、銘柄順に返します。
+// 取引のロット数は決済されていない残りのロット数で比較します。
+func ReconcilePositions(positions []Position, trades []ActiveTrade) []PositionReconciliation {
+	bySymbol := map[string]*PositionReconciliation{}
+	for i := range positions {
+		bySymbol[positions[i].Symbol] = &PositionReconciliation{Symbol: positions[i].Symbol, Position: &positions[i]}
+	}
+	for i := range trades {
+		r, ok := bySymbol[trades[i].Symbol]
+		if !ok {
+			r = &PositionReconciliation{Symbol: trades[i].Symbol}
+			bySymbol[trades[i].Symbol] = r
+		}
+		r.Trade = &trades[i]
+	}
+
+	results := make([]PositionReconciliation, 0, len(bySymbol))
+	for _, r := range bySymbol {
+		switch pos, trade := r.Position, r.Trade; {
+		case trade != nil && trade.PendingEntry != nil:
+			r.Status = ReconcilePendingEntry
+		case trade == nil:
+			r.Status = ReconcileUnknown
+		case pos == nil:
+			r.Status = ReconcileMissing
+		case pos.Side != trade.Side:
+			r.Status = ReconcileSideMismatch
+		case math.Abs(pos.Lots-trade.RemainingSize) > lotEpsilon:
+			r.Status = ReconcileSizeMismatch
+		default:
+			r.Status = ReconcileMatched
+		}
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Symbol < results[j].Symbol })
+	return results
+}
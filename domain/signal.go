@@ -0,0 +1,65 @@
+package domain
+
+import "fmt"
+
+// SignalParams は MACD と RSI によるトレンド判定のパラメータです。
+type SignalParams struct {
+	FastPeriod    int     `json:"fastPeriod"`
+	SlowPeriod    int     `json:"slowPeriod"`
+	SignalPeriod  int     `json:"signalPeriod"`
+	RSIPeriod     int     `json:"rsiPeriod"`
+	RSIOverbought float64 `json:"rsiOverbought"`
+	RSIOversold   float64 `json:"rsiOversold"`
+}
+
+// DefaultSignalParams は従来から使用しているパラメータ (12, 26, 9 / RSI 14, 70/30) を返します。
+func DefaultSignalParams() SignalParams {
+	return SignalParams{
+		FastPeriod:    12,
+		SlowPeriod:    26,
+		SignalPeriod:  9,
+		RSIPeriod:     14,
+		RSIOverbought: 70.0,
+		RSIOversold:   30.0,
+	}
+}
+
+// Validate はパラメータの整合性を検証します。
+func (p SignalParams) Validate() error {
+	if p.FastPeriod < 2 || p.SlowPeriod < 2 || p.SignalPeriod < 1 || p.RSIPeriod < 2 {
+		return fmt.Errorf("periods are too short: %s", p)
+	}
+	if p.FastPeriod >= p.SlowPeriod {
+		return fmt.Errorf("fast period must be shorter than slow period: %s", p)
+	}
+	if p.RSIOversold >= p.RSIOverbought {
+		return fmt.Errorf("RSI oversold must be below overbought: %s", p)
+	}
+	return nil
+}
+
+// String はパラメータを表形式で表示しやすい文字列にします。
+func (p SignalParams) String() string {
+	return fmt.Sprintf("MACD(%d,%d,%d) RSI(%d) %.0f/%.0f",
+		p.FastPeriod, p.SlowPeriod, p.SignalPeriod, p.RSIPeriod, p.RSIOverbought, p.RSIOversold)
+}
+
+// SignalConfig は銘柄ごとのトレンド判定パラメータの設定です。
+// 銘柄ごとの指定がない場合は Default を使用します。
+type SignalConfig struct {
+	Default SignalParams            `json:"default"`
+	Symbols map[string]SignalParams `json:"symbols,omitempty"`
+}
+
+// DefaultSignalConfig は全銘柄で DefaultSignalParams を使う設定を返します。
+func DefaultSignalConfig() SignalConfig {
+	return SignalConfig{Default: DefaultSignalParams()}
+}
+
+// ParamsFor は指定された銘柄のパラメータを返します。
+func (c SignalConfig) ParamsFor(symbol string) SignalParams {
+	if p, ok := c.Symbols[symbol]; ok {
+		return p
+	}
+	return c.Default
+}
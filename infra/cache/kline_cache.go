@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"crypto_trade_bot/domain"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KlineCache はローソク足データを銘柄・足の長さごとのCSVファイルに保存するキャッシュです。
+// 各行は KuCoin 先物APIと同じ [時刻(ms), 始値, 高値, 安値, 終値, 出来高, 売買代金] の列で、時刻で重複を除去します。
+// 売買代金の列がない古いファイルもそのまま読めます。
+type KlineCache struct {
+	dir string
+}
+
+// NewKlineCache は新しいKlineCacheを生成します。
+func NewKlineCache(dir string) *KlineCache {
+	return &KlineCache{dir: dir}
+}
+
+func (c *KlineCache) path(symbol string, granularity int) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%s_%d.csv", strings.ReplaceAll(symbol, "/", "_"), granularity))
+}
+
+// Merge はローソク足をキャッシュに追加します。既存の足と時刻が重複するものは新しい足で上書きします。
+// 追加された（新規の）本数を返します。
+func (c *KlineCache) Merge(symbol string, granularity int, candles []domain.Candle) (int, error) {
+	if len(candles) == 0 {
+		return 0, nil
+	}
+	existing, err := c.load(symbol, granularity)
+	if err != nil {
+		return 0, err
+	}
+
+	known := make(map[int64]bool, len(existing))
+	for _, k := range existing {
+		known[k.Time.UnixMilli()] = true
+	}
+	added := 0
+	for _, k := range candles {
+		if !known[k.Time.UnixMilli()] {
+			known[k.Time.UnixMilli()] = true
+			added++
+		}
+	}
+
+	// SortCandles は同じ時刻の足のうち後にあるものを残すため、新しい足が既存の足を上書きする
+	merged := domain.SortCandles(append(existing, candles...))
+	if err := c.save(symbol, granularity, merged); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// GetCandles はキャッシュからローソク足を取得します。
+// KuCoinGateway.GetCandles と同じく古い順に並べて返し、count が正の場合は直近 count 本に絞ります。
+func (c *KlineCache) GetCandles(symbol string, granularity int, count int) ([]domain.Candle, error) {
+	candles, err := c.load(symbol, granularity)
+	if err != nil {
+		return nil, err
+	}
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("no cached kline data for %s (%dm)", symbol, granularity)
+	}
+	return domain.LastCandles(candles, count), nil
+}
+
+func (c *KlineCache) load(symbol string, granularity int) ([]domain.Candle, error) {
+	path := c.path(symbol, granularity)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open kline cache %s: %w", path, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kline cache %s: %w", path, err)
+	}
+	candles := make([]domain.Candle, len(rows))
+	for i, row := range rows {
+		if candles[i], err = parseCandleRow(row); err != nil {
+			return nil, fmt.Errorf("invalid row %d in kline cache %s: %w", i+1, path, err)
+		}
+	}
+	return domain.SortCandles(candles), nil
+}
+
+func (c *KlineCache) save(symbol string, granularity int, candles []domain.Candle) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create kline cache directory: %w", err)
+	}
+	path := c.path(symbol, granularity)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create kline cache %s: %w", tmp, err)
+	}
+
+	rows := make([][]string, len(candles))
+	for i, k := range candles {
+		rows[i] = formatCandleRow(k)
+	}
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write kline cache %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close kline cache %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// parseCandleRow はCSVの1行をローソク足に変換します。売買代金の列は省略できます。
+func parseCandleRow(row []string) (domain.Candle, error) {
+	if len(row) < 6 {
+		return domain.Candle{}, fmt.Errorf("expected at least 6 columns, got %d", len(row))
+	}
+	var values [7]float64
+	for i := 0; i < len(row) && i < len(values); i++ {
+		v, err := strconv.ParseFloat(row[i], 64)
+		if err != nil {
+			return domain.Candle{}, fmt.Errorf("invalid column %d %q: %w", i+1, row[i], err)
+		}
+		values[i] = v
+	}
+	return domain.Candle{
+		Time:     time.UnixMilli(int64(values[0])),
+		Open:     values[1],
+		High:     values[2],
+		Low:      values[3],
+		Close:    values[4],
+		Volume:   values[5],
+		Turnover: values[6],
+	}, nil
+}
+
+// formatCandleRow はローソク足をCSVの1行に変換します。
+func formatCandleRow(k domain.Candle) []string {
+	row := []string{strconv.FormatInt(k.Time.UnixMilli(), 10)}
+	for _, v := range []float64{k.Open, k.High, k.Low, k.Close, k.Volume, k.Turnover} {
+		row = append(row, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return row
+}
@@ -0,0 +1,392 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// scrubbedHeaders は記録時に値を伏せる認証系のヘッダーです。
+var scrubbedHeaders = map[string]bool{
+	"Authorization":     true,
+	"Kc-Api-Key":        true,
+	"Kc-Api-Sign":       true,
+	"Kc-Api-Passphrase": true,
+	"Kc-Api-Timestamp":  true,
+}
+
+const redacted = "[REDACTED]"
+
+// timeVaryingParams は実行した時刻によって値が変わるクエリパラメータです（K-Line の期間など）。
+// 再生時に完全に一致する記録がない場合は、これらを除いて照合します。
+var timeVaryingParams = map[string]bool{
+	"from":    true,
+	"to":      true,
+	"startAt": true,
+	"endAt":   true,
+}
+
+// perRunFields は実行ごとに値が変わるクエリパラメータと JSON ボディの項目です。
+// clientOid は取引を始めた時刻から作るため、同じ取引を再生しても記録時とは異なります。
+var perRunFields = map[string]bool{
+	"clientOid": true,
+}
+
+// perRunPathPrefixes は、続くパスの要素が実行ごとに変わるパスです（clientOid を指定した取消など）。
+var perRunPathPrefixes = []string{
+	"/api/v1/orders/client-order/",
+}
+
+// RecordedRequest は記録されたリクエストです。
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// RecordedResponse は記録されたレスポンスです。
+type RecordedResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// Interaction はリクエストとレスポンスの組です。
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// Cassette は記録された通信の一覧です。以前の形式のカセットファイルはこの JSON 全体を1つ保存していました。
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// RecordingTransport は実際の通信を行いながら、その内容をカセットファイルに記録します。
+// 通信ごとに1行の JSON としてファイルへ追記するため、log.Fatal や Ctrl+C で終了してもそれまでの記録は残ります。
+type RecordingTransport struct {
+	base http.RoundTripper
+	path string
+
+	mu       sync.Mutex
+	file     *os.File
+	writeErr error // 最初の書き込みエラー。以降は記録せず Close で返す
+}
+
+// NewRecordingTransport は新しいRecordingTransportを生成します。カセットファイルは最初の記録時に作り直します。
+func NewRecordingTransport(base http.RoundTripper, path string) *RecordingTransport {
+	return &RecordingTransport{
+		base: base,
+		path: path,
+	}
+}
+
+// RoundTrip はリクエストを送信し、認証ヘッダーを伏せた上でリクエストとレスポンスを記録します。
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readAndRestore(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body for recording: %w", err)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readAndRestore(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body for recording: %w", err)
+	}
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: flattenHeaders(req.Header, true),
+			Body:    reqBody,
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    flattenHeaders(resp.Header, false),
+			Body:       respBody,
+		},
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.append(interaction); err != nil && t.writeErr == nil {
+		// 記録に失敗しても通信自体は成功しているため、レスポンスはそのまま返す
+		t.writeErr = err
+		log.Printf("Failed to record HTTP traffic, the cassette will be incomplete: %v", err)
+	}
+	return resp, nil
+}
+
+// append は通信を1行の JSON としてカセットファイルに追記します。呼び出し側で mu を保持します。
+func (t *RecordingTransport) append(i Interaction) error {
+	if t.writeErr != nil {
+		return t.writeErr
+	}
+	if err := t.open(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("failed to marshal interaction: %w", err)
+	}
+	if _, err := t.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %w", t.path, err)
+	}
+	return nil
+}
+
+// open はカセットファイルをまだ開いていなければ、空にして開きます。呼び出し側で mu を保持します。
+func (t *RecordingTransport) open() error {
+	if t.file != nil {
+		return nil
+	}
+	if dir := filepath.Dir(t.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", t.path, err)
+		}
+	}
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create cassette %s: %w", t.path, err)
+	}
+	t.file = f
+	return nil
+}
+
+// Close はカセットファイルを閉じます。通信がなかった場合も空のカセットファイルを作ります。
+// 記録中に書き込みに失敗していた場合はそのエラーを返します。
+func (t *RecordingTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.writeErr != nil {
+		return fmt.Errorf("failed to save cassette: %w", t.writeErr)
+	}
+	if err := t.open(); err != nil {
+		return fmt.Errorf("failed to save cassette: %w", err)
+	}
+	err := t.file.Close()
+	t.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to save cassette: %w", err)
+	}
+	return nil
+}
+
+// ReplayTransport はカセットファイルに記録されたレスポンスをネットワークを使わずに返します。
+// リクエストはメソッド、URL、ボディの内容で照合するため、記録時と順番が変わっても対応するレスポンスを返します。
+// 完全に一致する記録を使い切った場合は、期間などの時刻で変わるクエリパラメータと、clientOid などの実行ごとに
+// 変わる値を除いて照合するため、記録した取引の実行を別の時刻に再生できます。
+// 同じ内容のリクエストは記録された順に再生します。
+type ReplayTransport struct {
+	mu        sync.Mutex
+	responses []RecordedResponse
+	used      []bool
+	exact     map[string][]int // 照合キーごとの記録の添字（記録順）
+	loose     map[string][]int // 時刻や実行ごとに変わる値を除いた照合キーごとの記録の添字
+}
+
+// NewReplayTransport はカセットファイルを読み込み、新しいReplayTransportを生成します。
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	cassette, err := loadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &ReplayTransport{
+		used:  make([]bool, len(cassette.Interactions)),
+		exact: map[string][]int{},
+		loose: map[string][]int{},
+	}
+	for n, i := range cassette.Interactions {
+		u, err := url.Parse(i.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL in cassette %s: %w", path, err)
+		}
+		exact, loose := replayKeys(i.Request.Method, u, i.Request.Body)
+		t.responses = append(t.responses, i.Response)
+		t.exact[exact] = append(t.exact[exact], n)
+		t.loose[loose] = append(t.loose[loose], n)
+	}
+	return t, nil
+}
+
+// loadCassette はカセットファイルを読み込みます。1行に1つの通信を記録した形式と、以前の Cassette 全体の形式の両方を読めます。
+// 記録中に強制終了して最後の行が途中で切れている場合は、その行を除いて読み込みます。
+func loadCassette(path string) (Cassette, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Cassette{}, fmt.Errorf("cassette not found: %s", path)
+	}
+	if err != nil {
+		return Cassette{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var legacy Cassette
+	if err := json.Unmarshal(data, &legacy); err == nil && legacy.Interactions != nil {
+		return legacy, nil
+	}
+
+	var cassette Cassette
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var i Interaction
+		err := dec.Decode(&i)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Printf("Cassette %s ends with a truncated interaction, ignoring it", path)
+			break
+		}
+		if err != nil {
+			return Cassette{}, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+		}
+		cassette.Interactions = append(cassette.Interactions, i)
+	}
+	return cassette, nil
+}
+
+// RoundTrip はリクエストに対応する記録済みレスポンスを返します。記録がない、または使い切った場合はエラーを返します。
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readAndRestore(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body for replay: %w", err)
+	}
+	exact, loose := replayKeys(req.Method, req.URL, body)
+
+	t.mu.Lock()
+	n, ok := t.next(t.exact[exact])
+	if !ok {
+		n, ok = t.next(t.loose[loose])
+	}
+	if !ok {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no recorded interaction left for %s", exact)
+	}
+	t.used[n] = true
+	recorded := t.responses[n]
+	t.mu.Unlock()
+
+	header := http.Header{}
+	for k, v := range recorded.Headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		StatusCode:    recorded.StatusCode,
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// next は候補のうちまだ再生していない最初の記録の添字を返します。
+func (t *ReplayTransport) next(candidates []int) (int, bool) {
+	for _, n := range candidates {
+		if !t.used[n] {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// replayKeys はリクエストの照合キーと、時刻や実行ごとに変わる値を除いた照合キーを返します。
+// クエリパラメータは名前順に並べ、ボディは内容のハッシュで照合します。
+func replayKeys(method string, u *url.URL, body string) (exact, loose string) {
+	query := u.Query()
+	stable := url.Values{}
+	for k, v := range query {
+		if !timeVaryingParams[k] && !perRunFields[k] {
+			stable[k] = v
+		}
+	}
+	origin := method + " " + u.Scheme + "://" + u.Host
+	exact = origin + u.Path + "?" + query.Encode() + bodyKey(body)
+	loose = origin + stablePath(u.Path) + "?" + stable.Encode() + bodyKey(stableBody(body))
+	return exact, loose
+}
+
+// bodyKey はボディの内容のハッシュを照合キーの末尾に付ける形で返します。
+func bodyKey(body string) string {
+	if body == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(body))
+	return " body:" + hex.EncodeToString(sum[:8])
+}
+
+// stablePath は実行ごとに変わるパスの要素を伏せたパスを返します。
+func stablePath(path string) string {
+	for _, prefix := range perRunPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return prefix + "*"
+		}
+	}
+	return path
+}
+
+// stableBody は JSON オブジェクトのボディから実行ごとに変わる項目を除きます。JSON オブジェクトでない場合はそのまま返します。
+// 項目はキーの順に並べ直すため、記録時と項目の順番が違っても同じ内容として照合します。
+func stableBody(body string) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return body
+	}
+	for k := range perRunFields {
+		delete(fields, k)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return string(data)
+}
+
+// readAndRestore はボディを読み取り、後続の処理で再度読めるように差し戻します。
+func readAndRestore(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return "", err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return string(data), nil
+}
+
+func flattenHeaders(h http.Header, scrub bool) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	flat := make(map[string]string, len(h))
+	for k, v := range h {
+		value := strings.Join(v, ", ")
+		if scrub && scrubbedHeaders[http.CanonicalHeaderKey(k)] {
+			value = redacted
+		}
+		flat[k] = value
+	}
+	return flat
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// echoServer はリクエストのクエリとボディをそのまま返すサーバーです。
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, r.Method+" "+r.URL.RawQuery+" "+string(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// send はリクエストを送り、レスポンスのボディを返します。
+func send(t *testing.T, c *http.Client, method, url, body string) string {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("KC-API-KEY", "secret-key")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return string(data)
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	ts := echoServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder := NewRecordingTransport(http.DefaultTransport, path)
+	recording := &http.Client{Transport: recorder}
+	orderA := `{"clientOid":"a","size":1}`
+	orderB := `{"clientOid":"b","size":2}`
+	orderC := `{"clientOid":"XBTUSDTM-1700000000-1","size":3}`
+	klines := ts.URL + "/api/v1/kline/query?symbol=XBTUSDTM&granularity=60&from=1000&to=2000"
+	for _, r := range []struct{ method, url, body string }{
+		{http.MethodPost, ts.URL + "/api/v1/orders", orderA},
+		{http.MethodPost, ts.URL + "/api/v1/orders", orderB},
+		{http.MethodPost, ts.URL + "/api/v1/orders", orderC},
+		{http.MethodGet, ts.URL + "/api/v1/orders/byClientOid?clientOid=XBTUSDTM-1700000000-1", ""},
+		{http.MethodDelete, ts.URL + "/api/v1/orders/client-order/XBTUSDTM-1700000000-1?symbol=XBTUSDTM", ""},
+		{http.MethodGet, klines, ""},
+		{http.MethodGet, ts.URL + "/api/v1/kline/query?symbol=XBTUSDTM&granularity=60&from=3000&to=4000", ""},
+	} {
+		send(t, recording, r.method, r.url, r.body)
+	}
+	// 強制終了に備えて、Close を待たずに通信ごとに書き出している
+	if data, err := os.ReadFile(path); err != nil || strings.Count(string(data), "\n") != 7 {
+		t.Fatalf("cassette before Close has %d lines (%v), want all 7 interactions", strings.Count(string(data), "\n"), err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cassette: %v", err)
+	}
+	if strings.Contains(string(data), "secret-key") {
+		t.Error("cassette contains the API key")
+	}
+
+	replay, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatalf("NewReplayTransport: %v", err)
+	}
+	replaying := &http.Client{Transport: replay}
+
+	// 記録と逆の順番でも、ボディの内容で対応するレスポンスを返す
+	if got := send(t, replaying, http.MethodPost, ts.URL+"/api/v1/orders", orderB); got != "POST  "+orderB {
+		t.Errorf("order b replayed %q", got)
+	}
+	if got := send(t, replaying, http.MethodPost, ts.URL+"/api/v1/orders", orderA); got != "POST  "+orderA {
+		t.Errorf("order a replayed %q", got)
+	}
+	// 取引の開始時刻から作る clientOid は実行ごとに変わるため、それ以外の内容で照合する
+	if got := send(t, replaying, http.MethodPost, ts.URL+"/api/v1/orders", `{"size":3,"clientOid":"XBTUSDTM-1800000000-1"}`); got != "POST  "+orderC {
+		t.Errorf("order c replayed %q", got)
+	}
+	if got := send(t, replaying, http.MethodGet, ts.URL+"/api/v1/orders/byClientOid?clientOid=XBTUSDTM-1800000000-1", ""); got != "GET clientOid=XBTUSDTM-1700000000-1 " {
+		t.Errorf("order c lookup replayed %q", got)
+	}
+	if got := send(t, replaying, http.MethodDelete, ts.URL+"/api/v1/orders/client-order/XBTUSDTM-1800000000-1?symbol=XBTUSDTM", ""); got != "DELETE symbol=XBTUSDTM " {
+		t.Errorf("order c cancel replayed %q", got)
+	}
+	// クエリパラメータの順番が違っても同じリクエストとして照合する
+	got := send(t, replaying, http.MethodGet, ts.URL+"/api/v1/kline/query?to=2000&from=1000&granularity=60&symbol=XBTUSDTM", "")
+	if !strings.Contains(got, "from=1000") {
+		t.Errorf("klines replayed %q, want the from=1000 response", got)
+	}
+	// 期間が記録時と異なる場合は、残っている同じ銘柄・足の長さの記録を返す
+	got = send(t, replaying, http.MethodGet, ts.URL+"/api/v1/kline/query?symbol=XBTUSDTM&granularity=60&from=5000&to=6000", "")
+	if !strings.Contains(got, "from=3000") {
+		t.Errorf("klines replayed %q, want the remaining from=3000 response", got)
+	}
+
+	// 使い切った場合や、内容の異なるリクエストはエラーにする
+	for _, r := range []struct{ method, url, body string }{
+		{http.MethodPost, ts.URL + "/api/v1/orders", orderA},
+		{http.MethodPost, ts.URL + "/api/v1/orders", `{"clientOid":"c","size":1}`},
+		{http.MethodPost, ts.URL + "/api/v1/orders", `{"clientOid":"d","size":4}`},
+		{http.MethodGet, klines, ""},
+	} {
+		req, _ := http.NewRequest(r.method, r.url, strings.NewReader(r.body))
+		if resp, err := replaying.Do(req); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s %s %s: expected an error", r.method, r.url, r.body)
+		}
+	}
+}
+
+func TestReplayKeepsInteractionsBeforeATruncatedLine(t *testing.T) {
+	ts := echoServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder := NewRecordingTransport(http.DefaultTransport, path)
+	recording := &http.Client{Transport: recorder}
+	send(t, recording, http.MethodGet, ts.URL+"/api/v1/timestamp", "")
+	send(t, recording, http.MethodGet, ts.URL+"/api/v1/ticker?symbol=XBTUSDTM", "")
+
+	// Close の前に強制終了し、最後の通信を書いている途中で止まった状態にする
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cassette: %v", err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-10], 0o644); err != nil {
+		t.Fatalf("truncate cassette: %v", err)
+	}
+
+	replay, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatalf("NewReplayTransport: %v", err)
+	}
+	replaying := &http.Client{Transport: replay}
+	if got := send(t, replaying, http.MethodGet, ts.URL+"/api/v1/timestamp", ""); got != "GET  " {
+		t.Errorf("timestamp replayed %q", got)
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/ticker?symbol=XBTUSDTM", nil)
+	if resp, err := replaying.Do(req); err == nil {
+		resp.Body.Close()
+		t.Error("the truncated interaction was replayed")
+	}
+}
+
+func TestReplayReadsLegacyCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	legacy := `{"interactions":[
+		{"request":{"method":"GET","url":"http://kucoin.test/api/v1/timestamp"},"response":{"statusCode":200,"body":"first"}},
+		{"request":{"method":"GET","url":"http://kucoin.test/api/v1/timestamp"},"response":{"statusCode":200,"body":"second"}}
+	]}`
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatalf("write cassette: %v", err)
+	}
+	replay, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatalf("NewReplayTransport: %v", err)
+	}
+	replaying := &http.Client{Transport: replay}
+	for _, want := range []string{"first", "second"} {
+		if got := send(t, replaying, http.MethodGet, "http://kucoin.test/api/v1/timestamp", ""); got != want {
+			t.Errorf("replayed %q, want %q", got, want)
+		}
+	}
+}
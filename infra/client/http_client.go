@@ -20,6 +20,17 @@ func NewHTTPClient() *HTTPClient {
 	}
 }
 
+// NewHTTPClientWithTransport は指定したトランスポートを使うHTTPClientを生成します。
+// 通信の記録・再生などに使用します。
+func NewHTTPClientWithTransport(transport http.RoundTripper) *HTTPClient {
+	return &HTTPClient{
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: transport,
+		},
+	}
+}
+
 // Get はGETリクエストを送信します。
 func (c *HTTPClient) Get(url string, headers map[string]string) ([]byte, error) {
 	req, err := http.NewRequest("GET", url, nil)
@@ -59,3 +70,23 @@ func (c *HTTPClient) Post(url string, headers map[string]string, body io.Reader)
 
 	return io.ReadAll(resp.Body)
 }
+
+// Delete はDELETEリクエストを送信します。
+func (c *HTTPClient) Delete(url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,294 @@
+package client
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RFC 6455 のオペコードです。
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsMaxMessageSize は受信する1メッセージの上限です。板情報のスナップショットより十分大きくしています。
+const wsMaxMessageSize = 16 << 20
+
+// wsGUID は Sec-WebSocket-Accept の計算に使う固定の文字列です。
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrWebSocketClosed は相手が WebSocket の接続を閉じたことを表します。
+var ErrWebSocketClosed = errors.New("websocket closed")
+
+// WebSocketConn は RFC 6455 の WebSocket 接続です。テキストメッセージの送受信だけに対応します。
+// 制御フレームの ping には受信時に自動で pong を返します。
+type WebSocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	masked bool // クライアントから送るフレームはマスクする
+
+	writeMu sync.Mutex
+}
+
+// DialWebSocket は ws:// または wss:// の URL に接続し、WebSocket のハンドシェイクを行います。
+func DialWebSocket(rawURL string, timeout time.Duration) (*WebSocketConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket url: %w", err)
+	}
+	secure := false
+	switch u.Scheme {
+	case "ws", "http":
+	case "wss", "https":
+		secure = true
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme: %s", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", u.Host, err)
+	}
+
+	ws, err := handshake(conn, u, timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// handshake は HTTP の Upgrade リクエストを送り、サーバーが WebSocket に切り替えたことを確認します。
+func handshake(conn net.Conn, u *url.URL, timeout time.Duration) (*WebSocketConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: u.EscapedPath(), RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Host:       u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("failed to send websocket handshake: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read websocket handshake: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != WebSocketAcceptKey(key) {
+		return nil, fmt.Errorf("websocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+	return &WebSocketConn{conn: conn, reader: reader, masked: true}, nil
+}
+
+// WebSocketAcceptKey はハンドシェイクの Sec-WebSocket-Key に対する Sec-WebSocket-Accept を返します。
+func WebSocketAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// NewServerWebSocketConn はハンドシェイクを終えたサーバー側の接続を WebSocketConn にします。
+// テスト用の偽サーバーなどで使用します。
+func NewServerWebSocketConn(conn net.Conn, reader *bufio.Reader) *WebSocketConn {
+	return &WebSocketConn{conn: conn, reader: reader}
+}
+
+// ReadMessage は次のテキストまたはバイナリのメッセージを受信します。分割されたフレームは結合して返します。
+// 相手が接続を閉じた場合は ErrWebSocketClosed を返します。
+func (c *WebSocketConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return nil, ErrWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if started {
+				return nil, fmt.Errorf("websocket protocol error: new message before the previous one finished")
+			}
+			started = true
+			message = payload
+		case wsOpContinuation:
+			if !started {
+				return nil, fmt.Errorf("websocket protocol error: unexpected continuation frame")
+			}
+			if len(message)+len(payload) > wsMaxMessageSize {
+				return nil, fmt.Errorf("websocket message exceeds %d bytes", wsMaxMessageSize)
+			}
+			message = append(message, payload...)
+		default:
+			return nil, fmt.Errorf("websocket protocol error: unknown opcode %d", op)
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame は1つのフレームを受信し、マスクを外したペイロードを返します。
+func (c *WebSocketConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	op = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessageSize {
+		return false, 0, nil, fmt.Errorf("websocket frame exceeds %d bytes", wsMaxMessageSize)
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// WriteText はテキストメッセージを1つのフレームで送信します。
+func (c *WebSocketConn) WriteText(message []byte) error {
+	return c.writeFrame(wsOpText, message)
+}
+
+// writeFrame は1つのフレームを送信します。複数の goroutine から呼び出せます。
+func (c *WebSocketConn) writeFrame(op byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|op)
+	maskBit := byte(0)
+	if c.masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if c.masked {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// SetReadDeadline は ReadMessage がタイムアウトする時刻を設定します。
+func (c *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close は close フレームを送ってから接続を閉じます。
+func (c *WebSocketConn) Close() error {
+	c.writeFrame(wsOpClose, nil)
+	return c.conn.Close()
+}
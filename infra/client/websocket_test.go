@@ -0,0 +1,180 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// newWebSocketPair はメモリ上でつないだクライアント側（マスクする）とサーバー側の WebSocketConn を返します。
+func newWebSocketPair(t *testing.T) (clientConn, serverConn *WebSocketConn) {
+	t.Helper()
+	c, s := net.Pipe()
+	t.Cleanup(func() {
+		c.Close()
+		s.Close()
+	})
+	return &WebSocketConn{conn: c, reader: bufio.NewReader(c), masked: true}, NewServerWebSocketConn(s, bufio.NewReader(s))
+}
+
+// rawFrame はマスクしないフレームを組み立てます。fin が false のフレームは分割されたメッセージの途中です。
+func rawFrame(fin bool, op byte, payload string) []byte {
+	first := op
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(n))
+	}
+	return append(frame, payload...)
+}
+
+// frame は受信したフレームです。
+type frame struct {
+	op      byte
+	payload string
+}
+
+// collectFrames は c が受信したフレームを順に送るチャネルを返します。net.Pipe は読み手がいないと書き込めないため、常に読み続けます。
+func collectFrames(c *WebSocketConn) <-chan frame {
+	frames := make(chan frame, 16)
+	go func() {
+		defer close(frames)
+		for {
+			_, op, payload, err := c.readFrame()
+			if err != nil {
+				return
+			}
+			frames <- frame{op: op, payload: string(payload)}
+		}
+	}()
+	return frames
+}
+
+func TestWebSocketMessageRoundTrip(t *testing.T) {
+	// 長さの表し方が変わる境界（7ビット、16ビット、64ビット）の前後
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		clientConn, serverConn := newWebSocketPair(t)
+		message := bytes.Repeat([]byte("k"), size)
+
+		errs := make(chan error, 1)
+		go func() { errs <- clientConn.WriteText(message) }()
+		got, err := serverConn.ReadMessage()
+		if err != nil || !bytes.Equal(got, message) {
+			t.Fatalf("size %d: server read %d bytes, %v", size, len(got), err)
+		}
+		if err := <-errs; err != nil {
+			t.Fatalf("size %d: client write: %v", size, err)
+		}
+
+		go func() { errs <- serverConn.WriteText(message) }()
+		got, err = clientConn.ReadMessage()
+		if err != nil || !bytes.Equal(got, message) {
+			t.Fatalf("size %d: client read %d bytes, %v", size, len(got), err)
+		}
+		if err := <-errs; err != nil {
+			t.Fatalf("size %d: server write: %v", size, err)
+		}
+	}
+}
+
+func TestWebSocketClientFramesAreMasked(t *testing.T) {
+	clientConn, serverConn := newWebSocketPair(t)
+	raw := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := serverConn.conn.Read(buf)
+		raw <- buf[:n]
+	}()
+	if err := clientConn.WriteText([]byte(`{"type":"ping"}`)); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	data := <-raw
+	if data[0] != 0x80|wsOpText || data[1] != 0x80|15 {
+		t.Errorf("header = % x, want a final masked text frame of 15 bytes", data[:2])
+	}
+	if bytes.Contains(data, []byte("ping")) {
+		t.Errorf("payload sent unmasked: %q", data)
+	}
+}
+
+func TestWebSocketReadsFragmentedMessageWithControlFrames(t *testing.T) {
+	clientConn, serverConn := newWebSocketPair(t)
+	replies := collectFrames(serverConn)
+	go func() {
+		// 分割されたメッセージの途中に ping と pong が挟まる
+		for _, f := range [][]byte{
+			rawFrame(false, wsOpText, `{"type":`),
+			rawFrame(true, wsOpPing, "keepalive"),
+			rawFrame(false, wsOpContinuation, `"message",`),
+			rawFrame(true, wsOpPong, ""),
+			rawFrame(true, wsOpContinuation, `"topic":"/market/ticker"}`),
+		} {
+			serverConn.conn.Write(f)
+		}
+	}()
+
+	got, err := clientConn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if want := `{"type":"message","topic":"/market/ticker"}`; string(got) != want {
+		t.Errorf("ReadMessage = %q, want %q", got, want)
+	}
+	if reply := <-replies; reply.op != wsOpPong || reply.payload != "keepalive" {
+		t.Errorf("reply to ping = %+v, want a pong with the ping's payload", reply)
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	clientConn, serverConn := newWebSocketPair(t)
+	replies := collectFrames(serverConn)
+	go serverConn.conn.Write(rawFrame(true, wsOpClose, ""))
+
+	if _, err := clientConn.ReadMessage(); !errors.Is(err, ErrWebSocketClosed) {
+		t.Fatalf("ReadMessage = %v, want ErrWebSocketClosed", err)
+	}
+	if reply := <-replies; reply.op != wsOpClose {
+		t.Errorf("reply to close = %+v, want a close frame", reply)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	oversized := []byte{0x80 | wsOpText, 127}
+	oversized = binary.BigEndian.AppendUint64(oversized, wsMaxMessageSize+1)
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   string
+	}{
+		{name: "continuation without a message", frames: [][]byte{rawFrame(true, wsOpContinuation, "x")}, want: "unexpected continuation"},
+		{name: "new message before the previous finished", frames: [][]byte{rawFrame(false, wsOpText, "a"), rawFrame(true, wsOpText, "b")}, want: "new message before"},
+		{name: "unknown opcode", frames: [][]byte{rawFrame(true, 0x3, "x")}, want: "unknown opcode"},
+		{name: "oversized frame", frames: [][]byte{oversized}, want: "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, serverConn := newWebSocketPair(t)
+			go func() {
+				for _, f := range tt.frames {
+					if _, err := serverConn.conn.Write(f); err != nil {
+						return
+					}
+				}
+			}()
+			if _, err := clientConn.ReadMessage(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ReadMessage = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
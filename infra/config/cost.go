@@ -0,0 +1,81 @@
+package config
+
+import (
+	"crypto_trade_bot/domain"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadCostModel は環境変数から約定シミュレーション用のコストモデルを組み立てます。
+//
+//	COST_FEE_MODEL     "tiered"（既定）または "fixed"
+//	COST_FEE_BPS       fixed の場合の料率 (bps)
+//	COST_FEE_TIERS     tiered の場合のランク "最低取引量:メイカーbps:テイカーbps" のカンマ区切り
+//	COST_FEE_VOLUME    tiered の場合の30日間取引量 (USDT)
+//	COST_SLIPPAGE_MODEL  "fixed"（既定）または "book"（book の板を消化した平均約定価格。板を取得できない場合は固定スリッページ）
+//	COST_SLIPPAGE_BPS  固定スリッページ (bps)
+//	COST_FUNDING_RATE  8時間ごとの資金調達率（例: 0.0001）
+//	COST_FUNDING_OFFSET_HOURS  UTC の 0 時から最初の精算時刻までの時間（既定は KuCoin先物の4時間）
+func LoadCostModel(book domain.BookSource) domain.CostModel {
+	var fee domain.FeeModel
+	switch GetEnv("COST_FEE_MODEL", "tiered") {
+	case "fixed":
+		fee = domain.FixedBpsFee{Bps: GetEnvFloat("COST_FEE_BPS", 6)}
+	default:
+		fee = domain.TieredFee{
+			Tiers:  parseFeeTiers(GetEnv("COST_FEE_TIERS", "0:2:6")),
+			Volume: GetEnvFloat("COST_FEE_VOLUME", 0),
+		}
+	}
+
+	var slippage domain.SlippageModel = domain.FixedBpsSlippage{Bps: GetEnvFloat("COST_SLIPPAGE_BPS", 5)}
+	switch model := GetEnv("COST_SLIPPAGE_MODEL", "fixed"); model {
+	case "book":
+		if book == nil {
+			log.Printf("COST_SLIPPAGE_MODEL=book needs an order book source; using fixed slippage")
+			break
+		}
+		slippage = domain.BookSlippage{Book: book, Fallback: slippage}
+	case "fixed":
+	default:
+		log.Printf("Unknown COST_SLIPPAGE_MODEL %q; using fixed slippage", model)
+	}
+
+	return domain.CostModel{
+		Fee:      fee,
+		Slippage: slippage,
+		Funding: domain.FixedRateFunding{
+			Rate:     GetEnvFloat("COST_FUNDING_RATE", 0.0001),
+			Interval: 8 * time.Hour,
+			Offset:   time.Duration(GetEnvFloat("COST_FUNDING_OFFSET_HOURS", 4) * float64(time.Hour)),
+		},
+	}
+}
+
+func parseFeeTiers(value string) []domain.FeeTier {
+	var tiers []domain.FeeTier
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 {
+			log.Printf("Invalid fee tier %q, expected volume:maker:taker", entry)
+			continue
+		}
+		var nums [3]float64
+		valid := true
+		for i, p := range parts {
+			n, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				log.Printf("Invalid fee tier %q: %v", entry, err)
+				valid = false
+				break
+			}
+			nums[i] = n
+		}
+		if valid {
+			tiers = append(tiers, domain.FeeTier{MinVolume: nums[0], MakerBps: nums[1], TakerBps: nums[2]})
+		}
+	}
+	return tiers
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -21,3 +22,17 @@ func GetEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// GetEnvFloat は指定されたキーの環境変数を float64 として取得します。
+func GetEnvFloat(key string, fallback float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return f
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"crypto_trade_bot/domain"
+	"log"
+)
+
+// LoadMarginSettings は環境変数から取引の既定のレバレッジと証拠金の方式を読み込みます。
+//
+//	TRADE_LEVERAGE     レバレッジ（既定 1）
+//	TRADE_MARGIN_MODE  "isolated"（既定）または "cross"
+func LoadMarginSettings() domain.MarginSettings {
+	settings := domain.DefaultMarginSettings()
+	settings.Leverage = GetEnvFloat("TRADE_LEVERAGE", settings.Leverage)
+
+	if value := GetEnv("TRADE_MARGIN_MODE", ""); value != "" {
+		mode, err := domain.ParseMarginMode(value)
+		if err != nil {
+			log.Printf("Invalid TRADE_MARGIN_MODE, using %s: %v", settings.Mode, err)
+		} else {
+			settings.Mode = mode
+		}
+	}
+	return settings
+}
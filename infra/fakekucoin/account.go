@@ -0,0 +1,112 @@
+package fakekucoin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 非公開チャネルのトピックです。
+const (
+	tradeOrdersTopic = "/contractMarket/tradeOrders"
+	positionAllTopic = "/contract/positionAll"
+	walletTopic      = "/contractAccount/wallet"
+)
+
+// Liquidate は銘柄の建玉をマーク価格 markPrice で強制決済された状態にし、
+// 板に残っている注文と未発動の逆指値注文を取り消して、建玉の変化を非公開チャネルに送ります。
+func (s *Server) Liquidate(symbol string, markPrice float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.orders {
+		o := s.states[s.orders[i].OrderID]
+		if o.symbol == symbol && (o.active() || o.pendingStop()) {
+			s.cancel(o)
+		}
+	}
+	s.positions[symbol] = 0
+	s.publishPosition(symbol, markPrice, "liquidation")
+}
+
+// PublishBalance は証拠金の残高の変化を /contractAccount/wallet の購読者に送ります。
+func (s *Server) PublishBalance(currency string, available, hold float64) {
+	s.Publish(walletTopic, "availableBalance.change", map[string]interface{}{
+		"availableBalance": available,
+		"holdBalance":      hold,
+		"currency":         currency,
+		"timestamp":        strconv.FormatInt(time.Now().UnixMilli(), 10),
+	})
+}
+
+// cancel は注文を取り消します。板に出ていた注文の場合は取り消しを非公開チャネルに送ります。
+// KuCoin と同じく、未発動の逆指値注文は tradeOrders には流れません。
+func (s *Server) cancel(o *fakeOrder) {
+	onBook := !o.pendingStop()
+	o.canceled = true
+	if onBook {
+		s.publishOrderChange(o, "canceled", 0, 0, "", "")
+	}
+}
+
+// publishFill は約定を注文の変化と建玉の変化として非公開チャネルに送ります。
+func (s *Server) publishFill(o *fakeOrder, size, price float64, liquidity string) {
+	last := o.fills[len(o.fills)-1]
+	s.publishOrderChange(o, "match", size, price, last.tradeID, liquidity)
+	if o.filledSize >= o.size {
+		s.publishOrderChange(o, "filled", 0, 0, "", "")
+	}
+	s.publishPosition(o.symbol, price, "positionChange")
+}
+
+// publishOrderChange は注文の変化を /contractMarket/tradeOrders の購読者に送ります。
+func (s *Server) publishOrderChange(o *fakeOrder, eventType string, matchSize, matchPrice float64, tradeID, liquidity string) {
+	status := "open"
+	if !o.active() {
+		status = "done"
+	}
+	data := map[string]interface{}{
+		"orderId":      o.id,
+		"clientOid":    o.clientOid,
+		"symbol":       o.symbol,
+		"type":         eventType,
+		"status":       status,
+		"orderType":    o.orderType,
+		"side":         o.side,
+		"price":        strconv.FormatFloat(o.price, 'f', -1, 64),
+		"size":         strconv.FormatFloat(o.size, 'f', -1, 64),
+		"filledSize":   strconv.FormatFloat(o.filledSize, 'f', -1, 64),
+		"remainSize":   strconv.FormatFloat(o.size-o.filledSize, 'f', -1, 64),
+		"canceledSize": "0",
+		"orderTime":    o.createdAt.UnixNano(),
+		"ts":           time.Now().UnixNano(),
+	}
+	if o.canceled {
+		data["canceledSize"] = strconv.FormatFloat(o.size-o.filledSize, 'f', -1, 64)
+	}
+	if eventType == "match" {
+		data["matchSize"] = strconv.FormatFloat(matchSize, 'f', -1, 64)
+		data["matchPrice"] = strconv.FormatFloat(matchPrice, 'f', -1, 64)
+		data["tradeId"] = tradeID
+		data["liquidity"] = liquidity
+	}
+	s.Publish(tradeOrdersTopic, "orderChange", data)
+}
+
+// publishPosition は銘柄の建玉の変化を /contract/positionAll の購読者に送ります。
+func (s *Server) publishPosition(symbol string, markPrice float64, reason string) {
+	s.Publish(positionAllTopic, "position.change", map[string]interface{}{
+		"symbol":           symbol,
+		"currentQty":       s.positions[symbol],
+		"avgEntryPrice":    s.entries[symbol],
+		"realLeverage":     1,
+		"crossMode":        false,
+		"markPrice":        markPrice,
+		"changeReason":     reason,
+		"currentTimestamp": time.Now().UnixMilli(),
+	})
+}
+
+// handleBulletPrivate は /api/v1/bullet-private で、非公開チャネルを購読できる WebSocket のトークンを返します。
+func (s *Server) handleBulletPrivate(w http.ResponseWriter, r *http.Request) {
+	s.writeBulletToken(w, r, true)
+}
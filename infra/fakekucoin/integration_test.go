@@ -0,0 +1,373 @@
+package fakekucoin_test
+
+import (
+	"crypto_trade_bot/domain"
+	"crypto_trade_bot/infra/client"
+	"crypto_trade_bot/infra/fakekucoin"
+	"crypto_trade_bot/infra/storage"
+	"crypto_trade_bot/interface/gateway"
+	"crypto_trade_bot/usecase"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testSymbol     = "XBTUSDTM"
+	testKey        = "test-key"
+	testSecret     = "test-secret"
+	testPassphrase = "test-passphrase"
+)
+
+// testEnv は偽サーバーと、それに接続したゲートウェイ・ユースケースの組です。
+type testEnv struct {
+	server  *fakekucoin.Server
+	url     string
+	gateway *gateway.KuCoinGateway
+	trading *usecase.TradingUsecase
+	store   *storage.TradeStateFile
+}
+
+// newTestEnv は偽サーバーを起動し、transport（nil の場合は既定）で接続したゲートウェイとユースケースを返します。
+// 価格は prices の順に進みます。
+func newTestEnv(t *testing.T, transport http.RoundTripper, prices ...float64) *testEnv {
+	t.Helper()
+	t.Setenv("KUCOIN_API_KEY", testKey)
+	t.Setenv("KUCOIN_API_SECRET", testSecret)
+	t.Setenv("KUCOIN_API_PASSPHRASE", testPassphrase)
+
+	server := fakekucoin.NewServer(testKey, testSecret, testPassphrase)
+	server.SetContracts(fakekucoin.Contract{Symbol: testSymbol, QuoteCurrency: "USDT"})
+	server.SetPricePath(testSymbol, prices...)
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	httpClient := client.NewHTTPClient()
+	if transport != nil {
+		httpClient = client.NewHTTPClientWithTransport(transport)
+	}
+	g := gateway.NewKuCoinGateway(httpClient, ts.URL)
+	store := storage.NewTradeStateFile(filepath.Join(t.TempDir(), "trades.json"))
+	trading := usecase.NewTradingUsecase(g, g, nil, domain.DefaultSignalConfig(), store)
+	trading.SetPollInterval(10 * time.Millisecond)
+	return &testEnv{server: server, url: ts.URL, gateway: g, trading: trading, store: store}
+}
+
+// executeTrade は ExecuteTrade を実行し、取引の監視が終わるまで待ちます。
+func (e *testEnv) executeTrade(t *testing.T, amountUSD float64, opts usecase.TradeOptions) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.trading.ExecuteTrade(testSymbol, "buy", amountUSD, true, opts)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("ExecuteTrade did not finish")
+	}
+}
+
+// assertNoTradeState は保存された取引の状態が残っていないことを確認します。
+func (e *testEnv) assertNoTradeState(t *testing.T) {
+	t.Helper()
+	trade, err := e.store.Load(testSymbol)
+	if err != nil {
+		t.Fatalf("Load trade state: %v", err)
+	}
+	if trade != nil {
+		t.Errorf("trade state left behind: %+v", trade)
+	}
+}
+
+// assertFlat は取引所に建玉が残っていないことを確認します。
+func (e *testEnv) assertFlat(t *testing.T) {
+	t.Helper()
+	positions, err := e.gateway.GetPositions()
+	if err != nil {
+		t.Fatalf("GetPositions: %v", err)
+	}
+	if len(positions) != 0 {
+		t.Errorf("positions left open: %+v", positions)
+	}
+}
+
+// roundTripperFunc は関数を http.RoundTripper として使います。
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestExecuteTradeOpensAndTakesProfit(t *testing.T) {
+	env := newTestEnv(t, nil, 100, 100.5, 101.5)
+	env.executeTrade(t, 1000, usecase.TradeOptions{})
+
+	orders := env.server.Orders()
+	if len(orders) != 2 {
+		t.Fatalf("got %d orders, want an entry and a take-profit exit: %+v", len(orders), orders)
+	}
+	entry, exit := orders[0].Body, orders[1].Body
+	if entry["side"] != "buy" || entry["type"] != "market" || entry["size"] != "10" {
+		t.Errorf("entry order = %v, want a market buy of 10 lots", entry)
+	}
+	if exit["side"] != "sell" || exit["size"] != "10" || exit["reduceOnly"] != true {
+		t.Errorf("exit order = %v, want a reduce-only sell of 10 lots", exit)
+	}
+	if entry["clientOid"] == "" || entry["clientOid"] == exit["clientOid"] {
+		t.Errorf("clientOids of entry %v and exit %v must be set and distinct", entry["clientOid"], exit["clientOid"])
+	}
+	env.assertFlat(t)
+	env.assertNoTradeState(t)
+}
+
+func TestUntrackedPositionBlocksNewTrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		lots       float64
+		wantOrders int
+	}{
+		{name: "untracked position", lots: 2, wantOrders: 0},
+		// ロット数が 0 に丸められる端数は建玉として扱わない
+		{name: "sub-lot remainder", lots: 1e-9, wantOrders: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, nil, 100, 100.5, 101.5)
+			env.server.SetPosition(testSymbol, tt.lots, 99)
+			env.executeTrade(t, 1000, usecase.TradeOptions{})
+			if n := len(env.server.Orders()); n != tt.wantOrders {
+				t.Errorf("got %d orders, want %d", n, tt.wantOrders)
+			}
+			env.assertNoTradeState(t)
+		})
+	}
+}
+
+func TestReplayRecordedTrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder := client.NewRecordingTransport(http.DefaultTransport, path)
+	env := newTestEnv(t, recorder, 100, 100.5, 101.5)
+	env.executeTrade(t, 1000, usecase.TradeOptions{})
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// 取引 ID はミリ秒単位の開始時刻から作るため、再生時の clientOid は記録時と異なる
+	time.Sleep(10 * time.Millisecond)
+
+	replay, err := client.NewReplayTransport(path)
+	if err != nil {
+		t.Fatalf("NewReplayTransport: %v", err)
+	}
+	var replayErrs []error
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := replay.RoundTrip(r)
+		if err != nil {
+			replayErrs = append(replayErrs, err)
+		}
+		return resp, err
+	})
+	g := gateway.NewKuCoinGateway(client.NewHTTPClientWithTransport(transport), env.url)
+	store := storage.NewTradeStateFile(filepath.Join(t.TempDir(), "trades.json"))
+	replayed := &testEnv{server: env.server, url: env.url, gateway: g, trading: usecase.NewTradingUsecase(g, g, nil, domain.DefaultSignalConfig(), store), store: store}
+	replayed.trading.SetPollInterval(10 * time.Millisecond)
+	replayed.executeTrade(t, 1000, usecase.TradeOptions{})
+
+	if len(replayErrs) != 0 {
+		t.Errorf("requests missing from the cassette: %v", replayErrs)
+	}
+	if n := len(env.server.Orders()); n != 2 {
+		t.Errorf("replay reached the server: got %d orders, want the 2 recorded", n)
+	}
+	replayed.assertNoTradeState(t)
+}
+
+func TestBadSignatureIsRejected(t *testing.T) {
+	tamper := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if sign := r.Header.Get("KC-API-SIGN"); sign != "" {
+			r.Header.Set("KC-API-SIGN", "x"+sign)
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	env := newTestEnv(t, tamper, 100)
+
+	_, err := env.gateway.CreateOrder(domain.OrderRequest{ClientOID: "bad-sign", Symbol: testSymbol, Side: domain.Buy, Type: domain.OrderTypeMarket, Size: 1})
+	if err == nil || !strings.Contains(err.Error(), "Invalid KC-API-SIGN") {
+		t.Fatalf("CreateOrder error = %v, want Invalid KC-API-SIGN", err)
+	}
+	if !errors.Is(err, domain.ErrRejected) {
+		t.Errorf("errors.Is(err, ErrRejected) = false for %v", err)
+	}
+	// 公開エンドポイントは署名なしで使える
+	if _, err := env.gateway.GetCurrentPrice(testSymbol); err != nil {
+		t.Errorf("GetCurrentPrice: %v", err)
+	}
+
+	env.executeTrade(t, 1000, usecase.TradeOptions{})
+	if orders := env.server.Orders(); len(orders) != 0 {
+		t.Errorf("orders accepted with a bad signature: %+v", orders)
+	}
+	env.assertNoTradeState(t)
+}
+
+func TestRejectedEntryIsNotResubmitted(t *testing.T) {
+	env := newTestEnv(t, nil, 100)
+	env.server.FailNext("/api/v1/orders", http.StatusOK, "300000", "Order quantity exceeds the risk limit")
+
+	env.executeTrade(t, 1000, usecase.TradeOptions{})
+	if orders := env.server.Orders(); len(orders) != 0 {
+		t.Errorf("rejected entry was resubmitted: %+v", orders)
+	}
+	env.assertFlat(t)
+	env.assertNoTradeState(t)
+}
+
+func TestLostEntryResponseIsConfirmedByClientOid(t *testing.T) {
+	env := newTestEnv(t, nil, 100, 100.5, 101.5)
+	env.server.DropNextResponse("/api/v1/orders")
+
+	env.executeTrade(t, 1000, usecase.TradeOptions{})
+	orders := env.server.Orders()
+	if len(orders) != 2 || orders[0].Body["side"] != "buy" || orders[1].Body["side"] != "sell" {
+		t.Fatalf("got orders %+v, want the entry once and its exit", orders)
+	}
+	env.assertFlat(t)
+	env.assertNoTradeState(t)
+}
+
+func TestPartiallyFilledEntryMonitorsFilledSize(t *testing.T) {
+	env := newTestEnv(t, nil, 100, 100.5)
+	go func() {
+		// 指値の建て注文が板に載ったら、10ロットのうち4ロットだけ約定させる
+		for i := 0; i < 200; i++ {
+			if orders := env.server.Orders(); len(orders) > 0 {
+				if err := env.server.FillOrder(orders[0].OrderID, 4, 99); err != nil {
+					t.Errorf("FillOrder: %v", err)
+				}
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Error("entry order was never placed")
+	}()
+
+	env.executeTrade(t, 990, usecase.TradeOptions{EntryLimitPrice: 99, EntryTimeout: 300 * time.Millisecond})
+	orders := env.server.Orders()
+	if len(orders) != 2 {
+		t.Fatalf("got %d orders, want an entry and an exit: %+v", len(orders), orders)
+	}
+	if entry := orders[0].Body; entry["type"] != "limit" || entry["size"] != "10" {
+		t.Errorf("entry order = %v, want a limit order of 10 lots", entry)
+	}
+	if exit := orders[1].Body; exit["side"] != "sell" || exit["size"] != "4" {
+		t.Errorf("exit order = %v, want a sell of the 4 filled lots", exit)
+	}
+	env.assertFlat(t)
+	env.assertNoTradeState(t)
+}
+
+func TestStopMovesToBreakevenAfterFirstTarget(t *testing.T) {
+	// 101.5 で半分を利益確定した後、建値の 100 まで戻ったところで残りを損切りする
+	env := newTestEnv(t, nil, 100, 101.5, 100.5, 99.9)
+	env.executeTrade(t, 1000, usecase.TradeOptions{
+		StopLoss:                  domain.StopLoss{Type: domain.StopLossPercent, Value: 5},
+		TakeProfits:               []domain.TakeProfit{{Type: domain.TakeProfitPercent, Value: 1, SizePct: 50}, {Type: domain.TakeProfitPercent, Value: 3, SizePct: 50}},
+		BreakevenAfterFirstTarget: true,
+	})
+
+	orders := env.server.Orders()
+	if len(orders) != 3 {
+		t.Fatalf("got %d orders, want the entry, the first target and the breakeven stop: %+v", len(orders), orders)
+	}
+	if tp, stop := orders[1].Body, orders[2].Body; tp["size"] != "5" || stop["size"] != "5" {
+		t.Errorf("exit orders = %v and %v, want 5 lots each", tp, stop)
+	}
+	env.assertFlat(t)
+	env.assertNoTradeState(t)
+}
+
+func TestExchangeStopMovesToBreakevenAfterFirstTarget(t *testing.T) {
+	env := newTestEnv(t, nil, 100, 101.5, 101.5, 100.5, 99.9, 99.9)
+	env.executeTrade(t, 1000, usecase.TradeOptions{
+		StopLoss:                  domain.StopLoss{Type: domain.StopLossPercent, Value: 5},
+		TakeProfits:               []domain.TakeProfit{{Type: domain.TakeProfitPercent, Value: 1, SizePct: 50}, {Type: domain.TakeProfitPercent, Value: 3, SizePct: 50}},
+		BreakevenAfterFirstTarget: true,
+		BracketPriceType:          domain.TradePrice,
+	})
+
+	var stops []string
+	for _, o := range env.server.Orders() {
+		if o.Body["stop"] == "down" {
+			stops = append(stops, o.Body["stopPrice"].(string))
+		}
+	}
+	if len(stops) != 2 || stops[0] != "95" || stops[1] != "100" {
+		t.Errorf("exchange stop prices = %v, want 95 then 100", stops)
+	}
+	env.assertFlat(t)
+	env.assertNoTradeState(t)
+}
+
+func TestRestartAfterSavingEntryReusesItsClientOid(t *testing.T) {
+	for _, placed := range []bool{true, false} {
+		env := newTestEnv(t, nil, 100, 100.5, 101.5)
+		// 建て注文の clientOid を保存した後、発注の前後どちらかで停止した状態
+		trade := &domain.ActiveTrade{ID: "XBTUSDTM-restart", Symbol: testSymbol, Side: domain.Buy, Size: 10, Multiplier: 1, OpenedAt: time.Now()}
+		entry := domain.OrderRequest{ClientOID: trade.NextClientOID(), Symbol: testSymbol, Side: domain.Buy, Type: domain.OrderTypeMarket, Size: 10}
+		trade.PendingEntry = &domain.PendingOrder{ClientOID: entry.ClientOID, Label: "Entry", Target: -1, Size: entry.Size}
+		if err := env.store.Save(trade); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if placed {
+			if _, err := env.gateway.CreateOrder(entry); err != nil {
+				t.Fatalf("CreateOrder: %v", err)
+			}
+		}
+
+		env.executeTrade(t, 1000, usecase.TradeOptions{})
+		orders := env.server.Orders()
+		if !placed {
+			// 取引所に届いていなかった建て注文は出し直さず、保存した状態を消すだけにする
+			if len(orders) != 0 {
+				t.Errorf("placed orders %+v after restarting before the entry was sent", orders)
+			}
+			env.assertNoTradeState(t)
+			continue
+		}
+		if len(orders) != 2 || orders[0].Body["clientOid"] != "XBTUSDTM-restart-1" || orders[1].Body["clientOid"] != "XBTUSDTM-restart-2" {
+			t.Fatalf("got orders %+v, want the saved entry once and an exit with the next clientOid", orders)
+		}
+		env.assertFlat(t)
+		env.assertNoTradeState(t)
+	}
+}
+
+func TestLiquidationFromAccountStreamEndsTrade(t *testing.T) {
+	// 価格は利益確定にも損切りにも届かないため、建玉の変化を受信しなければ監視は終わらない
+	env := newTestEnv(t, nil, 100)
+	stream := gateway.NewKuCoinAccountStream(env.gateway)
+	t.Cleanup(stream.Close)
+	env.trading.SetAccountEventStream(stream)
+
+	go func() {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			positions, err := env.gateway.GetPositions()
+			if err == nil && len(positions) == 1 && env.server.SocketSubscribers("/contract/positionAll") == 1 {
+				env.server.Liquidate(testSymbol, 90)
+				return
+			}
+		}
+	}()
+	env.executeTrade(t, 1000, usecase.TradeOptions{})
+
+	if orders := env.server.Orders(); len(orders) != 1 {
+		t.Errorf("got %d orders, want only the entry: %+v", len(orders), orders)
+	}
+	if pos, ok := stream.Position(testSymbol); ok {
+		t.Errorf("stream still holds the liquidated position %+v", pos)
+	}
+	env.assertFlat(t)
+	env.assertNoTradeState(t)
+}
@@ -0,0 +1,48 @@
+package fakekucoin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// fakeBook は /api/v1/level2/snapshot が返す板です。各気配は [価格, 数量] です。
+type fakeBook struct {
+	sequence int64
+	bids     [][2]float64
+	asks     [][2]float64
+}
+
+// SetOrderBook は /api/v1/level2/snapshot が返す板を設定します。bids と asks の各要素は [価格, 数量] です。
+func (s *Server) SetOrderBook(symbol string, sequence int64, bids, asks [][2]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.books[symbol] = fakeBook{sequence: sequence, bids: bids, asks: asks}
+}
+
+// PublishLevel2 は板の差分の更新を /contractMarket/level2 の購読者に送ります。
+// スナップショットには反映しないため、スナップショットとの食い違いや番号の飛びも再現できます。
+func (s *Server) PublishLevel2(symbol string, sequence int64, price float64, side string, size float64) {
+	s.Publish("/contractMarket/level2:"+symbol, "level2", map[string]interface{}{
+		"sequence":  sequence,
+		"change":    strconv.FormatFloat(price, 'f', -1, 64) + "," + side + "," + strconv.FormatFloat(size, 'f', -1, 64),
+		"timestamp": time.Now().UnixMilli(),
+	})
+}
+
+// handleOrderBook は /api/v1/level2/snapshot で設定された板を返します。
+func (s *Server) handleOrderBook(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	book, ok := s.books[symbol]
+	if !ok {
+		writeError(w, http.StatusOK, codeBadRequest, "unknown symbol: "+symbol)
+		return
+	}
+	writeData(w, map[string]interface{}{
+		"symbol":   symbol,
+		"sequence": book.sequence,
+		"bids":     book.bids,
+		"asks":     book.asks,
+		"ts":       time.Now().UnixNano(),
+	})
+}
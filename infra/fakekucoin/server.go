@@ -0,0 +1,904 @@
+package fakekucoin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	codeSuccess           = "200000"
+	codeInvalidKey        = "400003"
+	codeInvalidPassphrase = "400004"
+	codeInvalidSign       = "400005"
+	codeBadRequest        = "400100"
+	codeNotFound          = "404000"
+)
+
+// Contract は偽サーバーが返す先物契約です。
+type Contract struct {
+	Symbol        string
+	Volume24h     float64
+	QuoteCurrency string
+	Status        string  // 省略時は "Open"
+	Multiplier    float64 // 省略時は 1
+	LotSize       float64 // 省略時は 1
+	TickSize      float64 // 省略時は 0.01
+	MaxOrderQty   float64 // 省略時は 1000000
+	MaxLeverage   float64 // 省略時は 100
+}
+
+// withDefaults は省略された項目に既定値を設定します。
+func (c Contract) withDefaults() Contract {
+	if c.Status == "" {
+		c.Status = "Open"
+	}
+	if c.Multiplier == 0 {
+		c.Multiplier = 1
+	}
+	if c.LotSize == 0 {
+		c.LotSize = 1
+	}
+	if c.TickSize == 0 {
+		c.TickSize = 0.01
+	}
+	if c.MaxOrderQty == 0 {
+		c.MaxOrderQty = 1000000
+	}
+	if c.MaxLeverage == 0 {
+		c.MaxLeverage = 100
+	}
+	return c
+}
+
+// Trade は /api/v1/trade/history が返す市場の約定です。Size はロット数です。
+type Trade struct {
+	Price float64
+	Size  float64
+	Side  string
+	Time  time.Time // 省略時は追加した時刻
+}
+
+// ReceivedOrder は偽サーバーが受け付けた注文です。
+type ReceivedOrder struct {
+	OrderID string
+	Body    map[string]interface{}
+}
+
+// fakeOrder は偽サーバーが保持する注文の状態です。
+type fakeOrder struct {
+	id         string
+	clientOid  string
+	symbol     string
+	side       string
+	orderType  string
+	price      float64
+	size       float64
+	filledSize float64
+	canceled   bool
+	postOnly   bool
+	reduceOnly bool
+	closeOrder bool
+	createdAt  time.Time
+	fills      []fakeFill
+
+	// 逆指値注文の場合のみ
+	stop          string
+	stopPriceType string
+	stopPrice     float64
+	stopTriggered bool
+}
+
+// fakeFill は注文の1回の約定です。
+type fakeFill struct {
+	tradeID   string
+	price     float64
+	size      float64
+	liquidity string
+	at        time.Time
+}
+
+const (
+	// 約定時の手数料率
+	takerFeeRate = 0.0006
+	makerFeeRate = 0.0002
+)
+
+// failure は次のリクエストで返すよう予約されたエラーレスポンスです。
+type failure struct {
+	status int
+	code   string
+	msg    string
+}
+
+// Server は KuCoin 先物APIの一部を再現するテスト用の偽サーバーです。
+// httptest.NewServer(server) で起動し、その URL を gateway.NewKuCoinGateway に渡して使います。
+type Server struct {
+	apiKey     string
+	apiSecret  string
+	passphrase string
+
+	mu        sync.Mutex
+	contracts []Contract
+	prices    map[string][]float64
+	priceIdx  map[string]int
+	klines    map[string][][]interface{}
+	orders    []ReceivedOrder
+	states    map[string]*fakeOrder
+	lastPrice map[string]float64
+	positions map[string]float64 // 銘柄ごとの建玉のロット数（ショートは負）
+	entries   map[string]float64 // 銘柄ごとの建玉の平均建値
+	trades    map[string][]Trade
+	books     map[string]fakeBook
+	failures  map[string][]failure
+	drops     map[string]int
+	orderSeq  int
+	tradeSeq  int
+
+	// WebSocket の接続は長く続くため、mu とは別のロックで管理する
+	sockMu       sync.Mutex
+	sockets      map[*socketConn]struct{}
+	tokens       map[string]bool // bullet API で発行したトークンごとの非公開チャネルを購読できるか
+	tokenSeq     int
+	pingInterval time.Duration
+	unresponsive bool
+}
+
+// NewServer は指定した認証情報で署名を検証する偽サーバーを生成します。
+func NewServer(apiKey, apiSecret, passphrase string) *Server {
+	return &Server{
+		apiKey:       apiKey,
+		apiSecret:    apiSecret,
+		passphrase:   passphrase,
+		prices:       map[string][]float64{},
+		priceIdx:     map[string]int{},
+		klines:       map[string][][]interface{}{},
+		states:       map[string]*fakeOrder{},
+		lastPrice:    map[string]float64{},
+		positions:    map[string]float64{},
+		entries:      map[string]float64{},
+		trades:       map[string][]Trade{},
+		books:        map[string]fakeBook{},
+		failures:     map[string][]failure{},
+		drops:        map[string]int{},
+		sockets:      map[*socketConn]struct{}{},
+		tokens:       map[string]bool{},
+		pingInterval: 18 * time.Second,
+	}
+}
+
+// SetContracts は /api/v1/contracts/active が返す契約を設定します。
+func (s *Server) SetContracts(contracts ...Contract) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contracts = make([]Contract, len(contracts))
+	for i, c := range contracts {
+		s.contracts[i] = c.withDefaults()
+	}
+}
+
+// SetPricePath は /api/v1/ticker が返す価格の推移を設定します。
+// 呼び出されるたびに次の価格に進み、最後の価格に達した後はその価格を返し続けます。
+// 未発動の逆指値注文は、この価格が発動価格に達した時点で発動します。
+func (s *Server) SetPricePath(symbol string, prices ...float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[symbol] = prices
+	s.priceIdx[symbol] = 0
+}
+
+// SetKlines は /api/v1/kline/query が返すローソク足を設定します。
+// 各行は KuCoin と同じく [時刻(ms), 始値, 高値, 安値, 終値, 出来高] の数値です。
+func (s *Server) SetKlines(symbol string, granularity int, rows [][]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.klines[klineKey(symbol, granularity)] = rows
+}
+
+// AddTrades は市場の約定を追加します。シーケンス番号は追加した順に振られます。
+func (s *Server) AddTrades(symbol string, trades ...Trade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range trades {
+		if t.Time.IsZero() {
+			t.Time = time.Now()
+		}
+		s.trades[symbol] = append(s.trades[symbol], t)
+	}
+}
+
+// FailNext は指定したパスへの次のリクエストでエラーレスポンスを返すよう予約します。
+func (s *Server) FailNext(path string, status int, code, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], failure{status: status, code: code, msg: msg})
+}
+
+// SetPosition は銘柄の建玉を lots ロット（ショートは負）、平均建値 entryPrice に設定します。
+// ボットの外で建てた建玉がある状況の再現に使います。
+func (s *Server) SetPosition(symbol string, lots, entryPrice float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.positions[symbol] = lots
+	s.entries[symbol] = entryPrice
+}
+
+// DropNextResponse は指定したパスへの次のリクエストを処理した上で、応答の代わりにゲートウェイタイムアウトを返すよう予約します。
+// 注文は受け付けられたのにクライアントには結果が届かない状況の再現に使います。
+func (s *Server) DropNextResponse(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drops[path]++
+}
+
+// Orders はこれまでに受け付けた注文を返します。
+func (s *Server) Orders() []ReceivedOrder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders := make([]ReceivedOrder, len(s.orders))
+	copy(orders, s.orders)
+	return orders
+}
+
+// FillOrder は板に残っている注文を指定した数量・価格でメイカーとして約定させます。
+// 指値注文が部分約定・全量約定する状況の再現に使います。
+func (s *Server) FillOrder(orderID string, size, price float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.states[orderID]
+	if !ok {
+		return fmt.Errorf("unknown order: %s", orderID)
+	}
+	if o.canceled || o.filledSize+size > o.size {
+		return fmt.Errorf("order %s cannot be filled by %v", orderID, size)
+	}
+	s.fill(o, size, price, "maker")
+	return nil
+}
+
+// ServeHTTP はリクエストをエンドポイントごとに処理します。
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == socketPath {
+		s.handleSocket(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "failed to read body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if queue := s.failures[r.URL.Path]; len(queue) > 0 {
+		s.failures[r.URL.Path] = queue[1:]
+		writeError(w, queue[0].status, queue[0].code, queue[0].msg)
+		return
+	}
+
+	if s.drops[r.URL.Path] > 0 {
+		s.drops[r.URL.Path]--
+		s.route(httptest.NewRecorder(), r, body)
+		w.WriteHeader(http.StatusGatewayTimeout)
+		io.WriteString(w, "upstream request timeout")
+		return
+	}
+	s.route(w, r, body)
+}
+
+// route はリクエストをエンドポイントごとのハンドラに振り分けます。
+func (s *Server) route(w http.ResponseWriter, r *http.Request, body []byte) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/contracts/active":
+		s.handleContracts(w)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/bullet-public":
+		s.handleBulletPublic(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/bullet-private":
+		if s.authenticate(w, r, string(body)) {
+			s.handleBulletPrivate(w, r)
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/ticker":
+		s.handleTicker(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/kline/query":
+		s.handleKlines(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/level2/snapshot":
+		s.handleOrderBook(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/trade/history":
+		s.handleTradeHistory(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/orders":
+		if s.authenticate(w, r, string(body)) {
+			s.handleCreateOrder(w, body)
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/orders":
+		if s.authenticate(w, r, string(body)) {
+			s.handleListOrders(w, r)
+		}
+	case r.Method == http.MethodDelete && r.URL.Path == "/api/v1/orders":
+		if s.authenticate(w, r, string(body)) {
+			s.handleCancelAll(w, r)
+		}
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v1/orders/client-order/"):
+		if s.authenticate(w, r, string(body)) {
+			s.handleCancelByClientOid(w, r, strings.TrimPrefix(r.URL.Path, "/api/v1/orders/client-order/"))
+		}
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v1/orders/"):
+		if s.authenticate(w, r, string(body)) {
+			s.handleCancelOrder(w, strings.TrimPrefix(r.URL.Path, "/api/v1/orders/"))
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/orders/byClientOid":
+		if s.authenticate(w, r, string(body)) {
+			s.handleGetOrderByClientOid(w, r)
+		}
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/orders/"):
+		if s.authenticate(w, r, string(body)) {
+			s.handleGetOrder(w, strings.TrimPrefix(r.URL.Path, "/api/v1/orders/"))
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/stopOrders":
+		if s.authenticate(w, r, string(body)) {
+			s.handleListStopOrders(w, r)
+		}
+	case r.Method == http.MethodDelete && r.URL.Path == "/api/v1/stopOrders":
+		if s.authenticate(w, r, string(body)) {
+			s.handleCancelAllStops(w, r)
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/positions":
+		if s.authenticate(w, r, string(body)) {
+			s.handlePositions(w)
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/fills":
+		if s.authenticate(w, r, string(body)) {
+			s.handleFills(w, r)
+		}
+	default:
+		writeError(w, http.StatusNotFound, codeNotFound, "unknown endpoint: "+r.Method+" "+r.URL.Path)
+	}
+}
+
+// authenticate は getAuthHeaders が生成する署名ヘッダーを検証します。
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request, body string) bool {
+	if r.Header.Get("KC-API-KEY") != s.apiKey {
+		writeError(w, http.StatusUnauthorized, codeInvalidKey, "Invalid KC-API-KEY")
+		return false
+	}
+	if r.Header.Get("KC-API-KEY-VERSION") != "2" || r.Header.Get("KC-API-PASSPHRASE") != sign(s.apiSecret, s.passphrase) {
+		writeError(w, http.StatusUnauthorized, codeInvalidPassphrase, "Invalid KC-API-PASSPHRASE")
+		return false
+	}
+	timestamp := r.Header.Get("KC-API-TIMESTAMP")
+	expected := sign(s.apiSecret, timestamp+r.Method+r.URL.RequestURI()+body)
+	if timestamp == "" || !hmac.Equal([]byte(r.Header.Get("KC-API-SIGN")), []byte(expected)) {
+		writeError(w, http.StatusUnauthorized, codeInvalidSign, "Invalid KC-API-SIGN")
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleContracts(w http.ResponseWriter) {
+	data := make([]map[string]interface{}, 0, len(s.contracts))
+	for _, c := range s.contracts {
+		data = append(data, map[string]interface{}{
+			"symbol":        c.Symbol,
+			"volume24h":     c.Volume24h,
+			"isDele":        false,
+			"status":        c.Status,
+			"quoteCurrency": c.QuoteCurrency,
+			"multiplier":    c.Multiplier,
+			"lotSize":       c.LotSize,
+			"tickSize":      c.TickSize,
+			"maxOrderQty":   c.MaxOrderQty,
+			"maxLeverage":   c.MaxLeverage,
+		})
+	}
+	writeData(w, data)
+}
+
+func (s *Server) handleTicker(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	path := s.prices[symbol]
+	if len(path) == 0 {
+		writeError(w, http.StatusOK, codeBadRequest, "unknown symbol: "+symbol)
+		return
+	}
+	idx := s.priceIdx[symbol]
+	if idx < len(path)-1 {
+		s.priceIdx[symbol] = idx + 1
+	}
+	s.lastPrice[symbol] = path[idx]
+	s.triggerStops(symbol, path[idx])
+	writeData(w, map[string]interface{}{"symbol": symbol, "price": path[idx]})
+}
+
+func (s *Server) handleKlines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	granularity, _ := strconv.Atoi(q.Get("granularity"))
+	rows, ok := s.klines[klineKey(q.Get("symbol"), granularity)]
+	if !ok {
+		writeError(w, http.StatusOK, codeBadRequest, "unknown symbol: "+q.Get("symbol"))
+		return
+	}
+
+	from, hasFrom := parseMillis(q.Get("from"))
+	to, hasTo := parseMillis(q.Get("to"))
+	data := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		t := toFloat(row[0])
+		if (hasFrom && t < from) || (hasTo && t > to) {
+			continue
+		}
+		data = append(data, row)
+	}
+	writeData(w, data)
+}
+
+// handleTradeHistory は直近100件の約定を新しい順に返します。
+func (s *Server) handleTradeHistory(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	trades := s.trades[symbol]
+	data := []map[string]interface{}{}
+	for i := len(trades) - 1; i >= 0 && len(data) < 100; i-- {
+		t := trades[i]
+		data = append(data, map[string]interface{}{
+			"sequence": i + 1,
+			"tradeId":  fmt.Sprintf("fake-market-trade-%d", i+1),
+			"price":    strconv.FormatFloat(t.Price, 'f', -1, 64),
+			"size":     t.Size,
+			"side":     t.Side,
+			"ts":       t.Time.UnixNano(),
+		})
+	}
+	writeData(w, data)
+}
+
+func (s *Server) handleCreateOrder(w http.ResponseWriter, body []byte) {
+	var req map[string]interface{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, codeBadRequest, "invalid json body")
+		return
+	}
+	for _, field := range []string{"clientOid", "symbol", "side", "type"} {
+		if v, _ := req[field].(string); v == "" {
+			writeError(w, http.StatusOK, codeBadRequest, field+" is required")
+			return
+		}
+	}
+	if side := req["side"]; side != "buy" && side != "sell" {
+		writeError(w, http.StatusOK, codeBadRequest, fmt.Sprintf("invalid side: %v", side))
+		return
+	}
+	if closeOrder, _ := req["closeOrder"].(bool); !closeOrder && req["size"] == nil {
+		writeError(w, http.StatusOK, codeBadRequest, "size is required unless closeOrder is set")
+		return
+	}
+	if req["type"] == "limit" && req["price"] == nil {
+		writeError(w, http.StatusOK, codeBadRequest, "price is required for limit orders")
+		return
+	}
+	if stop, _ := req["stop"].(string); stop != "" {
+		if stop != "down" && stop != "up" {
+			writeError(w, http.StatusOK, codeBadRequest, fmt.Sprintf("invalid stop: %v", stop))
+			return
+		}
+		if t := req["stopPriceType"]; t != "TP" && t != "MP" && t != "IP" {
+			writeError(w, http.StatusOK, codeBadRequest, fmt.Sprintf("invalid stopPriceType: %v", t))
+			return
+		}
+		if toFloat(req["stopPrice"]) <= 0 {
+			writeError(w, http.StatusOK, codeBadRequest, "stopPrice is required for stop orders")
+			return
+		}
+	}
+	if c, ok := s.contract(req["symbol"].(string)); ok {
+		size := toFloat(req["size"])
+		if lots := size / c.LotSize; req["size"] != nil && (size <= 0 || lots != math.Trunc(lots) || size > c.MaxOrderQty) {
+			writeError(w, http.StatusOK, codeBadRequest, fmt.Sprintf("Quantity invalid: %v", req["size"]))
+			return
+		}
+		if leverage := toFloat(req["leverage"]); leverage > c.MaxLeverage {
+			writeError(w, http.StatusOK, codeBadRequest, fmt.Sprintf("Leverage %v exceeds the maximum %v", req["leverage"], c.MaxLeverage))
+			return
+		}
+	}
+
+	for _, o := range s.states {
+		if o.clientOid == req["clientOid"] {
+			writeError(w, http.StatusOK, codeBadRequest, "The clientOid is duplicated: "+o.clientOid)
+			return
+		}
+	}
+
+	s.orderSeq++
+	orderID := fmt.Sprintf("fake-order-%d", s.orderSeq)
+	s.orders = append(s.orders, ReceivedOrder{OrderID: orderID, Body: req})
+
+	o := &fakeOrder{
+		id:        orderID,
+		clientOid: req["clientOid"].(string),
+		symbol:    req["symbol"].(string),
+		side:      req["side"].(string),
+		orderType: req["type"].(string),
+		price:     toFloat(req["price"]),
+		size:      toFloat(req["size"]),
+		createdAt: time.Now(),
+		stopPrice: toFloat(req["stopPrice"]),
+	}
+	o.reduceOnly, _ = req["reduceOnly"].(bool)
+	o.closeOrder, _ = req["closeOrder"].(bool)
+	o.stop, _ = req["stop"].(string)
+	o.stopPriceType, _ = req["stopPriceType"].(string)
+	o.postOnly, _ = req["postOnly"].(bool)
+	s.states[orderID] = o
+
+	market, ok := s.currentPrice(o.symbol)
+	switch {
+	case o.stop == "":
+		s.execute(o, market, ok)
+	case ok && stopReached(o, market):
+		o.stopTriggered = true
+		s.execute(o, market, ok)
+	}
+	if o.active() {
+		s.publishOrderChange(o, "open", 0, 0, "", "")
+	}
+	writeData(w, map[string]interface{}{"orderId": orderID})
+}
+
+// execute は発注された（または発動した逆指値の）注文を直近の価格 market で処理します。
+// 成行注文と、即時に約定できる指値注文はテイカーとして全量約定させます。
+// reduce-only と closeOrder の注文は建玉を超えて約定せず、減らす建玉がない場合は取り消します。
+func (s *Server) execute(o *fakeOrder, market float64, hasPrice bool) {
+	if o.reduceOnly || o.closeOrder {
+		pos := s.positions[o.symbol]
+		reducible := pos
+		if o.side == "buy" {
+			reducible = -pos
+		}
+		if reducible <= 0 {
+			s.cancel(o)
+			return
+		}
+		if o.closeOrder || o.size > reducible {
+			o.size = reducible
+		}
+	}
+
+	marketable := hasPrice && (o.orderType == "market" ||
+		(o.side == "buy" && o.price >= market) || (o.side == "sell" && o.price <= market))
+	switch {
+	case marketable && o.postOnly:
+		s.cancel(o)
+	case marketable:
+		s.fill(o, o.size, market, "taker")
+	case o.orderType == "market":
+		s.cancel(o)
+	}
+}
+
+// triggerStops は price に達した銘柄の未発動の逆指値注文を発動させます。
+func (s *Server) triggerStops(symbol string, price float64) {
+	for i := range s.orders {
+		o := s.states[s.orders[i].OrderID]
+		if o.symbol == symbol && o.pendingStop() && stopReached(o, price) {
+			o.stopTriggered = true
+			s.execute(o, price, true)
+		}
+	}
+}
+
+// stopReached は price が逆指値注文の発動価格に達したかを返します。
+func stopReached(o *fakeOrder, price float64) bool {
+	if o.stop == "down" {
+		return price <= o.stopPrice
+	}
+	return price >= o.stopPrice
+}
+
+func (s *Server) handleGetOrder(w http.ResponseWriter, orderID string) {
+	o, ok := s.states[orderID]
+	if !ok {
+		writeError(w, http.StatusNotFound, codeNotFound, "order not exist: "+orderID)
+		return
+	}
+	writeData(w, o.toJSON())
+}
+
+// handleGetOrderByClientOid は KuCoin と同じく、存在しない clientOid には data を null で返します。
+func (s *Server) handleGetOrderByClientOid(w http.ResponseWriter, r *http.Request) {
+	clientOid := r.URL.Query().Get("clientOid")
+	for _, o := range s.states {
+		if o.clientOid == clientOid {
+			writeData(w, o.toJSON())
+			return
+		}
+	}
+	writeData(w, nil)
+}
+
+func (s *Server) handleListOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	items := []map[string]interface{}{}
+	for i := range s.orders {
+		o := s.states[s.orders[i].OrderID]
+		if q.Get("status") == "active" && !o.active() {
+			continue
+		}
+		if symbol := q.Get("symbol"); symbol != "" && o.symbol != symbol {
+			continue
+		}
+		items = append(items, o.toJSON())
+	}
+	writeData(w, map[string]interface{}{
+		"currentPage": 1,
+		"pageSize":    len(items),
+		"totalNum":    len(items),
+		"totalPage":   1,
+		"items":       items,
+	})
+}
+
+func (s *Server) handleListStopOrders(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	items := []map[string]interface{}{}
+	for i := range s.orders {
+		o := s.states[s.orders[i].OrderID]
+		if o.pendingStop() && (symbol == "" || o.symbol == symbol) {
+			items = append(items, o.toJSON())
+		}
+	}
+	writeData(w, map[string]interface{}{
+		"currentPage": 1,
+		"pageSize":    len(items),
+		"totalNum":    len(items),
+		"totalPage":   1,
+		"items":       items,
+	})
+}
+
+func (s *Server) handleCancelAllStops(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	ids := []string{}
+	for i := range s.orders {
+		o := s.states[s.orders[i].OrderID]
+		if o.symbol == symbol && o.pendingStop() {
+			s.cancel(o)
+			ids = append(ids, o.id)
+		}
+	}
+	writeData(w, map[string]interface{}{"cancelledOrderIds": ids})
+}
+
+func (s *Server) handleCancelOrder(w http.ResponseWriter, orderID string) {
+	o, ok := s.states[orderID]
+	if !ok || !(o.active() || o.pendingStop()) {
+		writeError(w, http.StatusOK, codeBadRequest, "order cannot be canceled: "+orderID)
+		return
+	}
+	s.cancel(o)
+	writeData(w, map[string]interface{}{"cancelledOrderIds": []string{orderID}})
+}
+
+func (s *Server) handleCancelByClientOid(w http.ResponseWriter, r *http.Request, clientOid string) {
+	symbol := r.URL.Query().Get("symbol")
+	for _, o := range s.states {
+		if o.clientOid == clientOid && o.symbol == symbol && o.active() {
+			s.cancel(o)
+			writeData(w, map[string]interface{}{"clientOid": clientOid})
+			return
+		}
+	}
+	writeError(w, http.StatusOK, codeBadRequest, "order cannot be canceled: "+clientOid)
+}
+
+func (s *Server) handleCancelAll(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	ids := []string{}
+	for i := range s.orders {
+		o := s.states[s.orders[i].OrderID]
+		if o.symbol == symbol && o.active() {
+			s.cancel(o)
+			ids = append(ids, o.id)
+		}
+	}
+	writeData(w, map[string]interface{}{"cancelledOrderIds": ids})
+}
+
+// active は注文が板に残っているかを返します。未発動の逆指値注文は板に出ていません。
+func (o *fakeOrder) active() bool {
+	return !o.canceled && !o.pendingStop() && o.filledSize < o.size
+}
+
+// pendingStop は未発動の逆指値注文かを返します。
+func (o *fakeOrder) pendingStop() bool {
+	return o.stop != "" && !o.stopTriggered && !o.canceled
+}
+
+// toJSON は /api/v1/orders 系のエンドポイントが返す注文の形式に変換します。
+func (o *fakeOrder) toJSON() map[string]interface{} {
+	status := "open"
+	if !o.active() && !o.pendingStop() {
+		status = "done"
+	}
+	data := map[string]interface{}{
+		"id":          o.id,
+		"clientOid":   o.clientOid,
+		"symbol":      o.symbol,
+		"type":        o.orderType,
+		"side":        o.side,
+		"price":       strconv.FormatFloat(o.price, 'f', -1, 64),
+		"size":        o.size,
+		"filledSize":  o.filledSize,
+		"isActive":    o.active(),
+		"cancelExist": o.canceled,
+		"status":      status,
+		"reduceOnly":  o.reduceOnly,
+		"closeOrder":  o.closeOrder,
+		"createdAt":   o.createdAt.UnixMilli(),
+	}
+	if o.stop != "" {
+		data["stop"] = o.stop
+		data["stopPriceType"] = o.stopPriceType
+		data["stopPrice"] = strconv.FormatFloat(o.stopPrice, 'f', -1, 64)
+		data["stopTriggered"] = o.stopTriggered
+	}
+	return data
+}
+
+func (s *Server) handlePositions(w http.ResponseWriter) {
+	items := []map[string]interface{}{}
+	for symbol, lots := range s.positions {
+		if lots == 0 {
+			continue
+		}
+		items = append(items, map[string]interface{}{
+			"symbol":        symbol,
+			"currentQty":    lots,
+			"avgEntryPrice": s.entries[symbol],
+			"realLeverage":  1,
+			"isOpen":        true,
+			"crossMode":     false,
+			"marginMode":    "ISOLATED",
+		})
+	}
+	writeData(w, items)
+}
+
+func (s *Server) handleFills(w http.ResponseWriter, r *http.Request) {
+	orderID := r.URL.Query().Get("orderId")
+	items := []map[string]interface{}{}
+	if o, ok := s.states[orderID]; ok {
+		for _, f := range o.fills {
+			rate := takerFeeRate
+			if f.liquidity == "maker" {
+				rate = makerFeeRate
+			}
+			items = append(items, map[string]interface{}{
+				"tradeId":   f.tradeID,
+				"orderId":   o.id,
+				"symbol":    o.symbol,
+				"side":      o.side,
+				"liquidity": f.liquidity,
+				"price":     strconv.FormatFloat(f.price, 'f', -1, 64),
+				"size":      f.size,
+				"fee":       strconv.FormatFloat(f.price*f.size*s.multiplier(o.symbol)*rate, 'f', -1, 64),
+				"tradeTime": f.at.UnixNano(),
+			})
+		}
+	}
+	writeData(w, map[string]interface{}{
+		"currentPage": 1,
+		"pageSize":    len(items),
+		"totalNum":    len(items),
+		"totalPage":   1,
+		"items":       items,
+	})
+}
+
+// contract は登録された契約を返します。
+func (s *Server) contract(symbol string) (Contract, bool) {
+	for _, c := range s.contracts {
+		if c.Symbol == symbol {
+			return c, true
+		}
+	}
+	return Contract{}, false
+}
+
+// multiplier は契約の乗数を返します。契約が登録されていない場合は 1 です。
+func (s *Server) multiplier(symbol string) float64 {
+	if c, ok := s.contract(symbol); ok {
+		return c.Multiplier
+	}
+	return 1
+}
+
+// currentPrice は直近に /api/v1/ticker が返した価格を返します。まだ返していない場合は価格推移の最初の価格です。
+func (s *Server) currentPrice(symbol string) (float64, bool) {
+	if p, ok := s.lastPrice[symbol]; ok {
+		return p, true
+	}
+	if path := s.prices[symbol]; len(path) > 0 {
+		return path[0], true
+	}
+	return 0, false
+}
+
+// fill は注文に約定を追加します。
+func (s *Server) fill(o *fakeOrder, size, price float64, liquidity string) {
+	s.tradeSeq++
+	o.filledSize += size
+	before := s.positions[o.symbol]
+	delta := size
+	if o.side == "sell" {
+		delta = -size
+	}
+	after := before + delta
+	switch {
+	case before == 0 || before*after < 0:
+		s.entries[o.symbol] = price
+	case math.Abs(after) > math.Abs(before):
+		s.entries[o.symbol] = (s.entries[o.symbol]*math.Abs(before) + price*size) / math.Abs(after)
+	}
+	s.positions[o.symbol] = after
+	o.fills = append(o.fills, fakeFill{
+		tradeID:   fmt.Sprintf("fake-trade-%d", s.tradeSeq),
+		price:     price,
+		size:      size,
+		liquidity: liquidity,
+		at:        time.Now(),
+	})
+	s.publishFill(o, size, price, liquidity)
+}
+
+func sign(secret, message string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(message))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func klineKey(symbol string, granularity int) string {
+	return fmt.Sprintf("%s:%d", symbol, granularity)
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+func parseMillis(value string) (float64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	return n, err == nil
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": codeSuccess, "data": data})
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "msg": msg})
+}
@@ -0,0 +1,261 @@
+package fakekucoin
+
+import (
+	"crypto_trade_bot/infra/client"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// socketPath は偽サーバーの WebSocket のエンドポイントです。
+const socketPath = "/socket"
+
+// socketConn は偽サーバーに接続中の WebSocket クライアントです。
+type socketConn struct {
+	conn    *client.WebSocketConn
+	token   string
+	private bool
+	mu      sync.Mutex
+	topics  map[string]bool
+}
+
+// subscribed はトピックを購読しているかを返します。
+func (c *socketConn) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.topics[topic]
+}
+
+// SetSocketPingInterval は bullet API が返す ping の間隔を設定します。再接続のテストで短くするのに使います。
+func (s *Server) SetSocketPingInterval(d time.Duration) {
+	s.sockMu.Lock()
+	defer s.sockMu.Unlock()
+	s.pingInterval = d
+}
+
+// SetSocketUnresponsive は接続中の WebSocket クライアントの ping に pong を返さないようにします。
+// 応答しなくなった接続をクライアントが検出して再接続することの再現に使います。
+func (s *Server) SetSocketUnresponsive(unresponsive bool) {
+	s.sockMu.Lock()
+	defer s.sockMu.Unlock()
+	s.unresponsive = unresponsive
+}
+
+// Publish はトピックを購読している全ての WebSocket クライアントにメッセージを送ります。
+func (s *Server) Publish(topic, subject string, data interface{}) {
+	body, _ := json.Marshal(map[string]interface{}{"type": "message", "topic": topic, "subject": subject, "data": data})
+	for _, c := range s.socketConns() {
+		if c.subscribed(topic) {
+			c.conn.WriteText(body)
+		}
+	}
+}
+
+// PublishTicker は最終約定価格の更新を /contractMarket/ticker の購読者に送ります。KuCoin と同じく価格は文字列です。
+func (s *Server) PublishTicker(symbol string, price float64) {
+	s.Publish("/contractMarket/ticker:"+symbol, "ticker", map[string]interface{}{
+		"symbol":       symbol,
+		"side":         "buy",
+		"price":        strconv.FormatFloat(price, 'f', -1, 64),
+		"size":         1,
+		"bestBidPrice": strconv.FormatFloat(price, 'f', -1, 64),
+		"bestAskPrice": strconv.FormatFloat(price, 'f', -1, 64),
+		"ts":           time.Now().UnixNano(),
+	})
+}
+
+// PublishMarkPrice はマーク価格の更新を /contract/instrument の購読者に送ります。
+func (s *Server) PublishMarkPrice(symbol string, markPrice, indexPrice float64) {
+	s.Publish("/contract/instrument:"+symbol, "mark.index.price", map[string]interface{}{
+		"granularity": 1000,
+		"markPrice":   markPrice,
+		"indexPrice":  indexPrice,
+		"timestamp":   time.Now().UnixMilli(),
+	})
+}
+
+// PublishCandle は1分足の更新を /contractMarket/limitCandle の購読者に送ります。
+// KuCoin と同じく candles は [開始時刻(秒), 始値, 終値, 高値, 安値, 出来高, 売買代金] の文字列です。
+func (s *Server) PublishCandle(symbol string, start time.Time, open, closePrice, high, low, volume float64) {
+	values := []float64{float64(start.Unix()), open, closePrice, high, low, volume, closePrice * volume}
+	candles := make([]string, len(values))
+	for i, v := range values {
+		candles[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	s.Publish("/contractMarket/limitCandle:"+symbol+"_1min", "candle.stick", map[string]interface{}{
+		"symbol":  symbol,
+		"candles": candles,
+		"time":    time.Now().UnixMilli(),
+	})
+}
+
+// SocketSubscribers はトピックを購読している WebSocket クライアントの数を返します。
+func (s *Server) SocketSubscribers(topic string) int {
+	n := 0
+	for _, c := range s.socketConns() {
+		if c.subscribed(topic) {
+			n++
+		}
+	}
+	return n
+}
+
+// SocketTokens は接続中の WebSocket クライアントが接続に使った bullet のトークンを返します。
+func (s *Server) SocketTokens() []string {
+	var tokens []string
+	for _, c := range s.socketConns() {
+		tokens = append(tokens, c.token)
+	}
+	return tokens
+}
+
+// DisconnectSockets は接続中の全ての WebSocket クライアントを切断します。再接続の再現に使います。
+// トークンの期限切れで切断された場合と同じく、接続に使ったトークンは無効にするため、再接続には bullet API で新しいトークンが必要です。
+func (s *Server) DisconnectSockets() {
+	for _, c := range s.socketConns() {
+		s.sockMu.Lock()
+		delete(s.tokens, c.token)
+		s.sockMu.Unlock()
+		c.conn.Close()
+	}
+}
+
+// socketConns は接続中の WebSocket クライアントの一覧を返します。
+func (s *Server) socketConns() []*socketConn {
+	s.sockMu.Lock()
+	defer s.sockMu.Unlock()
+	conns := make([]*socketConn, 0, len(s.sockets))
+	for c := range s.sockets {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// handleBulletPublic は /api/v1/bullet-public で、この偽サーバーの WebSocket に接続するトークンを返します。
+func (s *Server) handleBulletPublic(w http.ResponseWriter, r *http.Request) {
+	s.writeBulletToken(w, r, false)
+}
+
+// writeBulletToken は WebSocket に接続する新しいトークンと接続先を返します。
+// private のトークンで接続した場合だけ非公開チャネルを購読できます。
+func (s *Server) writeBulletToken(w http.ResponseWriter, r *http.Request, private bool) {
+	s.sockMu.Lock()
+	s.tokenSeq++
+	kind := "public"
+	if private {
+		kind = "private"
+	}
+	token := fmt.Sprintf("fake-%s-token-%d", kind, s.tokenSeq)
+	s.tokens[token] = private
+	pingInterval := s.pingInterval
+	s.sockMu.Unlock()
+	writeData(w, map[string]interface{}{
+		"token": token,
+		"instanceServers": []map[string]interface{}{{
+			"endpoint":     "ws://" + r.Host + socketPath,
+			"encrypt":      false,
+			"protocol":     "websocket",
+			"pingInterval": pingInterval.Milliseconds(),
+			"pingTimeout":  pingInterval.Milliseconds(),
+		}},
+	})
+}
+
+// handleSocket は WebSocket のハンドシェイクを行い、welcome を送ってから購読と ping を処理します。
+func (s *Server) handleSocket(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	s.sockMu.Lock()
+	private, ok := s.tokens[token]
+	s.sockMu.Unlock()
+	if !ok || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		writeError(w, http.StatusUnauthorized, codeInvalidKey, "invalid websocket request")
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, codeBadRequest, "websocket is not supported")
+		return
+	}
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + client.WebSocketAcceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return
+	}
+
+	c := &socketConn{
+		conn:    client.NewServerWebSocketConn(netConn, rw.Reader),
+		token:   token,
+		private: private,
+		topics:  map[string]bool{},
+	}
+	s.sockMu.Lock()
+	s.sockets[c] = struct{}{}
+	s.sockMu.Unlock()
+	defer func() {
+		s.sockMu.Lock()
+		delete(s.sockets, c)
+		s.sockMu.Unlock()
+		c.conn.Close()
+	}()
+
+	welcome, _ := json.Marshal(map[string]string{"id": r.URL.Query().Get("connectId"), "type": "welcome"})
+	if err := c.conn.WriteText(welcome); err != nil {
+		return
+	}
+	for {
+		body, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg struct {
+			ID             string `json:"id"`
+			Type           string `json:"type"`
+			Topic          string `json:"topic"`
+			PrivateChannel bool   `json:"privateChannel"`
+			Response       bool   `json:"response"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case "ping":
+			s.sockMu.Lock()
+			unresponsive := s.unresponsive
+			s.sockMu.Unlock()
+			if unresponsive {
+				continue
+			}
+			reply, _ := json.Marshal(map[string]string{"id": msg.ID, "type": "pong"})
+			c.conn.WriteText(reply)
+		case "subscribe", "unsubscribe":
+			if msg.PrivateChannel && !c.private {
+				reply, _ := json.Marshal(map[string]interface{}{"id": msg.ID, "type": "error", "code": 401, "data": "token is not authorized for private channels"})
+				c.conn.WriteText(reply)
+				continue
+			}
+			c.mu.Lock()
+			if prefix, symbols, ok := strings.Cut(msg.Topic, ":"); ok {
+				// "/topic:A,B" のように複数の銘柄をまとめた購読は銘柄ごとのトピックに分ける
+				for _, symbol := range strings.Split(symbols, ",") {
+					c.topics[prefix+":"+symbol] = msg.Type == "subscribe"
+				}
+			} else {
+				c.topics[msg.Topic] = msg.Type == "subscribe"
+			}
+			c.mu.Unlock()
+			if msg.Response {
+				reply, _ := json.Marshal(map[string]string{"id": msg.ID, "type": "ack"})
+				c.conn.WriteText(reply)
+			}
+		}
+	}
+}
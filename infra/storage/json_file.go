@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// JSONFile は構造体をJSONファイルとして保存・読み込みするためのストアです。
+type JSONFile struct {
+	path string
+}
+
+// NewJSONFile は新しいJSONFileを生成します。
+func NewJSONFile(path string) *JSONFile {
+	return &JSONFile{path: path}
+}
+
+// Load はファイルの内容を v に読み込みます。ファイルが存在しない場合は false を返します。
+func (f *JSONFile) Load(v interface{}) (bool, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", f.path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to unmarshal %s: %w", f.path, err)
+	}
+	return true, nil
+}
+
+// Save は v をJSONとして書き込みます。途中で失敗しても既存ファイルを壊さないよう一時ファイル経由で置き換えます。
+func (f *JSONFile) Save(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", f.path, err)
+	}
+	if dir := filepath.Dir(f.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", f.path, err)
+		}
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", f.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"crypto_trade_bot/domain"
+	"sort"
+	"sync"
+)
+
+// TradeStateFile は監視中の取引の状態を銘柄ごとにJSONファイルへ保存するストアです。
+type TradeStateFile struct {
+	file *JSONFile
+	mu   sync.Mutex
+}
+
+// NewTradeStateFile は新しいTradeStateFileを生成します。
+func NewTradeStateFile(path string) *TradeStateFile {
+	return &TradeStateFile{file: NewJSONFile(path)}
+}
+
+// Load は指定された銘柄の取引状態を返します。保存されていない場合は nil を返します。
+func (s *TradeStateFile) Load(symbol string) (*domain.ActiveTrade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	trade, ok := trades[symbol]
+	if !ok {
+		return nil, nil
+	}
+	return &trade, nil
+}
+
+// List は保存されている全ての取引状態を銘柄順に返します。
+func (s *TradeStateFile) List() ([]domain.ActiveTrade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]domain.ActiveTrade, 0, len(trades))
+	for _, t := range trades {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Symbol < list[j].Symbol })
+	return list, nil
+}
+
+// Save は取引状態を保存します。同じ銘柄の状態は上書きされます。
+func (s *TradeStateFile) Save(trade *domain.ActiveTrade) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.load()
+	if err != nil {
+		return err
+	}
+	trades[trade.Symbol] = *trade
+	return s.file.Save(trades)
+}
+
+// Delete は指定された銘柄の取引状態を削除します。
+func (s *TradeStateFile) Delete(symbol string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(trades, symbol)
+	return s.file.Save(trades)
+}
+
+func (s *TradeStateFile) load() (map[string]domain.ActiveTrade, error) {
+	trades := map[string]domain.ActiveTrade{}
+	if _, err := s.file.Load(&trades); err != nil {
+		return nil, err
+	}
+	return trades, nil
+}
@@ -1,20 +1,70 @@
 package controller
 
+import (
+	"crypto_trade_bot/domain"
+	"crypto_trade_bot/usecase"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
 // TradingUsecase は分析ユースケースのインターフェースです。
 type TradingUsecase interface {
 	AnalyzeTrends()
-	ExecuteTrade(symbol, side string, amountUSD float64, execute bool)
+	ExecuteTrade(symbol, side string, amountUSD float64, execute bool, opts usecase.TradeOptions)
+	ReconcilePositions(opts usecase.TradeOptions) ([]domain.PositionReconciliation, error)
+	ResumeTrades(results []domain.PositionReconciliation, exclude string)
+}
+
+// BacktestUsecase はバックテストユースケースのインターフェースです。
+type BacktestUsecase interface {
+	RunBacktest(symbols []string, granularity int, amountUSD, initialCapital float64) ([]domain.BacktestResult, error)
+}
+
+// DownloadUsecase は過去データのダウンロードユースケースのインターフェースです。
+type DownloadUsecase interface {
+	DownloadKlines(symbol string, granularity int, from, to time.Time) error
+}
+
+// OptimizeUsecase はパラメータ最適化ユースケースのインターフェースです。
+type OptimizeUsecase interface {
+	Optimize(symbols []string, granularity int, opts usecase.OptimizeOptions) ([]domain.OptimizationResult, error)
+}
+
+// ReportUsecase はパフォーマンスレポート作成ユースケースのインターフェースです。
+type ReportUsecase interface {
+	GenerateReport(name string, orders []domain.Order, initialCapital, funding float64, equityCurve []domain.EquityPoint) (domain.PerformanceReport, error)
+}
+
+// OrderUsecase は注文の一覧表示・取消ユースケースのインターフェースです。
+type OrderUsecase interface {
+	ListOpenOrders(symbol string) ([]domain.Order, error)
+	CancelOrder(orderID string) error
+	CancelOrderByClientOID(symbol, clientOID string) error
+	CancelAllOrders(symbols []string) ([]string, error)
 }
 
 // CLIController はCLIからの入力を処理します。
 type CLIController struct {
-	usecase TradingUsecase
+	usecase         TradingUsecase
+	backtestUsecase BacktestUsecase
+	downloadUsecase DownloadUsecase
+	optimizeUsecase OptimizeUsecase
+	reportUsecase   ReportUsecase
+	orderUsecase    OrderUsecase
 }
 
 // NewCLIController は新しいCLIControllerを生成します。
-func NewCLIController(usecase TradingUsecase) *CLIController {
+func NewCLIController(usecase TradingUsecase, backtestUsecase BacktestUsecase, downloadUsecase DownloadUsecase, optimizeUsecase OptimizeUsecase, reportUsecase ReportUsecase, orderUsecase OrderUsecase) *CLIController {
 	return &CLIController{
-		usecase: usecase,
+		usecase:         usecase,
+		backtestUsecase: backtestUsecase,
+		downloadUsecase: downloadUsecase,
+		optimizeUsecase: optimizeUsecase,
+		reportUsecase:   reportUsecase,
+		orderUsecase:    orderUsecase,
 	}
 }
 
@@ -24,6 +74,220 @@ func (c *CLIController) RunAnalysis() {
 }
 
 // RunTrade は取引処理を開始します。
-func (c *CLIController) RunTrade(symbol, side string, amountUSD float64, execute bool) {
-	c.usecase.ExecuteTrade(symbol, side, amountUSD, execute)
+// 実際に発注する場合は、先に取引所の建玉と保存した取引を突き合わせて結果を表示し、
+// 他の銘柄で建玉が確認できた取引の監視も並行して再開します。突き合わせができなかった場合は取引しません。
+func (c *CLIController) RunTrade(symbol, side string, amountUSD float64, execute bool, opts usecase.TradeOptions) {
+	if !execute {
+		c.usecase.ExecuteTrade(symbol, side, amountUSD, execute, opts)
+		return
+	}
+	results, err := c.usecase.ReconcilePositions(opts)
+	if err != nil {
+		log.Printf("Refusing to trade: failed to reconcile positions with the exchange: %v", err)
+		return
+	}
+	printReconciliation(results)
+
+	resumed := make(chan struct{})
+	go func() {
+		defer close(resumed)
+		c.usecase.ResumeTrades(results, symbol)
+	}()
+	c.usecase.ExecuteTrade(symbol, side, amountUSD, execute, opts)
+	<-resumed
+}
+
+// RunReconcile は取引所の建玉と保存した取引を突き合わせて結果を表示します。
+// monitor が true の場合は、建玉が確認できた取引の監視を再開して全て決済されるまで待ちます。
+func (c *CLIController) RunReconcile(monitor bool, opts usecase.TradeOptions) {
+	results, err := c.usecase.ReconcilePositions(opts)
+	if err != nil {
+		log.Printf("Reconciliation failed: %v", err)
+		return
+	}
+	printReconciliation(results)
+	if monitor {
+		c.usecase.ResumeTrades(results, "")
+	}
+}
+
+// printReconciliation は建玉の突き合わせ結果を表示します。食い違いには内容と行った対応を添えます。
+func printReconciliation(results []domain.PositionReconciliation) {
+	discrepancies := 0
+	for _, r := range results {
+		if r.Discrepancy() {
+			discrepancies++
+		}
+	}
+	fmt.Printf("\n--- Position Reconciliation (%d symbols, %d discrepancies) ---\n", len(results), discrepancies)
+	if len(results) == 0 {
+		return
+	}
+	fmt.Printf("%-12s %-14s %-24s %-24s %s\n", "Symbol", "Status", "Exchange", "Local", "Action")
+	for _, r := range results {
+		exchange, local := "-", "-"
+		if p := r.Position; p != nil {
+			exchange = fmt.Sprintf("%s %v @ %.4f", p.Side, p.Lots, p.EntryPrice)
+		}
+		if t := r.Trade; t != nil {
+			local = fmt.Sprintf("%s %v @ %.4f", t.Side, t.RemainingSize, t.EntryPrice)
+		}
+		action := r.Action
+		if action == "" && r.Discrepancy() {
+			action = "none (report only)"
+		}
+		fmt.Printf("%-12s %-14s %-24s %-24s %s\n", r.Symbol, r.Status, exchange, local, action)
+	}
+}
+
+// RunBacktest はバックテストを実行し、銘柄ごとの取引一覧と資産推移を表示します。
+// writeReport が true の場合は銘柄ごとのパフォーマンスレポートも出力します。
+func (c *CLIController) RunBacktest(symbols []string, granularity int, amountUSD, initialCapital float64, writeReport bool) {
+	results, err := c.backtestUsecase.RunBacktest(symbols, granularity, amountUSD, initialCapital)
+	if err != nil {
+		log.Printf("Backtest failed: %v", err)
+		return
+	}
+
+	for _, result := range results {
+		fmt.Printf("\n--- Backtest: %s (%d trades) ---\n", result.Symbol, len(result.Trades))
+		for _, t := range result.Trades {
+			status := "closed"
+			if t.IsOpen {
+				status = "open"
+			}
+			fmt.Printf("%s %-4s entry=%.4f @ %s exit=%.4f @ %s gross=%.4f costs=%.4f net=%.4f (%.2f%%) [%s]\n",
+				t.Symbol, t.Side, t.EntryPrice, t.EntryTime.Format("2006-01-02 15:04"),
+				t.ExitPrice, t.ExitTime.Format("2006-01-02 15:04"), t.GrossPnL, t.Costs(), t.PnL, t.ReturnRate(), status)
+		}
+		fmt.Printf("PnL: gross %.4f, net %.4f (costs incl. slippage %.4f)\n", result.GrossPnL(), result.NetPnL(), result.GrossPnL()-result.NetPnL())
+		fmt.Printf("Equity: %.2f -> %.2f (%d points)\n", result.InitialCapital, result.FinalEquity(), len(result.EquityCurve))
+		fmt.Println("--------------------------")
+
+		if writeReport {
+			c.RunReport("backtest_"+result.Symbol, usecase.TradesToOrders(result.Trades), result.InitialCapital, 0, result.EquityCurve)
+		}
+	}
+}
+
+// RunReport はパフォーマンスレポートを出力し、主要な指標を表示します。
+// funding は注文の手数料に含まれていない資金調達コストの合計です。
+func (c *CLIController) RunReport(name string, orders []domain.Order, initialCapital, funding float64, equityCurve []domain.EquityPoint) {
+	report, err := c.reportUsecase.GenerateReport(name, orders, initialCapital, funding, equityCurve)
+	if err != nil {
+		log.Printf("Report failed: %v", err)
+		return
+	}
+	fmt.Printf("Report %s: return %.2f%%, CAGR %.2f%%, Sharpe %.2f, Sortino %.2f, MaxDD %.2f%%, win rate %.2f%%, PF %.2f\n",
+		report.Name, report.TotalReturn, report.CAGR, report.Sharpe, report.Sortino, report.MaxDrawdown, report.WinRate, report.ProfitFactor)
+}
+
+// RunDownload は指定された銘柄の過去のローソク足をダウンロードしてキャッシュに保存します。
+func (c *CLIController) RunDownload(symbols []string, granularity int, from, to time.Time) {
+	for _, symbol := range symbols {
+		if err := c.downloadUsecase.DownloadKlines(symbol, granularity, from, to); err != nil {
+			log.Printf("Download failed for %s: %v", symbol, err)
+		}
+	}
+}
+
+// RunListOrders は板に残っている注文を一覧表示します。symbols が空の場合は全銘柄が対象です。
+func (c *CLIController) RunListOrders(symbols []string) {
+	if len(symbols) == 0 {
+		symbols = []string{""}
+	}
+	var orders []domain.Order
+	for _, symbol := range symbols {
+		found, err := c.orderUsecase.ListOpenOrders(symbol)
+		if err != nil {
+			log.Printf("Failed to list open orders: %v", err)
+			return
+		}
+		orders = append(orders, found...)
+	}
+
+	fmt.Printf("\n--- Open Orders (%d) ---\n", len(orders))
+	if len(orders) == 0 {
+		return
+	}
+	fmt.Printf("%-24s %-24s %-12s %-5s %-7s %14s %14s %14s %-17s %s\n",
+		"Order ID", "Client OID", "Symbol", "Side", "Type", "Price", "Size", "Filled", "Status", "Created")
+	for _, o := range orders {
+		fmt.Printf("%-24s %-24s %-12s %-5s %-7s %14.4f %14f %14f %-17s %s\n",
+			o.ID, o.ClientOID, o.Symbol, o.Side, o.Type, o.Price, o.Amount, o.FilledSize, o.Status, o.CreatedAt.Format(time.RFC3339))
+	}
+}
+
+// RunCancelOrder は注文IDまたは clientOid を指定して注文を取り消します。clientOid の場合は symbol が必要です。
+func (c *CLIController) RunCancelOrder(orderID, symbol, clientOID string) {
+	var err error
+	if clientOID != "" {
+		err = c.orderUsecase.CancelOrderByClientOID(symbol, clientOID)
+	} else {
+		err = c.orderUsecase.CancelOrder(orderID)
+	}
+	if err != nil {
+		log.Printf("Cancel failed: %v", err)
+	}
+}
+
+// RunCancelAll は指定された銘柄の板に残っている注文を全て取り消します。
+func (c *CLIController) RunCancelAll(symbols []string) {
+	canceled, err := c.orderUsecase.CancelAllOrders(symbols)
+	if err != nil {
+		log.Printf("Cancel all failed: %v", err)
+	}
+	fmt.Printf("\n--- Canceled Orders (%d) ---\n", len(canceled))
+	for _, id := range canceled {
+		fmt.Println(id)
+	}
+}
+
+// RunOptimize はパラメータ最適化を実行し、順位表と分析に使える設定のJSONを出力します。
+// configOut が指定されている場合は設定をファイルにも書き出します。
+func (c *CLIController) RunOptimize(symbols []string, granularity int, opts usecase.OptimizeOptions, configOut string) {
+	results, err := c.optimizeUsecase.Optimize(symbols, granularity, opts)
+	if err != nil {
+		log.Printf("Optimization failed: %v", err)
+		return
+	}
+
+	signalConfig := domain.DefaultSignalConfig()
+	signalConfig.Symbols = map[string]domain.SignalParams{}
+	for _, result := range results {
+		fmt.Printf("\n--- Optimization: %s ---\n", result.Symbol)
+		fmt.Printf("%4s  %-32s %10s %10s %7s\n", "Rank", "Params", "WF Return", "IS Return", "Trades")
+		for i, score := range result.Ranking {
+			if i >= 10 {
+				break
+			}
+			fmt.Printf("%4d  %-32s %9.2f%% %9.2f%% %7d\n", i+1, score.Params, score.OutSampleReturn, score.InSampleReturn, score.Trades)
+		}
+
+		fmt.Println("Walk-forward windows:")
+		for _, w := range result.Windows {
+			fmt.Printf("  test %s - %s  %-32s train %.2f%% / test %.2f%%\n",
+				w.TestStart.Format("2006-01-02"), w.TestEnd.Format("2006-01-02"), w.Params, w.TrainReturn, w.TestReturn)
+		}
+
+		if best, ok := result.Best(); ok {
+			signalConfig.Symbols[result.Symbol] = best
+		}
+	}
+
+	snippet, err := json.MarshalIndent(signalConfig, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal signal config: %v", err)
+		return
+	}
+	fmt.Println("\n--- Signal config (use with -signal-config) ---")
+	fmt.Println(string(snippet))
+
+	if configOut != "" {
+		if err := os.WriteFile(configOut, snippet, 0o644); err != nil {
+			log.Printf("Failed to write signal config: %v", err)
+			return
+		}
+		log.Printf("Signal config written to %s", configOut)
+	}
 }
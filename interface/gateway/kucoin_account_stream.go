@@ -0,0 +1,272 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 非公開チャネルのトピックです。
+const (
+	tradeOrdersTopic = "/contractMarket/tradeOrders"
+	positionAllTopic = "/contract/positionAll"
+	walletTopic      = "/contractAccount/wallet"
+)
+
+// accountSubscriberBuffer は購読者ごとに溜めておくイベントの数です。
+// 溢れたイベントは捨てるため、購読者は REST での確認と組み合わせて使います。
+const accountSubscriberBuffer = 256
+
+// KuCoinAccountStream は KuCoin 先物の非公開 WebSocket で自分の注文・建玉・残高の変化を受信し、
+// 最新の状態を手元に保持して、任意の数の購読者にイベントとして配信します。
+// 切断中に起きた変化は受信できないため、再接続した後も REST で取得した状態を正とします。
+type KuCoinAccountStream struct {
+	gateway *KuCoinGateway
+	socket  *kucoinSocket
+	start   sync.Once
+
+	mu          sync.Mutex
+	orders      map[string]domain.Order
+	positions   map[string]domain.Position
+	balances    map[string]domain.BalanceEvent
+	subscribers map[chan domain.AccountEvent]struct{}
+}
+
+// NewKuCoinAccountStream は g の認証情報で非公開 WebSocket に接続する KuCoinAccountStream を生成します。
+// 接続は最初に購読したときに開始します。
+func NewKuCoinAccountStream(g *KuCoinGateway) *KuCoinAccountStream {
+	a := &KuCoinAccountStream{
+		gateway:     g,
+		orders:      map[string]domain.Order{},
+		positions:   map[string]domain.Position{},
+		balances:    map[string]domain.BalanceEvent{},
+		subscribers: map[chan domain.AccountEvent]struct{}{},
+	}
+	a.socket = newKucoinSocket("Account", g.getPrivateBulletToken, a.handle)
+	a.socket.private = true
+	return a
+}
+
+// SubscribeAccountEvents は口座の変化を受け取るチャネルと、購読をやめる関数を返します。
+// 受信が追いつかずにバッファが溢れた場合、そのイベントは捨てられます。購読をやめるとチャネルは閉じられます。
+func (a *KuCoinAccountStream) SubscribeAccountEvents() (<-chan domain.AccountEvent, func()) {
+	ch := make(chan domain.AccountEvent, accountSubscriberBuffer)
+	a.mu.Lock()
+	a.subscribers[ch] = struct{}{}
+	a.mu.Unlock()
+
+	a.start.Do(func() {
+		a.socket.subscribe(tradeOrdersTopic)
+		a.socket.subscribe(positionAllTopic)
+		a.socket.subscribe(walletTopic)
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			a.mu.Lock()
+			delete(a.subscribers, ch)
+			close(ch)
+			a.mu.Unlock()
+		})
+	}
+}
+
+// Order はストリームで最後に受信した注文の状態を返します。
+func (a *KuCoinAccountStream) Order(orderID string) (domain.Order, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	o, ok := a.orders[orderID]
+	return o, ok
+}
+
+// Position はストリームで最後に受信した建玉を返します。受信していない銘柄や建玉がなくなった銘柄は ok が false です。
+func (a *KuCoinAccountStream) Position(symbol string) (domain.Position, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.positions[symbol]
+	return p, ok
+}
+
+// Balance はストリームで最後に受信した通貨の残高を返します。
+func (a *KuCoinAccountStream) Balance(currency string) (domain.BalanceEvent, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.balances[currency]
+	return b, ok
+}
+
+// Connected は WebSocket に接続しているかを返します。
+func (a *KuCoinAccountStream) Connected() bool {
+	return a.socket.Connected()
+}
+
+// Close は WebSocket の接続を閉じます。
+func (a *KuCoinAccountStream) Close() {
+	a.socket.Close()
+}
+
+// handle は受信したメッセージをイベントにして手元の状態に反映し、購読者に配信します。
+func (a *KuCoinAccountStream) handle(msg socketMessage) {
+	var event domain.AccountEvent
+	var err error
+	switch {
+	case msg.Topic == tradeOrdersTopic && msg.Subject == "orderChange":
+		event.Order, err = parseOrderEvent(msg.Data)
+	case (msg.Topic == positionAllTopic || strings.HasPrefix(msg.Topic, "/contract/position:")) && msg.Subject == "position.change":
+		event.Position, err = a.parsePositionEvent(msg.Data)
+	case msg.Topic == walletTopic && (msg.Subject == "availableBalance.change" || msg.Subject == "walletBalance.change"):
+		event.Balance, err = parseBalanceEvent(msg.Data)
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("Ignoring malformed %s message: %v", msg.Subject, err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case event.Order != nil:
+		a.orders[event.Order.Order.ID] = event.Order.Order
+	case event.Position != nil:
+		if event.Position.Closed() {
+			delete(a.positions, event.Position.Position.Symbol)
+		} else {
+			a.positions[event.Position.Position.Symbol] = event.Position.Position
+		}
+	case event.Balance != nil:
+		a.balances[event.Balance.Currency] = *event.Balance
+	}
+	for ch := range a.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Account event subscriber is not keeping up; dropping an event")
+		}
+	}
+}
+
+// parseOrderEvent は orderChange のメッセージを読み取ります。
+func parseOrderEvent(data json.RawMessage) (*domain.OrderEvent, error) {
+	var o struct {
+		OrderID    string    `json:"orderId"`
+		ClientOid  string    `json:"clientOid"`
+		Symbol     string    `json:"symbol"`
+		Type       string    `json:"type"`
+		Status     string    `json:"status"`
+		OrderType  string    `json:"orderType"`
+		Side       string    `json:"side"`
+		Price      flexFloat `json:"price"`
+		Size       flexFloat `json:"size"`
+		FilledSize flexFloat `json:"filledSize"`
+		MatchSize  flexFloat `json:"matchSize"`
+		MatchPrice flexFloat `json:"matchPrice"`
+		TradeID    string    `json:"tradeId"`
+		Liquidity  string    `json:"liquidity"`
+		OrderTime  int64     `json:"orderTime"` // ナノ秒
+		Ts         int64     `json:"ts"`        // ナノ秒
+	}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, err
+	}
+
+	size, filled := float64(o.Size), float64(o.FilledSize)
+	status := domain.OrderStatusNew
+	switch {
+	case o.Type == "canceled" || (o.Status == "done" && filled < size):
+		status = domain.OrderStatusCanceled
+	case o.Type == "filled" || o.Status == "done":
+		status = domain.OrderStatusFilled
+	case filled > 0:
+		status = domain.OrderStatusPartiallyFilled
+	}
+	return &domain.OrderEvent{
+		Type: domain.OrderEventType(o.Type),
+		Order: domain.Order{
+			ID:         o.OrderID,
+			ClientOID:  o.ClientOid,
+			Symbol:     o.Symbol,
+			Side:       domain.OrderSide(o.Side),
+			Type:       domain.OrderType(o.OrderType),
+			Price:      float64(o.Price),
+			Amount:     size,
+			FilledSize: filled,
+			Status:     status,
+			CreatedAt:  time.Unix(0, o.OrderTime),
+		},
+		MatchSize:  float64(o.MatchSize),
+		MatchPrice: float64(o.MatchPrice),
+		TradeID:    o.TradeID,
+		Liquidity:  o.Liquidity,
+		Time:       time.Unix(0, o.Ts),
+	}, nil
+}
+
+// parsePositionEvent は position.change のメッセージを読み取ります。
+// Size は契約の乗数を掛けた原資産数量で、契約の仕様を取得できない場合は 0 のままにします。
+func (a *KuCoinAccountStream) parsePositionEvent(data json.RawMessage) (*domain.PositionEvent, error) {
+	var p struct {
+		Symbol           string    `json:"symbol"`
+		CurrentQty       flexFloat `json:"currentQty"`
+		AvgEntryPrice    flexFloat `json:"avgEntryPrice"`
+		RealLeverage     flexFloat `json:"realLeverage"`
+		CrossMode        bool      `json:"crossMode"`
+		MarkPrice        flexFloat `json:"markPrice"`
+		ChangeReason     string    `json:"changeReason"`
+		CurrentTimestamp int64     `json:"currentTimestamp"` // ミリ秒
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+
+	qty := float64(p.CurrentQty)
+	pos := domain.Position{
+		Symbol:     p.Symbol,
+		Side:       domain.Buy,
+		Lots:       qty,
+		EntryPrice: float64(p.AvgEntryPrice),
+		Leverage:   float64(p.RealLeverage),
+		MarginMode: domain.IsolatedMargin,
+	}
+	if qty < 0 {
+		pos.Side, pos.Lots = domain.Sell, -qty
+	}
+	if spec, err := a.gateway.GetContract(p.Symbol); err == nil {
+		pos.Size = pos.Lots * spec.Multiplier
+	} else {
+		log.Printf("Could not get contract for position update of %s: %v", p.Symbol, err)
+	}
+	if p.CrossMode {
+		pos.MarginMode = domain.CrossMargin
+	}
+	return &domain.PositionEvent{
+		Position:  pos,
+		MarkPrice: float64(p.MarkPrice),
+		Reason:    p.ChangeReason,
+		Time:      time.UnixMilli(p.CurrentTimestamp),
+	}, nil
+}
+
+// parseBalanceEvent は残高の変化のメッセージを読み取ります。
+func parseBalanceEvent(data json.RawMessage) (*domain.BalanceEvent, error) {
+	var b struct {
+		Currency         string    `json:"currency"`
+		AvailableBalance flexFloat `json:"availableBalance"`
+		HoldBalance      flexFloat `json:"holdBalance"`
+		Timestamp        flexFloat `json:"timestamp"` // ミリ秒。文字列で送られることがある
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	return &domain.BalanceEvent{
+		Currency:  b.Currency,
+		Available: float64(b.AvailableBalance),
+		Hold:      float64(b.HoldBalance),
+		Time:      time.UnixMilli(int64(b.Timestamp)),
+	}, nil
+}
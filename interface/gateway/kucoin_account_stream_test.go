@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"crypto_trade_bot/infra/fakekucoin"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// newTestAccountStream は受信したイベントを返すチャネルを購読者に加えた KuCoinAccountStream を返します。
+// WebSocket には接続せず、handle に渡したメッセージだけを処理します。
+func newTestAccountStream(t *testing.T) (*KuCoinAccountStream, chan domain.AccountEvent) {
+	t.Helper()
+	server, g := newFakeKuCoin(t)
+	server.SetContracts(
+		fakekucoin.Contract{Symbol: "XBTUSDTM", QuoteCurrency: "USDT", Multiplier: 0.001},
+		fakekucoin.Contract{Symbol: "ETHUSDTM", QuoteCurrency: "USDT", Multiplier: 0.01},
+	)
+	a := NewKuCoinAccountStream(g)
+	events := make(chan domain.AccountEvent, accountSubscriberBuffer)
+	a.subscribers[events] = struct{}{}
+	return a, events
+}
+
+// handleFixture は testdata に記録した KuCoin のメッセージを a に渡し、配信されたイベントを返します。
+func handleFixture(t *testing.T, a *KuCoinAccountStream, events <-chan domain.AccountEvent, name string) domain.AccountEvent {
+	t.Helper()
+	var msg socketMessage
+	if err := json.Unmarshal(readFixture(t, name), &msg); err != nil {
+		t.Fatalf("unmarshal %s: %v", name, err)
+	}
+	a.handle(msg)
+	select {
+	case ev := <-events:
+		return ev
+	default:
+		t.Fatalf("%s was not delivered as an event", name)
+		return domain.AccountEvent{}
+	}
+}
+
+func TestAccountStreamDecodesOrderChanges(t *testing.T) {
+	a, events := newTestAccountStream(t)
+	const orderID = "5cdfc138b21023a909e5ad55"
+	tests := []struct {
+		fixture    string
+		wantType   domain.OrderEventType
+		wantStatus domain.OrderStatus
+		wantFilled float64
+		wantMatch  float64
+	}{
+		{fixture: "account_order_open.json", wantType: domain.OrderEventOpen, wantStatus: domain.OrderStatusNew},
+		{fixture: "account_order_match.json", wantType: domain.OrderEventMatch, wantStatus: domain.OrderStatusPartiallyFilled, wantFilled: 15, wantMatch: 15},
+		// 一部約定した後に取り消された注文は取消として扱う
+		{fixture: "account_order_canceled.json", wantType: domain.OrderEventCanceled, wantStatus: domain.OrderStatusCanceled, wantFilled: 15},
+	}
+	for _, tt := range tests {
+		ev := handleFixture(t, a, events, tt.fixture)
+		if ev.Order == nil {
+			t.Fatalf("%s: got %+v, want an order event", tt.fixture, ev)
+		}
+		o := ev.Order
+		if o.Type != tt.wantType || o.Order.Status != tt.wantStatus || o.Order.FilledSize != tt.wantFilled || o.MatchSize != tt.wantMatch {
+			t.Errorf("%s: type %s, status %s, filled %v, match %v; want %s, %s, %v, %v",
+				tt.fixture, o.Type, o.Order.Status, o.Order.FilledSize, o.MatchSize, tt.wantType, tt.wantStatus, tt.wantFilled, tt.wantMatch)
+		}
+		if o.Order.ID != orderID || o.Order.ClientOID != "XBTUSDTM-lq8k2f0w-1" || o.Order.Symbol != "XBTUSDTM" || o.Order.Side != domain.Buy || o.Order.Amount != 20 || o.Order.Price != 35000.5 {
+			t.Errorf("%s: order = %+v", tt.fixture, o.Order)
+		}
+		// 手元の注文の状態は最後に受信したものになる
+		if got, ok := a.Order(orderID); !ok || got.Status != tt.wantStatus {
+			t.Errorf("%s: Order(%s) = %+v, %v", tt.fixture, orderID, got, ok)
+		}
+	}
+
+	ev := handleFixture(t, a, events, "account_order_match.json")
+	if ev.Order.MatchPrice != 35000.5 || ev.Order.TradeID != "5ce24c16b210233c36eexxxx" || ev.Order.Liquidity != "maker" {
+		t.Errorf("match details = %+v", ev.Order)
+	}
+	if !ev.Order.Time.Equal(time.Unix(0, 1700000001987654321)) || !ev.Order.Order.CreatedAt.Equal(time.Unix(0, 1700000000123456789)) {
+		t.Errorf("times = %s, created %s", ev.Order.Time, ev.Order.Order.CreatedAt)
+	}
+
+	ev = handleFixture(t, a, events, "account_order_filled.json")
+	if ev.Order.Order.Status != domain.OrderStatusFilled || ev.Order.Order.Type != domain.OrderTypeMarket || ev.Order.Order.Side != domain.Sell {
+		t.Errorf("filled market order = %+v", ev.Order.Order)
+	}
+}
+
+func TestAccountStreamDecodesPositionChanges(t *testing.T) {
+	a, events := newTestAccountStream(t)
+
+	ev := handleFixture(t, a, events, "account_position_change.json")
+	if ev.Position == nil {
+		t.Fatalf("got %+v, want a position event", ev)
+	}
+	want := domain.Position{Symbol: "XBTUSDTM", Side: domain.Buy, Lots: 15, Size: 0.015, EntryPrice: 35000.5, Leverage: 10, MarginMode: domain.IsolatedMargin}
+	if got := ev.Position.Position; !positionsEqual(got, want) {
+		t.Errorf("position = %+v, want %+v", got, want)
+	}
+	if ev.Position.MarkPrice != 34980.5 || ev.Position.Reason != "positionChange" || ev.Position.Closed() || ev.Position.Liquidated() {
+		t.Errorf("position event = %+v", ev.Position)
+	}
+	if got, ok := a.Position("XBTUSDTM"); !ok || got.Lots != 15 {
+		t.Errorf("Position(XBTUSDTM) = %+v, %v", got, ok)
+	}
+
+	// 銘柄ごとのトピックで、数値が文字列で送られるショートの建玉
+	ev = handleFixture(t, a, events, "account_position_short.json")
+	want = domain.Position{Symbol: "ETHUSDTM", Side: domain.Sell, Lots: 7, Size: 0.07, EntryPrice: 2000.25, Leverage: 3.2, MarginMode: domain.CrossMargin}
+	if got := ev.Position.Position; !positionsEqual(got, want) {
+		t.Errorf("short position = %+v, want %+v", got, want)
+	}
+
+	// 強制決済で建玉がなくなると、手元の建玉からも取り除く
+	ev = handleFixture(t, a, events, "account_position_liquidation.json")
+	if !ev.Position.Closed() || !ev.Position.Liquidated() || ev.Position.MarkPrice != 33105 {
+		t.Errorf("liquidation event = %+v", ev.Position)
+	}
+	if !ev.Position.Time.Equal(time.UnixMilli(1700000300000)) {
+		t.Errorf("liquidation time = %s", ev.Position.Time)
+	}
+	if got, ok := a.Position("XBTUSDTM"); ok {
+		t.Errorf("Position(XBTUSDTM) after liquidation = %+v", got)
+	}
+	if _, ok := a.Position("ETHUSDTM"); !ok {
+		t.Error("liquidation of XBTUSDTM removed the ETHUSDTM position")
+	}
+}
+
+func TestAccountStreamDecodesBalanceChanges(t *testing.T) {
+	a, events := newTestAccountStream(t)
+	ev := handleFixture(t, a, events, "account_wallet.json")
+	want := domain.BalanceEvent{Currency: "USDT", Available: 5923, Hold: 2312, Time: time.UnixMilli(1700000002011)}
+	if ev.Balance == nil || ev.Balance.Currency != want.Currency || ev.Balance.Available != want.Available || ev.Balance.Hold != want.Hold || !ev.Balance.Time.Equal(want.Time) {
+		t.Errorf("balance event = %+v, want %+v", ev.Balance, want)
+	}
+	if got, ok := a.Balance("USDT"); !ok || got.Available != 5923 {
+		t.Errorf("Balance(USDT) = %+v, %v", got, ok)
+	}
+}
+
+// positionsEqual は建玉の時刻以外の項目を比べます。Size は乗数を掛けた値のため誤差を許容します。
+func positionsEqual(got, want domain.Position) bool {
+	diff := got.Size - want.Size
+	return got.Symbol == want.Symbol && got.Side == want.Side && got.Lots == want.Lots && diff < 1e-12 && diff > -1e-12 &&
+		got.EntryPrice == want.EntryPrice && got.Leverage == want.Leverage && got.MarginMode == want.MarginMode
+}
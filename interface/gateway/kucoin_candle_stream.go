@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// candleSubscriberBuffer は購読者ごとに溜めておく足の更新の数です。溢れた場合は古い更新から捨てます。
+const candleSubscriberBuffer = 64
+
+// candleTopic は銘柄の1分足の更新のトピックです。
+func candleTopic(symbol string) string { return "/contractMarket/limitCandle:" + symbol + "_1min" }
+
+// KuCoinCandleStream は KuCoin 先物の公開 WebSocket で1分足の更新を受信し、銘柄ごとに任意の数の購読者へ配信します。
+// 足が確定するまでは、同じ開始時刻の足が値を変えながら繰り返し届きます。
+type KuCoinCandleStream struct {
+	socket *kucoinSocket
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan domain.Candle]struct{} // 銘柄ごとの購読者
+}
+
+// NewKuCoinCandleStream は g の接続先の公開 WebSocket を使う KuCoinCandleStream を生成します。
+// 接続は最初に購読したときに開始します。
+func NewKuCoinCandleStream(g *KuCoinGateway) *KuCoinCandleStream {
+	c := &KuCoinCandleStream{subscribers: map[string]map[chan domain.Candle]struct{}{}}
+	c.socket = newKucoinSocket("Candle", g.getPublicBulletToken, c.handle)
+	return c
+}
+
+// SubscribeCandles は銘柄の1分足の更新を受け取るチャネルと、購読をやめる関数を返します。
+// 受信が追いつかない場合は古い更新を捨てます。購読をやめるとチャネルは閉じられます。
+func (c *KuCoinCandleStream) SubscribeCandles(symbol string) (<-chan domain.Candle, func()) {
+	ch := make(chan domain.Candle, candleSubscriberBuffer)
+	c.mu.Lock()
+	if c.subscribers[symbol] == nil {
+		c.subscribers[symbol] = map[chan domain.Candle]struct{}{}
+	}
+	c.subscribers[symbol][ch] = struct{}{}
+	c.mu.Unlock()
+
+	c.socket.subscribe(candleTopic(symbol))
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			c.mu.Lock()
+			delete(c.subscribers[symbol], ch)
+			if len(c.subscribers[symbol]) == 0 {
+				delete(c.subscribers, symbol)
+			}
+			close(ch)
+			c.mu.Unlock()
+
+			c.socket.unsubscribe(candleTopic(symbol))
+		})
+	}
+	return ch, cancel
+}
+
+// Close は WebSocket の接続を閉じます。購読者のチャネルは閉じないため、各購読者が購読をやめてください。
+func (c *KuCoinCandleStream) Close() {
+	c.socket.Close()
+}
+
+// handle は受信した足の更新を、その銘柄の購読者に配信します。
+func (c *KuCoinCandleStream) handle(msg socketMessage) {
+	if !strings.HasPrefix(msg.Topic, "/contractMarket/limitCandle:") {
+		return
+	}
+	symbol, candle, err := parseCandleMessage(msg.Data)
+	if err != nil {
+		log.Printf("Ignoring malformed candle message: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.subscribers[symbol] {
+		select {
+		case ch <- candle:
+		default:
+			// 送信するのは mu を持つ handle だけなので、1つ取り出せば必ず空きができる
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- candle
+		}
+	}
+}
+
+// parseCandleMessage は足の更新のメッセージを読み取ります。
+// candles は REST の K-Line と列の順番が異なり、[開始時刻(秒), 始値, 終値, 高値, 安値, 出来高, 売買代金] です。
+func parseCandleMessage(data json.RawMessage) (string, domain.Candle, error) {
+	var msg struct {
+		Symbol  string      `json:"symbol"`
+		Candles []flexFloat `json:"candles"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return "", domain.Candle{}, err
+	}
+	if len(msg.Candles) < 6 {
+		return "", domain.Candle{}, fmt.Errorf("expected at least 6 candle values, got %d", len(msg.Candles))
+	}
+	v := msg.Candles
+	candle := domain.Candle{
+		Time:   time.Unix(int64(v[0]), 0),
+		Open:   float64(v[1]),
+		Close:  float64(v[2]),
+		High:   float64(v[3]),
+		Low:    float64(v[4]),
+		Volume: float64(v[5]),
+	}
+	if len(v) > 6 {
+		candle.Turnover = float64(v[6])
+	}
+	return msg.Symbol, candle, nil
+}
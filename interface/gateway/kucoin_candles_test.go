@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"crypto_trade_bot/infra/client"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serveKlines は /api/v1/kline/query に body を返すサーバーに接続したゲートウェイを返します。
+func serveKlines(t *testing.T, body []byte) *KuCoinGateway {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/kline/query" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(ts.Close)
+	return NewKuCoinGateway(client.NewHTTPClient(), ts.URL)
+}
+
+// readFixture は testdata のレスポンスを読み込みます。
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture %s: %v", name, err)
+	}
+	return body
+}
+
+func TestGetCandlesDecodesBothEncodings(t *testing.T) {
+	want := []domain.Candle{
+		{Time: time.UnixMilli(1700000000000), Open: 35000.1, High: 35100.5, Low: 34950.2, Close: 35050.3, Volume: 1234, Turnover: 43210.5},
+		{Time: time.UnixMilli(1700003600000), Open: 35050.3, High: 35200, Low: 35010.7, Close: 35180.4, Volume: 987, Turnover: 34702.25},
+		{Time: time.UnixMilli(1700007200000), Open: 35180.4, High: 35190.9, Low: 34800, Close: 34850.6, Volume: 2010, Turnover: 70300.75},
+	}
+	tests := []struct {
+		fixture     string
+		hasTurnover bool
+		description string
+	}{
+		{fixture: "klines_numbers.json", hasTurnover: true, description: "numbers, oldest first, with turnover"},
+		{fixture: "klines_strings.json", hasTurnover: false, description: "strings, newest first, without turnover"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			g := serveKlines(t, readFixture(t, tt.fixture))
+			got, err := g.GetCandles("XBTUSDTM", 60, 0)
+			if err != nil {
+				t.Fatalf("GetCandles(%s): %v", tt.description, err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d candles, want %d", len(got), len(want))
+			}
+			for i, w := range want {
+				if !tt.hasTurnover {
+					w.Turnover = 0
+				}
+				if !got[i].Time.Equal(w.Time) {
+					t.Errorf("candle %d: time %v, want %v", i, got[i].Time, w.Time)
+				}
+				got[i].Time = w.Time
+				if got[i] != w {
+					t.Errorf("candle %d: got %+v, want %+v", i, got[i], w)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCandlesKeepsLatestCount(t *testing.T) {
+	g := serveKlines(t, readFixture(t, "klines_strings.json"))
+	got, err := g.GetCandles("XBTUSDTM", 60, 2)
+	if err != nil {
+		t.Fatalf("GetCandles: %v", err)
+	}
+	if len(got) != 2 || got[0].Time.UnixMilli() != 1700003600000 || got[1].Time.UnixMilli() != 1700007200000 {
+		t.Fatalf("got %+v, want the latest 2 candles oldest first", got)
+	}
+}
+
+func TestGetCandlesRangeErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		rateLimited bool
+	}{
+		{name: "rate limited", body: `{"code":"429000","msg":"Too Many Requests"}`, rateLimited: true},
+		{name: "api error", body: `{"code":"400100","msg":"Param validation error"}`},
+		{name: "short row", body: `{"code":"200000","data":[[1700000000000,1,2,3,4]]}`},
+		{name: "not a number", body: `{"code":"200000","data":[[1700000000000,"1","2","x","4","5"]]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := serveKlines(t, []byte(tt.body))
+			_, err := g.GetCandlesRange("XBTUSDTM", 60, time.UnixMilli(1700000000000), time.UnixMilli(1700007200000))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := errors.Is(err, domain.ErrRateLimited); got != tt.rateLimited {
+				t.Errorf("errors.Is(err, ErrRateLimited) = %v, want %v (err: %v)", got, tt.rateLimited, err)
+			}
+		})
+	}
+}
+
+func TestGetCandlesRangeEmpty(t *testing.T) {
+	g := serveKlines(t, []byte(`{"code":"200000","data":[]}`))
+	got, err := g.GetCandlesRange("XBTUSDTM", 60, time.UnixMilli(1700000000000), time.UnixMilli(1700007200000))
+	if err != nil || len(got) != 0 {
+		t.Fatalf("got %v, %v; want no candles and no error", got, err)
+	}
+}
@@ -1,15 +1,18 @@
 package gateway
 
 import (
-	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto_trade_bot/domain"
 	"crypto_trade_bot/infra/client"
 	"crypto_trade_bot/infra/config"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,14 +23,23 @@ type KuCoinGateway struct {
 	apiKey     string
 	apiSecret  string
 	passphrase string
+
+	contractsMu sync.Mutex
+	contracts   map[string]domain.ContractSpec // 取得済みの契約仕様のキャッシュ
 }
 
+// rateLimitCode は KuCoin API がレート制限超過時に返すコードです。
+const rateLimitCode = "429000"
+
+// DefaultKuCoinFuturesURL は KuCoin 先物取引APIのエンドポイントです。
+const DefaultKuCoinFuturesURL = "https://api-futures.kucoin.com"
+
 // NewKuCoinGateway は新しい KuCoinGateway を生成します。
-func NewKuCoinGateway(httpClient *client.HTTPClient) *KuCoinGateway {
-	// 先物取引APIのエンドポイントに変更
+// baseURL にはテスト用の偽サーバーなど、本番以外のエンドポイントも指定できます。
+func NewKuCoinGateway(httpClient *client.HTTPClient, baseURL string) *KuCoinGateway {
 	return &KuCoinGateway{
 		httpClient: httpClient,
-		baseURL:    "https://api-futures.kucoin.com",
+		baseURL:    strings.TrimRight(baseURL, "/"),
 		apiKey:     config.GetEnv("KUCOIN_API_KEY", ""),
 		apiSecret:  config.GetEnv("KUCOIN_API_SECRET", ""),
 		passphrase: config.GetEnv("KUCOIN_API_PASSPHRASE", ""),
@@ -43,11 +55,16 @@ type FuturesContractsResponse struct {
 		IsDele        bool    `json:"isDele"`
 		Status        string  `json:"status"`
 		QuoteCurrency string  `json:"quoteCurrency"`
+		Multiplier    float64 `json:"multiplier"`
+		LotSize       float64 `json:"lotSize"`
+		TickSize      float64 `json:"tickSize"`
+		MaxOrderQty   float64 `json:"maxOrderQty"`
+		MaxLeverage   float64 `json:"maxLeverage"`
 	} `json:"data"`
 }
 
-// GetTop20USDTpairsByVolume は24時間の取引量が多いUSDTペアを上位20件取得します。
-func (g *KuCoinGateway) GetTop20USDTpairsByVolume() ([]string, error) {
+// getActiveContracts は取引可能な先物契約の一覧を取得します。
+func (g *KuCoinGateway) getActiveContracts() (*FuturesContractsResponse, error) {
 	// 先物APIのエンドポイントに変更
 	url := fmt.Sprintf("%s/api/v1/contracts/active", g.baseURL)
 	respBody, err := g.httpClient.Get(url, nil)
@@ -63,6 +80,45 @@ func (g *KuCoinGateway) GetTop20USDTpairsByVolume() ([]string, error) {
 	if contractsResp.Code != "200000" {
 		return nil, fmt.Errorf("KuCoin API error: %s", string(respBody))
 	}
+	return &contractsResp, nil
+}
+
+// GetContract は銘柄の契約仕様を返します。初回の呼び出しで全契約を取得してキャッシュします。
+func (g *KuCoinGateway) GetContract(symbol string) (domain.ContractSpec, error) {
+	g.contractsMu.Lock()
+	defer g.contractsMu.Unlock()
+
+	if g.contracts == nil {
+		contractsResp, err := g.getActiveContracts()
+		if err != nil {
+			return domain.ContractSpec{}, err
+		}
+		g.contracts = make(map[string]domain.ContractSpec, len(contractsResp.Data))
+		for _, c := range contractsResp.Data {
+			g.contracts[c.Symbol] = domain.ContractSpec{
+				Symbol:      c.Symbol,
+				Multiplier:  c.Multiplier,
+				LotSize:     c.LotSize,
+				TickSize:    c.TickSize,
+				MaxOrderQty: c.MaxOrderQty,
+				MaxLeverage: c.MaxLeverage,
+			}
+		}
+	}
+
+	spec, ok := g.contracts[symbol]
+	if !ok {
+		return domain.ContractSpec{}, fmt.Errorf("no active contract for %s", symbol)
+	}
+	return spec, nil
+}
+
+// GetTop20USDTpairsByVolume は24時間の取引量が多いUSDTペアを上位20件取得します。
+func (g *KuCoinGateway) GetTop20USDTpairsByVolume() ([]string, error) {
+	contractsResp, err := g.getActiveContracts()
+	if err != nil {
+		return nil, err
+	}
 
 	// USDT建ての契約のみをフィルタリングし、取引量でソート
 	type contract struct {
@@ -117,6 +173,86 @@ func (g *KuCoinGateway) GetCurrentPrice(symbol string) (float64, error) {
 	return priceResp.Data.Price, nil
 }
 
+// GetRecentTrades は銘柄の直近の約定履歴（全参加者の約定）を取得します。
+func (g *KuCoinGateway) GetRecentTrades(symbol string) ([]domain.MarketTrade, error) {
+	url := fmt.Sprintf("%s/api/v1/trade/history?symbol=%s", g.baseURL, symbol)
+	respBody, err := g.httpClient.Get(url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade history for %s: %w", symbol, err)
+	}
+
+	var historyResp struct {
+		Code string `json:"code"`
+		Data []struct {
+			Sequence int64     `json:"sequence"`
+			Price    flexFloat `json:"price"`
+			Size     flexFloat `json:"size"`
+			Side     string    `json:"side"`
+			Ts       int64     `json:"ts"` // ナノ秒
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &historyResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal trade history for %s: %w", symbol, err)
+	}
+	if historyResp.Code == rateLimitCode {
+		return nil, fmt.Errorf("trade history %s: %w", symbol, domain.ErrRateLimited)
+	}
+	if historyResp.Code != "200000" {
+		return nil, fmt.Errorf("KuCoin API error for trade history %s: %s", symbol, string(respBody))
+	}
+
+	trades := make([]domain.MarketTrade, 0, len(historyResp.Data))
+	for _, t := range historyResp.Data {
+		trades = append(trades, domain.MarketTrade{
+			Sequence: t.Sequence,
+			Price:    float64(t.Price),
+			Size:     float64(t.Size),
+			Side:     domain.OrderSide(t.Side),
+			Time:     time.Unix(0, t.Ts),
+		})
+	}
+	return trades, nil
+}
+
+// GetOrderBook は銘柄の板情報の全量のスナップショットを取得します。
+func (g *KuCoinGateway) GetOrderBook(symbol string) (domain.OrderBook, error) {
+	url := fmt.Sprintf("%s/api/v1/level2/snapshot?symbol=%s", g.baseURL, symbol)
+	respBody, err := g.httpClient.Get(url, nil)
+	if err != nil {
+		return domain.OrderBook{}, fmt.Errorf("failed to get order book for %s: %w", symbol, err)
+	}
+
+	var snapshotResp struct {
+		Code string `json:"code"`
+		Data struct {
+			Sequence int64          `json:"sequence"`
+			Bids     [][2]flexFloat `json:"bids"`
+			Asks     [][2]flexFloat `json:"asks"`
+			Ts       int64          `json:"ts"` // ナノ秒
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &snapshotResp); err != nil {
+		return domain.OrderBook{}, fmt.Errorf("failed to unmarshal order book for %s: %w", symbol, err)
+	}
+	if snapshotResp.Code == rateLimitCode {
+		return domain.OrderBook{}, fmt.Errorf("order book %s: %w", symbol, domain.ErrRateLimited)
+	}
+	if snapshotResp.Code != "200000" {
+		return domain.OrderBook{}, fmt.Errorf("KuCoin API error for order book %s: %s", symbol, string(respBody))
+	}
+
+	book := domain.OrderBook{Symbol: symbol, Sequence: snapshotResp.Data.Sequence, Time: time.Unix(0, snapshotResp.Data.Ts)}
+	for _, l := range snapshotResp.Data.Bids {
+		book.Bids = append(book.Bids, domain.PriceLevel{Price: float64(l[0]), Size: float64(l[1])})
+	}
+	for _, l := range snapshotResp.Data.Asks {
+		book.Asks = append(book.Asks, domain.PriceLevel{Price: float64(l[0]), Size: float64(l[1])})
+	}
+	sort.Slice(book.Bids, func(i, j int) bool { return book.Bids[i].Price > book.Bids[j].Price })
+	sort.Slice(book.Asks, func(i, j int) bool { return book.Asks[i].Price < book.Asks[j].Price })
+	return book, nil
+}
+
 // --- Private Methods for Authentication ---
 
 func (g *KuCoinGateway) getAuthHeaders(method, endpoint, body string) map[string]string {
@@ -141,98 +277,151 @@ func (g *KuCoinGateway) getAuthHeaders(method, endpoint, body string) map[string
 	}
 }
 
-// CreateOrder は新しい注文を作成します。
-func (g *KuCoinGateway) CreateOrder(symbol string, side string, orderType string, size string) (string, error) {
+// CreateOrder は新しい注文を作成します。req.ClientOID が空の場合は clientOid を生成します。
+// 取引所が拒否した場合は domain.ErrRejected を含むエラーを返し、それ以外のエラーでは注文が受け付けられた可能性があります。
+func (g *KuCoinGateway) CreateOrder(req domain.OrderRequest) (string, error) {
+	if err := req.Validate(); err != nil {
+		return "", fmt.Errorf("invalid order request: %w: %w", err, domain.ErrRejected)
+	}
+
 	endpoint := "/api/v1/orders"
-	url := g.baseURL + endpoint
 
-	reqBodyMap := map[string]string{
-		"clientOid": fmt.Sprintf("%d", time.Now().UnixNano()),
-		"symbol":    symbol,
-		"side":      side,      // "buy" or "sell"
-		"type":      orderType, // "market" or "limit"
-		"leverage":  "1",       // レバレッジを1に固定
-		"size":      size,      // for market order
-		// "price":     price,  // for limit order
+	clientOID := req.ClientOID
+	if clientOID == "" {
+		clientOID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	reqBodyMap := map[string]interface{}{
+		"clientOid": clientOID,
+		"symbol":    req.Symbol,
+		"side":      string(req.Side),
+		"type":      string(req.Type),
+	}
+	leverage := req.Leverage
+	if leverage == 0 {
+		leverage = 1
+	}
+	reqBodyMap["leverage"] = formatNumber(leverage)
+	if req.MarginMode != "" {
+		reqBodyMap["marginMode"] = strings.ToUpper(string(req.MarginMode))
+	}
+	if req.CloseOrder {
+		reqBodyMap["closeOrder"] = true
+	} else {
+		reqBodyMap["size"] = formatNumber(req.Size)
+	}
+	if req.ReduceOnly {
+		reqBodyMap["reduceOnly"] = true
+	}
+	if req.Type == domain.OrderTypeLimit {
+		reqBodyMap["price"] = formatNumber(req.Price)
+		if req.TimeInForce != "" {
+			reqBodyMap["timeInForce"] = string(req.TimeInForce)
+		}
+		if req.PostOnly {
+			reqBodyMap["postOnly"] = true
+		}
+		if req.Hidden {
+			reqBodyMap["hidden"] = true
+		}
+		if req.Iceberg {
+			reqBodyMap["iceberg"] = true
+			reqBodyMap["visibleSize"] = formatNumber(req.VisibleSize)
+		}
+	}
+	if req.Stop != "" {
+		reqBodyMap["stop"] = string(req.Stop)
+		reqBodyMap["stopPriceType"] = string(req.StopPriceType)
+		reqBodyMap["stopPrice"] = formatNumber(req.StopPrice)
 	}
 	reqBodyBytes, err := json.Marshal(reqBodyMap)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal order request body: %w", err)
 	}
-	reqBody := string(reqBodyBytes)
-
-	headers := g.getAuthHeaders("POST", endpoint, reqBody)
 
-	respBody, err := g.httpClient.Post(url, headers, bytes.NewBuffer(reqBodyBytes))
-	if err != nil {
+	var data struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := g.privateRequest("POST", endpoint, reqBodyBytes, &data); err != nil {
 		return "", fmt.Errorf("failed to create order: %w", err)
 	}
+	return data.OrderID, nil
+}
 
-	var orderResp struct {
-		Code string `json:"code"`
-		Data struct {
-			OrderID string `json:"orderId"`
-		} `json:"data"`
-		Msg string `json:"msg"`
-	}
+// GetCandles は直近のローソク足を古い順に取得します。count が正の場合は直近 count 本に絞ります。
+func (g *KuCoinGateway) GetCandles(symbol string, granularity int, count int) ([]domain.Candle, error) {
+	// 先物APIのK-Lineエンドポイントとパラメータに変更
+	// granularity: 1, 5, 15, 30, 60, 120, 240, 480, 720, 1440, 10080 (minutes)
+	// from/toを指定しない場合は直近のデータが返る。期間指定は GetCandlesRange を使う
+	endpoint := fmt.Sprintf("/api/v1/kline/query?symbol=%s&granularity=%d", symbol, granularity)
 
-	if err := json.Unmarshal(respBody, &orderResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal order response: %s", string(respBody))
+	candles, err := g.queryCandles(symbol, endpoint)
+	if err != nil {
+		return nil, err
 	}
 
-	if orderResp.Code != "200000" {
-		return "", fmt.Errorf("failed to create order on KuCoin: %s", orderResp.Msg)
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("no kline data returned for %s", symbol)
 	}
 
-	return orderResp.Data.OrderID, nil
+	return domain.LastCandles(candles, count), nil
 }
 
-// GetKlines は指定した期間のローソク足データを取得します。
-func (g *KuCoinGateway) GetKlines(symbol string, granularity int, count int) ([][]string, error) {
-	// 先物APIのK-Lineエンドポイントとパラメータに変更
-	// granularity: 1, 5, 15, 30, 60, 120, 240, 480, 720, 1440, 10080 (minutes)
-	// 先物APIではstartAt/endAtは使わない（直近のデータを取得する）
-	endpoint := fmt.Sprintf("/api/v1/kline/query?symbol=%s&granularity=%d", symbol, granularity)
-	url := g.baseURL + endpoint
+// GetCandlesRange は指定した期間 [from, to] のローソク足を古い順に取得します。
+// 1回のリクエストで返る本数には上限があるため、長い期間は呼び出し側でページングします。
+func (g *KuCoinGateway) GetCandlesRange(symbol string, granularity int, from, to time.Time) ([]domain.Candle, error) {
+	// 先物APIでは期間指定のパラメータは from/to（ミリ秒）
+	endpoint := fmt.Sprintf("/api/v1/kline/query?symbol=%s&granularity=%d&from=%d&to=%d",
+		symbol, granularity, from.UnixMilli(), to.UnixMilli())
+	return g.queryCandles(symbol, endpoint)
+}
 
-	respBody, err := g.httpClient.Get(url, nil)
+// queryCandles はK-Lineエンドポイントを呼び出し、各行をローソク足に変換して古い順に並べます。
+// 先物APIの行は [時刻(ms), 始値, 高値, 安値, 終値, 出来高, 売買代金] で、各列は数値でも文字列でも返されます。
+// 売買代金の列は返されないことがあります。
+func (g *KuCoinGateway) queryCandles(symbol, endpoint string) ([]domain.Candle, error) {
+	respBody, err := g.httpClient.Get(g.baseURL+endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get klines for %s: %w", symbol, err)
 	}
 
-	var klineResp struct {
-		Code string     `json:"code"`
-		Data [][]string `json:"data"`
+	var resp kucoinResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal kline response for %s: %w", symbol, err)
 	}
-	if err := json.Unmarshal(respBody, &klineResp); err != nil {
-		// KuCoinのデータ形式は [[string, string, ...]] なので、一度interface{}で受けてから変換する
-		var rawKlineResp struct {
-			Code string          `json:"code"`
-			Data [][]interface{} `json:"data"`
-		}
-		if err2 := json.Unmarshal(respBody, &rawKlineResp); err2 != nil {
-			return nil, fmt.Errorf("failed to unmarshal kline response for %s: %w", symbol, err2)
-		}
-		if rawKlineResp.Code != "200000" {
-			return nil, fmt.Errorf("KuCoin API error for kline %s: %s", symbol, string(respBody))
-		}
-		// interface{}をstringに変換
-		klineResp.Data = make([][]string, len(rawKlineResp.Data))
-		for i, d := range rawKlineResp.Data {
-			klineResp.Data[i] = make([]string, len(d))
-			for j, v := range d {
-				klineResp.Data[i][j] = fmt.Sprintf("%v", v)
-			}
-		}
+	if resp.Code == rateLimitCode {
+		return nil, fmt.Errorf("kline %s: %w", symbol, domain.ErrRateLimited)
 	}
-
-	if klineResp.Code != "200000" && klineResp.Code != "" {
+	if resp.Code != "200000" {
 		return nil, fmt.Errorf("KuCoin API error for kline %s: %s", symbol, string(respBody))
 	}
+	var rows [][]flexFloat
+	if len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, &rows); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal klines for %s: %w", symbol, err)
+		}
+	}
 
-	if len(klineResp.Data) == 0 {
-		return nil, fmt.Errorf("no kline data returned for %s", symbol)
+	candles := make([]domain.Candle, len(rows))
+	for i, row := range rows {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("invalid kline row for %s at %d: %v", symbol, i, row)
+		}
+		candles[i] = domain.Candle{
+			Time:   time.UnixMilli(int64(row[0])),
+			Open:   float64(row[1]),
+			High:   float64(row[2]),
+			Low:    float64(row[3]),
+			Close:  float64(row[4]),
+			Volume: float64(row[5]),
+		}
+		if len(row) > 6 {
+			candles[i].Turnover = float64(row[6])
+		}
 	}
+	return domain.SortCandles(candles), nil
+}
 
-	return klineResp.Data, nil
+// formatNumber は数値を指数表記にならない文字列に整形します。
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
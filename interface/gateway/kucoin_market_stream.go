@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// priceSubscriberBuffer は購読者ごとに溜めておく価格の更新の数です。溢れた場合は古い更新から捨てます。
+const priceSubscriberBuffer = 16
+
+// KuCoinMarketStream は KuCoin 先物の公開 WebSocket で最終約定価格とマーク価格を受信し、
+// 銘柄ごとに任意の数の購読者へ配信します。切断された場合は自動で再接続して購読し直します。
+type KuCoinMarketStream struct {
+	socket *kucoinSocket
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan domain.PriceUpdate]struct{} // 銘柄ごとの購読者
+}
+
+// NewKuCoinMarketStream は g の接続先の公開 WebSocket を使う KuCoinMarketStream を生成します。
+// 接続は最初に購読したときに開始します。
+func NewKuCoinMarketStream(g *KuCoinGateway) *KuCoinMarketStream {
+	m := &KuCoinMarketStream{subscribers: map[string]map[chan domain.PriceUpdate]struct{}{}}
+	m.socket = newKucoinSocket("Market data", g.getPublicBulletToken, m.handle)
+	return m
+}
+
+// tickerTopic と instrumentTopic は銘柄の最終約定価格とマーク価格のトピックです。
+func tickerTopic(symbol string) string     { return "/contractMarket/ticker:" + symbol }
+func instrumentTopic(symbol string) string { return "/contract/instrument:" + symbol }
+
+// SubscribePrices は銘柄の価格の更新を受け取るチャネルと、購読をやめる関数を返します。
+// 受信が追いつかない場合は古い更新を捨てるため、チャネルからは常に新しい価格が届きます。
+// 購読をやめるとチャネルは閉じられます。
+func (m *KuCoinMarketStream) SubscribePrices(symbol string) (<-chan domain.PriceUpdate, func()) {
+	ch := make(chan domain.PriceUpdate, priceSubscriberBuffer)
+	m.mu.Lock()
+	if m.subscribers[symbol] == nil {
+		m.subscribers[symbol] = map[chan domain.PriceUpdate]struct{}{}
+	}
+	m.subscribers[symbol][ch] = struct{}{}
+	m.mu.Unlock()
+
+	m.socket.subscribe(tickerTopic(symbol))
+	m.socket.subscribe(instrumentTopic(symbol))
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.subscribers[symbol], ch)
+			if len(m.subscribers[symbol]) == 0 {
+				delete(m.subscribers, symbol)
+			}
+			close(ch)
+			m.mu.Unlock()
+
+			m.socket.unsubscribe(tickerTopic(symbol))
+			m.socket.unsubscribe(instrumentTopic(symbol))
+		})
+	}
+	return ch, cancel
+}
+
+// Connected は WebSocket に接続しているかを返します。
+func (m *KuCoinMarketStream) Connected() bool {
+	return m.socket.Connected()
+}
+
+// Close は WebSocket の接続を閉じます。購読者のチャネルは閉じないため、各購読者が購読をやめてください。
+func (m *KuCoinMarketStream) Close() {
+	m.socket.Close()
+}
+
+// handle は受信したメッセージを価格の更新にして、その銘柄の購読者に配信します。
+func (m *KuCoinMarketStream) handle(msg socketMessage) {
+	var update domain.PriceUpdate
+	switch {
+	case strings.HasPrefix(msg.Topic, "/contractMarket/ticker:"):
+		var data struct {
+			Symbol       string    `json:"symbol"`
+			Price        flexFloat `json:"price"`
+			BestBidPrice flexFloat `json:"bestBidPrice"`
+			BestAskPrice flexFloat `json:"bestAskPrice"`
+			Ts           int64     `json:"ts"` // ナノ秒
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			log.Printf("Ignoring malformed ticker message: %v", err)
+			return
+		}
+		update = domain.PriceUpdate{
+			Symbol:  data.Symbol,
+			Kind:    domain.PriceLast,
+			Price:   float64(data.Price),
+			BestBid: float64(data.BestBidPrice),
+			BestAsk: float64(data.BestAskPrice),
+			Time:    time.Unix(0, data.Ts),
+		}
+	case strings.HasPrefix(msg.Topic, "/contract/instrument:") && msg.Subject == "mark.index.price":
+		var data struct {
+			MarkPrice  flexFloat `json:"markPrice"`
+			IndexPrice flexFloat `json:"indexPrice"`
+			Timestamp  int64     `json:"timestamp"` // ミリ秒
+		}
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			log.Printf("Ignoring malformed mark price message: %v", err)
+			return
+		}
+		update = domain.PriceUpdate{
+			Symbol:     strings.TrimPrefix(msg.Topic, "/contract/instrument:"),
+			Kind:       domain.PriceMark,
+			Price:      float64(data.MarkPrice),
+			IndexPrice: float64(data.IndexPrice),
+			Time:       time.UnixMilli(data.Timestamp),
+		}
+	default:
+		return
+	}
+	if update.Price <= 0 {
+		return
+	}
+	m.publish(update)
+}
+
+// publish は価格の更新を銘柄の全ての購読者に配信します。購読者のバッファが一杯の場合は一番古い更新を捨てます。
+func (m *KuCoinMarketStream) publish(update domain.PriceUpdate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subscribers[update.Symbol] {
+		select {
+		case ch <- update:
+		default:
+			// 送信するのは mu を持つ publish だけなので、1つ取り出せば必ず空きができる
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- update
+		}
+	}
+}
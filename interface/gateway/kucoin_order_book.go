@@ -0,0 +1,280 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// orderBookResyncWait はスナップショットの取得に失敗した場合や、スナップショットが差分に追いついていない場合に
+// 取り直すまで待つ時間です。
+const orderBookResyncWait = time.Second
+
+// maxPendingLevel2Changes は同期が終わるまでに溜める差分の上限です。超えた場合は古い差分から捨てます。
+// 古い差分は次に取得するスナップショットに含まれるため、同期が長引いても溜めた差分が増え続けないようにします。
+const maxPendingLevel2Changes = 10000
+
+// level2Topic は銘柄の板の差分の更新のトピックです。
+func level2Topic(symbol string) string { return "/contractMarket/level2:" + symbol }
+
+// level2Change は板の差分の更新の1件です。
+type level2Change struct {
+	sequence int64
+	side     domain.OrderSide
+	price    float64
+	size     float64
+}
+
+// localOrderBook は1銘柄の手元で維持している板です。
+type localOrderBook struct {
+	watchers int
+	book     domain.OrderBook
+	synced   bool           // book がスナップショットと差分で最新になっているか
+	syncing  bool           // スナップショットを取得中か
+	pending  []level2Change // 同期が終わるまでに受信した差分
+}
+
+// KuCoinOrderBooks は Watch した銘柄の板を、REST のスナップショットと WebSocket の差分の更新で手元に維持します。
+// 差分の通し番号が飛んだ場合や再接続した場合は、スナップショットを取り直して同期し直します。
+type KuCoinOrderBooks struct {
+	gateway *KuCoinGateway
+	socket  *kucoinSocket
+
+	mu    sync.Mutex
+	books map[string]*localOrderBook
+}
+
+// NewKuCoinOrderBooks は g の接続先の板を維持する KuCoinOrderBooks を生成します。
+// WebSocket への接続は最初に Watch したときに開始します。
+func NewKuCoinOrderBooks(g *KuCoinGateway) *KuCoinOrderBooks {
+	b := &KuCoinOrderBooks{gateway: g, books: map[string]*localOrderBook{}}
+	b.socket = newKucoinSocket("Order book", g.getPublicBulletToken, b.handle)
+	b.socket.onConnect = b.resyncAll
+	return b
+}
+
+// Watch は銘柄の板の維持を開始し、やめるための関数を返します。
+// 同じ銘柄を複数回 Watch した場合は、全ての関数が呼ばれるまで維持を続けます。
+func (b *KuCoinOrderBooks) Watch(symbol string) func() {
+	b.mu.Lock()
+	lb, ok := b.books[symbol]
+	if !ok {
+		lb = &localOrderBook{}
+		b.books[symbol] = lb
+	}
+	lb.watchers++
+	b.mu.Unlock()
+
+	if !ok {
+		// 差分を取りこぼさないよう、購読してからスナップショットを取得する
+		b.socket.subscribe(level2Topic(symbol))
+		b.resync(symbol)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			lb.watchers--
+			last := lb.watchers == 0
+			if last {
+				delete(b.books, symbol)
+			}
+			b.mu.Unlock()
+			if last {
+				b.socket.unsubscribe(level2Topic(symbol))
+			}
+		})
+	}
+}
+
+// GetOrderBook は銘柄の板を返します。手元の板が同期していればそのコピーを、
+// Watch していない銘柄や同期中・切断中の場合は REST のスナップショットを返します。
+func (b *KuCoinOrderBooks) GetOrderBook(symbol string) (domain.OrderBook, error) {
+	b.mu.Lock()
+	if lb, ok := b.books[symbol]; ok && lb.synced && b.socket.Connected() {
+		book := lb.book.Clone()
+		b.mu.Unlock()
+		return book, nil
+	}
+	b.mu.Unlock()
+	return b.gateway.GetOrderBook(symbol)
+}
+
+// Close は WebSocket の接続を閉じます。
+func (b *KuCoinOrderBooks) Close() {
+	b.socket.Close()
+}
+
+// handle は受信した板の差分を適用します。同期中の銘柄の差分は同期が終わるまで溜めておきます。
+func (b *KuCoinOrderBooks) handle(msg socketMessage) {
+	if !strings.HasPrefix(msg.Topic, "/contractMarket/level2:") {
+		return
+	}
+	symbol := strings.TrimPrefix(msg.Topic, "/contractMarket/level2:")
+	change, err := parseLevel2Change(msg.Data)
+	if err != nil {
+		log.Printf("Ignoring malformed order book update for %s: %v", symbol, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lb, ok := b.books[symbol]
+	if !ok {
+		return
+	}
+	if !lb.synced {
+		if len(lb.pending) >= maxPendingLevel2Changes {
+			lb.pending = lb.pending[1:]
+		}
+		lb.pending = append(lb.pending, change)
+		return
+	}
+	switch {
+	case change.sequence <= lb.book.Sequence:
+		// スナップショットに含まれている更新
+	case change.sequence == lb.book.Sequence+1:
+		lb.book.Apply(change.side, change.price, change.size)
+		lb.book.Sequence = change.sequence
+	default:
+		log.Printf("Order book for %s skipped from sequence %d to %d; resyncing", symbol, lb.book.Sequence, change.sequence)
+		lb.synced = false
+		lb.pending = []level2Change{change}
+		b.startSync(symbol, lb)
+	}
+}
+
+// resyncAll は WebSocket に接続し直した後、切断中に失った更新を補うために全ての板を同期し直します。
+func (b *KuCoinOrderBooks) resyncAll() {
+	b.mu.Lock()
+	symbols := make([]string, 0, len(b.books))
+	for symbol := range b.books {
+		symbols = append(symbols, symbol)
+	}
+	b.mu.Unlock()
+	for _, symbol := range symbols {
+		b.resync(symbol)
+	}
+}
+
+// resync は銘柄の板を同期していない状態に戻し、スナップショットから同期し直します。
+func (b *KuCoinOrderBooks) resync(symbol string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lb, ok := b.books[symbol]
+	if !ok {
+		return
+	}
+	lb.synced = false
+	lb.pending = nil
+	b.startSync(symbol, lb)
+}
+
+// startSync は同期を開始します。既に同期中の場合は何もしません。b.mu を持って呼び出します。
+func (b *KuCoinOrderBooks) startSync(symbol string, lb *localOrderBook) {
+	if lb.syncing {
+		return
+	}
+	lb.syncing = true
+	go b.sync(symbol, lb)
+}
+
+// sync はスナップショットを取得し、その後に受信した差分を通し番号順に適用して板を最新にします。
+// 溜めた差分がスナップショットの次の番号から続いていない場合は、待ってからスナップショットを取り直します。
+func (b *KuCoinOrderBooks) sync(symbol string, lb *localOrderBook) {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			time.Sleep(orderBookResyncWait)
+		}
+		snapshot, err := b.gateway.GetOrderBook(symbol)
+
+		b.mu.Lock()
+		if b.books[symbol] != lb {
+			// 同期中に Watch をやめた
+			b.mu.Unlock()
+			return
+		}
+		if err != nil {
+			b.mu.Unlock()
+			log.Printf("Could not get order book snapshot for %s: %v", symbol, err)
+			continue
+		}
+		book, err := applyPending(snapshot, lb.pending)
+		if err != nil {
+			// 次に取得するスナップショットはこれより新しいため、これに含まれていた差分は捨てる
+			lb.pending = changesAfter(lb.pending, snapshot.Sequence)
+			b.mu.Unlock()
+			log.Printf("Order book snapshot for %s is not usable yet: %v", symbol, err)
+			continue
+		}
+		lb.book, lb.synced, lb.syncing, lb.pending = book, true, false, nil
+		b.mu.Unlock()
+		log.Printf("Order book for %s synced at sequence %d", symbol, book.Sequence)
+		return
+	}
+}
+
+// applyPending はスナップショットに、その後の差分を通し番号順に適用した板を返します。
+// スナップショットより古い差分は読み飛ばし、番号が飛んでいる場合はエラーを返します。
+func applyPending(snapshot domain.OrderBook, pending []level2Change) (domain.OrderBook, error) {
+	changes := append([]level2Change(nil), pending...)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].sequence < changes[j].sequence })
+	book := snapshot.Clone()
+	for _, c := range changes {
+		if c.sequence <= book.Sequence {
+			continue
+		}
+		if c.sequence != book.Sequence+1 {
+			return domain.OrderBook{}, fmt.Errorf("update %d does not follow snapshot sequence %d", c.sequence, book.Sequence)
+		}
+		book.Apply(c.side, c.price, c.size)
+		book.Sequence = c.sequence
+	}
+	return book, nil
+}
+
+// changesAfter は通し番号が sequence より後の差分だけを返します。
+func changesAfter(changes []level2Change, sequence int64) []level2Change {
+	var after []level2Change
+	for _, c := range changes {
+		if c.sequence > sequence {
+			after = append(after, c)
+		}
+	}
+	return after
+}
+
+// parseLevel2Change は差分の更新のメッセージを読み取ります。change は "価格,サイド,数量" の形式です。
+func parseLevel2Change(data json.RawMessage) (level2Change, error) {
+	var msg struct {
+		Sequence int64  `json:"sequence"`
+		Change   string `json:"change"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return level2Change{}, err
+	}
+	parts := strings.Split(msg.Change, ",")
+	if len(parts) != 3 {
+		return level2Change{}, fmt.Errorf("invalid change %q", msg.Change)
+	}
+	price, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return level2Change{}, fmt.Errorf("invalid price in change %q: %w", msg.Change, err)
+	}
+	size, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return level2Change{}, fmt.Errorf("invalid size in change %q: %w", msg.Change, err)
+	}
+	side := domain.OrderSide(parts[1])
+	if side != domain.Buy && side != domain.Sell {
+		return level2Change{}, fmt.Errorf("invalid side in change %q", msg.Change)
+	}
+	return level2Change{sequence: msg.Sequence, side: side, price: price, size: size}, nil
+}
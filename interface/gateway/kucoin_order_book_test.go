@@ -0,0 +1,213 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLevel2Change(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    level2Change
+		wantErr bool
+	}{
+		{data: `{"sequence":18,"change":"5000.0,sell,83","timestamp":1551770400000}`, want: level2Change{sequence: 18, side: domain.Sell, price: 5000, size: 83}},
+		{data: `{"sequence":19,"change":"4999.5,buy,12","timestamp":1551770400000}`, want: level2Change{sequence: 19, side: domain.Buy, price: 4999.5, size: 12}},
+		// 数量 0 はその価格を板から取り除く更新
+		{data: `{"sequence":20,"change":"5000.0,sell,0","timestamp":1551770400000}`, want: level2Change{sequence: 20, side: domain.Sell, price: 5000}},
+		{data: `{"sequence":21,"change":"5000.0,sell"}`, wantErr: true},
+		{data: `{"sequence":21,"change":"abc,sell,1"}`, wantErr: true},
+		{data: `{"sequence":21,"change":"5000.0,bid,1"}`, wantErr: true},
+		{data: `{"sequence":21,"change":"5000.0,sell,x"}`, wantErr: true},
+		{data: `{"sequence":"21"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLevel2Change(json.RawMessage(tt.data))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseLevel2Change(%s) = %+v, want an error", tt.data, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseLevel2Change(%s) = %+v, %v; want %+v", tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyPending(t *testing.T) {
+	snapshot := domain.OrderBook{
+		Symbol:   "XBTUSDTM",
+		Sequence: 10,
+		Bids:     []domain.PriceLevel{{Price: 99, Size: 10}},
+		Asks:     []domain.PriceLevel{{Price: 100, Size: 5}, {Price: 101, Size: 8}},
+	}
+	tests := []struct {
+		name     string
+		pending  []level2Change
+		wantSeq  int64
+		wantBids []domain.PriceLevel
+		wantAsks []domain.PriceLevel
+		wantErr  bool
+	}{
+		{name: "no updates", wantSeq: 10, wantBids: snapshot.Bids, wantAsks: snapshot.Asks},
+		{
+			name:     "updates in order",
+			pending:  []level2Change{{sequence: 11, side: domain.Sell, price: 100, size: 3}, {sequence: 12, side: domain.Buy, price: 99.5, size: 4}},
+			wantSeq:  12,
+			wantBids: []domain.PriceLevel{{Price: 99.5, Size: 4}, {Price: 99, Size: 10}},
+			wantAsks: []domain.PriceLevel{{Price: 100, Size: 3}, {Price: 101, Size: 8}},
+		},
+		{
+			name:     "updates received out of order",
+			pending:  []level2Change{{sequence: 12, side: domain.Sell, price: 101, size: 0}, {sequence: 11, side: domain.Sell, price: 101, size: 2}},
+			wantSeq:  12,
+			wantBids: snapshot.Bids,
+			wantAsks: []domain.PriceLevel{{Price: 100, Size: 5}},
+		},
+		{
+			// スナップショットに含まれている更新は適用しない
+			name:     "updates older than the snapshot",
+			pending:  []level2Change{{sequence: 9, side: domain.Sell, price: 100, size: 99}, {sequence: 10, side: domain.Sell, price: 100, size: 99}, {sequence: 11, side: domain.Sell, price: 102, size: 1}},
+			wantSeq:  11,
+			wantBids: snapshot.Bids,
+			wantAsks: []domain.PriceLevel{{Price: 100, Size: 5}, {Price: 101, Size: 8}, {Price: 102, Size: 1}},
+		},
+		{name: "gap after the snapshot", pending: []level2Change{{sequence: 12, side: domain.Sell, price: 100, size: 1}}, wantErr: true},
+		{name: "gap between updates", pending: []level2Change{{sequence: 11, side: domain.Sell, price: 100, size: 1}, {sequence: 13, side: domain.Sell, price: 100, size: 2}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, err := applyPending(snapshot, tt.pending)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyPending = %+v, want an error", book)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPending: %v", err)
+			}
+			if book.Sequence != tt.wantSeq || !reflect.DeepEqual(book.Bids, tt.wantBids) || !reflect.DeepEqual(book.Asks, tt.wantAsks) {
+				t.Errorf("applyPending = seq %d bids %v asks %v, want seq %d bids %v asks %v", book.Sequence, book.Bids, book.Asks, tt.wantSeq, tt.wantBids, tt.wantAsks)
+			}
+		})
+	}
+	if len(snapshot.Asks) != 2 || snapshot.Asks[0].Size != 5 {
+		t.Errorf("applyPending modified the snapshot: %+v", snapshot.Asks)
+	}
+}
+
+// syncedBook は手元の板が同期していればそのコピーを返します。
+func syncedBook(b *KuCoinOrderBooks, symbol string) (domain.OrderBook, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lb, ok := b.books[symbol]
+	if !ok || !lb.synced {
+		return domain.OrderBook{}, false
+	}
+	return lb.book.Clone(), true
+}
+
+// waitForBook は手元の板が sequence まで同期するまで待ち、その板を返します。
+func waitForBook(t *testing.T, b *KuCoinOrderBooks, symbol string, sequence int64) domain.OrderBook {
+	t.Helper()
+	var book domain.OrderBook
+	waitFor(t, "order book sequence", func() bool {
+		var ok bool
+		book, ok = syncedBook(b, symbol)
+		return ok && book.Sequence == sequence
+	})
+	return book
+}
+
+func TestOrderBookFollowsUpdatesAndResyncsAfterGap(t *testing.T) {
+	server, g := newFakeKuCoin(t)
+	bids := [][2]float64{{99, 10}, {98, 20}}
+	server.SetOrderBook("XBTUSDTM", 10, bids, [][2]float64{{100, 5}, {101, 8}})
+	b := NewKuCoinOrderBooks(g)
+	t.Cleanup(b.Close)
+	defer b.Watch("XBTUSDTM")()
+
+	waitForBook(t, b, "XBTUSDTM", 10)
+	waitFor(t, "subscription", func() bool { return server.SocketSubscribers(level2Topic("XBTUSDTM")) == 1 })
+
+	// スナップショットに含まれている番号の更新は読み飛ばし、次の番号の更新だけを適用する
+	server.PublishLevel2("XBTUSDTM", 10, 100, "sell", 999)
+	server.PublishLevel2("XBTUSDTM", 11, 100, "sell", 7)
+	book := waitForBook(t, b, "XBTUSDTM", 11)
+	if ask, _ := book.BestAsk(); ask != (domain.PriceLevel{Price: 100, Size: 7}) {
+		t.Fatalf("best ask = %+v, want 7 lots at 100", ask)
+	}
+	if local, err := b.GetOrderBook("XBTUSDTM"); err != nil || local.Sequence != 11 {
+		t.Errorf("GetOrderBook = seq %d, %v; want the local book at 11", local.Sequence, err)
+	}
+
+	// 12 を取りこぼして 14 を受信したため同期し直す。取得したスナップショットは 12 までしか含まず、
+	// 13 を受信するまでは使えないため、取り直す
+	server.SetOrderBook("XBTUSDTM", 12, bids, [][2]float64{{100, 7}, {101, 8}})
+	server.PublishLevel2("XBTUSDTM", 14, 101, "sell", 0)
+	waitFor(t, "resync to start", func() bool { _, ok := syncedBook(b, "XBTUSDTM"); return !ok })
+	if local, err := b.GetOrderBook("XBTUSDTM"); err != nil || local.Sequence != 12 {
+		t.Errorf("GetOrderBook while resyncing = seq %d, %v; want the REST snapshot at 12", local.Sequence, err)
+	}
+	server.PublishLevel2("XBTUSDTM", 13, 102, "sell", 3)
+
+	book = waitForBook(t, b, "XBTUSDTM", 14)
+	if want := []domain.PriceLevel{{Price: 100, Size: 7}, {Price: 102, Size: 3}}; !reflect.DeepEqual(book.Asks, want) {
+		t.Errorf("asks after resync = %v, want %v", book.Asks, want)
+	}
+}
+
+func TestOrderBookResyncsAfterReconnect(t *testing.T) {
+	server, g := newFakeKuCoin(t)
+	server.SetOrderBook("XBTUSDTM", 10, [][2]float64{{99, 10}}, [][2]float64{{100, 5}})
+	b := NewKuCoinOrderBooks(g)
+	t.Cleanup(b.Close)
+	defer b.Watch("XBTUSDTM")()
+	waitForBook(t, b, "XBTUSDTM", 10)
+
+	// 切断中の更新は受信できないため、接続し直したらスナップショットから同期し直す
+	server.SetOrderBook("XBTUSDTM", 30, [][2]float64{{99, 10}}, [][2]float64{{100, 1}})
+	server.DisconnectSockets()
+	waitForBook(t, b, "XBTUSDTM", 30)
+	waitFor(t, "resubscription", func() bool { return server.SocketSubscribers(level2Topic("XBTUSDTM")) == 1 })
+
+	server.PublishLevel2("XBTUSDTM", 31, 100, "sell", 2)
+	book := waitForBook(t, b, "XBTUSDTM", 31)
+	if ask, _ := book.BestAsk(); ask.Size != 2 {
+		t.Errorf("best ask after reconnect = %+v, want 2 lots", ask)
+	}
+}
+
+func TestOrderBookWatchIsCounted(t *testing.T) {
+	server, g := newFakeKuCoin(t)
+	server.SetOrderBook("XBTUSDTM", 10, [][2]float64{{99, 10}}, [][2]float64{{100, 5}})
+	b := NewKuCoinOrderBooks(g)
+	t.Cleanup(b.Close)
+	topic := level2Topic("XBTUSDTM")
+
+	stopFirst := b.Watch("XBTUSDTM")
+	stopSecond := b.Watch("XBTUSDTM")
+	waitForBook(t, b, "XBTUSDTM", 10)
+	waitFor(t, "subscription", func() bool { return server.SocketSubscribers(topic) == 1 })
+
+	// 同じ関数を2回呼んでも、もう1つの Watch の分は維持を続ける
+	stopFirst()
+	stopFirst()
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := syncedBook(b, "XBTUSDTM"); !ok || server.SocketSubscribers(topic) != 1 {
+		t.Fatalf("stopped maintaining the book while another Watch is active")
+	}
+
+	stopSecond()
+	waitFor(t, "unsubscription", func() bool { return server.SocketSubscribers(topic) == 0 })
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.books) != 0 {
+		t.Errorf("books still maintained after every Watch stopped: %v", b.books)
+	}
+}
@@ -0,0 +1,346 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto_trade_bot/domain"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kucoinResponse は KuCoin API の共通のレスポンス形式です。
+type kucoinResponse struct {
+	Code string          `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// flexFloat は文字列・数値・null のいずれで返される数値も受け付けます。
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %s: %w", string(b), err)
+	}
+	*f = flexFloat(v)
+	return nil
+}
+
+// privateRequest は署名付きのリクエストを送り、成功した場合はレスポンスの data を out にデコードします。
+func (g *KuCoinGateway) privateRequest(method, endpoint string, body []byte, out interface{}) error {
+	headers := g.getAuthHeaders(method, endpoint, string(body))
+
+	var respBody []byte
+	var err error
+	switch method {
+	case "GET":
+		respBody, err = g.httpClient.Get(g.baseURL+endpoint, headers)
+	case "POST":
+		respBody, err = g.httpClient.Post(g.baseURL+endpoint, headers, bytes.NewBuffer(body))
+	case "DELETE":
+		respBody, err = g.httpClient.Delete(g.baseURL+endpoint, headers)
+	default:
+		return fmt.Errorf("unsupported method: %s", method)
+	}
+	if err != nil {
+		return err
+	}
+
+	var resp kucoinResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %s", string(respBody))
+	}
+	if resp.Code == rateLimitCode {
+		return fmt.Errorf("%s %s: %w", method, endpoint, domain.ErrRateLimited)
+	}
+	if resp.Code != "200000" {
+		if strings.HasPrefix(resp.Code, "5") {
+			// サーバー内部のエラーは処理されたかどうか分からない
+			return fmt.Errorf("KuCoin API error for %s %s: %s", method, endpoint, resp.Msg)
+		}
+		return fmt.Errorf("KuCoin API error for %s %s: %s: %w", method, endpoint, resp.Msg, domain.ErrRejected)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return fmt.Errorf("failed to unmarshal data of %s %s: %w", method, endpoint, err)
+	}
+	return nil
+}
+
+// kucoinOrder は /api/v1/orders/{orderId} が返す注文の詳細です。
+type kucoinOrder struct {
+	ID          string    `json:"id"`
+	ClientOid   string    `json:"clientOid"`
+	Symbol      string    `json:"symbol"`
+	Type        string    `json:"type"`
+	Side        string    `json:"side"`
+	Price       flexFloat `json:"price"`
+	Size        flexFloat `json:"size"`
+	FilledSize  flexFloat `json:"filledSize"`
+	IsActive    bool      `json:"isActive"`
+	CancelExist bool      `json:"cancelExist"`
+	Status      string    `json:"status"`
+	Stop        string    `json:"stop"`
+	StopPrice   flexFloat `json:"stopPrice"`
+	StopTrigger bool      `json:"stopTriggered"`
+	CreatedAt   int64     `json:"createdAt"`
+}
+
+// toDomain は KuCoin の注文を domain.Order に変換します。
+// KuCoin の status は open/done の2値のため、isActive と約定数量から状態を判定します。
+// 未発動の逆指値注文は isActive が false のまま status が open になります。
+func (o kucoinOrder) toDomain() domain.Order {
+	size, filled := float64(o.Size), float64(o.FilledSize)
+
+	var status domain.OrderStatus
+	switch {
+	case o.Stop != "" && !o.StopTrigger && o.Status == "open":
+		status = domain.OrderStatusNew
+	case o.IsActive && filled > 0:
+		status = domain.OrderStatusPartiallyFilled
+	case o.IsActive:
+		status = domain.OrderStatusNew
+	case filled > 0 && filled >= size && !o.CancelExist:
+		status = domain.OrderStatusFilled
+	default:
+		status = domain.OrderStatusCanceled
+	}
+
+	return domain.Order{
+		ID:         o.ID,
+		ClientOID:  o.ClientOid,
+		Symbol:     o.Symbol,
+		Side:       domain.OrderSide(o.Side),
+		Type:       domain.OrderType(o.Type),
+		Price:      float64(o.Price),
+		Amount:     size,
+		FilledSize: filled,
+		Status:     status,
+		Stop:       domain.StopDirection(o.Stop),
+		StopPrice:  float64(o.StopPrice),
+		CreatedAt:  time.UnixMilli(o.CreatedAt),
+	}
+}
+
+// GetOrder は注文の状態を取得します。約定がある場合は約定履歴から平均約定価格と手数料を計算します。
+func (g *KuCoinGateway) GetOrder(orderID string) (domain.Order, error) {
+	var detail kucoinOrder
+	if err := g.privateRequest("GET", "/api/v1/orders/"+url.PathEscape(orderID), nil, &detail); err != nil {
+		return domain.Order{}, fmt.Errorf("failed to get order %s: %w", orderID, err)
+	}
+	order := detail.toDomain()
+	if order.FilledSize == 0 {
+		return order, nil
+	}
+
+	fills, err := g.GetFills(orderID)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if len(fills) == 0 {
+		// 約定履歴の反映が遅れている場合、平均約定価格はまだ分からない
+		order.Price = 0
+		return order, nil
+	}
+	order.ApplyFills(fills)
+	return order, nil
+}
+
+// GetOrderByClientOID は発注時の clientOid で注文の状態を取得します。
+// 注文が見つからない場合は domain.ErrOrderNotFound を返します。
+func (g *KuCoinGateway) GetOrderByClientOID(clientOID string) (domain.Order, error) {
+	var detail *kucoinOrder
+	endpoint := "/api/v1/orders/byClientOid?clientOid=" + url.QueryEscape(clientOID)
+	if err := g.privateRequest("GET", endpoint, nil, &detail); err != nil {
+		return domain.Order{}, fmt.Errorf("failed to get order with clientOid %s: %w", clientOID, err)
+	}
+	// 存在しない clientOid には data が null で返る
+	if detail == nil || detail.ID == "" {
+		return domain.Order{}, fmt.Errorf("clientOid %s: %w", clientOID, domain.ErrOrderNotFound)
+	}
+	return g.GetOrder(detail.ID)
+}
+
+// GetFills は注文の約定履歴を取得します。
+func (g *KuCoinGateway) GetFills(orderID string) ([]domain.Fill, error) {
+	var fills []domain.Fill
+	for page := 1; ; page++ {
+		endpoint := fmt.Sprintf("/api/v1/fills?orderId=%s&currentPage=%d&pageSize=100", url.QueryEscape(orderID), page)
+		var data struct {
+			TotalPage int `json:"totalPage"`
+			Items     []struct {
+				TradeID   string    `json:"tradeId"`
+				OrderID   string    `json:"orderId"`
+				Symbol    string    `json:"symbol"`
+				Side      string    `json:"side"`
+				Liquidity string    `json:"liquidity"`
+				Price     flexFloat `json:"price"`
+				Size      flexFloat `json:"size"`
+				Fee       flexFloat `json:"fee"`
+				TradeTime int64     `json:"tradeTime"` // ナノ秒
+			} `json:"items"`
+		}
+		if err := g.privateRequest("GET", endpoint, nil, &data); err != nil {
+			return nil, fmt.Errorf("failed to get fills for order %s: %w", orderID, err)
+		}
+
+		for _, item := range data.Items {
+			fills = append(fills, domain.Fill{
+				TradeID:   item.TradeID,
+				OrderID:   item.OrderID,
+				Symbol:    item.Symbol,
+				Side:      domain.OrderSide(item.Side),
+				Price:     float64(item.Price),
+				Size:      float64(item.Size),
+				Fee:       float64(item.Fee),
+				Liquidity: domain.Liquidity(item.Liquidity),
+				Time:      time.Unix(0, item.TradeTime),
+			})
+		}
+		if page >= data.TotalPage {
+			return fills, nil
+		}
+	}
+}
+
+// GetOpenOrders は板に残っている注文と未発動の逆指値注文を取得します。symbol が空の場合は全銘柄が対象です。
+func (g *KuCoinGateway) GetOpenOrders(symbol string) ([]domain.Order, error) {
+	orders, err := g.listOrders("/api/v1/orders?status=active", symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open orders: %w", err)
+	}
+	stopOrders, err := g.listOrders("/api/v1/stopOrders?", symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stop orders: %w", err)
+	}
+	return append(orders, stopOrders...), nil
+}
+
+// listOrders は注文一覧のエンドポイントを全ページ取得します。
+func (g *KuCoinGateway) listOrders(base, symbol string) ([]domain.Order, error) {
+	var orders []domain.Order
+	for page := 1; ; page++ {
+		endpoint := base
+		if !strings.HasSuffix(endpoint, "?") {
+			endpoint += "&"
+		}
+		endpoint += fmt.Sprintf("currentPage=%d&pageSize=100", page)
+		if symbol != "" {
+			endpoint += "&symbol=" + url.QueryEscape(symbol)
+		}
+		var data struct {
+			TotalPage int           `json:"totalPage"`
+			Items     []kucoinOrder `json:"items"`
+		}
+		if err := g.privateRequest("GET", endpoint, nil, &data); err != nil {
+			return nil, err
+		}
+		for _, item := range data.Items {
+			orders = append(orders, item.toDomain())
+		}
+		if page >= data.TotalPage {
+			return orders, nil
+		}
+	}
+}
+
+// GetPositions は保有中の建玉を取得します。Lots は建玉のロット数、Size は乗数を掛けた原資産数量です。
+func (g *KuCoinGateway) GetPositions() ([]domain.Position, error) {
+	var data []struct {
+		Symbol           string    `json:"symbol"`
+		CurrentQty       flexFloat `json:"currentQty"` // ロット数。ショートは負
+		AvgEntryPrice    flexFloat `json:"avgEntryPrice"`
+		RealLeverage     flexFloat `json:"realLeverage"`
+		IsOpen           bool      `json:"isOpen"`
+		CrossMode        bool      `json:"crossMode"`
+		MarginMode       string    `json:"marginMode"`
+		OpeningTimestamp int64     `json:"openingTimestamp"`
+	}
+	if err := g.privateRequest("GET", "/api/v1/positions", nil, &data); err != nil {
+		return nil, fmt.Errorf("failed to get positions: %w", err)
+	}
+
+	var positions []domain.Position
+	for _, p := range data {
+		qty := float64(p.CurrentQty)
+		if !p.IsOpen || qty == 0 {
+			continue
+		}
+		spec, err := g.GetContract(p.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		// 建玉のロット数は paper と同じくロットの刻みに揃え、1ロットに満たない場合は建玉がないものとする
+		lots := spec.RoundLots(math.Abs(qty))
+		if lots <= 0 {
+			continue
+		}
+		pos := domain.Position{
+			Symbol:     p.Symbol,
+			Side:       domain.Buy,
+			Lots:       lots,
+			Size:       lots * spec.Multiplier,
+			EntryPrice: float64(p.AvgEntryPrice),
+			Leverage:   float64(p.RealLeverage),
+			MarginMode: domain.IsolatedMargin,
+		}
+		if p.OpeningTimestamp > 0 {
+			pos.OpenedAt = time.UnixMilli(p.OpeningTimestamp)
+		}
+		if qty < 0 {
+			pos.Side = domain.Sell
+		}
+		if p.CrossMode || strings.EqualFold(p.MarginMode, "CROSS") {
+			pos.MarginMode = domain.CrossMargin
+		}
+		positions = append(positions, pos)
+	}
+	return positions, nil
+}
+
+// CancelOrder は注文IDを指定して注文を取り消します。
+func (g *KuCoinGateway) CancelOrder(orderID string) error {
+	if err := g.privateRequest("DELETE", "/api/v1/orders/"+url.PathEscape(orderID), nil, nil); err != nil {
+		return fmt.Errorf("failed to cancel order %s: %w", orderID, err)
+	}
+	return nil
+}
+
+// CancelOrderByClientOID は発注時に指定した clientOid で注文を取り消します。
+func (g *KuCoinGateway) CancelOrderByClientOID(symbol, clientOID string) error {
+	endpoint := fmt.Sprintf("/api/v1/orders/client-order/%s?symbol=%s", url.PathEscape(clientOID), url.QueryEscape(symbol))
+	if err := g.privateRequest("DELETE", endpoint, nil, nil); err != nil {
+		return fmt.Errorf("failed to cancel order with clientOid %s: %w", clientOID, err)
+	}
+	return nil
+}
+
+// CancelAllOrders は銘柄の板に残っている注文と未発動の逆指値注文を全て取り消し、取り消した注文IDを返します。
+func (g *KuCoinGateway) CancelAllOrders(symbol string) ([]string, error) {
+	if symbol == "" {
+		return nil, fmt.Errorf("symbol is required to cancel all orders")
+	}
+	var cancelled []string
+	for _, endpoint := range []string{"/api/v1/orders", "/api/v1/stopOrders"} {
+		var data struct {
+			CancelledOrderIds []string `json:"cancelledOrderIds"`
+		}
+		if err := g.privateRequest("DELETE", endpoint+"?symbol="+url.QueryEscape(symbol), nil, &data); err != nil {
+			return cancelled, fmt.Errorf("failed to cancel orders for %s: %w", symbol, err)
+		}
+		cancelled = append(cancelled, data.CancelledOrderIds...)
+	}
+	return cancelled, nil
+}
@@ -0,0 +1,316 @@
+package gateway
+
+import (
+	"crypto_trade_bot/infra/client"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// socketDialTimeout は WebSocket への接続と welcome メッセージを待つ時間です。
+	socketDialTimeout = 10 * time.Second
+	// socketReconnectMin と socketReconnectMax は再接続を待つ時間の最小と最大です。失敗が続くと倍々に延ばします。
+	socketReconnectMin = time.Second
+	socketReconnectMax = time.Minute
+	// socketStableAfter はこの時間より長く接続できていた場合に、再接続の待ち時間を最小に戻します。
+	socketStableAfter = time.Minute
+)
+
+// bulletToken は WebSocket に接続するために bullet API で取得するトークンと接続先です。
+type bulletToken struct {
+	Token           string `json:"token"`
+	InstanceServers []struct {
+		Endpoint     string `json:"endpoint"`
+		PingInterval int64  `json:"pingInterval"` // ミリ秒
+		PingTimeout  int64  `json:"pingTimeout"`  // ミリ秒
+	} `json:"instanceServers"`
+}
+
+// getPrivateBulletToken は自分の注文や建玉を購読する非公開チャネル用の WebSocket のトークンを、署名付きのリクエストで取得します。
+func (g *KuCoinGateway) getPrivateBulletToken() (bulletToken, error) {
+	var token bulletToken
+	if err := g.privateRequest("POST", "/api/v1/bullet-private", nil, &token); err != nil {
+		return bulletToken{}, fmt.Errorf("failed to get private websocket token: %w", err)
+	}
+	if token.Token == "" || len(token.InstanceServers) == 0 {
+		return bulletToken{}, fmt.Errorf("private websocket token response has no token or server")
+	}
+	return token, nil
+}
+
+// getPublicBulletToken は公開チャネル用の WebSocket のトークンを取得します。
+func (g *KuCoinGateway) getPublicBulletToken() (bulletToken, error) {
+	respBody, err := g.httpClient.Post(g.baseURL+"/api/v1/bullet-public", nil, nil)
+	if err != nil {
+		return bulletToken{}, fmt.Errorf("failed to get websocket token: %w", err)
+	}
+	var resp kucoinResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return bulletToken{}, fmt.Errorf("failed to unmarshal websocket token response: %s", string(respBody))
+	}
+	if resp.Code != "200000" {
+		return bulletToken{}, fmt.Errorf("KuCoin API error for websocket token: %s", resp.Msg)
+	}
+	var token bulletToken
+	if err := json.Unmarshal(resp.Data, &token); err != nil {
+		return bulletToken{}, fmt.Errorf("failed to unmarshal websocket token: %w", err)
+	}
+	if token.Token == "" || len(token.InstanceServers) == 0 {
+		return bulletToken{}, fmt.Errorf("websocket token response has no token or server")
+	}
+	return token, nil
+}
+
+// socketMessage は KuCoin の WebSocket でやり取りするメッセージです。
+type socketMessage struct {
+	ID             string          `json:"id,omitempty"`
+	Type           string          `json:"type"`
+	Topic          string          `json:"topic,omitempty"`
+	Subject        string          `json:"subject,omitempty"`
+	PrivateChannel bool            `json:"privateChannel,omitempty"`
+	Response       bool            `json:"response,omitempty"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+// kucoinSocket は KuCoin の WebSocket への接続を維持し、購読中のトピックのメッセージを onMessage に渡します。
+// 接続が切れた場合はトークンを取り直して再接続し、購読中のトピックを全て購読し直します。
+// 接続は最初にトピックを購読したときに開始します。
+type kucoinSocket struct {
+	name      string
+	bullet    func() (bulletToken, error)
+	onMessage func(socketMessage)
+	// onConnect は接続してトピックを購読し直した直後に呼ばれます。切断中に失ったメッセージの補完に使います。
+	onConnect func()
+	// private は非公開チャネルのトピックを購読する接続かです。
+	private bool
+
+	start sync.Once
+	done  chan struct{}
+
+	mu        sync.Mutex
+	topics    map[string]int // トピックごとの購読数
+	conn      *client.WebSocketConn
+	nextID    int64
+	closed    bool
+	connected bool
+}
+
+// newKucoinSocket は新しい kucoinSocket を生成します。name はログに出力する接続の名前です。
+func newKucoinSocket(name string, bullet func() (bulletToken, error), onMessage func(socketMessage)) *kucoinSocket {
+	return &kucoinSocket{
+		name:      name,
+		bullet:    bullet,
+		onMessage: onMessage,
+		done:      make(chan struct{}),
+		topics:    map[string]int{},
+	}
+}
+
+// subscribe はトピックを購読します。同じトピックを複数回購読した場合は、同じ回数 unsubscribe するまで購読を続けます。
+func (s *kucoinSocket) subscribe(topic string) {
+	s.mu.Lock()
+	s.topics[topic]++
+	first := s.topics[topic] == 1
+	conn := s.conn
+	s.mu.Unlock()
+
+	if first && conn != nil {
+		s.send(conn, "subscribe", topic)
+	}
+	s.start.Do(func() { go s.run() })
+}
+
+// unsubscribe はトピックの購読を1つ解除します。
+func (s *kucoinSocket) unsubscribe(topic string) {
+	s.mu.Lock()
+	s.topics[topic]--
+	last := s.topics[topic] <= 0
+	if last {
+		delete(s.topics, topic)
+	}
+	conn := s.conn
+	s.mu.Unlock()
+
+	if last && conn != nil {
+		s.send(conn, "unsubscribe", topic)
+	}
+}
+
+// Connected は WebSocket に接続しているかを返します。
+func (s *kucoinSocket) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected
+}
+
+// Close は接続を閉じ、再接続を止めます。
+func (s *kucoinSocket) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	conn := s.conn
+	s.mu.Unlock()
+
+	close(s.done)
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// run は Close されるまで接続を維持します。接続に失敗した場合や切断された場合は待ってから再接続します。
+func (s *kucoinSocket) run() {
+	wait := socketReconnectMin
+	for {
+		started := time.Now()
+		err := s.serve()
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		if time.Since(started) > socketStableAfter {
+			wait = socketReconnectMin
+		}
+		log.Printf("%s websocket disconnected: %v. Reconnecting in %s", s.name, err, wait)
+		select {
+		case <-s.done:
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, socketReconnectMax)
+	}
+}
+
+// serve は1回の接続で、welcome を待ってからトピックを購読し、切断されるまでメッセージを受信します。
+// 接続中はサーバーが指定した間隔で ping を送り、その間隔と応答待ちの時間を過ぎても何も受信しない場合は切断します。
+func (s *kucoinSocket) serve() error {
+	token, err := s.bullet()
+	if err != nil {
+		return err
+	}
+	server := token.InstanceServers[0]
+	endpoint := fmt.Sprintf("%s?token=%s&connectId=%s", server.Endpoint, url.QueryEscape(token.Token), strconv.FormatInt(time.Now().UnixNano(), 36))
+	conn, err := client.DialWebSocket(endpoint, socketDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(socketDialTimeout))
+	welcome, err := readSocketMessage(conn)
+	if err != nil {
+		return fmt.Errorf("no welcome message: %w", err)
+	}
+	if welcome.Type != "welcome" {
+		return fmt.Errorf("expected welcome message, got %s", welcome.Type)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.conn, s.connected = conn, true
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.conn, s.connected = nil, false
+		s.mu.Unlock()
+	}()
+
+	log.Printf("%s websocket connected; subscribing to %d topics", s.name, len(topics))
+	for _, topic := range topics {
+		if err := s.send(conn, "subscribe", topic); err != nil {
+			return err
+		}
+	}
+	if s.onConnect != nil {
+		s.onConnect()
+	}
+
+	pingInterval := time.Duration(server.PingInterval) * time.Millisecond
+	if pingInterval <= 0 {
+		pingInterval = 18 * time.Second
+	}
+	pingTimeout := time.Duration(server.PingTimeout) * time.Millisecond
+	if pingTimeout <= 0 {
+		pingTimeout = 10 * time.Second
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.ping(conn, pingInterval, stop)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(pingInterval + pingTimeout))
+		msg, err := readSocketMessage(conn)
+		if err != nil {
+			return err
+		}
+		switch msg.Type {
+		case "message":
+			s.onMessage(msg)
+		case "error":
+			log.Printf("%s websocket error: %s", s.name, string(msg.Data))
+		}
+	}
+}
+
+// ping は stop が閉じられるまで interval ごとに ping を送ります。送れなかった場合は接続を閉じて受信側を終わらせます。
+func (s *kucoinSocket) ping(conn *client.WebSocketConn, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.send(conn, "ping", ""); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// send は ID を付けたメッセージを送信します。
+func (s *kucoinSocket) send(conn *client.WebSocketConn, msgType, topic string) error {
+	s.mu.Lock()
+	s.nextID++
+	id := strconv.FormatInt(s.nextID, 10)
+	s.mu.Unlock()
+
+	msg := socketMessage{ID: id, Type: msgType, Topic: topic, PrivateChannel: s.private && topic != "", Response: topic != ""}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := conn.WriteText(body); err != nil {
+		return fmt.Errorf("failed to send %s %s: %w", msgType, topic, err)
+	}
+	return nil
+}
+
+// readSocketMessage は次のメッセージを受信してデコードします。
+func readSocketMessage(conn *client.WebSocketConn) (socketMessage, error) {
+	body, err := conn.ReadMessage()
+	if err != nil {
+		return socketMessage{}, err
+	}
+	var msg socketMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return socketMessage{}, fmt.Errorf("failed to unmarshal websocket message: %w", err)
+	}
+	return msg, nil
+}
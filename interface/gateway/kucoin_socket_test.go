@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"crypto_trade_bot/infra/client"
+	"crypto_trade_bot/infra/fakekucoin"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testTickerTopic = "/contractMarket/ticker:XBTUSDTM"
+
+// newFakeKuCoin は偽サーバーを起動し、それに接続したゲートウェイを返します。
+func newFakeKuCoin(t *testing.T) (*fakekucoin.Server, *KuCoinGateway) {
+	t.Helper()
+	t.Setenv("KUCOIN_API_KEY", "test-key")
+	t.Setenv("KUCOIN_API_SECRET", "test-secret")
+	t.Setenv("KUCOIN_API_PASSPHRASE", "test-passphrase")
+	server := fakekucoin.NewServer("test-key", "test-secret", "test-passphrase")
+	server.SetContracts(fakekucoin.Contract{Symbol: "XBTUSDTM", QuoteCurrency: "USDT"})
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return server, NewKuCoinGateway(client.NewHTTPClient(), ts.URL)
+}
+
+// waitFor は cond が true になるまで待ちます。5秒以内にならない場合はテストを失敗させます。
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newTestSocket は受信したメッセージを messages に送る公開チャネルの kucoinSocket を返します。connects は接続した回数です。
+func newTestSocket(t *testing.T, g *KuCoinGateway) (s *kucoinSocket, messages chan socketMessage, connects *atomic.Int32) {
+	t.Helper()
+	messages = make(chan socketMessage, 16)
+	connects = &atomic.Int32{}
+	s = newKucoinSocket("Test", g.getPublicBulletToken, func(msg socketMessage) { messages <- msg })
+	s.onConnect = func() { connects.Add(1) }
+	t.Cleanup(s.Close)
+	return s, messages, connects
+}
+
+// receive は次のメッセージを待ちます。
+func receive(t *testing.T, messages <-chan socketMessage) socketMessage {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no websocket message received")
+		return socketMessage{}
+	}
+}
+
+func TestSocketReconnectsWithNewTokenAndResubscribes(t *testing.T) {
+	server, g := newFakeKuCoin(t)
+	s, messages, connects := newTestSocket(t, g)
+
+	s.subscribe(testTickerTopic)
+	waitFor(t, "subscription", func() bool { return server.SocketSubscribers(testTickerTopic) == 1 })
+	server.PublishTicker("XBTUSDTM", 100)
+	if msg := receive(t, messages); msg.Topic != testTickerTopic || msg.Subject != "ticker" {
+		t.Fatalf("received %+v, want a ticker on %s", msg, testTickerTopic)
+	}
+	first := server.SocketTokens()
+
+	// 切断されるとトークンが無効になるため、新しいトークンを取得して接続し直し、購読もし直す
+	server.DisconnectSockets()
+	waitFor(t, "resubscription", func() bool {
+		return s.Connected() && server.SocketSubscribers(testTickerTopic) == 1
+	})
+	if again := server.SocketTokens(); len(first) != 1 || len(again) != 1 || again[0] == first[0] {
+		t.Errorf("reconnected with tokens %v, want a new token instead of %v", again, first)
+	}
+	if n := connects.Load(); n != 2 {
+		t.Errorf("onConnect called %d times, want 2", n)
+	}
+	server.PublishTicker("XBTUSDTM", 101)
+	if msg := receive(t, messages); msg.Topic != testTickerTopic {
+		t.Errorf("received %+v after reconnecting, want a ticker on %s", msg, testTickerTopic)
+	}
+}
+
+func TestSocketReconnectsWhenPingsGoUnanswered(t *testing.T) {
+	server, g := newFakeKuCoin(t)
+	server.SetSocketPingInterval(50 * time.Millisecond)
+	s, _, connects := newTestSocket(t, g)
+
+	s.subscribe(testTickerTopic)
+	waitFor(t, "subscription", func() bool { return server.SocketSubscribers(testTickerTopic) == 1 })
+
+	// ping の間隔と応答待ちの時間を過ぎても何も受信しなければ、接続が切れたとみなす
+	server.SetSocketUnresponsive(true)
+	waitFor(t, "ping timeout", func() bool { return !s.Connected() })
+	server.SetSocketUnresponsive(false)
+
+	waitFor(t, "resubscription", func() bool {
+		return s.Connected() && server.SocketSubscribers(testTickerTopic) == 1
+	})
+	if n := connects.Load(); n != 2 {
+		t.Errorf("onConnect called %d times, want 2", n)
+	}
+}
+
+func TestSocketSubscriptionsAreCounted(t *testing.T) {
+	server, g := newFakeKuCoin(t)
+	s, _, _ := newTestSocket(t, g)
+
+	s.subscribe(testTickerTopic)
+	s.subscribe(testTickerTopic)
+	waitFor(t, "subscription", func() bool { return server.SocketSubscribers(testTickerTopic) == 1 })
+
+	// 2回購読したトピックは、2回解除するまで購読を続ける
+	s.unsubscribe(testTickerTopic)
+	time.Sleep(50 * time.Millisecond)
+	if n := server.SocketSubscribers(testTickerTopic); n != 1 {
+		t.Fatalf("unsubscribed after the first of two unsubscribes: %d subscribers", n)
+	}
+	s.unsubscribe(testTickerTopic)
+	waitFor(t, "unsubscription", func() bool { return server.SocketSubscribers(testTickerTopic) == 0 })
+}
@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"log"
+	"sync"
+)
+
+// OrderBookSource は板情報の取得元です。KuCoinGateway の REST のスナップショットと、KuCoinOrderBooks の手元の板が実装します。
+type OrderBookSource interface {
+	GetOrderBook(symbol string) (domain.OrderBook, error)
+}
+
+// ContractSource は契約仕様の取得元です。
+type ContractSource interface {
+	GetContract(symbol string) (domain.ContractSpec, error)
+}
+
+// OrderBookDepth は取引所の板を domain.BookSource として提供し、domain.BookSlippage で板の厚みに応じた約定価格を見積もれるようにします。
+// 取引所の板の数量はロット数のため、契約仕様の乗数で原資産単位に換算して返します。
+// 板は呼び出すたびに取得し直すため、バックテストでは過去の板ではなく現在の板で見積もることになります。
+type OrderBookDepth struct {
+	books     OrderBookSource
+	contracts ContractSource
+
+	mu          sync.Mutex
+	multipliers map[string]float64
+}
+
+// NewOrderBookDepth は books の板を contracts の契約仕様で換算する OrderBookDepth を生成します。
+func NewOrderBookDepth(books OrderBookSource, contracts ContractSource) *OrderBookDepth {
+	return &OrderBookDepth{books: books, contracts: contracts, multipliers: map[string]float64{}}
+}
+
+// Levels は side の成行注文が約定する相手側の気配を、良い順に原資産単位の数量で返します。
+// 板や契約仕様を取得できない場合は nil を返し、domain.BookSlippage は Fallback で見積もります。
+func (d *OrderBookDepth) Levels(symbol string, side domain.OrderSide) []domain.PriceLevel {
+	multiplier, err := d.multiplier(symbol)
+	if err != nil {
+		log.Printf("Could not get contract spec for %s to read the order book: %v", symbol, err)
+		return nil
+	}
+	book, err := d.books.GetOrderBook(symbol)
+	if err != nil {
+		log.Printf("Could not get order book for %s to estimate slippage: %v", symbol, err)
+		return nil
+	}
+	taker := book.Levels(symbol, side)
+	levels := make([]domain.PriceLevel, len(taker))
+	for i, l := range taker {
+		levels[i] = domain.PriceLevel{Price: l.Price, Size: l.Size * multiplier}
+	}
+	return levels
+}
+
+// multiplier は銘柄の1ロットあたりの原資産数量を返します。契約仕様は銘柄ごとに1回だけ取得します。
+func (d *OrderBookDepth) multiplier(symbol string) (float64, error) {
+	d.mu.Lock()
+	m, ok := d.multipliers[symbol]
+	d.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+	spec, err := d.contracts.GetContract(symbol)
+	if err != nil {
+		return 0, err
+	}
+	d.mu.Lock()
+	d.multipliers[symbol] = spec.Multiplier
+	d.mu.Unlock()
+	return spec.Multiplier, nil
+}
@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"math"
+	"testing"
+)
+
+func TestOrderBookDepthEstimatesSlippageInBaseUnits(t *testing.T) {
+	market := &stubMarket{
+		spec: domain.ContractSpec{Symbol: "ETHUSDTM", Multiplier: 0.01, LotSize: 1, TickSize: 0.01},
+		book: domain.OrderBook{
+			Symbol: "ETHUSDTM",
+			Bids:   []domain.PriceLevel{{Price: 99, Size: 200}, {Price: 98, Size: 1000}},
+			Asks:   []domain.PriceLevel{{Price: 100, Size: 300}, {Price: 101, Size: 500}},
+		},
+	}
+	slippage := domain.BookSlippage{Book: NewOrderBookDepth(market, market), Fallback: domain.FixedBpsSlippage{Bps: 5}}
+
+	tests := []struct {
+		side domain.OrderSide
+		size float64 // 原資産単位
+		want float64
+	}{
+		// 300 ロット = 3 を 100 で、残り 1 を 101 で
+		{side: domain.Buy, size: 4, want: 100.25},
+		{side: domain.Buy, size: 3, want: 100},
+		// 200 ロット = 2 を 99 で、残り 2 を 98 で
+		{side: domain.Sell, size: 4, want: 98.5},
+		// 板が足りない分は最後の価格帯で約定したとみなす
+		{side: domain.Sell, size: 20, want: (2*99 + 18*98) / 20.0},
+	}
+	for _, tt := range tests {
+		if got := slippage.FillPrice("ETHUSDTM", tt.side, tt.size, 99.5); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("FillPrice(%s, %v) = %v, want %v", tt.side, tt.size, got, tt.want)
+		}
+	}
+
+	// 板が空の場合は固定スリッページで見積もる
+	market.book = domain.OrderBook{Symbol: "ETHUSDTM"}
+	if got := slippage.FillPrice("ETHUSDTM", domain.Buy, 4, 100); math.Abs(got-100.05) > 1e-9 {
+		t.Errorf("FillPrice with an empty book = %v, want the fallback 100.05", got)
+	}
+}
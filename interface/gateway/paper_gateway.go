@@ -0,0 +1,499 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"crypto_trade_bot/infra/config"
+	"crypto_trade_bot/infra/storage"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MarketDataSource はペーパートレードで参照する相場データの取得元です。
+type MarketDataSource interface {
+	GetTop20USDTpairsByVolume() ([]string, error)
+	GetCurrentPrice(symbol string) (float64, error)
+	GetCandles(symbol string, granularity int, count int) ([]domain.Candle, error)
+	GetContract(symbol string) (domain.ContractSpec, error)
+	GetRecentTrades(symbol string) ([]domain.MarketTrade, error)
+	GetOrderBook(symbol string) (domain.OrderBook, error)
+}
+
+// PaperGateway は実際の注文を出さずに約定をシミュレートする KuCoinGateway の実装です。
+// 相場データは MarketDataSource から取得し、仮想のUSDT残高とポジションをファイルに保存します。
+type PaperGateway struct {
+	market MarketDataSource
+	store  *storage.JSONFile
+	costs  domain.CostModel
+
+	mu    sync.Mutex
+	state paperState
+}
+
+// paperState はペーパートレードの永続化される状態です。
+type paperState struct {
+	InitialBalance float64
+	Balance        float64
+	TotalFees      float64
+	Positions      map[string]*domain.Position
+	TotalFunding   float64
+	FundedAt       map[string]time.Time // 銘柄ごとに資金調達コストを計上済みの時刻
+	Orders         []domain.Order
+	OrderSeq       int
+	// StopRequests は未発動の逆指値注文の内容です。発動するまで Orders 上の注文は新規の状態です。
+	StopRequests map[string]domain.OrderRequest
+}
+
+// NewPaperGateway は新しい PaperGateway を生成します。保存済みの状態があれば引き継ぎます。
+// 約定価格・手数料・資金調達コストは costs に従って計算します。
+func NewPaperGateway(market MarketDataSource, costs domain.CostModel) (*PaperGateway, error) {
+	g := &PaperGateway{
+		market: market,
+		store:  storage.NewJSONFile(config.GetEnv("PAPER_STATE_FILE", "paper_state.json")),
+		costs:  costs,
+	}
+	initialBalance := config.GetEnvFloat("PAPER_INITIAL_BALANCE", 1000.0)
+	g.state = paperState{
+		InitialBalance: initialBalance,
+		Balance:        initialBalance,
+		Positions:      map[string]*domain.Position{},
+		FundedAt:       map[string]time.Time{},
+		StopRequests:   map[string]domain.OrderRequest{},
+	}
+
+	found, err := g.store.Load(&g.state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load paper state: %w", err)
+	}
+	if g.state.Positions == nil {
+		g.state.Positions = map[string]*domain.Position{}
+	}
+	if g.state.FundedAt == nil {
+		g.state.FundedAt = map[string]time.Time{}
+	}
+	if g.state.StopRequests == nil {
+		g.state.StopRequests = map[string]domain.OrderRequest{}
+	}
+	if found {
+		log.Printf("Loaded paper state: balance %.4f USDT, %d open positions", g.state.Balance, len(g.state.Positions))
+	}
+	return g, nil
+}
+
+// Orders はこれまでに約定したペーパー注文の履歴を返します。
+func (g *PaperGateway) Orders() []domain.Order {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	orders := make([]domain.Order, len(g.state.Orders))
+	copy(orders, g.state.Orders)
+	return orders
+}
+
+// InitialBalance はペーパートレード開始時の残高を返します。
+func (g *PaperGateway) InitialBalance() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state.InitialBalance
+}
+
+// TotalFunding はペーパートレード開始時からの資金調達コストの累計を返します。
+func (g *PaperGateway) TotalFunding() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state.TotalFunding
+}
+
+// GetTop20USDTpairsByVolume は相場データの取得元にそのまま委譲します。
+func (g *PaperGateway) GetTop20USDTpairsByVolume() ([]string, error) {
+	return g.market.GetTop20USDTpairsByVolume()
+}
+
+// GetCurrentPrice は相場データの取得元から価格を取得し、保有中であれば資金調達コストを計上します。
+// 価格が未発動の逆指値注文の発動価格に達していれば、その価格で約定させます。
+func (g *PaperGateway) GetCurrentPrice(symbol string) (float64, error) {
+	price, err := g.market.GetCurrentPrice(symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	funded := g.accrueFunding(symbol, price, time.Now())
+	if g.triggerStops(symbol, price) || funded {
+		if err := g.store.Save(&g.state); err != nil {
+			return 0, fmt.Errorf("failed to save paper state: %w", err)
+		}
+	}
+	return price, nil
+}
+
+// GetContract は相場データの取得元にそのまま委譲します。
+func (g *PaperGateway) GetContract(symbol string) (domain.ContractSpec, error) {
+	return g.market.GetContract(symbol)
+}
+
+// GetRecentTrades は相場データの取得元にそのまま委譲します。ペーパー注文の約定は含みません。
+func (g *PaperGateway) GetRecentTrades(symbol string) ([]domain.MarketTrade, error) {
+	return g.market.GetRecentTrades(symbol)
+}
+
+// GetOrderBook は相場データの取得元にそのまま委譲します。
+func (g *PaperGateway) GetOrderBook(symbol string) (domain.OrderBook, error) {
+	return g.market.GetOrderBook(symbol)
+}
+
+// GetCandles は相場データの取得元にそのまま委譲します。
+func (g *PaperGateway) GetCandles(symbol string, granularity int, count int) ([]domain.Candle, error) {
+	return g.market.GetCandles(symbol, granularity, count)
+}
+
+// CreateOrder は注文を現在価格にスリッページを加えた価格で約定させ、テイカー手数料を差し引きます。
+// 注文数量は実際の取引所と同じくロット数で、契約仕様に沿っているかを検証します。
+// 指値注文は現在価格で即時に約定できる場合のみ受け付け、板に残る注文はサポートしません。
+// 逆指値注文は発動価格に達するまで保持し、GetCurrentPrice で価格を確認したときに成行で約定させます。
+func (g *PaperGateway) CreateOrder(req domain.OrderRequest) (string, error) {
+	if err := req.Validate(); err != nil {
+		return "", fmt.Errorf("invalid order request: %w: %w", err, domain.ErrRejected)
+	}
+	spec, err := g.market.GetContract(req.Symbol)
+	if err != nil {
+		return "", fmt.Errorf("failed to get contract for paper order: %w", err)
+	}
+	price, err := g.market.GetCurrentPrice(req.Symbol)
+	if err != nil {
+		return "", fmt.Errorf("failed to get price for paper fill: %w", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if req.ClientOID != "" {
+		if _, ok := g.findByClientOID(req.ClientOID); ok {
+			return "", fmt.Errorf("paper order with clientOid %s already exists: %w", req.ClientOID, domain.ErrRejected)
+		}
+	}
+	g.state.OrderSeq++
+	order := domain.Order{
+		ID:         fmt.Sprintf("paper-%d", g.state.OrderSeq),
+		ClientOID:  req.ClientOID,
+		Symbol:     req.Symbol,
+		Side:       req.Side,
+		Type:       req.Type,
+		Amount:     req.Size,
+		Multiplier: spec.Multiplier,
+		Status:     domain.OrderStatusNew,
+		Stop:       req.Stop,
+		StopPrice:  req.StopPrice,
+		CreatedAt:  time.Now(),
+	}
+	if req.Stop != "" && !domain.StopTriggered(req.Stop, req.StopPrice, price) {
+		g.state.Orders = append(g.state.Orders, order)
+		g.state.StopRequests[order.ID] = req
+		if err := g.store.Save(&g.state); err != nil {
+			return "", fmt.Errorf("failed to save paper state: %w", err)
+		}
+		log.Printf("[PAPER] Stop order %s: %s %s %v lots when price goes %s to %.4f", order.ID, req.Side, req.Symbol, req.Size, req.Stop, req.StopPrice)
+		return order.ID, nil
+	}
+
+	if err := g.fill(&order, req, spec, price); err != nil {
+		g.state.OrderSeq--
+		return "", fmt.Errorf("%w: %w", err, domain.ErrRejected)
+	}
+	g.state.Orders = append(g.state.Orders, order)
+	if err := g.store.Save(&g.state); err != nil {
+		return "", fmt.Errorf("failed to save paper state: %w", err)
+	}
+	return order.ID, nil
+}
+
+// fill は注文を price を基準に約定させ、ポジションと残高、注文の約定結果に反映します。
+func (g *PaperGateway) fill(order *domain.Order, req domain.OrderRequest, spec domain.ContractSpec, price float64) error {
+	symbol, side := req.Symbol, req.Side
+
+	lots := req.Size
+	if req.ReduceOnly || req.CloseOrder {
+		pos := g.state.Positions[symbol]
+		if pos == nil || pos.Side == side {
+			return fmt.Errorf("reduce-only order would not reduce a position on %s", symbol)
+		}
+		if posLots := spec.RoundLots(pos.Size / spec.Multiplier); req.CloseOrder || lots > posLots {
+			lots = posLots
+		}
+	}
+	if err := spec.ValidateLots(lots); err != nil {
+		return err
+	}
+	qty := lots * spec.Multiplier
+
+	fillPrice := g.costs.Slippage.FillPrice(symbol, side, qty, price)
+	if req.Type == domain.OrderTypeLimit {
+		marketable := (side == domain.Buy && req.Price >= price) || (side == domain.Sell && req.Price <= price)
+		switch {
+		case req.PostOnly && marketable:
+			return fmt.Errorf("post-only order at %.4f would take liquidity (price %.4f)", req.Price, price)
+		case !marketable:
+			return fmt.Errorf("paper trading cannot rest limit orders: %s at %.4f, price %.4f", side, req.Price, price)
+		}
+		// 指値より不利な価格では約定しない
+		if (side == domain.Buy && fillPrice > req.Price) || (side == domain.Sell && fillPrice < req.Price) {
+			fillPrice = req.Price
+		}
+	}
+	fee := g.costs.Fee.Fee(fillPrice*qty, domain.Taker)
+
+	g.accrueFunding(symbol, price, time.Now())
+
+	leverage := req.Leverage
+	if leverage == 0 {
+		leverage = 1
+	}
+	if spec.MaxLeverage > 0 && leverage > spec.MaxLeverage {
+		return fmt.Errorf("leverage %vx exceeds the maximum %vx on %s", leverage, spec.MaxLeverage, symbol)
+	}
+	if err := g.applyFill(symbol, spec, side, qty, fillPrice, fee, leverage); err != nil {
+		return err
+	}
+
+	order.Price, order.Amount, order.FilledSize, order.Fee = fillPrice, lots, lots, fee
+	order.Status = domain.OrderStatusFilled
+	log.Printf("[PAPER] %s %s %v lots (%.6f) @ %.4f (fee %.4f), balance %.4f USDT", side, symbol, lots, qty, fillPrice, fee, g.state.Balance)
+	return nil
+}
+
+// triggerStops は price が発動価格に達した銘柄の逆指値注文を約定させます。
+// 建玉がなくなっているなどで約定できない場合は、取引所と同じく注文を取り消します。状態が変化した場合は true を返します。
+func (g *PaperGateway) triggerStops(symbol string, price float64) bool {
+	changed := false
+	for i := range g.state.Orders {
+		order := &g.state.Orders[i]
+		req, ok := g.state.StopRequests[order.ID]
+		if !ok || req.Symbol != symbol || !domain.StopTriggered(req.Stop, req.StopPrice, price) {
+			continue
+		}
+		delete(g.state.StopRequests, order.ID)
+		changed = true
+
+		spec, err := g.market.GetContract(symbol)
+		if err == nil {
+			err = g.fill(order, req, spec, price)
+		}
+		if err != nil {
+			order.Status = domain.OrderStatusCanceled
+			log.Printf("[PAPER] Stop order %s triggered at %.4f but was canceled: %v", order.ID, price, err)
+			continue
+		}
+		log.Printf("[PAPER] Stop order %s triggered at %.4f", order.ID, price)
+	}
+	return changed
+}
+
+// GetOrder はペーパー注文を返します。逆指値注文以外は発注時に全量が約定します。
+func (g *PaperGateway) GetOrder(orderID string) (domain.Order, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, o := range g.state.Orders {
+		if o.ID == orderID {
+			return o, nil
+		}
+	}
+	return domain.Order{}, fmt.Errorf("paper order not found: %s", orderID)
+}
+
+// GetPositions はペーパートレードで保有中の建玉を銘柄順に返します。
+// 以前の状態ファイルに残っている1ロットに満たない端数の建玉は返しません。
+func (g *PaperGateway) GetPositions() ([]domain.Position, error) {
+	g.mu.Lock()
+	positions := make([]domain.Position, 0, len(g.state.Positions))
+	for _, p := range g.state.Positions {
+		positions = append(positions, *p)
+	}
+	g.mu.Unlock()
+
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+	open := positions[:0]
+	for _, p := range positions {
+		spec, err := g.market.GetContract(p.Symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get contract for paper position: %w", err)
+		}
+		if p.Lots = spec.RoundLots(p.Size / spec.Multiplier); p.Lots > 0 {
+			open = append(open, p)
+		}
+	}
+	return open, nil
+}
+
+// GetOrderByClientOID は発注時の clientOid でペーパー注文を返します。見つからない場合は domain.ErrOrderNotFound を返します。
+func (g *PaperGateway) GetOrderByClientOID(clientOID string) (domain.Order, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if i, ok := g.findByClientOID(clientOID); ok {
+		return g.state.Orders[i], nil
+	}
+	return domain.Order{}, fmt.Errorf("paper clientOid %s: %w", clientOID, domain.ErrOrderNotFound)
+}
+
+// findByClientOID は clientOid が一致するペーパー注文の添字を返します。
+func (g *PaperGateway) findByClientOID(clientOID string) (int, bool) {
+	for i, o := range g.state.Orders {
+		if o.ClientOID == clientOID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// GetOpenOrders は未発動の逆指値注文を返します。symbol が空の場合は全銘柄が対象です。
+func (g *PaperGateway) GetOpenOrders(symbol string) ([]domain.Order, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var orders []domain.Order
+	for _, o := range g.state.Orders {
+		if _, ok := g.state.StopRequests[o.ID]; ok && (symbol == "" || o.Symbol == symbol) {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+// CancelOrder は未発動の逆指値注文を取り消します。約定済みの注文は取り消せない理由をエラーで返します。
+func (g *PaperGateway) CancelOrder(orderID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.state.Orders {
+		if g.state.Orders[i].ID != orderID {
+			continue
+		}
+		if _, ok := g.state.StopRequests[orderID]; !ok {
+			return fmt.Errorf("paper order %s is already %s", orderID, g.state.Orders[i].Status)
+		}
+		g.cancelStop(&g.state.Orders[i])
+		if err := g.store.Save(&g.state); err != nil {
+			return fmt.Errorf("failed to save paper state: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("paper order not found: %s", orderID)
+}
+
+// CancelOrderByClientOID は発注時の clientOid を指定して未発動の逆指値注文を取り消します。
+func (g *PaperGateway) CancelOrderByClientOID(symbol, clientOID string) error {
+	g.mu.Lock()
+	var order domain.Order
+	i, ok := g.findByClientOID(clientOID)
+	if ok {
+		order = g.state.Orders[i]
+	}
+	g.mu.Unlock()
+	if !ok || order.Symbol != symbol {
+		return fmt.Errorf("paper order with clientOid %s not found on %s", clientOID, symbol)
+	}
+	return g.CancelOrder(order.ID)
+}
+
+// CancelAllOrders は銘柄の未発動の逆指値注文を全て取り消します。
+func (g *PaperGateway) CancelAllOrders(symbol string) ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var canceled []string
+	for i := range g.state.Orders {
+		o := &g.state.Orders[i]
+		if _, ok := g.state.StopRequests[o.ID]; ok && o.Symbol == symbol {
+			g.cancelStop(o)
+			canceled = append(canceled, o.ID)
+		}
+	}
+	if len(canceled) == 0 {
+		return nil, nil
+	}
+	if err := g.store.Save(&g.state); err != nil {
+		return canceled, fmt.Errorf("failed to save paper state: %w", err)
+	}
+	return canceled, nil
+}
+
+func (g *PaperGateway) cancelStop(order *domain.Order) {
+	delete(g.state.StopRequests, order.ID)
+	order.Status = domain.OrderStatusCanceled
+	log.Printf("[PAPER] Canceled stop order %s", order.ID)
+}
+
+// applyFill は約定をポジションと残高に反映します。反対売買の場合は損益を確定させます。
+// 新たに建てる分には leverage に応じた証拠金が必要です。建玉は基軸通貨の数量で持つため、
+// 分割決済で1ロットに満たない端数が残った場合は決済済みとして扱います。
+func (g *PaperGateway) applyFill(symbol string, spec domain.ContractSpec, side domain.OrderSide, qty, price, fee, leverage float64) error {
+	pos := g.state.Positions[symbol]
+	belowOneLot := func(q float64) bool { return spec.RoundLots(q/spec.Multiplier) <= 0 }
+
+	openQty := qty
+	if pos != nil && pos.Side != side {
+		openQty = math.Max(0, qty-pos.Size)
+		if belowOneLot(openQty) {
+			openQty = 0
+		}
+	}
+	if required := openQty*price/leverage + fee; required > g.availableBalance() {
+		return fmt.Errorf("insufficient paper balance: required %.4f, available %.4f", required, g.availableBalance())
+	}
+
+	g.state.Balance -= fee
+	g.state.TotalFees += fee
+
+	switch {
+	case pos == nil:
+		g.state.Positions[symbol] = &domain.Position{Symbol: symbol, Side: side, Size: qty, EntryPrice: price, Leverage: leverage, OpenedAt: time.Now()}
+	case pos.Side == side:
+		pos.EntryPrice = (pos.Notional() + qty*price) / (pos.Size + qty)
+		pos.Size += qty
+		pos.Leverage = leverage
+	default:
+		closeQty := math.Min(qty, pos.Size)
+		realized := (&domain.Position{Side: pos.Side, Size: closeQty, EntryPrice: pos.EntryPrice}).UnrealizedPnL(price)
+		g.state.Balance += realized
+		pos.Size -= closeQty
+		log.Printf("[PAPER] Realized PnL on %s: %.4f USDT", symbol, realized)
+		if belowOneLot(pos.Size) {
+			delete(g.state.Positions, symbol)
+			delete(g.state.FundedAt, symbol)
+		}
+		if openQty > 0 {
+			g.state.Positions[symbol] = &domain.Position{Symbol: symbol, Side: side, Size: openQty, EntryPrice: price, Leverage: leverage, OpenedAt: time.Now()}
+		}
+	}
+	return nil
+}
+
+// accrueFunding は前回計上時から now までの資金調達コストを残高に反映します。計上した場合は true を返します。
+func (g *PaperGateway) accrueFunding(symbol string, markPrice float64, now time.Time) bool {
+	pos := g.state.Positions[symbol]
+	if pos == nil {
+		return false
+	}
+	from, ok := g.state.FundedAt[symbol]
+	if !ok {
+		from = pos.OpenedAt
+	}
+	g.state.FundedAt[symbol] = now
+
+	funding := g.costs.Funding.Funding(*pos, markPrice, from, now)
+	if funding == 0 {
+		return false
+	}
+	g.state.Balance -= funding
+	g.state.TotalFunding += funding
+	log.Printf("[PAPER] Funding on %s: %.4f USDT (total %.4f)", symbol, funding, g.state.TotalFunding)
+	return true
+}
+
+// availableBalance は建玉ごとのレバレッジに応じた証拠金を除いた残高を返します。
+func (g *PaperGateway) availableBalance() float64 {
+	used := 0.0
+	for _, p := range g.state.Positions {
+		used += p.Margin()
+	}
+	return g.state.Balance - used
+}
@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"crypto_trade_bot/domain"
+	"crypto_trade_bot/usecase"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stubMarket は固定の価格・契約仕様・板を返す MarketDataSource です。
+type stubMarket struct {
+	price float64
+	spec  domain.ContractSpec
+	book  domain.OrderBook
+}
+
+func (m *stubMarket) GetTop20USDTpairsByVolume() ([]string, error) { return nil, nil }
+func (m *stubMarket) GetCurrentPrice(string) (float64, error)      { return m.price, nil }
+func (m *stubMarket) GetCandles(string, int, int) ([]domain.Candle, error) {
+	return nil, nil
+}
+func (m *stubMarket) GetContract(string) (domain.ContractSpec, error) { return m.spec, nil }
+func (m *stubMarket) GetRecentTrades(string) ([]domain.MarketTrade, error) {
+	return nil, nil
+}
+func (m *stubMarket) GetOrderBook(string) (domain.OrderBook, error) {
+	return m.book, nil
+}
+
+// flatFunding は計上するたびに建玉の有無にかかわらず一定額を資金調達コストとする FundingModel です。
+type flatFunding float64
+
+func (f flatFunding) Funding(domain.Position, float64, time.Time, time.Time) float64 {
+	return float64(f)
+}
+
+// newTestPaperGateway は一時ファイルに状態を保存する残高 1000 USDT の PaperGateway を返します。
+func newTestPaperGateway(t *testing.T, market *stubMarket, costs domain.CostModel) *PaperGateway {
+	t.Helper()
+	t.Setenv("PAPER_STATE_FILE", filepath.Join(t.TempDir(), "paper_state.json"))
+	t.Setenv("PAPER_INITIAL_BALANCE", "1000")
+	g, err := NewPaperGateway(market, costs)
+	if err != nil {
+		t.Fatalf("NewPaperGateway: %v", err)
+	}
+	return g
+}
+
+func TestPaperReportIncludesFunding(t *testing.T) {
+	market := &stubMarket{price: 100, spec: domain.ContractSpec{Symbol: "XBTUSDTM", Multiplier: 1, LotSize: 1, TickSize: 0.01}}
+	costs := domain.NoCostModel()
+	costs.Fee = domain.FixedBpsFee{Bps: 10}
+	costs.Funding = flatFunding(0.5)
+	g := newTestPaperGateway(t, market, costs)
+
+	if _, err := g.CreateOrder(domain.OrderRequest{ClientOID: "entry", Symbol: "XBTUSDTM", Side: domain.Buy, Type: domain.OrderTypeMarket, Size: 2}); err != nil {
+		t.Fatalf("entry: %v", err)
+	}
+	// 価格を確認したときと決済したときに資金調達コストを計上する
+	market.price = 110
+	if _, err := g.GetCurrentPrice("XBTUSDTM"); err != nil {
+		t.Fatalf("GetCurrentPrice: %v", err)
+	}
+	if _, err := g.CreateOrder(domain.OrderRequest{ClientOID: "exit", Symbol: "XBTUSDTM", Side: domain.Sell, Type: domain.OrderTypeMarket, Size: 2, ReduceOnly: true}); err != nil {
+		t.Fatalf("exit: %v", err)
+	}
+	if g.TotalFunding() != 1 {
+		t.Fatalf("TotalFunding = %v, want 1", g.TotalFunding())
+	}
+
+	report := usecase.BuildPerformanceReport("paper", g.Orders(), g.InitialBalance(), g.TotalFunding(), nil)
+	// 粗利 20、手数料 0.2 + 0.22、資金調達 1
+	checks := []struct {
+		field     string
+		got, want float64
+	}{
+		{"GrossPnL", report.GrossPnL, 20},
+		{"TotalCosts", report.TotalCosts, 1.42},
+		{"NetPnL", report.NetPnL, 18.58},
+		{"FinalEquity", report.FinalEquity, g.state.Balance},
+	}
+	for _, c := range checks {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+		}
+	}
+}
+
+func TestPaperPartialClosesLeaveNoPosition(t *testing.T) {
+	market := &stubMarket{price: 3000, spec: domain.ContractSpec{Symbol: "ETHUSDTM", Multiplier: 0.01, LotSize: 1, TickSize: 0.01}}
+	g := newTestPaperGateway(t, market, domain.NoCostModel())
+
+	orders := []domain.OrderRequest{
+		{ClientOID: "entry", Symbol: "ETHUSDTM", Side: domain.Buy, Type: domain.OrderTypeMarket, Size: 5},
+		{ClientOID: "tp1", Symbol: "ETHUSDTM", Side: domain.Sell, Type: domain.OrderTypeMarket, Size: 2, ReduceOnly: true},
+		{ClientOID: "tp2", Symbol: "ETHUSDTM", Side: domain.Sell, Type: domain.OrderTypeMarket, Size: 3, ReduceOnly: true},
+	}
+	for _, req := range orders {
+		if _, err := g.CreateOrder(req); err != nil {
+			t.Fatalf("%s: %v", req.ClientOID, err)
+		}
+		if req.ClientOID == "tp1" {
+			positions, err := g.GetPositions()
+			if err != nil {
+				t.Fatalf("GetPositions: %v", err)
+			}
+			if len(positions) != 1 || positions[0].Lots != 3 {
+				t.Fatalf("positions after the first close = %+v, want 3 lots", positions)
+			}
+		}
+	}
+
+	// 0.05 - 0.02 - 0.03 の浮動小数点の端数を建玉として残さない
+	positions, err := g.GetPositions()
+	if err != nil {
+		t.Fatalf("GetPositions: %v", err)
+	}
+	if len(positions) != 0 || len(g.state.Positions) != 0 {
+		t.Errorf("positions left after closing in parts: %+v, state %+v", positions, g.state.Positions)
+	}
+
+	// 端数が残っていないため、反対側の新規建ても同じ数量で建つ
+	if _, err := g.CreateOrder(domain.OrderRequest{ClientOID: "short", Symbol: "ETHUSDTM", Side: domain.Sell, Type: domain.OrderTypeMarket, Size: 1}); err != nil {
+		t.Fatalf("short: %v", err)
+	}
+	if pos := g.state.Positions["ETHUSDTM"]; pos == nil || pos.Side != domain.Sell || math.Abs(pos.Size-0.01) > 1e-12 {
+		t.Errorf("position after the new entry = %+v, want a 0.01 short", pos)
+	}
+}
+
+func TestPaperGetPositionsSkipsDust(t *testing.T) {
+	market := &stubMarket{price: 3000, spec: domain.ContractSpec{Symbol: "ETHUSDTM", Multiplier: 0.01, LotSize: 1, TickSize: 0.01}}
+	g := newTestPaperGateway(t, market, domain.NoCostModel())
+	// 修正前の状態ファイルに残った端数
+	g.state.Positions["ETHUSDTM"] = &domain.Position{Symbol: "ETHUSDTM", Side: domain.Buy, Size: 3.47e-18, EntryPrice: 3000, Leverage: 1}
+
+	positions, err := g.GetPositions()
+	if err != nil {
+		t.Fatalf("GetPositions: %v", err)
+	}
+	if len(positions) != 0 {
+		t.Errorf("GetPositions = %+v, want no positions", positions)
+	}
+}
@@ -0,0 +1,147 @@
+package presenter
+
+import (
+	"crypto_trade_bot/domain"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	chartWidth  = 900
+	chartHeight = 240
+)
+
+// ReportWriter はパフォーマンスレポートをJSONと単体で閲覧できるHTMLとして書き出します。
+type ReportWriter struct {
+	dir string
+}
+
+// NewReportWriter は新しいReportWriterを生成します。
+func NewReportWriter(dir string) *ReportWriter {
+	return &ReportWriter{dir: dir}
+}
+
+// WriteReport は <dir>/<name>.json と <dir>/<name>.html を書き出します。
+func (w *ReportWriter) WriteReport(report domain.PerformanceReport) error {
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+	base := filepath.Join(w.dir, strings.ReplaceAll(report.Name, "/", "_"))
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(base+".json", data, 0o644); err != nil {
+		return fmt.Errorf("failed to write json report: %w", err)
+	}
+
+	f, err := os.Create(base + ".html")
+	if err != nil {
+		return fmt.Errorf("failed to create html report: %w", err)
+	}
+	defer f.Close()
+
+	equity := make([]float64, len(report.EquityCurve))
+	for i, p := range report.EquityCurve {
+		equity[i] = p.Equity
+	}
+	drawdown := make([]float64, len(report.DrawdownCurve))
+	for i, p := range report.DrawdownCurve {
+		drawdown[i] = p.Drawdown
+	}
+
+	view := struct {
+		domain.PerformanceReport
+		Width, Height  int
+		EquityPoints   string
+		DrawdownPoints string
+	}{
+		PerformanceReport: report,
+		Width:             chartWidth,
+		Height:            chartHeight,
+		EquityPoints:      polyline(equity),
+		DrawdownPoints:    polyline(drawdown),
+	}
+	if err := reportTemplate.Execute(f, view); err != nil {
+		return fmt.Errorf("failed to render html report: %w", err)
+	}
+	return nil
+}
+
+// polyline は系列をチャート領域に収まるSVGの座標列に変換します。
+func polyline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+
+	var b strings.Builder
+	for i, v := range values {
+		x := 0.0
+		if len(values) > 1 {
+			x = float64(i) / float64(len(values)-1) * chartWidth
+		}
+		y := (hi - v) / (hi - lo) * chartHeight
+		fmt.Fprintf(&b, "%.1f,%.1f ", x, y)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<title>Performance Report - {{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th { background: #f4f4f4; text-align: left; }
+svg { background: #fafafa; border: 1px solid #ddd; margin-bottom: 1.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>{{.Start.Format "2006-01-02 15:04"}} - {{.End.Format "2006-01-02 15:04"}}</p>
+<table>
+<tr><th>Initial capital</th><td>{{printf "%.2f" .InitialCapital}}</td></tr>
+<tr><th>Final equity</th><td>{{printf "%.2f" .FinalEquity}}</td></tr>
+<tr><th>Total return</th><td>{{printf "%.2f%%" .TotalReturn}}</td></tr>
+<tr><th>CAGR</th><td>{{printf "%.2f%%" .CAGR}}</td></tr>
+<tr><th>Sharpe</th><td>{{printf "%.2f" .Sharpe}}</td></tr>
+<tr><th>Sortino</th><td>{{printf "%.2f" .Sortino}}</td></tr>
+<tr><th>Max drawdown</th><td>{{printf "%.2f%%" .MaxDrawdown}}</td></tr>
+<tr><th>Max drawdown duration</th><td>{{printf "%.1f days" .MaxDrawdownDays}}</td></tr>
+<tr><th>Gross PnL</th><td>{{printf "%.4f" .GrossPnL}}</td></tr>
+<tr><th>Costs (fees + funding)</th><td>{{printf "%.4f" .TotalCosts}}</td></tr>
+<tr><th>Net PnL</th><td>{{printf "%.4f" .NetPnL}}</td></tr>
+<tr><th>Trades</th><td>{{.Trades}}</td></tr>
+<tr><th>Win rate</th><td>{{printf "%.2f%%" .WinRate}}</td></tr>
+<tr><th>Profit factor</th><td>{{printf "%.2f" .ProfitFactor}}</td></tr>
+<tr><th>Average trade PnL</th><td>{{printf "%.4f" .AverageTradePnL}}</td></tr>
+<tr><th>Exposure</th><td>{{printf "%.2f%%" .Exposure}}</td></tr>
+</table>
+<h2>Equity</h2>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}"><polyline fill="none" stroke="#2a7ae2" stroke-width="1.5" points="{{.EquityPoints}}"/></svg>
+<h2>Drawdown</h2>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}"><polyline fill="none" stroke="#d9534f" stroke-width="1.5" points="{{.DrawdownPoints}}"/></svg>
+<h2>Trades</h2>
+<table>
+<tr><th>Symbol</th><th>Side</th><th>Entry</th><th>Entry price</th><th>Exit</th><th>Exit price</th><th>Size</th><th>Gross PnL</th><th>Costs</th><th>Net PnL</th></tr>
+{{range .RoundTrips}}<tr><td>{{.Symbol}}</td><td>{{.Side}}</td><td>{{.EntryTime.Format "2006-01-02 15:04"}}</td><td>{{printf "%.4f" .EntryPrice}}</td><td>{{.ExitTime.Format "2006-01-02 15:04"}}</td><td>{{printf "%.4f" .ExitPrice}}</td><td>{{printf "%.6f" .Size}}</td><td>{{printf "%.4f" .GrossPnL}}</td><td>{{printf "%.4f" .Costs}}</td><td>{{printf "%.4f" .PnL}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"log"
+	"time"
+)
+
+// AccountEventStream は自分の注文・建玉・残高の変化を配信するストリームのインターフェースです。
+type AccountEventStream interface {
+	SubscribeAccountEvents() (<-chan domain.AccountEvent, func())
+}
+
+// SetAccountEventStream は注文と建玉の変化を受け取るストリームを設定します。
+// 設定すると、注文の約定や取消を待つ間と取引監視で、次の定期確認を待たずに取引所の状態を確認します。
+// 約定や建玉の状態そのものは従来どおり REST で確認するため、ストリームが止まっても確認が遅れるだけです。
+func (uc *TradingUsecase) SetAccountEventStream(s AccountEventStream) {
+	uc.accountEvents = s
+	uc.executor.SetAccountEventStream(s)
+}
+
+// SetAccountEventStream は注文の約定を待つ間に、注文の変化を受け取るストリームを設定します。
+func (e *OrderExecutor) SetAccountEventStream(s AccountEventStream) {
+	e.accountEvents = s
+}
+
+// subscribeAccountEvents はストリームがあれば購読を開始します。ストリームがない場合は nil のチャネルと何もしない関数を返します。
+func subscribeAccountEvents(s AccountEventStream) (<-chan domain.AccountEvent, func()) {
+	if s == nil {
+		return nil, func() {}
+	}
+	return s.SubscribeAccountEvents()
+}
+
+// waitForOrderEvent は注文 orderID の変化が届くか d が経過するまで待ちます。events が nil の場合は d だけ待ちます。
+func waitForOrderEvent(events <-chan domain.AccountEvent, orderID string, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if ev.Order != nil && ev.Order.Order.ID == orderID {
+				return
+			}
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// 取引所の建玉がボットの決済注文によらずに減った場合に、決済として記録するラベルです。
+const (
+	liquidationLabel   = "Liquidation"
+	adlLabel           = "Auto-deleverage"
+	outsideCloseLabel  = "Closed outside the bot"
+	outsideReduceLabel = "Reduced outside the bot"
+)
+
+// applyPositionEvent は建玉がなくなった、または強制決済されたという変化 ev を受けて取引所の建玉を確認し、
+// 保存した残りより小さくなっていれば、その差をボットの外で決済されたものとしてマーク価格で記録します。
+// 建玉がなくなった場合は、先に取引所の決済注文を取り消してその約定を記録します。記録した場合は true を返します。
+func (uc *TradingUsecase) applyPositionEvent(trade *domain.ActiveTrade, ev domain.PositionEvent, latestPrice float64) bool {
+	pos, err := uc.exchangePosition(trade.Symbol)
+	if err != nil {
+		log.Printf("Could not check the %s position after a position change: %v", trade.Symbol, err)
+		return false
+	}
+	lots := 0.0
+	if pos != nil && pos.Side == trade.Side {
+		lots = pos.Lots
+	}
+	if lots >= trade.RemainingSize {
+		return false
+	}
+
+	if lots == 0 && trade.UsesBracket() {
+		uc.cancelBracket(trade)
+	}
+	closed := trade.RemainingSize - lots
+	if closed <= 0 {
+		return true
+	}
+	label := outsideReduceLabel
+	switch {
+	case ev.Reason == domain.PositionChangeLiquidation:
+		label = liquidationLabel
+	case ev.Reason == domain.PositionChangeADL:
+		label = adlLabel
+	case lots == 0:
+		label = outsideCloseLabel
+	}
+	price := ev.MarkPrice
+	if price <= 0 {
+		price = latestPrice
+	}
+	at := ev.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	trade.RecordExit(domain.ExitFill{Label: label, Size: closed, Price: price, At: at}, -1)
+	fill := trade.Exits[len(trade.Exits)-1]
+	log.Printf("%s on %s: %v lots @ %.4f (mark price), realized PnL: %.4f USD. Remaining: %v lots",
+		label, trade.Symbol, fill.Size, fill.Price, fill.PnL, trade.RemainingSize)
+	return true
+}
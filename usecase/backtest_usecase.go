@@ -0,0 +1,172 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"log"
+	"time"
+)
+
+// KlineProvider はローソク足データの取得元を表すインターフェースです。
+// KuCoinGateway と同じく古い順に並べて返すため、ライブ分析と同じロジックで検証できます。
+type KlineProvider interface {
+	GetCandles(symbol string, granularity int, count int) ([]domain.Candle, error)
+}
+
+// BacktestUsecase は過去のローソク足でトレンド判定ロジックを検証するユースケースを実装します。
+type BacktestUsecase struct {
+	klineProvider KlineProvider
+	signalConfig  domain.SignalConfig
+	costs         domain.CostModel
+}
+
+// NewBacktestUsecase は新しい BacktestUsecase を生成します。
+func NewBacktestUsecase(kp KlineProvider, signalConfig domain.SignalConfig, costs domain.CostModel) *BacktestUsecase {
+	return &BacktestUsecase{
+		klineProvider: kp,
+		signalConfig:  signalConfig,
+		costs:         costs,
+	}
+}
+
+// RunBacktest は指定された銘柄ごとにバックテストを実行します。
+func (uc *BacktestUsecase) RunBacktest(symbols []string, granularity int, amountUSD, initialCapital float64) ([]domain.BacktestResult, error) {
+	if amountUSD <= 0 {
+		return nil, fmt.Errorf("amount must be positive: %.2f", amountUSD)
+	}
+
+	var results []domain.BacktestResult
+	for _, symbol := range symbols {
+		log.Printf("Backtesting %s...", symbol)
+		candles, err := uc.klineProvider.GetCandles(symbol, granularity, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get klines for %s: %w", symbol, err)
+		}
+		times, closePrices := domain.CandleCloses(candles)
+		params := uc.signalConfig.ParamsFor(symbol)
+		results = append(results, simulate(symbol, times, closePrices, 0, amountUSD, initialCapital, params, uc.costs))
+	}
+	return results, nil
+}
+
+// backtestPosition はシミュレーション中の保有ポジションです。
+type backtestPosition struct {
+	trade       domain.Trade
+	refEntry    float64 // スリッページを含まない基準の建値
+	targetPrice float64
+	fundedAt    time.Time
+}
+
+// simulate は終値を1本ずつ流し、ライブと同じシグナル判定と1%利益確定を再現します。
+// 約定には costs のスリッページ・手数料を適用し、保有中は資金調達コストを積み上げます。
+// tradeFrom より前の足はインジケーターのウォームアップにのみ使い、取引と資産曲線には含めません。
+func simulate(symbol string, times []time.Time, closePrices []float64, tradeFrom int, amountUSD, initialCapital float64, params domain.SignalParams, costs domain.CostModel) domain.BacktestResult {
+	result := domain.BacktestResult{
+		Symbol:         symbol,
+		InitialCapital: initialCapital,
+	}
+
+	realized := initialCapital
+	var position *backtestPosition
+
+	for i := tradeFrom; i < len(closePrices); i++ {
+		price := closePrices[i]
+		if position != nil {
+			accrueFunding(position, price, times[i], costs)
+		}
+
+		closedThisBar := false
+		if position != nil && isTakeProfitReached(string(position.trade.Side), price, position.targetPrice) {
+			trade := closeSimulatedTrade(position, times[i], price, false, costs)
+			realized += trade.PnL
+			result.Trades = append(result.Trades, trade)
+			position = nil
+			closedThisBar = true
+		}
+
+		if position == nil && !closedThisBar {
+			start := i + 1 - analysisKlineCount
+			if start < 0 {
+				start = 0
+			}
+			if signal, ok := evaluateTrendSignal(closePrices[start:i+1], params); ok {
+				side := ""
+				if signal.isLong {
+					side = "buy"
+				} else if signal.isShort {
+					side = "sell"
+				}
+				if side != "" {
+					position = openSimulatedPosition(symbol, domain.OrderSide(side), times[i], price, amountUSD/price, costs)
+				}
+			}
+		}
+
+		equity := realized
+		if position != nil {
+			equity += unrealizedPnL(position.trade, price) - position.trade.Costs()
+		}
+		result.EquityCurve = append(result.EquityCurve, domain.EquityPoint{Time: times[i], Equity: equity})
+	}
+
+	if position != nil {
+		last := len(closePrices) - 1
+		result.Trades = append(result.Trades, closeSimulatedTrade(position, times[last], closePrices[last], true, costs))
+	}
+
+	return result
+}
+
+// openSimulatedPosition はスリッページを加えた価格で建て、建て手数料を計上します。
+func openSimulatedPosition(symbol string, side domain.OrderSide, at time.Time, refPrice, size float64, costs domain.CostModel) *backtestPosition {
+	fillPrice := costs.Slippage.FillPrice(symbol, side, size, refPrice)
+	return &backtestPosition{
+		trade: domain.Trade{
+			Symbol:     symbol,
+			Side:       side,
+			EntryTime:  at,
+			EntryPrice: fillPrice,
+			Size:       size,
+			EntryFee:   costs.Fee.Fee(fillPrice*size, domain.Taker),
+		},
+		refEntry:    refPrice,
+		targetPrice: takeProfitPrice(string(side), refPrice),
+		fundedAt:    at,
+	}
+}
+
+// accrueFunding は前回から今回の足までに発生した資金調達コストを積み上げます。
+func accrueFunding(position *backtestPosition, markPrice float64, at time.Time, costs domain.CostModel) {
+	p := domain.Position{Symbol: position.trade.Symbol, Side: position.trade.Side, Size: position.trade.Size, EntryPrice: position.trade.EntryPrice}
+	position.trade.Funding += costs.Funding.Funding(p, markPrice, position.fundedAt, at)
+	position.fundedAt = at
+}
+
+// closeSimulatedTrade はスリッページを加えた価格で決済し、グロス損益とコスト控除後の損益を記録します。
+func closeSimulatedTrade(position *backtestPosition, exitTime time.Time, refPrice float64, isOpen bool, costs domain.CostModel) domain.Trade {
+	side := position.trade.Side
+	fillPrice := costs.Slippage.FillPrice(position.trade.Symbol, oppositeSide(side), position.trade.Size, refPrice)
+
+	trade := closeBacktestTrade(position.trade, exitTime, fillPrice, isOpen)
+	trade.ExitFee = costs.Fee.Fee(fillPrice*trade.Size, domain.Taker)
+	trade.GrossPnL = unrealizedPnL(domain.Trade{Side: side, EntryPrice: position.refEntry, Size: trade.Size}, refPrice)
+	trade.PnL -= trade.Costs()
+	return trade
+}
+
+// closeBacktestTrade は約定価格どおりの損益で取引を決済します（コストは含みません）。
+func closeBacktestTrade(trade domain.Trade, exitTime time.Time, exitPrice float64, isOpen bool) domain.Trade {
+	trade.ExitTime = exitTime
+	trade.ExitPrice = exitPrice
+	trade.PnL = unrealizedPnL(trade, exitPrice)
+	trade.GrossPnL = trade.PnL
+	trade.IsOpen = isOpen
+	return trade
+}
+
+func unrealizedPnL(trade domain.Trade, price float64) float64 {
+	if trade.Side == domain.Buy {
+		return (price - trade.EntryPrice) * trade.Size
+	}
+	return (trade.EntryPrice - price) * trade.Size
+}
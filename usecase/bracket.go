@@ -0,0 +1,257 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// placeBracket は建て直後に、損切りと利益確定の各段階を取引所の逆指値注文として発注します。
+// 損切りは closeOrder で残り全量を、利益確定は reduce-only で段階のサイズを決済するため、
+// 監視ループが止まっている間にどちらが発動しても建玉を超えて約定することはありません。
+// 発注に失敗した決済は監視ループでの決済に戻ります。
+// 各注文は clientOid を保存してから発注し、結果が分からない注文は syncBracket で取引所の注文と照合します。
+func (uc *TradingUsecase) placeBracket(trade *domain.ActiveTrade, spec domain.ContractSpec) {
+	_, profitDir := bracketDirections(trade.Side)
+	for i := range trade.TakeProfits {
+		tp := &trade.TakeProfits[i]
+		price := spec.RoundPrice(tp.Price, trade.CloseSide())
+		tp.ClientOID = trade.NextClientOID()
+		orderID, err := uc.createStopOrder(trade, tp.ClientOID, profitDir, price, tp.Size)
+		switch {
+		case notPlaced(err):
+			tp.ClientOID = ""
+			log.Printf("Failed to place exchange %s order; it will be executed by the monitor only while the bot is running: %v", tp.Label, err)
+		case err != nil:
+			log.Printf("Exchange %s order %s is unconfirmed and will be checked by clientOid: %v", tp.Label, tp.ClientOID, err)
+		default:
+			tp.OrderID = orderID
+			log.Printf("%s: exchange stop order %s placed for %v lots at %.4f (%s)", tp.Label, orderID, tp.Size, price, trade.BracketStop.PriceType)
+		}
+	}
+	uc.updateBracketStop(trade, spec)
+}
+
+// updateBracketStop は取引所の損切り注文を現在有効な損切り価格に合わせます。
+// トレーリングストップが動いた場合は新しい価格で発注してから古い注文を取り消すため、保護されない時間はありません。
+// 前に出した新しい損切り注文の結果が確定していない間は動かしません。
+func (uc *TradingUsecase) updateBracketStop(trade *domain.ActiveTrade, spec domain.ContractSpec) {
+	label, price, ok := trade.ProtectiveStop()
+	if !ok || trade.BracketStop.Replacing != nil {
+		return
+	}
+	price = spec.RoundPrice(price, trade.CloseSide())
+	old := trade.BracketStop
+	if old.OrderID != "" && old.Price == price {
+		return
+	}
+
+	lossDir, _ := bracketDirections(trade.Side)
+	pending := &domain.PendingOrder{ClientOID: trade.NextClientOID(), Label: label, Target: -1, Price: price}
+	trade.BracketStop.Replacing = pending
+	orderID, err := uc.createStopOrder(trade, pending.ClientOID, lossDir, price, 0)
+	switch {
+	case notPlaced(err):
+		trade.BracketStop.Replacing = nil
+		if old.OrderID == "" {
+			log.Printf("Failed to place exchange %s order; it will be executed by the monitor only while the bot is running: %v", label, err)
+		} else {
+			log.Printf("Failed to move exchange stop order %s to %.4f; keeping it at %.4f: %v", old.OrderID, price, old.Price, err)
+		}
+	case err != nil:
+		log.Printf("Exchange %s order %s at %.4f is unconfirmed and will be checked by clientOid: %v", label, pending.ClientOID, price, err)
+	default:
+		uc.replaceBracketStop(trade, orderID)
+	}
+}
+
+// replaceBracketStop は確定した新しい損切り注文を BracketStop にし、古い注文を取り消します。
+func (uc *TradingUsecase) replaceBracketStop(trade *domain.ActiveTrade, orderID string) {
+	old, p := trade.BracketStop, trade.BracketStop.Replacing
+	trade.BracketStop.OrderID, trade.BracketStop.ClientOID = orderID, p.ClientOID
+	trade.BracketStop.Price, trade.BracketStop.Label = p.Price, p.Label
+	trade.BracketStop.Replacing = nil
+	log.Printf("%s: exchange stop order %s placed at %.4f (%s) to close the remaining position", p.Label, orderID, p.Price, trade.BracketStop.PriceType)
+
+	if old.OrderID != "" {
+		uc.cancelBracketOrder(trade, old.OrderID, old.Label, -1)
+	}
+}
+
+// resolveBracketOrders は発注結果が確定していない取引所の決済注文を clientOid で探します。
+// 見つかった注文は注文IDを記録し、見つからなかった注文は発注されなかったものとして監視ループでの決済に戻します。
+// 状態が変化した場合は true を返します。
+func (uc *TradingUsecase) resolveBracketOrders(trade *domain.ActiveTrade) bool {
+	changed := false
+	for i := range trade.TakeProfits {
+		tp := &trade.TakeProfits[i]
+		if tp.ClientOID == "" || tp.OrderID != "" || tp.Filled {
+			continue
+		}
+		order, found, ok := uc.lookupBracketOrder(tp.ClientOID, tp.Label)
+		switch {
+		case !ok:
+		case found:
+			tp.OrderID = order.ID
+			log.Printf("%s: exchange stop order %s was placed as %s", tp.Label, tp.ClientOID, order.ID)
+			changed = true
+		default:
+			tp.ClientOID = ""
+			changed = true
+		}
+	}
+	if p := trade.BracketStop.Replacing; p != nil {
+		order, found, ok := uc.lookupBracketOrder(p.ClientOID, p.Label)
+		switch {
+		case !ok:
+		case found:
+			uc.replaceBracketStop(trade, order.ID)
+			changed = true
+		default:
+			trade.BracketStop.Replacing = nil
+			changed = true
+		}
+	}
+	return changed
+}
+
+// lookupBracketOrder は clientOid で取引所の決済注文を探します。確認できなかった場合は ok が false です。
+func (uc *TradingUsecase) lookupBracketOrder(clientOID, label string) (order domain.Order, found, ok bool) {
+	order, err := uc.kucoinGateway.GetOrderByClientOID(clientOID)
+	switch {
+	case err == nil:
+		return order, true, true
+	case errors.Is(err, domain.ErrOrderNotFound):
+		log.Printf("Exchange %s order %s never reached the exchange; the monitor takes over", label, clientOID)
+		return domain.Order{}, false, true
+	default:
+		log.Printf("Could not look up exchange %s order %s: %v", label, clientOID, err)
+		return domain.Order{}, false, false
+	}
+}
+
+// syncBracket は取引所の決済注文の約定を確認して記録し、建玉がなくなった場合は残りの注文を取り消します。
+// 約定せずに取り消されていた決済注文は監視ループでの決済に戻します。状態が変化した場合は true を返します。
+func (uc *TradingUsecase) syncBracket(trade *domain.ActiveTrade) bool {
+	changed := uc.resolveBracketOrders(trade)
+	for i := range trade.TakeProfits {
+		tp := &trade.TakeProfits[i]
+		if tp.OrderID == "" || tp.Filled {
+			continue
+		}
+		done, filled := uc.settleBracketOrder(trade, tp.OrderID, tp.Label, i)
+		switch {
+		case filled:
+			// 一部だけ約定して終わった場合も、その段階は取引所に任せたものとして終える
+			tp.Filled = true
+		case done:
+			tp.OrderID, tp.ClientOID = "", ""
+		}
+		changed = changed || done
+	}
+	if id := trade.BracketStop.OrderID; id != "" {
+		done, filled := uc.settleBracketOrder(trade, id, trade.BracketStop.Label, -1)
+		if done {
+			trade.BracketStop.OrderID, trade.BracketStop.ClientOID = "", ""
+			changed = true
+		}
+		if filled && !trade.IsClosed() {
+			log.Printf("%s order %s did not close the whole position (%v lots remaining); the monitor takes over", trade.BracketStop.Label, id, trade.RemainingSize)
+		}
+	}
+
+	if trade.IsClosed() {
+		uc.cancelBracket(trade)
+	}
+	return changed
+}
+
+// settleBracketOrder は取引所の決済注文が終了したかを確認し、約定していれば記録します。
+func (uc *TradingUsecase) settleBracketOrder(trade *domain.ActiveTrade, orderID, label string, target int) (done, filled bool) {
+	order, err := uc.kucoinGateway.GetOrder(orderID)
+	if err != nil {
+		log.Printf("Could not get status of exchange %s order %s: %v", label, orderID, err)
+		return false, false
+	}
+	if !order.IsDone() || (order.FilledSize > 0 && order.Price == 0) {
+		return false, false
+	}
+	if order.FilledSize == 0 {
+		log.Printf("Exchange %s order %s was %s without any fill; the monitor takes over", label, orderID, order.Status)
+		return true, false
+	}
+	uc.recordBracketFill(trade, order, label, target)
+	return true, true
+}
+
+// cancelBracket は建玉がなくなった後に残っている取引所の決済注文を全て取り消します。
+// 発注結果が確定していない注文も、取引所にあれば取り消します。
+func (uc *TradingUsecase) cancelBracket(trade *domain.ActiveTrade) {
+	uc.resolveBracketOrders(trade)
+	for i := range trade.TakeProfits {
+		tp := &trade.TakeProfits[i]
+		if tp.OrderID != "" && !tp.Filled {
+			uc.cancelBracketOrder(trade, tp.OrderID, tp.Label, i)
+			tp.Filled = true
+		}
+	}
+	if id := trade.BracketStop.OrderID; id != "" {
+		uc.cancelBracketOrder(trade, id, trade.BracketStop.Label, -1)
+		trade.BracketStop.OrderID, trade.BracketStop.ClientOID = "", ""
+	}
+}
+
+// cancelBracketOrder は取引所の決済注文を取り消します。取消までに約定した分があれば記録します。
+func (uc *TradingUsecase) cancelBracketOrder(trade *domain.ActiveTrade, orderID, label string, target int) {
+	order, err := uc.executor.cancelRemaining(orderID)
+	if err != nil {
+		log.Printf("Failed to cancel exchange %s order %s; check the exchange: %v", label, orderID, err)
+		return
+	}
+	if order.FilledSize > 0 {
+		uc.recordBracketFill(trade, order, label, target)
+		return
+	}
+	log.Printf("Canceled exchange %s order %s", label, orderID)
+}
+
+// recordBracketFill は取引所の決済注文の約定を決済として記録します。
+func (uc *TradingUsecase) recordBracketFill(trade *domain.ActiveTrade, order domain.Order, label string, target int) {
+	trade.RecordExit(domain.ExitFill{Label: label, OrderID: order.ID, Size: order.FilledSize, Price: order.Price, Fee: order.Fee, At: time.Now()}, target)
+	fill := trade.Exits[len(trade.Exits)-1]
+	log.Printf("Exchange %s order %s filled: %v lots @ %.4f, realized PnL: %.4f USD (fee %.4f). Remaining: %v lots",
+		label, order.ID, fill.Size, fill.Price, fill.PnL, fill.Fee, trade.RemainingSize)
+}
+
+// createStopOrder は clientOid を付けた決済用の成行の逆指値注文を、取引の状態を保存してから発注します。
+// size が 0 の場合は残り全量を決済します。
+func (uc *TradingUsecase) createStopOrder(trade *domain.ActiveTrade, clientOID string, stop domain.StopDirection, price, size float64) (string, error) {
+	req := domain.OrderRequest{
+		ClientOID:     clientOID,
+		Symbol:        trade.Symbol,
+		Side:          trade.CloseSide(),
+		Type:          domain.OrderTypeMarket,
+		Size:          size,
+		ReduceOnly:    size > 0,
+		CloseOrder:    size == 0,
+		Leverage:      trade.Margin.Leverage,
+		MarginMode:    trade.Margin.Mode,
+		Stop:          stop,
+		StopPriceType: trade.BracketStop.PriceType,
+		StopPrice:     price,
+	}
+	if err := uc.tradeStore.Save(trade); err != nil {
+		return "", fmt.Errorf("%w: failed to save trade state for %s: %v", errNotSubmitted, trade.Symbol, err)
+	}
+	return uc.executor.submit(req)
+}
+
+// bracketDirections は建玉のサイドに対する損切りと利益確定の逆指値の発動方向を返します。
+func bracketDirections(side domain.OrderSide) (loss, profit domain.StopDirection) {
+	if side == domain.Buy {
+		return domain.StopDown, domain.StopUp
+	}
+	return domain.StopUp, domain.StopDown
+}
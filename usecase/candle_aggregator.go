@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// liveCandleLimit は銘柄ごとに手元に保持する元の足の最低限の本数です。1分足で1週間分です。
+const liveCandleLimit = 7 * 24 * 60
+
+// CandleStream はリアルタイムの足の更新を配信するストリームのインターフェースです。
+// 足が確定するまでは、同じ開始時刻の足が値を変えながら繰り返し届きます。
+type CandleStream interface {
+	SubscribeCandles(symbol string) (<-chan domain.Candle, func())
+}
+
+// watchedCandles は Watch している銘柄の手元の元の足です。
+type watchedCandles struct {
+	watchers   int
+	cancel     func()
+	candles    []domain.Candle // 古い順
+	backfilled bool            // 取得元の足で過去の分を補ったか
+}
+
+// CandleAggregator は1つの足の長さ（例えば1分足）の取得元から、その倍数の任意の長さの足を UTC の区切りで組み立てます。
+// KlineProvider を実装するため、分析・バックテスト・最適化はどの足の長さもこの1つの取得元に要求できます。
+// GetCandles は確定した足だけを返し、形成中の足は GetCandlesWithPartial で別に取得します。
+// ストリームを設定して Watch した銘柄は、最初に取得元で過去の足を補った後、ストリームの足で手元の系列を更新し続けます。
+// 取得元が1回に返す本数より多くの元の足が必要な場合は、SetHistory で設定した期間指定の取得元で遡って補います。
+type CandleAggregator struct {
+	source          KlineProvider
+	base            int
+	stream          CandleStream
+	history         KlineHistoryGateway
+	requestInterval time.Duration
+
+	mu      sync.Mutex
+	watched map[string]*watchedCandles
+}
+
+// NewCandleAggregator は source の base 分足から足を組み立てる CandleAggregator を生成します。
+func NewCandleAggregator(source KlineProvider, base int) *CandleAggregator {
+	return &CandleAggregator{source: source, base: base, watched: map[string]*watchedCandles{}}
+}
+
+// SetHistory は、取得元の足が要求した本数に足りない場合に、最古の足より前を遡って取得する期間指定の取得元を設定します。
+// requestInterval はレート制限を避けるためのリクエスト間隔です。
+func (a *CandleAggregator) SetHistory(h KlineHistoryGateway, requestInterval time.Duration) {
+	a.history = h
+	a.requestInterval = requestInterval
+}
+
+// SetCandleStream は Watch した銘柄の base 分足を受け取るストリームを設定します。
+func (a *CandleAggregator) SetCandleStream(s CandleStream) {
+	a.stream = s
+}
+
+// GetCandles は銘柄の granularity 分足のうち確定したものを古い順に返します。count が正の場合は直近 count 本に絞ります。
+func (a *CandleAggregator) GetCandles(symbol string, granularity int, count int) ([]domain.Candle, error) {
+	candles, _, err := a.GetCandlesWithPartial(symbol, granularity, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("no complete %dm candles for %s", granularity, symbol)
+	}
+	return candles, nil
+}
+
+// GetCandlesWithPartial は確定した granularity 分足と、形成中の足を分けて返します。形成中の足がない場合 partial は nil です。
+// count が正の場合、元の足が足りずに確定した足が count 本に満たなければエラーを返します。
+func (a *CandleAggregator) GetCandlesWithPartial(symbol string, granularity int, count int) (complete []domain.Candle, partial *domain.Candle, err error) {
+	if granularity < a.base || granularity%a.base != 0 {
+		return nil, nil, fmt.Errorf("cannot build %dm candles from %dm candles", granularity, a.base)
+	}
+	ratio := granularity / a.base
+	need := 0
+	if count > 0 {
+		// 区切りの途中から始まる最初の足と形成中の足の分を余分に取る
+		need = (count + 2) * ratio
+	}
+	candles, err := a.baseCandles(symbol, need)
+	if err != nil {
+		return nil, nil, err
+	}
+	complete, partial, err = domain.AggregateCandles(candles, a.base, granularity, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if count > 0 && len(complete) < count {
+		return nil, nil, fmt.Errorf("only %d of %d complete %dm candles for %s could be built from %d %dm candles", len(complete), count, granularity, symbol, len(candles), a.base)
+	}
+	return domain.LastCandles(complete, count), partial, nil
+}
+
+// Watch は銘柄の base 分足をストリームで受け取り始め、やめるための関数を返します。
+// ストリームが設定されていない場合は何もしません。同じ銘柄を複数回 Watch した場合は、全ての関数が呼ばれるまで続けます。
+func (a *CandleAggregator) Watch(symbol string) func() {
+	if a.stream == nil {
+		return func() {}
+	}
+	a.mu.Lock()
+	w, ok := a.watched[symbol]
+	if !ok {
+		updates, cancel := a.stream.SubscribeCandles(symbol)
+		w = &watchedCandles{cancel: cancel}
+		a.watched[symbol] = w
+		go a.receive(w, updates)
+	}
+	w.watchers++
+	a.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			w.watchers--
+			last := w.watchers == 0
+			if last {
+				delete(a.watched, symbol)
+			}
+			a.mu.Unlock()
+			if last {
+				w.cancel()
+			}
+		})
+	}
+}
+
+// receive はストリームの足を手元の系列に反映します。形成中の足は同じ開始時刻の足を置き換えて更新します。
+func (a *CandleAggregator) receive(w *watchedCandles, updates <-chan domain.Candle) {
+	for c := range updates {
+		a.mu.Lock()
+		n := len(w.candles)
+		switch {
+		case n > 0 && w.candles[n-1].Time.Equal(c.Time):
+			w.candles[n-1] = c
+		case n == 0 || w.candles[n-1].Time.Before(c.Time):
+			w.candles = append(w.candles, c)
+		default:
+			w.candles = domain.SortCandles(append(w.candles, c))
+		}
+		w.candles = domain.LastCandles(w.candles, liveCandleLimit)
+		a.mu.Unlock()
+	}
+}
+
+// baseCandles は base 分足を古い順に直近 need 本（0 の場合は全て）返します。
+// Watch している銘柄は、手元の系列で足りればそれを返し、足りなければ取得元の足で過去の分を補います。
+func (a *CandleAggregator) baseCandles(symbol string, need int) ([]domain.Candle, error) {
+	a.mu.Lock()
+	w, watched := a.watched[symbol]
+	if watched && w.backfilled && need > 0 && len(w.candles) >= need {
+		candles := append([]domain.Candle(nil), domain.LastCandles(w.candles, need)...)
+		a.mu.Unlock()
+		return candles, nil
+	}
+	a.mu.Unlock()
+
+	candles, err := a.source.GetCandles(symbol, a.base, need)
+	if err != nil {
+		return nil, err
+	}
+	if a.history != nil && need > 0 && len(candles) < need {
+		if candles, err = a.pageBack(symbol, candles, need); err != nil {
+			return nil, err
+		}
+	}
+	if !watched {
+		return candles, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// ストリームの足の方が新しいため、同じ時刻の足はストリームの足を残す
+	w.candles = domain.SortCandles(append(append([]domain.Candle(nil), candles...), w.candles...))
+	w.candles = domain.LastCandles(w.candles, max(liveCandleLimit, need))
+	w.backfilled = true
+	return append([]domain.Candle(nil), domain.LastCandles(w.candles, need)...), nil
+}
+
+// pageBack は古い順に並んだ candles の最古の足より前を、期間指定の取得元で need 本になるまで遡って補います。
+// 空のページが maxEmptyPages 回続いた場合は、それより前にデータがないものとして手元の分を返します。
+func (a *CandleAggregator) pageBack(symbol string, candles []domain.Candle, need int) ([]domain.Candle, error) {
+	bar := time.Duration(a.base) * time.Minute
+	pageEnd := time.Now()
+	if len(candles) > 0 {
+		pageEnd = candles[0].Time.Add(-bar)
+	}
+	log.Printf("Fetching %d more %dm candles for %s", need-len(candles), a.base, symbol)
+	for emptyPages := 0; len(candles) < need && emptyPages < maxEmptyPages; {
+		pageStart := pageEnd.Add(-bar * (klinePageSize - 1))
+		page, err := fetchKlinePage(a.history, symbol, a.base, pageStart, pageEnd, a.requestInterval)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			emptyPages++
+		} else {
+			emptyPages = 0
+			candles = domain.SortCandles(append(page, candles...))
+		}
+		pageEnd = pageStart.Add(-bar)
+		if len(candles) < need {
+			time.Sleep(a.requestInterval)
+		}
+	}
+	return domain.LastCandles(candles, need), nil
+}
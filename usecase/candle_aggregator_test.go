@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"testing"
+	"time"
+)
+
+// stubMinuteKlines は直近 available 本の1分足を持つ取得元です。GetCandles は REST と同じく最大 klinePageSize 本だけ返します。
+type stubMinuteKlines struct {
+	candles []domain.Candle
+	pages   int
+}
+
+func newStubMinuteKlines(available int) *stubMinuteKlines {
+	end := time.Now().UTC().Truncate(time.Minute)
+	s := &stubMinuteKlines{}
+	for i := available; i > 0; i-- {
+		s.candles = append(s.candles, domain.Candle{Time: end.Add(-time.Duration(i) * time.Minute), Open: 1, High: 1, Low: 1, Close: 1, Volume: 1})
+	}
+	return s
+}
+
+func (s *stubMinuteKlines) GetCandles(symbol string, granularity int, count int) ([]domain.Candle, error) {
+	return domain.LastCandles(s.candles, min(count, klinePageSize)), nil
+}
+
+func (s *stubMinuteKlines) GetCandlesRange(symbol string, granularity int, from, to time.Time) ([]domain.Candle, error) {
+	s.pages++
+	var page []domain.Candle
+	for _, c := range s.candles {
+		if !c.Time.Before(from) && !c.Time.After(to) {
+			page = append(page, c)
+		}
+	}
+	return page, nil
+}
+
+func TestCandleAggregatorPagesBackForOlderCandles(t *testing.T) {
+	source := newStubMinuteKlines(24 * 60)
+	a := NewCandleAggregator(source, 1)
+	a.SetHistory(source, 0)
+
+	candles, err := a.GetCandles("XBTUSDTM", 60, 10)
+	if err != nil {
+		t.Fatalf("GetCandles: %v", err)
+	}
+	if len(candles) != 10 {
+		t.Fatalf("got %d candles, want 10", len(candles))
+	}
+	for _, c := range candles {
+		if c.Volume != 60 {
+			t.Errorf("candle at %s built from %v 1m candles, want 60", c.Time, c.Volume)
+		}
+	}
+	// (10 + 2) * 60 本のうち REST の 200 本の残りを 200 本ずつ遡る
+	if source.pages != 3 {
+		t.Errorf("fetched %d pages, want 3", source.pages)
+	}
+}
+
+func TestCandleAggregatorFailsWhenCandlesAreShort(t *testing.T) {
+	// 期間指定の取得元がない場合は REST の 200 本しか使えない
+	source := newStubMinuteKlines(24 * 60)
+	if _, err := NewCandleAggregator(source, 1).GetCandles("XBTUSDTM", 60, 10); err == nil {
+		t.Error("expected an error without a history source")
+	}
+
+	// 遡っても取引所のデータが足りない場合
+	short := newStubMinuteKlines(5 * 60)
+	a := NewCandleAggregator(short, 1)
+	a.SetHistory(short, 0)
+	if _, err := a.GetCandles("XBTUSDTM", 60, 10); err == nil {
+		t.Error("expected an error when the exchange has fewer candles")
+	}
+}
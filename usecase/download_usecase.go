@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	klinePageSize     = 200 // 先物APIが1回のリクエストで返す最大本数
+	maxRateLimitRetry = 5
+	// maxEmptyPages は空のページが続いたときに、それより前にデータがないとみなすまでのページ数です。
+	// メンテナンスなどで取引所のデータが途切れていても、その前の期間を取得し続けるために1ページでは止めません。
+	maxEmptyPages = 10
+)
+
+// KlineHistoryGateway は期間指定でローソク足を取得するためのインターフェースです。
+type KlineHistoryGateway interface {
+	GetCandlesRange(symbol string, granularity int, from, to time.Time) ([]domain.Candle, error)
+}
+
+// KlineStore はダウンロードしたローソク足の保存先です。
+type KlineStore interface {
+	Merge(symbol string, granularity int, candles []domain.Candle) (int, error)
+}
+
+// DownloadUsecase は過去のローソク足をページングしながら取得し、ローカルに保存するユースケースを実装します。
+type DownloadUsecase struct {
+	historyGateway  KlineHistoryGateway
+	store           KlineStore
+	requestInterval time.Duration
+}
+
+// NewDownloadUsecase は新しい DownloadUsecase を生成します。
+// requestInterval はレート制限を避けるためのリクエスト間隔です。
+func NewDownloadUsecase(hg KlineHistoryGateway, store KlineStore, requestInterval time.Duration) *DownloadUsecase {
+	return &DownloadUsecase{
+		historyGateway:  hg,
+		store:           store,
+		requestInterval: requestInterval,
+	}
+}
+
+// DownloadKlines は期間 [from, to] のローソク足を新しい方から遡って取得し、保存します。
+// 保存先の書き換えはページごとではなく最後に1回だけ行います。途中で取得に失敗した場合も、それまでに取得した分は保存します。
+func (uc *DownloadUsecase) DownloadKlines(symbol string, granularity int, from, to time.Time) error {
+	if granularity <= 0 {
+		return fmt.Errorf("granularity must be positive: %d", granularity)
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("invalid range: from %s is not before to %s", from, to)
+	}
+
+	barDuration := time.Duration(granularity) * time.Minute
+	pageEnd := to
+	var fetched []domain.Candle
+	emptyPages := 0
+
+	for !pageEnd.Before(from) {
+		pageStart := pageEnd.Add(-barDuration * (klinePageSize - 1))
+		if pageStart.Before(from) {
+			pageStart = from
+		}
+
+		klines, err := fetchKlinePage(uc.historyGateway, symbol, granularity, pageStart, pageEnd, uc.requestInterval)
+		if err != nil {
+			if len(fetched) == 0 {
+				return err
+			}
+			if _, storeErr := uc.store.Merge(symbol, granularity, fetched); storeErr != nil {
+				log.Printf("Failed to store the %d klines fetched for %s before the error: %v", len(fetched), symbol, storeErr)
+			}
+			return err
+		}
+		if len(klines) == 0 {
+			emptyPages++
+			if !pageStart.After(from) || emptyPages >= maxEmptyPages {
+				log.Printf("No more klines for %s before %s", symbol, pageEnd.Format(time.RFC3339))
+				break
+			}
+			// 途中で途切れている可能性があるため、空のページの前も遡る
+			log.Printf("No klines for %s between %s and %s, continuing further back", symbol, pageStart.Format(time.RFC3339), pageEnd.Format(time.RFC3339))
+			pageEnd = pageStart.Add(-barDuration)
+			time.Sleep(uc.requestInterval)
+			continue
+		}
+		emptyPages = 0
+
+		fetched = append(fetched, klines...)
+
+		// GetCandlesRange は古い順に返す
+		oldest := klines[0].Time
+		log.Printf("Fetched %d klines for %s, oldest %s", len(klines), symbol, oldest.Format(time.RFC3339))
+
+		// 取得できた最古の足より前に遡る
+		next := oldest.Add(-barDuration)
+		if !next.Before(pageEnd) {
+			break
+		}
+		pageEnd = next
+		time.Sleep(uc.requestInterval)
+	}
+
+	added, err := uc.store.Merge(symbol, granularity, fetched)
+	if err != nil {
+		return fmt.Errorf("failed to store klines for %s: %w", symbol, err)
+	}
+	log.Printf("Download finished for %s: %d klines fetched, %d new klines stored", symbol, len(fetched), added)
+	return nil
+}
+
+// fetchKlinePage は期間 [from, to] の1ページ分を取得します。レート制限に達した場合は待機してから再試行します。
+func fetchKlinePage(hg KlineHistoryGateway, symbol string, granularity int, from, to time.Time, requestInterval time.Duration) ([]domain.Candle, error) {
+	backoff := requestInterval
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		klines, err := hg.GetCandlesRange(symbol, granularity, from, to)
+		if err == nil {
+			return klines, nil
+		}
+		if !errors.Is(err, domain.ErrRateLimited) || attempt >= maxRateLimitRetry {
+			return nil, fmt.Errorf("failed to download klines for %s: %w", symbol, err)
+		}
+		backoff *= 2
+		log.Printf("Rate limited while downloading %s, retrying in %s", symbol, backoff)
+		time.Sleep(backoff)
+	}
+}
@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingKlineStore は Merge に渡されたローソク足を記録する KlineStore です。
+type recordingKlineStore struct {
+	merges  int
+	candles []domain.Candle
+}
+
+func (s *recordingKlineStore) Merge(symbol string, granularity int, candles []domain.Candle) (int, error) {
+	s.merges++
+	s.candles = domain.SortCandles(append(s.candles, candles...))
+	return len(candles), nil
+}
+
+// failingHistory は failAfter ページを返した後にエラーを返す KlineHistoryGateway です。
+type failingHistory struct {
+	source    *stubMinuteKlines
+	failAfter int
+}
+
+func (h *failingHistory) GetCandlesRange(symbol string, granularity int, from, to time.Time) ([]domain.Candle, error) {
+	if h.source.pages >= h.failAfter {
+		return nil, errors.New("connection reset")
+	}
+	return h.source.GetCandlesRange(symbol, granularity, from, to)
+}
+
+func TestDownloadKlinesMergesOnce(t *testing.T) {
+	source := newStubMinuteKlines(1000)
+	store := &recordingKlineStore{}
+	from, to := source.candles[0].Time, source.candles[len(source.candles)-1].Time
+	if err := NewDownloadUsecase(source, store, 0).DownloadKlines("XBTUSDTM", 1, from, to); err != nil {
+		t.Fatalf("DownloadKlines: %v", err)
+	}
+	if store.merges != 1 || len(store.candles) != 1000 {
+		t.Errorf("got %d merges of %d klines, want 1 merge of 1000", store.merges, len(store.candles))
+	}
+	if source.pages != 5 {
+		t.Errorf("fetched %d pages, want 5", source.pages)
+	}
+}
+
+func TestDownloadKlinesKeepsPagesFetchedBeforeAnError(t *testing.T) {
+	source := newStubMinuteKlines(1000)
+	store := &recordingKlineStore{}
+	from, to := source.candles[0].Time, source.candles[len(source.candles)-1].Time
+	history := &failingHistory{source: source, failAfter: 2}
+	if err := NewDownloadUsecase(history, store, 0).DownloadKlines("XBTUSDTM", 1, from, to); err == nil {
+		t.Fatal("expected the page error")
+	}
+	if store.merges != 1 || len(store.candles) != 2*klinePageSize {
+		t.Errorf("got %d merges of %d klines, want the %d klines of the first two pages", store.merges, len(store.candles), 2*klinePageSize)
+	}
+}
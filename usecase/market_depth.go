@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"log"
+)
+
+// depthBandPct は分析で板の厚さを測る、仲値からの価格の幅（%）です。
+const depthBandPct = 1.0
+
+// OrderBookSource は板情報の取得元のインターフェースです。
+type OrderBookSource interface {
+	GetOrderBook(symbol string) (domain.OrderBook, error)
+}
+
+// SetOrderBookSource は板情報の取得元を変更します。既定では取引所の REST のスナップショットを毎回取得します。
+// WebSocket で手元に維持している板を渡すと、取得のたびに通信せずに済みます。
+func (uc *TradingUsecase) SetOrderBookSource(s OrderBookSource) {
+	uc.orderBooks = s
+}
+
+// checkEntryLiquidity は成行の建て注文を板で約定させた場合の平均価格と、仲値からの不利な乖離を見積もってログに出力します。
+// maxSlippageBps が正の場合、見積もりがそれを超えるか、板の数量が足りないか、板を取得できなければエラーを返します。
+func (uc *TradingUsecase) checkEntryLiquidity(req domain.OrderRequest, maxSlippageBps float64) error {
+	book, err := uc.orderBooks.GetOrderBook(req.Symbol)
+	if err != nil {
+		if maxSlippageBps > 0 {
+			return fmt.Errorf("could not check the order book for %s: %w", req.Symbol, err)
+		}
+		log.Printf("Could not get the order book for %s to estimate slippage: %v", req.Symbol, err)
+		return nil
+	}
+
+	vwap, filled := book.VWAP(req.Side, req.Size)
+	slippage, ok := book.SlippageBps(req.Side, req.Size)
+	if !ok {
+		if maxSlippageBps > 0 {
+			return fmt.Errorf("the order book for %s has only %v of %v lots on the %s side", req.Symbol, filled, req.Size, req.Side)
+		}
+		log.Printf("The order book for %s has only %v of %v lots to fill the entry", req.Symbol, filled, req.Size)
+		return nil
+	}
+	spread, _ := book.SpreadBps()
+	log.Printf("Order book for %s: spread %.1f bps, estimated fill %v lots @ %.4f (slippage %.1f bps from mid)", req.Symbol, spread, req.Size, vwap, slippage)
+	if maxSlippageBps > 0 && slippage > maxSlippageBps {
+		return fmt.Errorf("estimated slippage %.1f bps on %s exceeds the limit of %.1f bps", slippage, req.Symbol, maxSlippageBps)
+	}
+	return nil
+}
+
+// attachLiquidity は板からスプレッドと仲値の前後 depthBandPct % 以内の気配の数量を asset に設定します。
+// 板を取得できない場合は設定せずにログに出力します。
+func (uc *TradingUsecase) attachLiquidity(asset *domain.Asset) {
+	book, err := uc.orderBooks.GetOrderBook(asset.Symbol)
+	if err != nil {
+		log.Printf("Could not get the order book for %s: %v", asset.Symbol, err)
+		return
+	}
+	spread, ok := book.SpreadBps()
+	if !ok {
+		return
+	}
+	mid, _ := book.MidPrice()
+	asset.SpreadBps = spread
+	asset.Depth = book.DepthAt(domain.Sell, mid*(1-depthBandPct/100)) + book.DepthAt(domain.Buy, mid*(1+depthBandPct/100))
+}
+
+// describeAsset は分析の候補を AI に渡す1行の説明にします。
+func describeAsset(asset domain.Asset) string {
+	info := fmt.Sprintf("%s (ROI: %.2f%%, MACD: %.4f, RSI: %.2f", asset.Symbol, asset.CalculateROI(), asset.MACD, asset.RSI)
+	if asset.SpreadBps > 0 {
+		info += fmt.Sprintf(", spread: %.1f bps, depth within %.0f%%: %v lots", asset.SpreadBps, depthBandPct, asset.Depth)
+	}
+	return info + ")"
+}
@@ -0,0 +1,259 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"log"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ParamGrid は最適化で探索するパラメータの候補値です。
+type ParamGrid struct {
+	FastPeriods   []int
+	SlowPeriods   []int
+	SignalPeriods []int
+	RSIPeriods    []int
+	Overboughts   []float64
+	Oversolds     []float64
+}
+
+// DefaultParamGrid は既定の探索範囲を返します。
+func DefaultParamGrid() ParamGrid {
+	return ParamGrid{
+		FastPeriods:   []int{8, 10, 12, 15},
+		SlowPeriods:   []int{21, 26, 30, 35},
+		SignalPeriods: []int{7, 9, 12},
+		RSIPeriods:    []int{9, 14, 21},
+		Overboughts:   []float64{65, 70, 75},
+		Oversolds:     []float64{25, 30, 35},
+	}
+}
+
+// combinations はグリッドの全組み合わせのうち、整合性のあるものを返します。
+func (g ParamGrid) combinations() []domain.SignalParams {
+	var params []domain.SignalParams
+	for _, fast := range g.FastPeriods {
+		for _, slow := range g.SlowPeriods {
+			for _, signal := range g.SignalPeriods {
+				for _, rsi := range g.RSIPeriods {
+					for _, ob := range g.Overboughts {
+						for _, os := range g.Oversolds {
+							p := domain.SignalParams{
+								FastPeriod:    fast,
+								SlowPeriod:    slow,
+								SignalPeriod:  signal,
+								RSIPeriod:     rsi,
+								RSIOverbought: ob,
+								RSIOversold:   os,
+							}
+							if p.Validate() == nil {
+								params = append(params, p)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return params
+}
+
+// OptimizeOptions は最適化の実行条件です。
+type OptimizeOptions struct {
+	Grid           ParamGrid
+	RandomSamples  int     // 0 より大きい場合はグリッドから無作為に抽出した候補のみを評価する
+	Folds          int     // ウォークフォワードのウィンドウ数
+	TrainRatio     float64 // 各ウィンドウに占める学習期間の割合
+	AmountUSD      float64
+	InitialCapital float64
+	Costs          domain.CostModel
+	Seed           int64
+}
+
+// OptimizeUsecase は過去データでトレンド判定パラメータを最適化するユースケースを実装します。
+type OptimizeUsecase struct {
+	klineProvider KlineProvider
+	workers       int
+}
+
+// NewOptimizeUsecase は新しい OptimizeUsecase を生成します。
+func NewOptimizeUsecase(kp KlineProvider) *OptimizeUsecase {
+	return &OptimizeUsecase{
+		klineProvider: kp,
+		workers:       runtime.NumCPU(),
+	}
+}
+
+// Optimize は銘柄ごとに候補パラメータを評価し、ウォークフォワード検証の結果で順位付けします。
+func (uc *OptimizeUsecase) Optimize(symbols []string, granularity int, opts OptimizeOptions) ([]domain.OptimizationResult, error) {
+	if opts.Folds < 1 {
+		return nil, fmt.Errorf("folds must be at least 1: %d", opts.Folds)
+	}
+	if opts.TrainRatio <= 0 || opts.TrainRatio >= 1 {
+		return nil, fmt.Errorf("train ratio must be between 0 and 1: %.2f", opts.TrainRatio)
+	}
+	if opts.AmountUSD <= 0 {
+		return nil, fmt.Errorf("amount must be positive: %.2f", opts.AmountUSD)
+	}
+
+	candidates := opts.Grid.combinations()
+	if opts.RandomSamples > 0 && opts.RandomSamples < len(candidates) {
+		rng := rand.New(rand.NewSource(opts.Seed))
+		rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		candidates = candidates[:opts.RandomSamples]
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no valid parameter combinations in grid")
+	}
+
+	var results []domain.OptimizationResult
+	for _, symbol := range symbols {
+		candles, err := uc.klineProvider.GetCandles(symbol, granularity, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get klines for %s: %w", symbol, err)
+		}
+		times, closePrices := domain.CandleCloses(candles)
+
+		windows, err := walkForwardWindows(len(closePrices), opts.Folds, opts.TrainRatio)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", symbol, err)
+		}
+
+		log.Printf("Optimizing %s: %d candidates, %d bars, %d walk-forward windows", symbol, len(candidates), len(closePrices), len(windows))
+		result := uc.optimizeSymbol(symbol, times, closePrices, candidates, windows, opts)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// walkForwardWindow は1つの学習期間と検証期間の組です（インデックスは半開区間）。
+type walkForwardWindow struct {
+	trainStart, trainEnd int
+	testStart, testEnd   int
+}
+
+// walkForwardWindows はデータを学習期間と検証期間が前進していくウィンドウに分割します。
+func walkForwardWindows(bars, folds int, trainRatio float64) ([]walkForwardWindow, error) {
+	testLen := int(float64(bars) / (float64(folds) + trainRatio/(1-trainRatio)))
+	trainLen := bars - testLen*folds
+	if testLen < 1 || trainLen < analysisKlineCount {
+		return nil, fmt.Errorf("not enough data for %d walk-forward windows: %d bars", folds, bars)
+	}
+
+	windows := make([]walkForwardWindow, folds)
+	for k := range windows {
+		start := k * testLen
+		windows[k] = walkForwardWindow{
+			trainStart: start,
+			trainEnd:   start + trainLen,
+			testStart:  start + trainLen,
+			testEnd:    start + trainLen + testLen,
+		}
+	}
+	return windows, nil
+}
+
+// evaluation は1つの候補パラメータの評価結果です。
+type evaluation struct {
+	inSample   domain.BacktestResult
+	windowTest []float64 // 各ウィンドウの検証期間の収益率 (%)
+	windowFit  []float64 // 各ウィンドウの学習期間の収益率 (%)
+}
+
+func (uc *OptimizeUsecase) optimizeSymbol(symbol string, times []time.Time, closePrices []float64, candidates []domain.SignalParams, windows []walkForwardWindow, opts OptimizeOptions) domain.OptimizationResult {
+	evals := make([]evaluation, len(candidates))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < uc.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				evals[i] = evaluateCandidate(symbol, times, closePrices, candidates[i], windows, opts)
+			}
+		}()
+	}
+	for i := range candidates {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// 各ウィンドウで学習期間の成績が最も良い候補を選び、その検証期間の成績を集計する
+	result := domain.OptimizationResult{Symbol: symbol}
+	for k, w := range windows {
+		best := 0
+		for i := range evals {
+			if evals[i].windowFit[k] > evals[best].windowFit[k] {
+				best = i
+			}
+		}
+		result.Windows = append(result.Windows, domain.WalkForwardWindow{
+			TrainStart:  times[w.trainStart],
+			TrainEnd:    times[w.trainEnd-1],
+			TestStart:   times[w.testStart],
+			TestEnd:     times[w.testEnd-1],
+			Params:      candidates[best],
+			TrainReturn: evals[best].windowFit[k],
+			TestReturn:  evals[best].windowTest[k],
+		})
+	}
+
+	for i, e := range evals {
+		result.Ranking = append(result.Ranking, domain.ParamScore{
+			Params:          candidates[i],
+			InSampleReturn:  returnRate(e.inSample),
+			Trades:          len(e.inSample.Trades),
+			OutSampleReturn: mean(e.windowTest),
+		})
+	}
+	// 過学習を避けるため、検証期間の平均収益率を優先して順位付けする
+	sort.SliceStable(result.Ranking, func(i, j int) bool {
+		a, b := result.Ranking[i], result.Ranking[j]
+		if a.OutSampleReturn != b.OutSampleReturn {
+			return a.OutSampleReturn > b.OutSampleReturn
+		}
+		return a.InSampleReturn > b.InSampleReturn
+	})
+	return result
+}
+
+func evaluateCandidate(symbol string, times []time.Time, closePrices []float64, params domain.SignalParams, windows []walkForwardWindow, opts OptimizeOptions) evaluation {
+	e := evaluation{
+		inSample: simulate(symbol, times, closePrices, 0, opts.AmountUSD, opts.InitialCapital, params, opts.Costs),
+	}
+	for _, w := range windows {
+		// 直前の足をウォームアップとして含め、取引は各期間の開始から行う
+		trainFrom := max(0, w.trainStart-analysisKlineCount)
+		train := simulate(symbol, times[trainFrom:w.trainEnd], closePrices[trainFrom:w.trainEnd], w.trainStart-trainFrom, opts.AmountUSD, opts.InitialCapital, params, opts.Costs)
+		testFrom := w.testStart - analysisKlineCount
+		test := simulate(symbol, times[testFrom:w.testEnd], closePrices[testFrom:w.testEnd], w.testStart-testFrom, opts.AmountUSD, opts.InitialCapital, params, opts.Costs)
+		e.windowFit = append(e.windowFit, returnRate(train))
+		e.windowTest = append(e.windowTest, returnRate(test))
+	}
+	return e
+}
+
+// returnRate はバックテスト結果の総収益率 (%) を返します。
+func returnRate(r domain.BacktestResult) float64 {
+	if r.InitialCapital == 0 {
+		return 0.0
+	}
+	return (r.FinalEquity() - r.InitialCapital) / r.InitialCapital * 100
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0.0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
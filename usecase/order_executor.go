@@ -0,0 +1,281 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// ExecutionGateway は注文の執行に必要な取引所の操作です。
+type ExecutionGateway interface {
+	GetCurrentPrice(symbol string) (float64, error)
+	CreateOrder(req domain.OrderRequest) (string, error)
+	GetOrder(orderID string) (domain.Order, error)
+	GetOrderByClientOID(clientOID string) (domain.Order, error)
+	CancelOrder(orderID string) error
+	GetContract(symbol string) (domain.ContractSpec, error)
+	GetRecentTrades(symbol string) ([]domain.MarketTrade, error)
+}
+
+// OrderExecutor は TradingUsecase と取引所の間で注文の約定を追跡し、
+// 大きな親注文を執行アルゴリズムに従って子注文に分けて発注します。
+type OrderExecutor struct {
+	gateway      ExecutionGateway
+	pollInterval time.Duration
+	// accountEvents は約定や取消を待つ間に注文の変化を受け取るストリームです。nil の場合は pollInterval ごとに確認します。
+	accountEvents AccountEventStream
+}
+
+// NewOrderExecutor は新しい OrderExecutor を生成します。
+func NewOrderExecutor(g ExecutionGateway) *OrderExecutor {
+	return &OrderExecutor{
+		gateway:      g,
+		pollInterval: defaultOrderPollInterval,
+	}
+}
+
+// SetPollInterval は注文の約定状況を確認する間隔を変更します。
+func (e *OrderExecutor) SetPollInterval(d time.Duration) {
+	e.pollInterval = d
+}
+
+// Run は req.ClientOID を付けた親注文を、plan の執行アルゴリズムか、plan がなければ1回の注文で執行します。
+// 1回の注文は timeout までに約定しなかった残りを取り消します。拒否や執行の中断はログに出力し、それまでの約定を返します。
+// 通信エラーなどで結果が分からなくなった場合は clientOid で取引所から約定を集め直し、それもできなかった場合にだけ
+// エラーを返します。その場合、呼び出し側は保存した clientOid で後から Recover して結果を確定させます。
+func (e *OrderExecutor) Run(req domain.OrderRequest, plan domain.ExecutionPlan, timeout time.Duration, abort <-chan struct{}, progress func(domain.ExecutionProgress)) (domain.ExecutionProgress, error) {
+	var result domain.ExecutionProgress
+	var err error
+	if plan.Enabled() {
+		result, err = e.Execute(req, plan, abort, progress)
+	} else {
+		result = domain.ExecutionProgress{Symbol: req.Symbol, Side: req.Side, TargetSize: req.Size}
+		var order domain.Order
+		if order, err = e.Place(req, timeout); err == nil {
+			result.AddFill(order)
+		}
+	}
+	switch {
+	case err == nil:
+		return result, nil
+	case notPlaced(err):
+		log.Printf("Order %s stopped: %v", req.ClientOID, err)
+		return result, nil
+	}
+
+	log.Printf("Result of order %s is unknown (%v); collecting its fills from the exchange", req.ClientOID, err)
+	recovered, _, rerr := e.Recover(req.Symbol, req.Side, domain.PendingOrder{ClientOID: req.ClientOID, Size: req.Size, Algo: plan.Algo})
+	if rerr != nil {
+		return result, fmt.Errorf("result of order %s is unknown: %w", req.ClientOID, rerr)
+	}
+	recovered.Aborted = result.Aborted
+	return recovered, nil
+}
+
+// Execute は成行の親注文を plan に従って子注文に分けて執行し、執行結果を返します。
+// 子注文の clientOid は親注文の clientOid に連番を付けたものです。
+// 子注文を発注するたびに progress に途中経過を渡します。abort が閉じられた場合は次の子注文を出さずに終了し、
+// それまでの約定を Aborted を立てた結果として返します。エラーの場合もそれまでの約定を含む結果を返します。
+func (e *OrderExecutor) Execute(req domain.OrderRequest, plan domain.ExecutionPlan, abort <-chan struct{}, progress func(domain.ExecutionProgress)) (domain.ExecutionProgress, error) {
+	result := domain.ExecutionProgress{Algo: plan.Algo, Symbol: req.Symbol, Side: req.Side, TargetSize: req.Size}
+	if err := plan.Validate(); err != nil {
+		return result, fmt.Errorf("invalid execution plan: %w", err)
+	}
+	if !plan.Enabled() {
+		return result, fmt.Errorf("no execution algorithm is set")
+	}
+	if req.Type != domain.OrderTypeMarket || req.CloseOrder {
+		return result, fmt.Errorf("execution algorithms only slice market orders of a fixed size")
+	}
+	if req.ClientOID == "" {
+		return result, fmt.Errorf("%w: clientOid of the parent order is required", errNotSubmitted)
+	}
+	spec, err := e.gateway.GetContract(req.Symbol)
+	if err != nil {
+		return result, fmt.Errorf("failed to get contract spec for %s: %w", req.Symbol, err)
+	}
+
+	run := execution{executor: e, parent: req, plan: plan, spec: spec, abort: abort, progress: progress, result: &result}
+	switch plan.Algo {
+	case domain.AlgoTWAP:
+		err = run.twap()
+	case domain.AlgoIceberg:
+		err = run.iceberg()
+	case domain.AlgoPOV:
+		err = run.pov()
+	}
+	return result, err
+}
+
+// execution は1つの親注文の執行中の状態です。
+type execution struct {
+	executor *OrderExecutor
+	parent   domain.OrderRequest
+	plan     domain.ExecutionPlan
+	spec     domain.ContractSpec
+	abort    <-chan struct{}
+	progress func(domain.ExecutionProgress)
+	result   *domain.ExecutionProgress
+}
+
+// twap は執行期間を子注文の数で等分した間隔で発注します。
+// IOC 指値で約定しなかった分は次の子注文に持ち越し、最後の子注文の後に残った分は約定させません。
+func (x *execution) twap() error {
+	sizes := domain.SplitLots(x.parent.Size, x.plan.Slices, x.spec)
+	interval := x.plan.Duration / time.Duration(len(sizes))
+	scheduled := 0.0
+	for i, size := range sizes {
+		if i > 0 && !x.wait(interval) {
+			return nil
+		}
+		scheduled += size
+		child := x.spec.RoundLots(scheduled - x.result.FilledSize)
+		if child <= 0 {
+			continue
+		}
+		if err := x.send(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iceberg は見せるサイズの子注文を、約定するたびに Interval をおいて出し直します。
+// 子注文が全く約定しなかった場合は、価格が離れたとみなして残りを約定させずに終了します。
+func (x *execution) iceberg() error {
+	visible := x.spec.RoundLots(x.plan.VisibleSize)
+	if visible <= 0 {
+		return fmt.Errorf("visible size %v is smaller than one lot (%v)", x.plan.VisibleSize, x.spec.LotSize)
+	}
+	for first := true; x.result.Remaining() > 0; first = false {
+		if (!first && !x.wait(x.plan.Interval)) || x.aborted() {
+			return nil
+		}
+		before := x.result.FilledSize
+		if err := x.send(math.Min(visible, x.spec.RoundLots(x.result.Remaining()))); err != nil {
+			return err
+		}
+		if x.result.FilledSize == before {
+			log.Printf("Iceberg child order on %s was not filled; stopping with %v lots remaining", x.parent.Symbol, x.result.Remaining())
+			return nil
+		}
+	}
+	return nil
+}
+
+// pov は Interval ごとに市場の出来高を集計し、その ParticipationPct % を子注文として発注します。
+// Duration が経過しても約定しきらなかった分は約定させません。
+func (x *execution) pov() error {
+	trades, err := x.executor.gateway.GetRecentTrades(x.parent.Symbol)
+	if err != nil {
+		return fmt.Errorf("failed to get recent trades for %s: %w", x.parent.Symbol, err)
+	}
+	lastSeq := latestSequence(trades, 0)
+
+	deadline := time.Now().Add(x.plan.Duration)
+	for x.result.Remaining() > 0 {
+		if !time.Now().Before(deadline) {
+			log.Printf("POV on %s reached its duration of %s with %v lots remaining", x.parent.Symbol, x.plan.Duration, x.result.Remaining())
+			return nil
+		}
+		if !x.wait(x.plan.Interval) {
+			return nil
+		}
+
+		trades, err := x.executor.gateway.GetRecentTrades(x.parent.Symbol)
+		if err != nil {
+			log.Printf("Could not get recent trades for %s: %v", x.parent.Symbol, err)
+			continue
+		}
+		volume := 0.0
+		for _, t := range trades {
+			if t.Sequence > lastSeq {
+				volume += t.Size
+			}
+		}
+		lastSeq = latestSequence(trades, lastSeq)
+
+		child := x.spec.RoundLots(math.Min(volume*x.plan.ParticipationPct/100, x.result.Remaining()))
+		if child <= 0 {
+			continue
+		}
+		if err := x.send(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send は子注文を1つ発注し、約定または取消で確定するのを待って結果に加えます。
+func (x *execution) send(size float64) error {
+	e := x.executor
+	child := x.parent
+	child.Size = size
+	if x.plan.MaxSlippageBps > 0 {
+		price, err := e.gateway.GetCurrentPrice(child.Symbol)
+		if err != nil {
+			return fmt.Errorf("failed to get price for child order: %w", err)
+		}
+		child.Type = domain.OrderTypeLimit
+		child.Price = x.plan.ChildLimitPrice(child.Side, price, x.spec)
+		child.TimeInForce = domain.ImmediateOrCancel
+	}
+
+	// 子注文は前の子注文が確定してから連番順に出すため、番号は発注済みの子注文の数から決まる
+	child.ClientOID = domain.ChildClientOID(x.parent.ClientOID, len(x.result.OrderIDs)+1)
+	order, err := e.Place(child, orderSettleTimeout)
+	if err != nil {
+		return fmt.Errorf("child order %s for %v lots: %w", child.ClientOID, size, err)
+	}
+	x.result.AddFill(order)
+	if x.progress != nil {
+		x.progress(*x.result)
+	}
+	return nil
+}
+
+// wait は d だけ待ちます。待っている間に中断された場合は false を返します。
+func (x *execution) wait(d time.Duration) bool {
+	if d <= 0 {
+		return !x.aborted()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-x.abort:
+		x.result.Aborted = true
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// aborted は中断されたかを待たずに確認します。
+func (x *execution) aborted() bool {
+	select {
+	case <-x.abort:
+		x.result.Aborted = true
+		return true
+	default:
+		return false
+	}
+}
+
+// latestSequence は約定履歴の最新のシーケンス番号を返します。約定がない場合は current を返します。
+func latestSequence(trades []domain.MarketTrade, current int64) int64 {
+	for _, t := range trades {
+		if t.Sequence > current {
+			current = t.Sequence
+		}
+	}
+	return current
+}
+
+// logExecutionProgress は執行アルゴリズムの途中経過をログに出力します。
+func logExecutionProgress(p domain.ExecutionProgress) {
+	log.Printf("%s %s %s: %v/%v lots filled (%.1f%%) @ avg %.4f, fees %.4f, %d child orders",
+		strings.ToUpper(string(p.Algo)), p.Side, p.Symbol, p.FilledSize, p.TargetSize, p.FilledPct(), p.AvgPrice, p.Fee, len(p.OrderIDs))
+}
@@ -0,0 +1,172 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// defaultOrderPollInterval は注文の約定状況を確認する間隔です。
+	defaultOrderPollInterval = time.Second
+	// defaultEntryTimeout は建て注文の約定を待つ既定の時間です。
+	defaultEntryTimeout = 30 * time.Second
+	// orderSettleTimeout は決済の成行注文の約定や、取消の反映を待つ時間です。
+	orderSettleTimeout = 10 * time.Second
+	// maxSubmitAttempts は結果が分からなかった注文を clientOid で確認してから再送する最大回数です。
+	maxSubmitAttempts = 3
+)
+
+// errNotSubmitted は発注前に処理を止め、注文を取引所に送っていないことを表すエラーです。
+var errNotSubmitted = errors.New("order was not submitted")
+
+// notPlaced は err が、注文が取引所に存在しないことが確定しているエラーかを返します。
+func notPlaced(err error) bool {
+	return errors.Is(err, domain.ErrRejected) || errors.Is(err, errNotSubmitted)
+}
+
+// submit は req.ClientOID を付けた注文を発注し、注文IDを返します。
+// 通信エラーなどで受け付けられたか分からない場合は、clientOid で取引所の注文を探し、見つからない場合にだけ
+// 同じ clientOid で再送するため、1つの注文が二重に発注されることはありません。
+// 取引所に拒否された場合は再送せずに domain.ErrRejected を含むエラーを返します。
+// それ以外のエラーの場合、注文が受け付けられたかは分かっていません。
+func (e *OrderExecutor) submit(req domain.OrderRequest) (string, error) {
+	if req.ClientOID == "" {
+		return "", fmt.Errorf("%w: clientOid is required", errNotSubmitted)
+	}
+	var lastErr error
+	for attempt := 1; attempt <= maxSubmitAttempts; attempt++ {
+		orderID, err := e.gateway.CreateOrder(req)
+		if err == nil {
+			return orderID, nil
+		}
+		lastErr = err
+		if errors.Is(err, domain.ErrRejected) && attempt == 1 {
+			return "", err
+		}
+		// 再送が重複として拒否された場合も含め、先に送った注文が受け付けられていないかを確認する
+		log.Printf("Order %s may not have reached the exchange: %v", req.ClientOID, err)
+		time.Sleep(e.pollInterval)
+		order, lookupErr := e.gateway.GetOrderByClientOID(req.ClientOID)
+		switch {
+		case lookupErr == nil:
+			log.Printf("Order %s was accepted by the exchange as %s", req.ClientOID, order.ID)
+			return order.ID, nil
+		case !errors.Is(lookupErr, domain.ErrOrderNotFound):
+			return "", fmt.Errorf("order %s may have been placed; failed to look it up: %w", req.ClientOID, lookupErr)
+		case errors.Is(err, domain.ErrRejected):
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("order %s was not confirmed after %d attempts: %w", req.ClientOID, maxSubmitAttempts, lastErr)
+}
+
+// Place は1つの注文を発注して約定を待ち、timeout までに確定しなければ残りを取り消して、確定した状態を返します。
+func (e *OrderExecutor) Place(req domain.OrderRequest, timeout time.Duration) (domain.Order, error) {
+	orderID, err := e.submit(req)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("failed to create %s order: %w", req.Side, err)
+	}
+	log.Printf("%s order placed successfully. Order ID: %s", req.Side, orderID)
+	return e.settle(orderID, timeout)
+}
+
+// settle は注文の約定を timeout まで待ち、確定しなければ残りを取り消して、確定した状態を返します。
+func (e *OrderExecutor) settle(orderID string, timeout time.Duration) (domain.Order, error) {
+	order, err := e.waitForOrder(orderID, timeout)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("order %s was placed but its status is unknown; check the exchange: %w", orderID, err)
+	}
+	if !order.IsDone() {
+		log.Printf("Order %s was not fully filled within %s (%v of %v lots). Canceling the rest.", orderID, timeout, order.FilledSize, order.Amount)
+		if order, err = e.cancelRemaining(orderID); err != nil {
+			return domain.Order{}, fmt.Errorf("failed to cancel the rest of order %s; check the exchange: %w", orderID, err)
+		}
+	}
+	order.ID = orderID
+	return order, nil
+}
+
+// Recover は clientOid を保存して発注した注文 p の結果を取引所から集め直します。
+// 執行アルゴリズムの場合は子注文を連番順に見つからなくなるまで集計します。確定していない注文は残りを取り消します。
+// 取引所に何も発注されていなかった場合は found が false です。
+func (e *OrderExecutor) Recover(symbol string, side domain.OrderSide, p domain.PendingOrder) (result domain.ExecutionProgress, found bool, err error) {
+	result = domain.ExecutionProgress{Algo: p.Algo, Symbol: symbol, Side: side, TargetSize: p.Size}
+	clientOID := p.ClientOID
+	for n := 1; ; n++ {
+		if p.Algo != "" {
+			clientOID = domain.ChildClientOID(p.ClientOID, n)
+		}
+		order, err := e.gateway.GetOrderByClientOID(clientOID)
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			return result, found, nil
+		}
+		if err != nil {
+			return result, false, fmt.Errorf("failed to look up order %s: %w", clientOID, err)
+		}
+		if order, err = e.settle(order.ID, orderSettleTimeout); err != nil {
+			return result, false, err
+		}
+		result.AddFill(order)
+		found = true
+		if p.Algo == "" {
+			return result, true, nil
+		}
+	}
+}
+
+// waitForOrder は注文が約定または取消されるか timeout が経過するまで状態を確認し、最後に取得した状態を返します。
+// 約定数量があるのに平均約定価格がまだ分からない場合は、約定履歴が反映されるまで待ちます。
+// 注文の変化のストリームがある場合は、この注文の変化が届いた時点で次の確認を行います。
+func (e *OrderExecutor) waitForOrder(orderID string, timeout time.Duration) (domain.Order, error) {
+	// 確認より前に購読し、確認と次の変化の間の約定を取りこぼさないようにする
+	events, unsubscribe := subscribeAccountEvents(e.accountEvents)
+	defer unsubscribe()
+	deadline := time.Now().Add(timeout)
+	var last domain.Order
+	var lastErr error
+	fetched := false
+
+	for {
+		order, err := e.gateway.GetOrder(orderID)
+		if err != nil {
+			log.Printf("Could not get status of order %s: %v", orderID, err)
+			lastErr = err
+		} else {
+			last, fetched = order, true
+			priceKnown := order.FilledSize == 0 || order.Price > 0
+			if order.IsDone() && priceKnown {
+				return order, nil
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			break
+		}
+		waitForOrderEvent(events, orderID, e.pollInterval)
+	}
+
+	if !fetched {
+		return domain.Order{}, fmt.Errorf("failed to get status of order %s: %w", orderID, lastErr)
+	}
+	return last, nil
+}
+
+// cancelRemaining は注文の未約定分を取り消し、取消後の確定した状態を返します。
+// 取消の直前に約定した分も含めるため、取消後に状態を取得し直します。
+func (e *OrderExecutor) cancelRemaining(orderID string) (domain.Order, error) {
+	if err := e.gateway.CancelOrder(orderID); err != nil {
+		// 取消と同時に約定しきった場合も取消は失敗するため、状態を確認してから判断する
+		log.Printf("Cancel of order %s failed: %v", orderID, err)
+	}
+	order, err := e.waitForOrder(orderID, orderSettleTimeout)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if !order.IsDone() {
+		return domain.Order{}, fmt.Errorf("order %s is still %s after cancel", orderID, order.Status)
+	}
+	return order, nil
+}
@@ -0,0 +1,143 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// stubExecutionGateway は発注と clientOid での照会を記録する ExecutionGateway です。
+// createErrs の先頭から順に CreateOrder のエラーを返し、accept が true の注文はエラーを返した場合も受け付けます。
+type stubExecutionGateway struct {
+	createErrs []error
+	accept     []bool
+	orders     map[string]domain.Order // clientOid ごとの受け付けた注文
+	creates    []string
+	lookups    []string
+}
+
+func newStubExecutionGateway() *stubExecutionGateway {
+	return &stubExecutionGateway{orders: map[string]domain.Order{}}
+}
+
+func (g *stubExecutionGateway) CreateOrder(req domain.OrderRequest) (string, error) {
+	g.creates = append(g.creates, req.ClientOID)
+	var err error
+	accept := true
+	if len(g.createErrs) > 0 {
+		err, accept = g.createErrs[0], g.accept[0]
+		g.createErrs, g.accept = g.createErrs[1:], g.accept[1:]
+	}
+	if accept {
+		id := fmt.Sprintf("order-%d", len(g.creates))
+		g.orders[req.ClientOID] = domain.Order{ID: id, ClientOID: req.ClientOID, Symbol: req.Symbol, Side: req.Side, Amount: req.Size, FilledSize: req.Size, Price: 100, Status: domain.OrderStatusFilled}
+		if err == nil {
+			return id, nil
+		}
+	}
+	return "", err
+}
+
+func (g *stubExecutionGateway) GetOrderByClientOID(clientOID string) (domain.Order, error) {
+	g.lookups = append(g.lookups, clientOID)
+	if order, ok := g.orders[clientOID]; ok {
+		return order, nil
+	}
+	return domain.Order{}, fmt.Errorf("order %s: %w", clientOID, domain.ErrOrderNotFound)
+}
+
+func (g *stubExecutionGateway) GetOrder(orderID string) (domain.Order, error) {
+	for _, order := range g.orders {
+		if order.ID == orderID {
+			return order, nil
+		}
+	}
+	return domain.Order{}, fmt.Errorf("order %s: %w", orderID, domain.ErrOrderNotFound)
+}
+
+func (g *stubExecutionGateway) GetCurrentPrice(string) (float64, error) { return 100, nil }
+func (g *stubExecutionGateway) CancelOrder(string) error                { return nil }
+func (g *stubExecutionGateway) GetContract(symbol string) (domain.ContractSpec, error) {
+	return domain.ContractSpec{Symbol: symbol, Multiplier: 1, LotSize: 1, TickSize: 0.1}, nil
+}
+func (g *stubExecutionGateway) GetRecentTrades(string) ([]domain.MarketTrade, error) { return nil, nil }
+
+func TestSubmit(t *testing.T) {
+	timeout := errors.New("context deadline exceeded")
+	tests := []struct {
+		name        string
+		createErrs  []error
+		accept      []bool
+		wantErr     bool
+		wantCreates int
+		wantLookups int
+	}{
+		{name: "accepted", wantCreates: 1},
+		// 応答は届かなかったが取引所は受け付けていたため、再送しない
+		{name: "timed out but placed", createErrs: []error{timeout}, accept: []bool{true}, wantCreates: 1, wantLookups: 1},
+		// 取引所に届いていなかったため、同じ clientOid で再送する
+		{name: "timed out and not placed", createErrs: []error{timeout}, accept: []bool{false}, wantCreates: 2, wantLookups: 1},
+		{name: "rejected", createErrs: []error{fmt.Errorf("risk limit: %w", domain.ErrRejected)}, accept: []bool{false}, wantErr: true, wantCreates: 1},
+		// 再送が拒否された場合は、先に送った注文がないことを確認してから諦める
+		{name: "resend rejected", createErrs: []error{timeout, fmt.Errorf("duplicate: %w", domain.ErrRejected)}, accept: []bool{false, false}, wantErr: true, wantCreates: 2, wantLookups: 2},
+		{name: "never confirmed", createErrs: []error{timeout, timeout, timeout}, accept: []bool{false, false, false}, wantErr: true, wantCreates: maxSubmitAttempts, wantLookups: maxSubmitAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newStubExecutionGateway()
+			g.createErrs, g.accept = tt.createErrs, tt.accept
+			e := NewOrderExecutor(g)
+			e.SetPollInterval(0)
+
+			orderID, err := e.submit(domain.OrderRequest{ClientOID: "XBTUSDTM-1-1", Symbol: "XBTUSDTM", Side: domain.Buy, Type: domain.OrderTypeMarket, Size: 1})
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("submit = %q, %v; want error %v", orderID, err, tt.wantErr)
+			}
+			if !tt.wantErr && orderID != g.orders["XBTUSDTM-1-1"].ID {
+				t.Errorf("submit returned %q, want the accepted order %q", orderID, g.orders["XBTUSDTM-1-1"].ID)
+			}
+			if len(g.creates) != tt.wantCreates || len(g.lookups) != tt.wantLookups {
+				t.Errorf("got %d creates and %d lookups, want %d and %d", len(g.creates), len(g.lookups), tt.wantCreates, tt.wantLookups)
+			}
+			for _, oid := range append(g.creates, g.lookups...) {
+				if oid != "XBTUSDTM-1-1" {
+					t.Errorf("used clientOid %q, want the same clientOid on every attempt", oid)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverUsesTheSavedClientOID(t *testing.T) {
+	// 連番を保存した後、発注の前後どちらで停止した場合も、保存した clientOid で確認するだけで発注はしない
+	for _, placed := range []bool{true, false} {
+		g := newStubExecutionGateway()
+		trade := &domain.ActiveTrade{ID: "XBTUSDTM-1", Symbol: "XBTUSDTM", Side: domain.Buy}
+		clientOID := trade.NextClientOID()
+		if placed {
+			g.CreateOrder(domain.OrderRequest{ClientOID: clientOID, Symbol: "XBTUSDTM", Side: domain.Buy, Size: 5})
+			g.creates = nil
+		}
+		p := domain.PendingOrder{ClientOID: clientOID, Label: "Entry", Target: -1, Size: 5}
+		e := NewOrderExecutor(g)
+		e.SetPollInterval(0)
+
+		progress, found, err := e.Recover("XBTUSDTM", domain.Buy, p)
+		if err != nil {
+			t.Fatalf("placed %v: Recover: %v", placed, err)
+		}
+		if found != placed || (placed && progress.FilledSize != 5) {
+			t.Errorf("placed %v: Recover = found %v with %v lots filled", placed, found, progress.FilledSize)
+		}
+		if len(g.creates) != 0 {
+			t.Errorf("placed %v: Recover sent orders %v", placed, g.creates)
+		}
+		if len(g.lookups) != 1 || g.lookups[0] != clientOID {
+			t.Errorf("placed %v: looked up %v, want only the saved %s", placed, g.lookups, clientOID)
+		}
+		if trade.OrderSeq != 1 {
+			t.Errorf("placed %v: order sequence advanced to %d", placed, trade.OrderSeq)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"log"
+)
+
+// OrderGateway は注文の照会・取消のためのインターフェースです。
+type OrderGateway interface {
+	GetOpenOrders(symbol string) ([]domain.Order, error)
+	CancelOrder(orderID string) error
+	CancelOrderByClientOID(symbol, clientOID string) error
+	CancelAllOrders(symbol string) ([]string, error)
+}
+
+// OrderUsecase は板に残っている注文の一覧表示と取消のユースケースを実装します。
+type OrderUsecase struct {
+	orderGateway OrderGateway
+}
+
+// NewOrderUsecase は新しい OrderUsecase を生成します。
+func NewOrderUsecase(og OrderGateway) *OrderUsecase {
+	return &OrderUsecase{orderGateway: og}
+}
+
+// ListOpenOrders は板に残っている注文を返します。symbol が空の場合は全銘柄が対象です。
+func (uc *OrderUsecase) ListOpenOrders(symbol string) ([]domain.Order, error) {
+	orders, err := uc.orderGateway.GetOpenOrders(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list open orders: %w", err)
+	}
+	return orders, nil
+}
+
+// CancelOrder は注文IDを指定して注文を取り消します。
+func (uc *OrderUsecase) CancelOrder(orderID string) error {
+	if orderID == "" {
+		return fmt.Errorf("order ID is required")
+	}
+	if err := uc.orderGateway.CancelOrder(orderID); err != nil {
+		return err
+	}
+	log.Printf("Canceled order %s", orderID)
+	return nil
+}
+
+// CancelOrderByClientOID は発注時の clientOid を指定して注文を取り消します。
+func (uc *OrderUsecase) CancelOrderByClientOID(symbol, clientOID string) error {
+	if symbol == "" || clientOID == "" {
+		return fmt.Errorf("symbol and clientOid are required")
+	}
+	if err := uc.orderGateway.CancelOrderByClientOID(symbol, clientOID); err != nil {
+		return err
+	}
+	log.Printf("Canceled order with clientOid %s on %s", clientOID, symbol)
+	return nil
+}
+
+// CancelAllOrders は銘柄ごとに板に残っている注文を全て取り消し、取り消した注文IDを返します。
+func (uc *OrderUsecase) CancelAllOrders(symbols []string) ([]string, error) {
+	var canceled []string
+	for _, symbol := range symbols {
+		ids, err := uc.orderGateway.CancelAllOrders(symbol)
+		if err != nil {
+			return canceled, err
+		}
+		log.Printf("Canceled %d orders on %s", len(ids), symbol)
+		canceled = append(canceled, ids...)
+	}
+	return canceled, nil
+}
@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"log"
+	"time"
+)
+
+// PriceStream はリアルタイムの価格を配信するストリームのインターフェースです。
+type PriceStream interface {
+	SubscribePrices(symbol string) (<-chan domain.PriceUpdate, func())
+}
+
+// SetPriceStream は取引監視で価格を受け取るストリームを設定します。設定しない場合は REST で定期的に価格を確認します。
+func (uc *TradingUsecase) SetPriceStream(s PriceStream) {
+	uc.priceStream = s
+}
+
+// priceFeed は取引監視に銘柄の最終約定価格を届けます。
+// ストリームがある場合は価格の更新が届いた時点で返し、pollInterval の間に届かない場合はストリームが止まっているか
+// 約定がないものとして REST で価格を取得します。ストリームがない場合は pollInterval ごとに REST で取得します。
+// 口座のストリームがある場合は、銘柄の建玉がなくなったか強制決済されたときにも待たずに価格を返します。
+type priceFeed struct {
+	uc        *TradingUsecase
+	symbol    string
+	updates   <-chan domain.PriceUpdate
+	cancel    func()
+	streaming bool // 直前の価格をストリームから受け取ったか
+
+	account       <-chan domain.AccountEvent
+	cancelAccount func()
+	position      *domain.PositionEvent // まだ取り出していない建玉の変化
+}
+
+// newPriceFeed は銘柄の priceFeed を生成し、ストリームがあれば購読を開始します。
+func (uc *TradingUsecase) newPriceFeed(symbol string) *priceFeed {
+	f := &priceFeed{uc: uc, symbol: symbol}
+	if uc.priceStream != nil {
+		f.updates, f.cancel = uc.priceStream.SubscribePrices(symbol)
+	}
+	f.account, f.cancelAccount = subscribeAccountEvents(uc.accountEvents)
+	return f
+}
+
+// next は次の最終約定価格を返します。
+func (f *priceFeed) next() (float64, error) {
+	timer := time.NewTimer(f.uc.pollInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case u, ok := <-f.updates:
+			if !ok {
+				f.updates = nil
+				return f.uc.kucoinGateway.GetCurrentPrice(f.symbol)
+			}
+			if u.Kind != domain.PriceLast {
+				continue
+			}
+			// 溜まっている更新は最新のものまで読み飛ばす
+			for drained := false; !drained; {
+				select {
+				case v, ok := <-f.updates:
+					if ok && v.Kind == domain.PriceLast {
+						u = v
+					}
+					drained = !ok
+				default:
+					drained = true
+				}
+			}
+			if !f.streaming {
+				log.Printf("Receiving %s prices from the WebSocket stream", f.symbol)
+				f.streaming = true
+			}
+			return u.Price, nil
+		case ev, ok := <-f.account:
+			if !ok {
+				f.account = nil
+				continue
+			}
+			if p := ev.Position; p != nil && p.Position.Symbol == f.symbol && (p.Closed() || p.Liquidated()) {
+				f.position = p
+				return f.uc.kucoinGateway.GetCurrentPrice(f.symbol)
+			}
+		case <-timer.C:
+			if f.streaming {
+				log.Printf("No %s price from the WebSocket stream for %s; checking over REST", f.symbol, f.uc.pollInterval)
+				f.streaming = false
+			}
+			return f.uc.kucoinGateway.GetCurrentPrice(f.symbol)
+		}
+	}
+}
+
+// positionEvent は受信した建玉の変化を取り出します。受信していない場合は nil です。
+func (f *priceFeed) positionEvent() *domain.PositionEvent {
+	p := f.position
+	f.position = nil
+	return p
+}
+
+// close はストリームの購読をやめます。
+func (f *priceFeed) close() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.cancelAccount()
+}
@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ReconcilePositions は取引所の建玉と保存した取引を突き合わせ、銘柄ごとの結果を返します。
+// opts.AdoptPositions が true の場合は、食い違いを次のように解消して Action に記録します。
+//   - 保存した取引のない建玉は、opts の決済条件で監視する取引として取り込む
+//   - 建玉が保存した取引より小さい場合は、差分がボットの外で決済されたものとして残りのロット数を合わせる
+//   - 建玉がなくなった取引は、残っている取引所の決済注文を取り消して保存した状態を削除する
+//
+// 反対側の建玉と、保存した取引より大きい建玉はボットの外で建てた分を区別できないため、報告のみ行います。
+func (uc *TradingUsecase) ReconcilePositions(opts TradeOptions) ([]domain.PositionReconciliation, error) {
+	positions, err := uc.kucoinGateway.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+	trades, err := uc.tradeStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trade states: %w", err)
+	}
+
+	results := domain.ReconcilePositions(positions, trades)
+	if !opts.AdoptPositions {
+		return results, nil
+	}
+	for i := range results {
+		r := &results[i]
+		switch {
+		case r.Status == domain.ReconcileUnknown:
+			trade, err := uc.adoptPosition(*r.Position, opts)
+			if err != nil {
+				r.Action = fmt.Sprintf("not adopted: %v", err)
+				continue
+			}
+			r.Trade, r.Action = trade, "adopted"
+		case r.Status == domain.ReconcileSizeMismatch && r.Position.Lots < r.Trade.RemainingSize:
+			r.Action = fmt.Sprintf("remaining size %v -> %v lots", r.Trade.RemainingSize, r.Position.Lots)
+			r.Trade.RemainingSize = r.Position.Lots
+			if err := uc.tradeStore.Save(r.Trade); err != nil {
+				r.Action = fmt.Sprintf("failed to save: %v", err)
+			}
+		case r.Status == domain.ReconcileMissing:
+			if r.Trade.UsesBracket() {
+				uc.cancelBracket(r.Trade)
+			}
+			r.Action = "deleted local state"
+			if err := uc.tradeStore.Delete(r.Symbol); err != nil {
+				r.Action = fmt.Sprintf("failed to delete local state: %v", err)
+			}
+		}
+	}
+	return results, nil
+}
+
+// adoptPosition はボットの外で建てた建玉を、平均建値を基準に opts の決済条件で監視する取引として保存します。
+func (uc *TradingUsecase) adoptPosition(pos domain.Position, opts TradeOptions) (*domain.ActiveTrade, error) {
+	spec, err := uc.kucoinGateway.GetContract(pos.Symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract spec for %s: %w", pos.Symbol, err)
+	}
+	atr := 0.0
+	if opts.StopLoss.Type == domain.StopLossATR || opts.TrailingStop.Type == domain.TrailingStopATR {
+		if atr, err = uc.currentATR(pos.Symbol); err != nil {
+			return nil, fmt.Errorf("failed to calculate ATR for %s: %w", pos.Symbol, err)
+		}
+	}
+	var stopPrice float64
+	if opts.StopLoss.Enabled() {
+		if stopPrice, err = opts.StopLoss.StopPrice(pos.Side, pos.EntryPrice, atr); err != nil {
+			return nil, fmt.Errorf("invalid stop-loss: %w", err)
+		}
+	}
+	targets, err := takeProfitTargets(pos.Side, pos.EntryPrice, stopPrice, pos.Lots, takeProfitLevels(opts), spec, opts.TrailingStop.Enabled())
+	if err != nil {
+		return nil, fmt.Errorf("invalid take-profit: %w", err)
+	}
+
+	margin := domain.MarginSettings{Leverage: pos.Leverage, Mode: pos.MarginMode}
+	if margin.Leverage < 1 {
+		margin.Leverage = 1
+	}
+	openedAt := pos.OpenedAt
+	if openedAt.IsZero() {
+		openedAt = time.Now()
+	}
+	trade := &domain.ActiveTrade{
+		ID:            domain.NewTradeID(pos.Symbol, openedAt),
+		Symbol:        pos.Symbol,
+		Side:          pos.Side,
+		Size:          pos.Lots,
+		RemainingSize: pos.Lots,
+		Multiplier:    spec.Multiplier,
+		Margin:        margin,
+		EntryPrice:    pos.EntryPrice,
+		OpenedAt:      openedAt,
+		ExitExecution: opts.ExitExecution,
+		TakeProfits:   targets,
+		StopPrice:     stopPrice,
+		Trailing:      opts.TrailingStop,
+		TrailingATR:   atr,
+
+		BreakevenAfterFirstTarget: opts.BreakevenAfterFirstTarget,
+	}
+	if _, err := trade.UpdateTrailing(pos.EntryPrice); err != nil {
+		return nil, fmt.Errorf("invalid trailing stop: %w", err)
+	}
+	log.Printf("Adopting %s position on %s: %v lots @ %.4f, stop-loss %.4f, %d take-profit levels", pos.Side, pos.Symbol, pos.Lots, pos.EntryPrice, stopPrice, len(targets))
+	if opts.BracketPriceType != "" {
+		trade.BracketStop.PriceType = opts.BracketPriceType
+		uc.placeBracket(trade, spec)
+	}
+	if err := uc.tradeStore.Save(trade); err != nil {
+		return nil, fmt.Errorf("failed to save trade state for %s: %w", pos.Symbol, err)
+	}
+	return trade, nil
+}
+
+// ResumeTrades は突き合わせで建玉が確認できた取引の監視を並行して再開し、全て決済されるまで待ちます。
+// exclude の銘柄は ExecuteTrade が監視するため除きます。反対側の建玉がある取引と建玉がない取引は監視しません。
+func (uc *TradingUsecase) ResumeTrades(results []domain.PositionReconciliation, exclude string) {
+	var wg sync.WaitGroup
+	for _, r := range results {
+		if r.Symbol == exclude || r.Trade == nil || r.Position == nil {
+			continue
+		}
+		if r.Status != domain.ReconcileMatched && r.Status != domain.ReconcileSizeMismatch && r.Status != domain.ReconcileUnknown {
+			continue
+		}
+		wg.Add(1)
+		go func(trade *domain.ActiveTrade) {
+			defer wg.Done()
+			log.Printf("Resuming monitoring of %s position on %s (entry %.4f, remaining %v lots)", trade.Side, trade.Symbol, trade.EntryPrice, trade.RemainingSize)
+			uc.monitorTrade(trade)
+		}(r.Trade)
+	}
+	wg.Wait()
+}
+
+// exchangePosition は銘柄の建玉が取引所にあれば、保存した取引の有無にかかわらず返します。
+// 保存した取引のない建玉かどうかは呼び出し側で判断します。1ロットに満たない端数の建玉は建玉がないものとして扱います。
+func (uc *TradingUsecase) exchangePosition(symbol string) (*domain.Position, error) {
+	positions, err := uc.kucoinGateway.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range positions {
+		if p.Symbol == symbol && p.Lots > 0 {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,301 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ReportWriter はパフォーマンスレポートの出力先です。
+type ReportWriter interface {
+	WriteReport(report domain.PerformanceReport) error
+}
+
+// ReportUsecase は注文履歴からパフォーマンスレポートを作成するユースケースを実装します。
+// バックテストの結果もペーパー/ライブの注文も domain.Order の形で受け取り、同じ指標で評価します。
+type ReportUsecase struct {
+	writer ReportWriter
+}
+
+// NewReportUsecase は新しい ReportUsecase を生成します。
+func NewReportUsecase(w ReportWriter) *ReportUsecase {
+	return &ReportUsecase{
+		writer: w,
+	}
+}
+
+// GenerateReport はレポートを作成して出力します。
+// equityCurve が空の場合は約定ごとの確定損益から資産曲線を組み立てます。
+// funding は注文の手数料に含まれていない資金調達コストの合計で、ペーパートレードの累計などを渡します。
+func (uc *ReportUsecase) GenerateReport(name string, orders []domain.Order, initialCapital, funding float64, equityCurve []domain.EquityPoint) (domain.PerformanceReport, error) {
+	report := BuildPerformanceReport(name, orders, initialCapital, funding, equityCurve)
+	if err := uc.writer.WriteReport(report); err != nil {
+		return report, fmt.Errorf("failed to write report %s: %w", name, err)
+	}
+	return report, nil
+}
+
+// BuildPerformanceReport は注文履歴と資産曲線からパフォーマンス指標を計算します。
+// funding は取引ごとに按分できない資金調達コストの合計で、損益とコストに含め、確定損益から組み立てる資産曲線では最後の時点で差し引きます。
+// equityCurve を渡す場合、funding は既にその資産曲線に反映されているものとします。
+func BuildPerformanceReport(name string, orders []domain.Order, initialCapital, funding float64, equityCurve []domain.EquityPoint) domain.PerformanceReport {
+	roundTrips := roundTripsFromOrders(orders)
+	if len(equityCurve) == 0 {
+		equityCurve = realizedEquityCurve(orders, roundTrips, initialCapital)
+		if n := len(equityCurve); n > 0 && funding != 0 {
+			equityCurve[n-1].Equity -= funding
+		}
+	}
+
+	report := domain.PerformanceReport{
+		Name:           name,
+		InitialCapital: initialCapital,
+		FinalEquity:    initialCapital,
+		Funding:        funding,
+		RoundTrips:     roundTrips,
+		EquityCurve:    equityCurve,
+		Trades:         len(roundTrips),
+	}
+	if len(equityCurve) > 0 {
+		report.Start = equityCurve[0].Time
+		report.End = equityCurve[len(equityCurve)-1].Time
+		report.FinalEquity = equityCurve[len(equityCurve)-1].Equity
+	}
+	if initialCapital > 0 {
+		report.TotalReturn = (report.FinalEquity/initialCapital - 1) * 100
+	}
+
+	years := report.End.Sub(report.Start).Hours() / (24 * 365)
+	if years > 0 && initialCapital > 0 && report.FinalEquity > 0 {
+		report.CAGR = (math.Pow(report.FinalEquity/initialCapital, 1/years) - 1) * 100
+	}
+
+	report.Sharpe, report.Sortino = riskAdjustedReturns(equityCurve)
+	report.DrawdownCurve, report.MaxDrawdown, report.MaxDrawdownDays = drawdowns(equityCurve)
+
+	grossProfit, grossLoss, wins, totalPnL := 0.0, 0.0, 0, 0.0
+	for _, t := range roundTrips {
+		totalPnL += t.PnL
+		report.GrossPnL += t.GrossPnL
+		report.TotalCosts += t.Costs()
+		if t.PnL > 0 {
+			wins++
+			grossProfit += t.PnL
+		} else {
+			grossLoss -= t.PnL
+		}
+	}
+	report.TotalCosts += funding
+	report.NetPnL = totalPnL - funding
+	if len(roundTrips) > 0 {
+		report.WinRate = float64(wins) / float64(len(roundTrips)) * 100
+		report.AverageTradePnL = totalPnL / float64(len(roundTrips))
+	}
+	if grossLoss > 0 {
+		report.ProfitFactor = grossProfit / grossLoss
+	}
+	report.Exposure = exposure(roundTrips, report.Start, report.End)
+
+	return report
+}
+
+// TradesToOrders はシミュレートされた取引を建て/決済の注文の組に変換します。
+// 期間終了時に未決済の取引は建ての注文のみを含めます。
+func TradesToOrders(trades []domain.Trade) []domain.Order {
+	var orders []domain.Order
+	for i, t := range trades {
+		orders = append(orders, domain.Order{
+			ID:        fmt.Sprintf("bt-%d-entry", i+1),
+			Symbol:    t.Symbol,
+			Side:      t.Side,
+			Price:     t.EntryPrice,
+			Amount:    t.Size,
+			Fee:       t.EntryFee,
+			Status:    domain.OrderStatusFilled,
+			CreatedAt: t.EntryTime,
+		})
+		if t.IsOpen {
+			continue
+		}
+		orders = append(orders, domain.Order{
+			ID:        fmt.Sprintf("bt-%d-exit", i+1),
+			Symbol:    t.Symbol,
+			Side:      oppositeSide(t.Side),
+			Price:     t.ExitPrice,
+			Amount:    t.Size,
+			Fee:       t.ExitFee + t.Funding, // 注文には資金調達の項目がないため決済時のコストとして計上する
+			Status:    domain.OrderStatusFilled,
+			CreatedAt: t.ExitTime,
+		})
+	}
+	return orders
+}
+
+func oppositeSide(side domain.OrderSide) domain.OrderSide {
+	if side == domain.Buy {
+		return domain.Sell
+	}
+	return domain.Buy
+}
+
+// roundTripsFromOrders は約定済みの注文を時系列に並べ、銘柄ごとに建てから決済までの取引を組み立てます。
+// 数量は原資産単位に換算し、手数料は決済したサイズの割合で建て/決済それぞれから按分します。
+func roundTripsFromOrders(orders []domain.Order) []domain.Trade {
+	filled := make([]domain.Order, 0, len(orders))
+	for _, o := range orders {
+		if o.Status == domain.OrderStatusFilled {
+			filled = append(filled, o)
+		}
+	}
+	sort.SliceStable(filled, func(i, j int) bool { return filled[i].CreatedAt.Before(filled[j].CreatedAt) })
+
+	positions := map[string]*domain.Trade{}
+	var trips []domain.Trade
+	for _, o := range filled {
+		pos := positions[o.Symbol]
+		amount := o.BaseAmount()
+		switch {
+		case pos == nil:
+			positions[o.Symbol] = &domain.Trade{Symbol: o.Symbol, Side: o.Side, EntryTime: o.CreatedAt, EntryPrice: o.Price, Size: amount, EntryFee: o.Fee}
+		case pos.Side == o.Side:
+			pos.EntryPrice = (pos.EntryPrice*pos.Size + o.Price*amount) / (pos.Size + amount)
+			pos.Size += amount
+			pos.EntryFee += o.Fee
+		default:
+			closeSize := math.Min(pos.Size, amount)
+			entryFee := pos.EntryFee * closeSize / pos.Size
+			trip := *pos
+			trip.Size = closeSize
+			trip.EntryFee = entryFee
+			trip = closeBacktestTrade(trip, o.CreatedAt, o.Price, false)
+			trip.ExitFee = o.Fee * closeSize / amount
+			trip.PnL -= trip.Costs()
+			trips = append(trips, trip)
+
+			pos.Size -= closeSize
+			pos.EntryFee -= entryFee
+			if pos.Size <= 0 {
+				delete(positions, o.Symbol)
+			}
+			if remaining := amount - closeSize; remaining > 0 {
+				positions[o.Symbol] = &domain.Trade{Symbol: o.Symbol, Side: o.Side, EntryTime: o.CreatedAt, EntryPrice: o.Price, Size: remaining, EntryFee: o.Fee * remaining / amount}
+			}
+		}
+	}
+	return trips
+}
+
+// realizedEquityCurve は確定損益のみで資産曲線を作ります。
+func realizedEquityCurve(orders []domain.Order, trips []domain.Trade, initialCapital float64) []domain.EquityPoint {
+	if len(orders) == 0 {
+		return nil
+	}
+	start := orders[0].CreatedAt
+	for _, o := range orders {
+		if o.CreatedAt.Before(start) {
+			start = o.CreatedAt
+		}
+	}
+
+	curve := []domain.EquityPoint{{Time: start, Equity: initialCapital}}
+	equity := initialCapital
+	for _, t := range trips {
+		equity += t.PnL
+		curve = append(curve, domain.EquityPoint{Time: t.ExitTime, Equity: equity})
+	}
+	return curve
+}
+
+// riskAdjustedReturns は資産曲線の各区間の収益率から年率換算のシャープレシオとソルティノレシオを計算します。
+func riskAdjustedReturns(curve []domain.EquityPoint) (float64, float64) {
+	if len(curve) < 3 {
+		return 0, 0
+	}
+	returns := make([]float64, 0, len(curve)-1)
+	for i := 1; i < len(curve); i++ {
+		if curve[i-1].Equity != 0 {
+			returns = append(returns, curve[i].Equity/curve[i-1].Equity-1)
+		}
+	}
+	span := curve[len(curve)-1].Time.Sub(curve[0].Time)
+	if span <= 0 || len(returns) < 2 {
+		return 0, 0
+	}
+	periodsPerYear := float64(len(returns)) / (span.Hours() / (24 * 365))
+
+	avg := mean(returns)
+	variance, downside := 0.0, 0.0
+	for _, r := range returns {
+		variance += (r - avg) * (r - avg)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDev := math.Sqrt(downside / float64(len(returns)))
+
+	sharpe, sortino := 0.0, 0.0
+	if std > 0 {
+		sharpe = avg / std * math.Sqrt(periodsPerYear)
+	}
+	if downsideDev > 0 {
+		sortino = avg / downsideDev * math.Sqrt(periodsPerYear)
+	}
+	return sharpe, sortino
+}
+
+// drawdowns はドローダウン曲線、最大ドローダウン (%) と最長の水面下期間（日）を計算します。
+func drawdowns(curve []domain.EquityPoint) ([]domain.DrawdownPoint, float64, float64) {
+	if len(curve) == 0 {
+		return nil, 0, 0
+	}
+	points := make([]domain.DrawdownPoint, len(curve))
+	peak := curve[0].Equity
+	peakTime := curve[0].Time
+	maxDD := 0.0
+	var longest time.Duration
+	for i, p := range curve {
+		if p.Equity >= peak {
+			peak = p.Equity
+			peakTime = p.Time
+		}
+		dd := 0.0
+		if peak > 0 {
+			dd = (p.Equity/peak - 1) * 100
+		}
+		points[i] = domain.DrawdownPoint{Time: p.Time, Drawdown: dd}
+		if dd < maxDD {
+			maxDD = dd
+		}
+		if underwater := p.Time.Sub(peakTime); dd < 0 && underwater > longest {
+			longest = underwater
+		}
+	}
+	return points, maxDD, longest.Hours() / 24
+}
+
+// exposure は期間中にいずれかのポジションを保有していた時間の割合 (%) を計算します。
+func exposure(trips []domain.Trade, start, end time.Time) float64 {
+	total := end.Sub(start)
+	if total <= 0 || len(trips) == 0 {
+		return 0
+	}
+	intervals := make([]domain.Trade, len(trips))
+	copy(intervals, trips)
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].EntryTime.Before(intervals[j].EntryTime) })
+
+	var held time.Duration
+	curStart, curEnd := intervals[0].EntryTime, intervals[0].ExitTime
+	for _, t := range intervals[1:] {
+		if t.EntryTime.After(curEnd) {
+			held += curEnd.Sub(curStart)
+			curStart, curEnd = t.EntryTime, t.ExitTime
+		} else if t.ExitTime.After(curEnd) {
+			curEnd = t.ExitTime
+		}
+	}
+	held += curEnd.Sub(curStart)
+	return math.Min(100, float64(held)/float64(total)*100)
+}
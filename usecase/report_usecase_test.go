@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"math"
+	"testing"
+	"time"
+)
+
+// roundTrip は建てと決済の約定済み注文の組を返します。
+func roundTrip(side domain.OrderSide, entry, exit float64, fee float64, opened, closed time.Time) []domain.Order {
+	return []domain.Order{
+		{Symbol: "XBTUSDTM", Side: side, Price: entry, Amount: 1, Fee: fee, Status: domain.OrderStatusFilled, CreatedAt: opened},
+		{Symbol: "XBTUSDTM", Side: oppositeSide(side), Price: exit, Amount: 1, Fee: fee, Status: domain.OrderStatusFilled, CreatedAt: closed},
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBuildPerformanceReport(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name   string
+		orders []domain.Order
+		want   domain.PerformanceReport
+	}{
+		{
+			name: "no trades",
+			want: domain.PerformanceReport{FinalEquity: 1000},
+		},
+		{
+			// +10 と -5 の取引に、建て/決済それぞれ 0.5 の手数料。資産は 1000 → 1009 → 1003
+			name: "one winner and one loser with fees",
+			orders: append(
+				roundTrip(domain.Buy, 100, 110, 0.5, t0, t0.Add(day)),
+				roundTrip(domain.Buy, 110, 105, 0.5, t0.Add(2*day), t0.Add(3*day))...),
+			want: domain.PerformanceReport{
+				FinalEquity:     1003,
+				TotalReturn:     0.3,
+				Sharpe:          2.2534470784011216,
+				Sortino:         5.664039231561171,
+				MaxDrawdown:     (1003.0/1009 - 1) * 100,
+				MaxDrawdownDays: 2,
+				GrossPnL:        5,
+				TotalCosts:      2,
+				NetPnL:          3,
+				Trades:          2,
+				WinRate:         50,
+				ProfitFactor:    1.5, // 9 / 6
+				AverageTradePnL: 1.5,
+				Exposure:        200.0 / 3, // 3日のうち2日
+			},
+		},
+		{
+			// -10 と -9 のショート。資産は 1000 → 990 → 981
+			name: "all losers",
+			orders: append(
+				roundTrip(domain.Sell, 100, 110, 0, t0, t0.Add(day)),
+				roundTrip(domain.Sell, 90, 99, 0, t0.Add(day), t0.Add(2*day))...),
+			want: domain.PerformanceReport{
+				FinalEquity:     981,
+				TotalReturn:     -1.9,
+				Sharpe:          -283.6943778082124,
+				Sortino:         -19.0833489761309,
+				MaxDrawdown:     -1.9,
+				MaxDrawdownDays: 2,
+				GrossPnL:        -19,
+				NetPnL:          -19,
+				Trades:          2,
+				WinRate:         0,
+				ProfitFactor:    0,
+				AverageTradePnL: -9.5,
+				Exposure:        100,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildPerformanceReport(tt.name, tt.orders, 1000, 0, nil)
+			if got.Trades != tt.want.Trades {
+				t.Errorf("Trades = %d, want %d", got.Trades, tt.want.Trades)
+			}
+			checks := []struct {
+				field     string
+				got, want float64
+			}{
+				{"FinalEquity", got.FinalEquity, tt.want.FinalEquity},
+				{"TotalReturn", got.TotalReturn, tt.want.TotalReturn},
+				{"Sharpe", got.Sharpe, tt.want.Sharpe},
+				{"Sortino", got.Sortino, tt.want.Sortino},
+				{"MaxDrawdown", got.MaxDrawdown, tt.want.MaxDrawdown},
+				{"MaxDrawdownDays", got.MaxDrawdownDays, tt.want.MaxDrawdownDays},
+				{"GrossPnL", got.GrossPnL, tt.want.GrossPnL},
+				{"TotalCosts", got.TotalCosts, tt.want.TotalCosts},
+				{"NetPnL", got.NetPnL, tt.want.NetPnL},
+				{"WinRate", got.WinRate, tt.want.WinRate},
+				{"ProfitFactor", got.ProfitFactor, tt.want.ProfitFactor},
+				{"AverageTradePnL", got.AverageTradePnL, tt.want.AverageTradePnL},
+				{"Exposure", got.Exposure, tt.want.Exposure},
+			}
+			for _, c := range checks {
+				if !approxEqual(c.got, c.want) {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDrawdownsTracksLongestUnderwaterPeriod(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	curve := []domain.EquityPoint{
+		{Time: t0, Equity: 100},
+		{Time: t0.Add(day), Equity: 80},      // -20%
+		{Time: t0.Add(2 * day), Equity: 120}, // 新高値
+		{Time: t0.Add(3 * day), Equity: 90},  // -25%
+		{Time: t0.Add(6 * day), Equity: 100}, // 新高値から4日間水面下
+	}
+	points, maxDD, days := drawdowns(curve)
+	if !approxEqual(maxDD, -25) {
+		t.Errorf("max drawdown = %v, want -25", maxDD)
+	}
+	if !approxEqual(days, 4) {
+		t.Errorf("longest underwater period = %v days, want 4", days)
+	}
+	if len(points) != len(curve) || !approxEqual(points[1].Drawdown, -20) || points[2].Drawdown != 0 {
+		t.Errorf("drawdown curve = %+v", points)
+	}
+}
@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+
+	"github.com/markcheno/go-talib"
+)
+
+const (
+	defaultAnalysisGranularity = 60  // 60 minutes = 1 hour
+	analysisKlineCount         = 100 // 分析に使用するローソク足の本数
+	takeProfitRate             = 0.01
+	atrPeriod                  = 14
+)
+
+// trendSignal は MACD と RSI によるトレンド判定の結果です。
+type trendSignal struct {
+	isLong  bool
+	isShort bool
+	macd    float64
+	rsi     float64
+}
+
+// evaluateTrendSignal は終値の系列からゴールデンクロス/デッドクロスと RSI でトレンドを判定します。
+// データが不足している場合は false を返します。
+func evaluateTrendSignal(closePrices []float64, params domain.SignalParams) (trendSignal, bool) {
+	// MACD計算に最低限必要な期間（RSIは期間より1本多く必要）
+	if len(closePrices) < params.SlowPeriod || len(closePrices) <= params.RSIPeriod {
+		return trendSignal{}, false
+	}
+
+	macd, macdSignal, _ := talib.Macd(closePrices, params.FastPeriod, params.SlowPeriod, params.SignalPeriod)
+	rsi := talib.Rsi(closePrices, params.RSIPeriod)
+
+	lastMacd := macd[len(macd)-1]
+	lastMacdSignal := macdSignal[len(macdSignal)-1]
+	prevMacd := macd[len(macd)-2]
+	prevMacdSignal := macdSignal[len(macdSignal)-2]
+	lastRsi := rsi[len(rsi)-1]
+
+	// 上昇トレンド（ロング候補）
+	isGoldenCross := prevMacd < prevMacdSignal && lastMacd > lastMacdSignal
+	isRsiNotOverbought := lastRsi < params.RSIOverbought
+
+	// 下降トレンド（ショート候補）
+	isDeadCross := prevMacd > prevMacdSignal && lastMacd < lastMacdSignal
+	isRsiNotOversold := lastRsi > params.RSIOversold
+
+	return trendSignal{
+		isLong:  isGoldenCross && isRsiNotOverbought,
+		isShort: isDeadCross && isRsiNotOversold,
+		macd:    lastMacd,
+		rsi:     lastRsi,
+	}, true
+}
+
+// takeProfitPrice はエントリー価格から利益確定価格を計算します。
+func takeProfitPrice(side string, entryPrice float64) float64 {
+	if side == "buy" {
+		return entryPrice * (1 + takeProfitRate)
+	}
+	return entryPrice * (1 - takeProfitRate)
+}
+
+// isTakeProfitReached は価格が利益確定価格に到達したかを判定します。
+func isTakeProfitReached(side string, price, targetPrice float64) bool {
+	return (side == "buy" && price >= targetPrice) || (side == "sell" && price <= targetPrice)
+}
+
+// averageTrueRange は古い順に並んだローソク足から直近の ATR を計算します。
+func averageTrueRange(candles []domain.Candle, period int) (float64, error) {
+	if len(candles) <= period {
+		return 0, fmt.Errorf("not enough klines for ATR(%d): %d", period, len(candles))
+	}
+	high := make([]float64, len(candles))
+	low := make([]float64, len(candles))
+	closePrices := make([]float64, len(candles))
+	for i, c := range candles {
+		high[i], low[i], closePrices[i] = c.High, c.Low, c.Close
+	}
+
+	atr := talib.Atr(high, low, closePrices, period)
+	return atr[len(atr)-1], nil
+}
@@ -0,0 +1,208 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"fmt"
+	"log"
+	"time"
+)
+
+// monitorTrade は建玉が全て決済されるまで価格を監視し、決済条件を満たした分を成行注文で決済します。
+// トレーリングストップが動いた場合や部分決済した場合は状態を保存し、再起動しても監視を再開できるようにします。
+// 取引所に逆指値注文を出している決済は、その約定を確認して記録し、トレーリングストップや建値への移動に合わせて損切り注文を動かします。
+// 価格のストリームがある場合は価格が届くたびに決済条件を確認し、取引所への確認や状態の保存は pollInterval ごとに行います。
+// 建玉がなくなった、または強制決済されたという変化を受け取った場合は、すぐに取引所を確認し、
+// ボットの外で決済された分をマーク価格で記録します。
+func (uc *TradingUsecase) monitorTrade(trade *domain.ActiveTrade) {
+	feed := uc.newPriceFeed(trade.Symbol)
+	defer feed.close()
+
+	var lastCheck time.Time
+	moved, exitFailed := false, false
+	// lastStop は取引所の損切り注文に反映済みの損切り価格です。利益確定の後に建値に移した場合に注文を動かします
+	lastStop := trade.StopPrice
+	for {
+		latestPrice, err := feed.next()
+		if err != nil {
+			log.Printf("Could not get latest price for %s: %v", trade.Symbol, err)
+			continue
+		}
+		positionEvent := feed.positionEvent()
+		periodic := positionEvent != nil || time.Since(lastCheck) >= uc.pollInterval
+		if periodic {
+			lastCheck = time.Now()
+			log.Printf("Latest price for %s: %.4f", trade.Symbol, latestPrice)
+		}
+
+		changed, err := trade.UpdateTrailing(latestPrice)
+		if err != nil {
+			log.Printf("Failed to update trailing stop for %s: %v", trade.Symbol, err)
+		}
+		moved = moved || changed
+		if periodic {
+			if moved && trade.TrailingActive {
+				log.Printf("Trailing stop for %s: best %.4f, stop %.4f", trade.Symbol, trade.BestPrice, trade.TrailingStopPrice)
+			}
+			stopMoved := trade.StopPrice != lastStop
+			if stopMoved {
+				log.Printf("Stop-loss for %s moved to %.4f", trade.Symbol, trade.StopPrice)
+				moved = true
+			}
+			if !trade.UsesBracket() {
+				lastStop = trade.StopPrice
+			} else {
+				if (moved && trade.TrailingActive) || stopMoved {
+					if spec, err := uc.kucoinGateway.GetContract(trade.Symbol); err != nil {
+						log.Printf("Could not get contract spec to move the exchange stop for %s: %v", trade.Symbol, err)
+					} else {
+						uc.updateBracketStop(trade, spec)
+						lastStop = trade.StopPrice
+					}
+				}
+				if uc.syncBracket(trade) {
+					moved = true
+				}
+			}
+			if moved && !trade.IsClosed() {
+				if err := uc.tradeStore.Save(trade); err != nil {
+					log.Printf("Failed to save trade state for %s: %v", trade.Symbol, err)
+				}
+			}
+			moved = false
+		}
+
+		// 前回の決済注文の結果が分からない場合は、それを確定させるまで次の決済注文を出さない
+		if trade.PendingExit != nil && (!periodic || !uc.resolvePendingExit(trade)) {
+			continue
+		}
+		if positionEvent != nil && !trade.IsClosed() && uc.applyPositionEvent(trade, *positionEvent, latestPrice) && !trade.IsClosed() {
+			if err := uc.tradeStore.Save(trade); err != nil {
+				log.Printf("Failed to save trade state for %s: %v", trade.Symbol, err)
+			}
+		}
+		// 決済できなかった場合は、次の定期確認まで決済注文を出し直さない
+		if exitFailed && !periodic {
+			continue
+		}
+		exitFailed = false
+
+		// 利益確定・損切り条件のチェック（価格が複数の段階を一度に超えた場合はまとめて決済する）
+		for !trade.IsClosed() {
+			label, size, target, ok := trade.NextExit(latestPrice)
+			if !ok {
+				break
+			}
+			if err := uc.closePartial(trade, label, size, target, latestPrice); err != nil {
+				log.Printf("%v", err)
+				exitFailed = true
+				break
+			}
+		}
+		if !trade.IsClosed() {
+			continue
+		}
+
+		if trade.UsesBracket() {
+			uc.cancelBracket(trade)
+		}
+		printExitSummary(trade)
+		if err := uc.tradeStore.Delete(trade.Symbol); err != nil {
+			log.Printf("Failed to delete trade state for %s: %v", trade.Symbol, err)
+		}
+		break
+	}
+}
+
+// closePartial は reduce-only の成行注文で建玉の一部または全部を決済し、残りサイズを保存します。
+// reduce-only にすることで、手動決済などで建玉が既にない場合に反対の建玉を建ててしまうのを防ぎます。
+// 利益確定は、執行アルゴリズムが設定されていれば子注文に分けて決済します。
+// 決済注文は clientOid を PendingExit として保存してから発注し、結果が分からない場合は PendingExit を残して
+// 次の監視で取引所の注文を確認するため、同じ決済を二重に発注することはありません。
+func (uc *TradingUsecase) closePartial(trade *domain.ActiveTrade, label string, size float64, target int, price float64) error {
+	closeSide := trade.CloseSide()
+	req := domain.OrderRequest{
+		ClientOID:  trade.NextClientOID(),
+		Symbol:     trade.Symbol,
+		Side:       closeSide,
+		Type:       domain.OrderTypeMarket,
+		Size:       size,
+		ReduceOnly: true,
+		Leverage:   trade.Margin.Leverage,
+		MarginMode: trade.Margin.Mode,
+	}
+	var plan domain.ExecutionPlan
+	if target >= 0 {
+		plan = trade.ExitExecution
+	}
+	trade.PendingExit = &domain.PendingOrder{ClientOID: req.ClientOID, Label: label, Target: target, Size: size, Algo: plan.Algo}
+	if err := uc.tradeStore.Save(trade); err != nil {
+		trade.PendingExit = nil
+		return fmt.Errorf("not placing %s order: failed to save trade state for %s: %w", label, trade.Symbol, err)
+	}
+
+	if plan.Enabled() {
+		log.Printf("%s reached at %.4f! Executing reduce-only %s order for %v lots with %s.", label, price, closeSide, size, plan.Algo)
+	} else {
+		log.Printf("%s reached at %.4f! Placing reduce-only %s order for %v lots to close position.", label, price, closeSide, size)
+	}
+	progress, err := uc.executor.Run(req, plan, orderSettleTimeout, nil, logExecutionProgress)
+	if err != nil {
+		return fmt.Errorf("%s order %s is kept pending: %w", label, req.ClientOID, err)
+	}
+	return uc.recordExit(trade, progress)
+}
+
+// resolvePendingExit は結果が確定していない決済注文を clientOid で確認し、約定していれば記録します。
+// 結果が確定した場合は true を返します。
+func (uc *TradingUsecase) resolvePendingExit(trade *domain.ActiveTrade) bool {
+	p := *trade.PendingExit
+	progress, found, err := uc.executor.Recover(trade.Symbol, trade.CloseSide(), p)
+	if err != nil {
+		log.Printf("Could not confirm %s order %s: %v", p.Label, p.ClientOID, err)
+		return false
+	}
+	if !found {
+		log.Printf("%s order %s never reached the exchange", p.Label, p.ClientOID)
+	}
+	if err := uc.recordExit(trade, progress); err != nil {
+		log.Printf("%v", err)
+	}
+	return true
+}
+
+// recordExit は PendingExit の決済注文の約定を記録して PendingExit を消し、残りサイズを保存します。
+func (uc *TradingUsecase) recordExit(trade *domain.ActiveTrade, progress domain.ExecutionProgress) error {
+	p := *trade.PendingExit
+	trade.PendingExit = nil
+	var err error
+	if progress.FilledSize == 0 {
+		err = fmt.Errorf("%s order %s for %s filled nothing", p.Label, p.ClientOID, trade.Symbol)
+	} else {
+		order := progress.Order()
+		trade.RecordExit(domain.ExitFill{Label: p.Label, OrderID: order.ID, Size: order.FilledSize, Price: order.Price, Fee: order.Fee, At: time.Now()}, p.Target)
+		fill := trade.Exits[len(trade.Exits)-1]
+		if order.FilledSize < p.Size {
+			log.Printf("%s order %s filled only %v of %v lots", p.Label, p.ClientOID, order.FilledSize, p.Size)
+		}
+		log.Printf("%s order filled. Order ID: %s. %v lots @ %.4f, realized PnL: %.4f USD (fee %.4f). Remaining: %v lots",
+			order.Side, fill.OrderID, fill.Size, fill.Price, fill.PnL, fill.Fee, trade.RemainingSize)
+	}
+
+	if !trade.IsClosed() {
+		if saveErr := uc.tradeStore.Save(trade); saveErr != nil {
+			log.Printf("Failed to save trade state for %s: %v", trade.Symbol, saveErr)
+		}
+	}
+	return err
+}
+
+// printExitSummary は決済ごとの実現損益と手数料を表示します。
+func printExitSummary(trade *domain.ActiveTrade) {
+	fmt.Printf("\n--- Exit Summary: %s %s (entry %.4f, %v lots, entry fee %.4f) ---\n", trade.Symbol, trade.Side, trade.EntryPrice, trade.Size, trade.EntryFee)
+	fmt.Printf("%-24s %14s %14s %14s %12s %s\n", "Level", "Lots", "Price", "PnL", "Fee", "Order ID")
+	for _, e := range trade.Exits {
+		fmt.Printf("%-24s %14v %14.4f %14.4f %12.4f %s\n", e.Label, e.Size, e.Price, e.PnL, e.Fee, e.OrderID)
+	}
+	gross, fees := trade.RealizedPnL(), trade.TotalFees()
+	fmt.Printf("Total realized PnL: %.4f USD (gross %.4f, fees %.4f)\n", gross-fees, gross, fees)
+}
@@ -4,25 +4,55 @@ import (
 	"crypto_trade_bot/domain"
 	"fmt"
 	"log"
-	"strconv"
+	"sort"
 	"sync"
 	"time"
-
-	"github.com/markcheno/go-talib"
 )
 
 // TradingUsecase は通貨選定やROIフィルタリングのユースケースを実装します。
 type TradingUsecase struct {
 	kucoinGateway KuCoinGateway
+	klineProvider KlineProvider
 	openaiGateway OpenAIGateway
+	signalConfig  domain.SignalConfig
+	tradeStore    TradeStateStore
+	pollInterval  time.Duration
+	// analysisGranularity は分析と ATR の計算に使う足の長さ（分）です。
+	analysisGranularity int
+	// executor は注文の約定を待ち、執行アルゴリズムで大きな注文を分割して発注します。
+	executor *OrderExecutor
+	// priceStream は取引監視で価格を受け取るストリームです。nil の場合は REST で価格を確認します。
+	priceStream PriceStream
+	// orderBooks は建て注文の事前確認と分析で使う板情報の取得元です。
+	orderBooks OrderBookSource
+	// accountEvents は取引監視で建玉の変化を受け取るストリームです。nil の場合は定期確認だけを行います。
+	accountEvents AccountEventStream
+}
+
+// TradeStateStore は監視中の取引の状態を永続化するためのインターフェースです。
+type TradeStateStore interface {
+	Load(symbol string) (*domain.ActiveTrade, error)
+	List() ([]domain.ActiveTrade, error)
+	Save(trade *domain.ActiveTrade) error
+	Delete(symbol string) error
 }
 
+// defaultPollInterval は取引監視で価格を確認する間隔です。
+const defaultPollInterval = 30 * time.Second
+
 // KuCoinGateway は KuCoin API との通信のためのインターフェースです。
 type KuCoinGateway interface {
 	GetTop20USDTpairsByVolume() ([]string, error)
 	GetCurrentPrice(symbol string) (float64, error)
-	CreateOrder(symbol string, side string, orderType string, size string) (string, error)
-	GetKlines(symbol string, granularity int, count int) ([][]string, error)
+	CreateOrder(req domain.OrderRequest) (string, error)
+	GetOrder(orderID string) (domain.Order, error)
+	GetOrderByClientOID(clientOID string) (domain.Order, error)
+	CancelOrder(orderID string) error
+	GetContract(symbol string) (domain.ContractSpec, error)
+	GetRecentTrades(symbol string) ([]domain.MarketTrade, error)
+	GetPositions() ([]domain.Position, error)
+	GetOrderBook(symbol string) (domain.OrderBook, error)
+	GetCandles(symbol string, granularity int, count int) ([]domain.Candle, error)
 }
 
 // OpenAIGateway は OpenAI API との通信のためのインターフェースです。
@@ -31,10 +61,32 @@ type OpenAIGateway interface {
 }
 
 // NewTradingUsecase は新しい TradingUsecase を生成します。
-func NewTradingUsecase(kg KuCoinGateway, og OpenAIGateway) *TradingUsecase {
+// kp は分析に使うローソク足の取得元で、ローカルキャッシュを渡すとネットワークを使わずに分析できます。
+func NewTradingUsecase(kg KuCoinGateway, kp KlineProvider, og OpenAIGateway, signalConfig domain.SignalConfig, ts TradeStateStore) *TradingUsecase {
 	return &TradingUsecase{
-		kucoinGateway: kg,
-		openaiGateway: og,
+		kucoinGateway:       kg,
+		klineProvider:       kp,
+		openaiGateway:       og,
+		signalConfig:        signalConfig,
+		tradeStore:          ts,
+		pollInterval:        defaultPollInterval,
+		executor:            NewOrderExecutor(kg),
+		orderBooks:          kg,
+		analysisGranularity: defaultAnalysisGranularity,
+	}
+}
+
+// SetAnalysisGranularity は分析と ATR の計算に使う足の長さ（分）を変更します。既定は60分足です。
+func (uc *TradingUsecase) SetAnalysisGranularity(minutes int) {
+	uc.analysisGranularity = minutes
+}
+
+// SetPollInterval は取引監視で価格を確認する間隔を変更します。テストで偽サーバーと組み合わせる場合などに使います。
+// 注文の約定状況を確認する間隔も、d の方が短い場合は d に揃えます。
+func (uc *TradingUsecase) SetPollInterval(d time.Duration) {
+	uc.pollInterval = d
+	if d < uc.executor.pollInterval {
+		uc.executor.SetPollInterval(d)
 	}
 }
 
@@ -58,60 +110,36 @@ func (uc *TradingUsecase) AnalyzeTrends() {
 			defer wg.Done()
 			log.Printf("Analyzing %s...", p)
 
-			klines, err := uc.kucoinGateway.GetKlines(p, 60, 100) // 60 minutes = 1 hour
+			candles, err := uc.klineProvider.GetCandles(p, uc.analysisGranularity, analysisKlineCount)
 			if err != nil {
 				log.Printf("Could not get klines for %s: %v", p, err)
 				return
 			}
+			_, closePrices := domain.CandleCloses(candles)
 
-			closePrices := make([]float64, len(klines))
-			for i, k := range klines {
-				price, err := strconv.ParseFloat(k[2], 64)
-				if err != nil {
-					log.Printf("Could not parse close price for %s: %v", p, err)
-					return
-				}
-				closePrices[i] = price
-			}
-			for i, j := 0, len(closePrices)-1; i < j; i, j = i+1, j-1 {
-				closePrices[i], closePrices[j] = closePrices[j], closePrices[i]
-			}
-
-			if len(closePrices) < 26 { // MACD計算に最低限必要な期間
+			signal, ok := evaluateTrendSignal(closePrices, uc.signalConfig.ParamsFor(p))
+			if !ok {
 				log.Printf("Not enough data for MACD calculation on %s", p)
 				return
 			}
 
-			macd, macdSignal, _ := talib.Macd(closePrices, 12, 26, 9)
-			rsi := talib.Rsi(closePrices, 14)
-
-			lastMacd := macd[len(macd)-1]
-			lastMacdSignal := macdSignal[len(macdSignal)-1]
-			prevMacd := macd[len(macd)-2]
-			prevMacdSignal := macdSignal[len(macdSignal)-2]
-			lastRsi := rsi[len(rsi)-1]
-
 			// --- トレンド判断 ---
-			// 上昇トレンド（ロング候補）
-			isGoldenCross := prevMacd < prevMacdSignal && lastMacd > lastMacdSignal
-			isRsiNotOverbought := lastRsi < 70.0
-			if isGoldenCross && isRsiNotOverbought {
-				asset := createAsset(p, closePrices, lastMacd, lastRsi)
+			if signal.isLong {
+				asset := createAsset(p, closePrices, signal.macd, signal.rsi)
+				uc.attachLiquidity(&asset)
 				mu.Lock()
 				longCandidates = append(longCandidates, asset)
 				mu.Unlock()
-				log.Printf("[LONG Candidate] %s: GoldenCross, RSI=%.2f", p, lastRsi)
+				log.Printf("[LONG Candidate] %s: GoldenCross, RSI=%.2f", p, signal.rsi)
 			}
 
-			// 下降トレンド（ショート候補）
-			isDeadCross := prevMacd > prevMacdSignal && lastMacd < lastMacdSignal
-			isRsiNotOversold := lastRsi > 30.0
-			if isDeadCross && isRsiNotOversold {
-				asset := createAsset(p, closePrices, lastMacd, lastRsi)
+			if signal.isShort {
+				asset := createAsset(p, closePrices, signal.macd, signal.rsi)
+				uc.attachLiquidity(&asset)
 				mu.Lock()
 				shortCandidates = append(shortCandidates, asset)
 				mu.Unlock()
-				log.Printf("[SHORT Candidate] %s: DeadCross, RSI=%.2f", p, lastRsi)
+				log.Printf("[SHORT Candidate] %s: DeadCross, RSI=%.2f", p, signal.rsi)
 			}
 
 		}(pair)
@@ -124,7 +152,7 @@ func (uc *TradingUsecase) AnalyzeTrends() {
 		log.Printf("\n--- Found %d LONG candidates ---", len(longCandidates))
 		var assetInfo []string
 		for _, asset := range longCandidates {
-			info := fmt.Sprintf("%s (ROI: %.2f%%, MACD: %.4f, RSI: %.2f)", asset.Symbol, asset.CalculateROI(), asset.MACD, asset.RSI)
+			info := describeAsset(asset)
 			log.Println("- " + info)
 			assetInfo = append(assetInfo, info)
 		}
@@ -146,7 +174,7 @@ func (uc *TradingUsecase) AnalyzeTrends() {
 		log.Printf("\n--- Found %d SHORT candidates ---", len(shortCandidates))
 		var assetInfo []string
 		for _, asset := range shortCandidates {
-			info := fmt.Sprintf("%s (ROI: %.2f%%, MACD: %.4f, RSI: %.2f)", asset.Symbol, asset.CalculateROI(), asset.MACD, asset.RSI)
+			info := describeAsset(asset)
 			log.Println("- " + info)
 			assetInfo = append(assetInfo, info)
 		}
@@ -174,8 +202,45 @@ func createAsset(symbol string, closePrices []float64, macd, rsi float64) domain
 	}
 }
 
+// TradeOptions は取引の決済条件です。
+type TradeOptions struct {
+	StopLoss     domain.StopLoss
+	TrailingStop domain.TrailingStop // 利益確定の段階で決済しなかった残りをトレーリングストップで決済する
+	// TakeProfits は段階的な利益確定です。トレーリングストップもない場合は +1% で全量を利益確定します。
+	TakeProfits []domain.TakeProfit
+	// BreakevenAfterFirstTarget を指定すると、最初の利益確定の段階を決済した時点で損切りを建値に移す。
+	BreakevenAfterFirstTarget bool
+	// EntryLimitPrice を指定した場合は成行ではなく指値で建て、決済条件もその価格を基準に計算する
+	EntryLimitPrice  float64
+	EntryTimeInForce domain.TimeInForce
+	EntryPostOnly    bool
+	// EntryTimeout は建て注文の約定を待つ時間です。0 の場合は既定の30秒です。
+	// 時間内に約定しきらなかった場合は残りを取り消し、約定した数量だけを監視します。
+	EntryTimeout time.Duration
+	// MaxEntrySlippageBps を指定すると、成行の建て注文を板で約定させた場合の仲値からの乖離の見積もりがこれを超える場合に建てない。
+	// 執行アルゴリズムで建てる場合は確認しない。
+	MaxEntrySlippageBps float64
+	// Margin はレバレッジと証拠金の方式です。レバレッジが 0 の場合は1倍・分離証拠金です。
+	Margin domain.MarginSettings
+	// BracketPriceType を指定すると、建て直後に損切りと利益確定を取引所の逆指値注文として発注し、
+	// ボットが停止している間も建玉を保護します。空の場合は監視ループだけで決済します。
+	BracketPriceType domain.StopPriceType
+	// EntryExecution を指定すると、成行の建て注文を執行アルゴリズムで子注文に分けて発注する。
+	EntryExecution domain.ExecutionPlan
+	// ExitExecution を指定すると、利益確定の決済を執行アルゴリズムで発注する。損切りは常に1回の成行注文で決済する。
+	ExitExecution domain.ExecutionPlan
+	// Abort が閉じられると、執行中のアルゴリズムは次の子注文を出さずに終了し、約定した分だけを監視する。
+	Abort <-chan struct{}
+	// AdoptPositions を指定すると、起動時の突き合わせでボットが保存していない建玉をこの決済条件で監視する取引として取り込み、
+	// 保存した状態と取引所の建玉の食い違いを解消する。指定しない場合は報告のみ行う。
+	AdoptPositions bool
+}
+
 // ExecuteTrade は指定された条件で取引を実行します。
-func (uc *TradingUsecase) ExecuteTrade(symbol, side string, amountUSD float64, execute bool) {
+// 同じ銘柄の監視中の取引が保存されている場合は、新規に建てずにその監視を再開します。
+// 建て注文は clientOid を含む取引の状態を保存してから発注するため、結果が分からないまま停止しても、
+// 次に実行したときに取引所の注文を確認して続きから監視し、二重に建てることはありません。
+func (uc *TradingUsecase) ExecuteTrade(symbol, side string, amountUSD float64, execute bool, opts TradeOptions) {
 	if !execute {
 		log.Println("Execute flag is not set. Exiting trade execution (Dry Run).")
 		return
@@ -185,63 +250,349 @@ func (uc *TradingUsecase) ExecuteTrade(symbol, side string, amountUSD float64, e
 		return
 	}
 
+	existing, err := uc.tradeStore.Load(symbol)
+	if err != nil {
+		log.Printf("Failed to load trade state for %s: %v", symbol, err)
+		return
+	}
+	if existing != nil && existing.PendingEntry != nil {
+		uc.resumeEntry(existing, opts)
+		return
+	}
+	if existing != nil {
+		log.Printf("Resuming monitoring of existing %s position on %s (entry %.4f, remaining %v lots)", existing.Side, symbol, existing.EntryPrice, existing.RemainingSize)
+		uc.monitorTrade(existing)
+		return
+	}
+
+	// 保存した取引がないため、この銘柄の建玉はボットの外で建てたものであり、そのまま建てると監視されずに残る
+	if pos, err := uc.exchangePosition(symbol); err != nil {
+		log.Printf("Refusing to trade: could not check existing positions on %s: %v", symbol, err)
+		return
+	} else if pos != nil {
+		log.Printf("Refusing to open a new position: the exchange already has a %s position of %v lots on %s that the bot is not tracking. Adopt it with -adopt-positions or close it manually.", pos.Side, pos.Lots, symbol)
+		return
+	}
+
 	log.Printf("Starting trade execution for %s, side: %s, amount: %.2f USD", symbol, side, amountUSD)
+	entryReq, trade, spec, err := uc.prepareEntry(symbol, domain.OrderSide(side), amountUSD, opts)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
 
-	currentPrice, err := uc.kucoinGateway.GetCurrentPrice(symbol)
+	entryReq.ClientOID = trade.NextClientOID()
+	trade.PendingEntry = &domain.PendingOrder{ClientOID: entryReq.ClientOID, Label: "Entry", Target: -1, Size: entryReq.Size, Algo: opts.EntryExecution.Algo}
+	if err := uc.tradeStore.Save(trade); err != nil {
+		log.Printf("Not placing the entry: failed to save trade state for %s: %v", symbol, err)
+		return
+	}
+
+	timeout := opts.EntryTimeout
+	if timeout <= 0 {
+		timeout = defaultEntryTimeout
+	}
+	if opts.EntryExecution.Enabled() {
+		log.Printf("Executing the entry with %s", opts.EntryExecution.Algo)
+	}
+	progress, err := uc.executor.Run(entryReq, opts.EntryExecution, timeout, opts.Abort, logExecutionProgress)
+	if err != nil {
+		log.Printf("%v. It will be confirmed by clientOid when the trade on %s is run again.", err, symbol)
+		return
+	}
+	if progress.Aborted {
+		log.Printf("Entry execution aborted after %v of %v lots", progress.FilledSize, progress.TargetSize)
+	}
+	uc.openTrade(trade, progress.Order(), spec, opts)
+}
+
+// resumeEntry は前回の実行で結果が確定しなかった建て注文を clientOid で確認し、約定していれば監視を始めます。
+// 取引所に注文がなかった場合や約定しなかった場合は、保存した状態を削除します。
+func (uc *TradingUsecase) resumeEntry(trade *domain.ActiveTrade, opts TradeOptions) {
+	p := *trade.PendingEntry
+	log.Printf("Confirming the pending %s entry %s on %s", trade.Side, p.ClientOID, trade.Symbol)
+	progress, found, err := uc.executor.Recover(trade.Symbol, trade.Side, p)
 	if err != nil {
-		log.Printf("Failed to get current price for %s: %v", symbol, err)
+		log.Printf("Could not confirm entry %s; check the exchange: %v", p.ClientOID, err)
+		return
+	}
+	if !found {
+		log.Printf("Entry %s never reached the exchange. Run again to place a new entry.", p.ClientOID)
+		if err := uc.tradeStore.Delete(trade.Symbol); err != nil {
+			log.Printf("Failed to delete trade state for %s: %v", trade.Symbol, err)
+		}
 		return
 	}
+	spec, err := uc.kucoinGateway.GetContract(trade.Symbol)
+	if err != nil {
+		log.Printf("Failed to get contract spec for %s: %v", trade.Symbol, err)
+		return
+	}
+	uc.openTrade(trade, progress.Order(), spec, opts)
+}
+
+// prepareEntry は建て注文と決済条件を発注前に検証し、建て注文と、発注前の価格で計算した決済条件を持つ取引を返します。
+func (uc *TradingUsecase) prepareEntry(symbol string, side domain.OrderSide, amountUSD float64, opts TradeOptions) (domain.OrderRequest, *domain.ActiveTrade, domain.ContractSpec, error) {
+	var spec domain.ContractSpec
+	currentPrice, err := uc.kucoinGateway.GetCurrentPrice(symbol)
+	if err != nil {
+		return domain.OrderRequest{}, nil, spec, fmt.Errorf("failed to get current price for %s: %w", symbol, err)
+	}
 	log.Printf("Current price of %s is %.4f USD", symbol, currentPrice)
 
-	size := amountUSD / currentPrice
-	sizeStr := fmt.Sprintf("%f", size)
+	entryReq := domain.OrderRequest{
+		Symbol: symbol,
+		Side:   side,
+		Type:   domain.OrderTypeMarket,
+	}
+	refPrice := currentPrice
+	if opts.EntryLimitPrice > 0 {
+		entryReq.Type = domain.OrderTypeLimit
+		entryReq.Price = opts.EntryLimitPrice
+		entryReq.TimeInForce = opts.EntryTimeInForce
+		entryReq.PostOnly = opts.EntryPostOnly
+		refPrice = opts.EntryLimitPrice
+	}
+	if spec, err = uc.kucoinGateway.GetContract(symbol); err != nil {
+		return entryReq, nil, spec, fmt.Errorf("failed to get contract spec for %s: %w", symbol, err)
+	}
+	if entryReq.Type == domain.OrderTypeLimit {
+		if rounded := spec.RoundPrice(entryReq.Price, entryReq.Side); rounded != entryReq.Price {
+			log.Printf("Limit price %.8f rounded to %.8f (tick size %v)", entryReq.Price, rounded, spec.TickSize)
+			entryReq.Price, refPrice = rounded, rounded
+		}
+	}
+	if entryReq.Size, err = spec.LotsForNotional(amountUSD, refPrice); err != nil {
+		return entryReq, nil, spec, fmt.Errorf("invalid order size: %w", err)
+	}
+	margin := opts.Margin
+	if margin.Leverage == 0 {
+		margin = domain.DefaultMarginSettings()
+	}
+	if err := margin.Validate(spec); err != nil {
+		return entryReq, nil, spec, fmt.Errorf("invalid leverage: %w", err)
+	}
+	entryReq.Leverage, entryReq.MarginMode = margin.Leverage, margin.Mode
+	if err := entryReq.Validate(); err != nil {
+		return entryReq, nil, spec, fmt.Errorf("invalid entry order: %w", err)
+	}
+	for _, plan := range []domain.ExecutionPlan{opts.EntryExecution, opts.ExitExecution} {
+		if err := plan.Validate(); err != nil {
+			return entryReq, nil, spec, fmt.Errorf("invalid execution algorithm: %w", err)
+		}
+	}
+	if opts.EntryExecution.Enabled() && entryReq.Type != domain.OrderTypeMarket {
+		return entryReq, nil, spec, fmt.Errorf("execution algorithms slice market entries; use the max slippage of the algorithm instead of a limit price")
+	}
+	// 成行の建て注文は板で約定させた場合の価格を見積もる。執行アルゴリズムは時間をかけて約定させるため上限は確認しない
+	if entryReq.Type == domain.OrderTypeMarket {
+		maxSlippage := opts.MaxEntrySlippageBps
+		if opts.EntryExecution.Enabled() {
+			maxSlippage = 0
+		}
+		if err := uc.checkEntryLiquidity(entryReq, maxSlippage); err != nil {
+			return entryReq, nil, spec, fmt.Errorf("refusing to trade: %w", err)
+		}
+	}
+
+	// 損切り・トレーリングストップは発注前に検証し、不正な場合は建てない
+	atr := 0.0
+	if opts.StopLoss.Type == domain.StopLossATR || opts.TrailingStop.Type == domain.TrailingStopATR {
+		if atr, err = uc.currentATR(symbol); err != nil {
+			return entryReq, nil, spec, fmt.Errorf("failed to calculate ATR for %s: %w", symbol, err)
+		}
+	}
+	var stopPrice float64
+	if opts.StopLoss.Enabled() {
+		if stopPrice, err = opts.StopLoss.StopPrice(side, refPrice, atr); err != nil {
+			return entryReq, nil, spec, fmt.Errorf("invalid stop-loss: %w", err)
+		}
+	}
+	if err := checkLiquidation(side, refPrice, stopPrice, margin); err != nil {
+		return entryReq, nil, spec, fmt.Errorf("refusing to trade: %w", err)
+	}
+	if opts.TrailingStop.Enabled() {
+		if _, err := opts.TrailingStop.PriceDistance(refPrice, atr); err != nil {
+			return entryReq, nil, spec, fmt.Errorf("invalid trailing stop: %w", err)
+		}
+	}
 
-	log.Printf("Placing market %s order for %s with size %s", side, symbol, sizeStr)
-	orderID, err := uc.kucoinGateway.CreateOrder(symbol, side, "market", sizeStr)
+	size := entryReq.Size
+	targets, err := takeProfitTargets(side, refPrice, stopPrice, size, takeProfitLevels(opts), spec, opts.TrailingStop.Enabled())
 	if err != nil {
-		log.Printf("Failed to create %s order: %v", side, err)
+		return entryReq, nil, spec, fmt.Errorf("invalid take-profit: %w", err)
+	}
+
+	notional := spec.Notional(size, refPrice)
+	if entryReq.Type == domain.OrderTypeLimit {
+		log.Printf("Placing limit %s order for %s with %v lots at %.4f", side, symbol, size, entryReq.Price)
+	} else {
+		log.Printf("Placing market %s order for %s with %v lots", side, symbol, size)
+	}
+	log.Printf("Leverage %s: notional %.2f USD, initial margin %.2f USD", margin, notional, margin.InitialMargin(notional))
+	if liq := margin.ApproxLiquidationPrice(side, refPrice); liq > 0 {
+		log.Printf("Approximate liquidation price: %.4f", liq)
+	}
+
+	openedAt := time.Now()
+	trade := &domain.ActiveTrade{
+		ID:            domain.NewTradeID(symbol, openedAt),
+		Symbol:        symbol,
+		Side:          side,
+		Size:          size,
+		Multiplier:    spec.Multiplier,
+		Margin:        margin,
+		OpenedAt:      openedAt,
+		ExitExecution: opts.ExitExecution,
+		TakeProfits:   targets,
+		StopPrice:     stopPrice,
+		Trailing:      opts.TrailingStop,
+		TrailingATR:   atr,
+
+		BreakevenAfterFirstTarget: opts.BreakevenAfterFirstTarget,
+	}
+	return entryReq, trade, spec, nil
+}
+
+// openTrade は建て注文の約定結果から決済条件を計算し直し、取引の監視を始めます。
+// 約定しなかった場合は保存した状態を削除します。
+func (uc *TradingUsecase) openTrade(trade *domain.ActiveTrade, order domain.Order, spec domain.ContractSpec, opts TradeOptions) {
+	orderID := order.ID
+	switch {
+	case order.FilledSize == 0:
+		log.Printf("Entry order %s was %s without any fill. Nothing to monitor.", orderID, order.Status)
+		if err := uc.tradeStore.Delete(trade.Symbol); err != nil {
+			log.Printf("Failed to delete trade state for %s: %v", trade.Symbol, err)
+		}
 		return
+	case order.FilledSize < order.Amount:
+		log.Printf("Entry order %s was %s after a partial fill (%v of %v lots); monitoring the filled size.", orderID, order.Status, order.FilledSize, order.Amount)
 	}
-	log.Printf("%s order placed successfully. Order ID: %s", side, orderID)
 
-	entryPrice := currentPrice
-	log.Printf("Assumed entry price: %.4f", entryPrice)
+	side, entryPrice, size := trade.Side, order.Price, order.FilledSize
+	log.Printf("Entry filled: %v lots @ %.4f (fee %.4f)", size, entryPrice, order.Fee)
+	trade.PendingEntry = nil
+	trade.Size, trade.RemainingSize = size, size
+	trade.EntryPrice, trade.EntryOrderID, trade.EntryFee = entryPrice, orderID, order.Fee
 
-	var targetPrice float64
-	if side == "buy" { // ロングの場合
-		targetPrice = entryPrice * 1.01 // 1%上昇で利益確定
-		log.Printf("Will place SELL order when price reaches >= %.4f", targetPrice)
-	} else { // ショートの場合
-		targetPrice = entryPrice * 0.99 // 1%下落で利益確定
-		log.Printf("Will place BUY order when price reaches <= %.4f", targetPrice)
+	// 決済条件は実際の約定価格と約定数量で計算し直す。発注前に検証済みのため、失敗した場合は発注前の条件を使う
+	if opts.StopLoss.Enabled() {
+		if sp, err := opts.StopLoss.StopPrice(side, entryPrice, trade.TrailingATR); err != nil {
+			log.Printf("Could not recalculate stop-loss from the fill, keeping %.4f: %v", trade.StopPrice, err)
+		} else {
+			trade.StopPrice = sp
+		}
+	}
+	if targets, err := takeProfitTargets(side, entryPrice, trade.StopPrice, size, takeProfitLevels(opts), spec, opts.TrailingStop.Enabled()); err != nil {
+		log.Printf("Could not recalculate take-profit from the fill, keeping the pre-order prices: %v", err)
+	} else {
+		trade.TakeProfits = targets
 	}
 
-	for {
-		time.Sleep(30 * time.Second)
+	closeSide := trade.CloseSide()
+	for _, t := range trade.TakeProfits {
+		if opts.BracketPriceType == "" {
+			log.Printf("%s: will place %s order for %v lots when price reaches %.4f", t.Label, closeSide, t.Size, t.Price)
+		}
+	}
+	if opts.TrailingStop.Enabled() {
+		log.Printf("Trailing stop (%s %.4f, activation %.2f%%) will follow the best price", opts.TrailingStop.Type, opts.TrailingStop.Distance, opts.TrailingStop.ActivationPct)
+		if _, err := trade.UpdateTrailing(entryPrice); err != nil {
+			log.Printf("Failed to initialize trailing stop: %v", err)
+		}
+	}
+	if opts.StopLoss.Enabled() {
+		log.Printf("Stop-loss (%s %.4f) set at %.4f", opts.StopLoss.Type, opts.StopLoss.Value, trade.StopPrice)
+	}
+	if opts.BracketPriceType != "" {
+		trade.BracketStop.PriceType = opts.BracketPriceType
+		uc.placeBracket(trade, spec)
+	}
+
+	if err := uc.tradeStore.Save(trade); err != nil {
+		log.Printf("Failed to save trade state for %s: %v", trade.Symbol, err)
+	}
+	uc.monitorTrade(trade)
+}
+
+// takeProfitLevels は利益確定の段階を返します。段階もトレーリングストップもない場合は +1% で全量を利益確定します。
+func takeProfitLevels(opts TradeOptions) []domain.TakeProfit {
+	if len(opts.TakeProfits) == 0 && !opts.TrailingStop.Enabled() {
+		return []domain.TakeProfit{{Type: domain.TakeProfitPercent, Value: takeProfitRate * 100, SizePct: 100}}
+	}
+	return opts.TakeProfits
+}
+
+// checkLiquidation は分離証拠金の場合に、損切りが清算価格より手前にあることを確認します。
+// 損切りがない場合はレバレッジが1倍を超えると清算まで損失が膨らみ得るため、警告のみ出します。
+func checkLiquidation(side domain.OrderSide, entryPrice, stopPrice float64, margin domain.MarginSettings) error {
+	liq := margin.ApproxLiquidationPrice(side, entryPrice)
+	if liq <= 0 || margin.Leverage <= 1 {
+		return nil
+	}
+	if stopPrice == 0 {
+		log.Printf("Warning: no stop-loss at %s; the position would be liquidated around %.4f", margin, liq)
+		return nil
+	}
+	if (side == domain.Buy && stopPrice <= liq) || (side == domain.Sell && stopPrice >= liq) {
+		return fmt.Errorf("stop-loss %.4f is beyond the approximate liquidation price %.4f at %s", stopPrice, liq, margin)
+	}
+	return nil
+}
+
+// takeProfitTargets は利益確定の段階ごとに価格と決済サイズ（ロット数）を確定します。
+// 各段階のサイズはロットの刻みに切り捨て、1ロットに満たない段階は除きます。
+// トレーリングストップで残りを決済しない場合は、最後の段階が端数を含む残り全てを決済します。
+func takeProfitTargets(side domain.OrderSide, entryPrice, stopPrice, size float64, levels []domain.TakeProfit, spec domain.ContractSpec, trailing bool) ([]domain.TakeProfitTarget, error) {
+	if err := domain.ValidateTakeProfits(levels); err != nil {
+		return nil, err
+	}
 
-		latestPrice, err := uc.kucoinGateway.GetCurrentPrice(symbol)
+	var targets []domain.TakeProfitTarget
+	for _, tp := range levels {
+		price, err := tp.TargetPrice(side, entryPrice, stopPrice)
 		if err != nil {
-			log.Printf("Could not get latest price for %s: %v", symbol, err)
-			continue
+			return nil, err
 		}
-		log.Printf("Latest price for %s: %.4f", symbol, latestPrice)
+		targets = append(targets, domain.TakeProfitTarget{
+			Label: tp.Label(),
+			Price: price,
+			Size:  spec.RoundLots(size * tp.SizePct / 100),
+		})
+	}
 
-		// 利益確定条件のチェック
-		if (side == "buy" && latestPrice >= targetPrice) || (side == "sell" && latestPrice <= targetPrice) {
-			closeSide := "sell"
-			if side == "sell" {
-				closeSide = "buy"
-			}
-			log.Printf("Target price reached! Placing %s order to close position.", closeSide)
-			closeSizeStr := fmt.Sprintf("%f", size)
-			closeOrderID, err := uc.kucoinGateway.CreateOrder(symbol, closeSide, "market", closeSizeStr)
-			if err != nil {
-				log.Printf("Failed to create %s order: %v", closeSide, err)
-				continue
-			}
-			log.Printf("%s order placed successfully. Order ID: %s. Exiting.", closeSide, closeOrderID)
-			break
+	// 価格に到達する順（ロングは昇順、ショートは降順）に並べる
+	sort.SliceStable(targets, func(i, j int) bool {
+		if side == domain.Buy {
+			return targets[i].Price < targets[j].Price
+		}
+		return targets[i].Price > targets[j].Price
+	})
+
+	if !trailing && len(targets) > 0 {
+		last := &targets[len(targets)-1]
+		last.Size = size
+		for _, t := range targets[:len(targets)-1] {
+			last.Size -= t.Size
 		}
 	}
+
+	kept := targets[:0]
+	for _, t := range targets {
+		if t.Size <= 0 {
+			log.Printf("%s is smaller than one lot and will be skipped", t.Label)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	return kept, nil
+}
+
+// currentATR は分析と同じ足の長さで直近の ATR を計算します。
+func (uc *TradingUsecase) currentATR(symbol string) (float64, error) {
+	candles, err := uc.klineProvider.GetCandles(symbol, uc.analysisGranularity, analysisKlineCount)
+	if err != nil {
+		return 0, err
+	}
+	return averageTrueRange(candles, atrPeriod)
 }
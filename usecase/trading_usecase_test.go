@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"crypto_trade_bot/domain"
+	"testing"
+)
+
+func TestTakeProfitTargets(t *testing.T) {
+	spec := domain.ContractSpec{Symbol: "XBTUSDTM", Multiplier: 0.001, LotSize: 1, TickSize: 0.1}
+	percent := func(sizePct, value float64) domain.TakeProfit {
+		return domain.TakeProfit{Type: domain.TakeProfitPercent, Value: value, SizePct: sizePct}
+	}
+	tests := []struct {
+		name      string
+		side      domain.OrderSide
+		size      float64
+		levels    []domain.TakeProfit
+		trailing  bool
+		wantPrice []float64
+		wantSize  []float64
+	}{
+		{
+			name:      "last target takes the rounding remainder",
+			side:      domain.Buy,
+			size:      10,
+			levels:    []domain.TakeProfit{percent(33, 1), percent(33, 2), percent(34, 3)},
+			wantPrice: []float64{101, 102, 103},
+			wantSize:  []float64{3, 3, 4},
+		},
+		{
+			name:      "sorted in the order price reaches them for a short",
+			side:      domain.Sell,
+			size:      7,
+			levels:    []domain.TakeProfit{percent(50, 2), percent(50, 1)},
+			wantPrice: []float64{99, 98},
+			wantSize:  []float64{3, 4},
+		},
+		{
+			name:      "trailing stop keeps the remainder",
+			side:      domain.Buy,
+			size:      7,
+			levels:    []domain.TakeProfit{percent(50, 1)},
+			trailing:  true,
+			wantPrice: []float64{101},
+			wantSize:  []float64{3},
+		},
+		{
+			name:      "target below one lot is skipped",
+			side:      domain.Buy,
+			size:      2,
+			levels:    []domain.TakeProfit{percent(40, 1)},
+			trailing:  true,
+			wantPrice: nil,
+			wantSize:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := takeProfitTargets(tt.side, 100, 0, tt.size, tt.levels, spec, tt.trailing)
+			if err != nil {
+				t.Fatalf("takeProfitTargets: %v", err)
+			}
+			if len(targets) != len(tt.wantSize) {
+				t.Fatalf("got %d targets %+v, want %d", len(targets), targets, len(tt.wantSize))
+			}
+			for i, target := range targets {
+				if !approxEqual(target.Price, tt.wantPrice[i]) || target.Size != tt.wantSize[i] {
+					t.Errorf("target %d = %v lots @ %v, want %v lots @ %v", i, target.Size, target.Price, tt.wantSize[i], tt.wantPrice[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTakeProfitTargetsRejectsOverAllocation(t *testing.T) {
+	spec := domain.ContractSpec{Symbol: "XBTUSDTM", Multiplier: 1, LotSize: 1, TickSize: 0.1}
+	levels := []domain.TakeProfit{
+		{Type: domain.TakeProfitPercent, Value: 1, SizePct: 60},
+		{Type: domain.TakeProfitPercent, Value: 2, SizePct: 60},
+	}
+	if _, err := takeProfitTargets(domain.Buy, 100, 0, 10, levels, spec, false); err == nil {
+		t.Error("expected an error for levels adding up to more than 100%")
+	}
+}